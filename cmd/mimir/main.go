@@ -5,9 +5,11 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,8 +19,10 @@ import (
 	"github.com/aqstack/mimir/internal/cache"
 	"github.com/aqstack/mimir/internal/config"
 	"github.com/aqstack/mimir/internal/embedding"
+	grpcserver "github.com/aqstack/mimir/internal/grpc"
 	"github.com/aqstack/mimir/internal/logger"
 	"github.com/aqstack/mimir/internal/proxy"
+	"google.golang.org/grpc"
 )
 
 var (
@@ -60,10 +64,21 @@ func main() {
 	var embedder embedding.Embedder
 	switch cfg.EmbeddingProvider {
 	case "ollama":
-		embedder = embedding.NewOllamaEmbedder(&embedding.OllamaConfig{
-			BaseURL: cfg.OllamaBaseURL,
-			Model:   cfg.EmbeddingModel,
+		ollama := embedding.NewOllamaEmbedder(&embedding.OllamaConfig{
+			BaseURL:       cfg.OllamaBaseURL,
+			Model:         cfg.EmbeddingModel,
+			MaxConcurrent: cfg.OllamaMaxConcurrent,
+
+			Timeout:               cfg.OllamaTimeout,
+			DialTimeout:           cfg.OllamaDialTimeout,
+			ResponseHeaderTimeout: cfg.OllamaResponseHeaderTimeout,
 		})
+		detectCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if _, err := ollama.DetectDimensions(detectCtx); err != nil {
+			log.Warn("could not detect embedding dimensions, using estimate", "error", err)
+		}
+		cancel()
+		embedder = ollama
 		log.Info("initialized Ollama embedder",
 			"base_url", cfg.OllamaBaseURL,
 			"model", embedder.Model(),
@@ -71,29 +86,110 @@ func main() {
 		)
 	case "openai":
 		embedder = embedding.NewOpenAIEmbedder(&embedding.OpenAIConfig{
-			APIKey:  cfg.OpenAIAPIKey,
-			BaseURL: cfg.OpenAIBaseURL,
-			Model:   cfg.EmbeddingModel,
+			APIKey:     cfg.OpenAIAPIKey,
+			BaseURL:    cfg.OpenAIBaseURL,
+			Model:      cfg.EmbeddingModel,
+			Dimensions: cfg.EmbeddingDimensions,
 		})
 		log.Info("initialized OpenAI embedder",
 			"model", embedder.Model(),
 			"dimensions", embedder.Dimensions(),
 		)
+	case "cohere":
+		embedder = embedding.NewCohereEmbedder(&embedding.CohereConfig{
+			APIKey:  cfg.CohereAPIKey,
+			BaseURL: cfg.CohereBaseURL,
+			Model:   cfg.EmbeddingModel,
+		})
+		log.Info("initialized Cohere embedder",
+			"model", embedder.Model(),
+			"dimensions", embedder.Dimensions(),
+		)
+	case "tei":
+		embedder = embedding.NewTEIEmbedder(&embedding.TEIConfig{
+			BaseURL:    cfg.TEIBaseURL,
+			Model:      cfg.EmbeddingModel,
+			Dimensions: cfg.EmbeddingDimensions,
+		})
+		log.Info("initialized TEI embedder",
+			"base_url", cfg.TEIBaseURL,
+			"model", embedder.Model(),
+		)
+	}
+
+	if cfg.BreakerThreshold > 0 {
+		embedder = embedding.NewBreakerEmbedder(embedder, &embedding.BreakerConfig{
+			FailureThreshold: cfg.BreakerThreshold,
+			Cooldown:         cfg.BreakerCooldown,
+			OnStateChange: func(from, to embedding.BreakerState) {
+				log.Warn("embedder circuit changed state", "from", from.String(), "to", to.String())
+			},
+		})
+	}
+
+	if cfg.EmbeddingCacheSize > 0 {
+		embedder = embedding.NewCachingEmbedder(embedder, cfg.EmbeddingCacheSize)
 	}
 
 	// Initialize cache
-	semanticCache := cache.NewMemoryCache(&cache.Options{
+	toolCallPolicy, _ := cache.ParseToolCallPolicy(cfg.ToolCallPolicy) // checked by Validate
+	cacheOpts := &cache.Options{
 		MaxSize:             cfg.MaxCacheSize,
+		MaxBytes:            cfg.MaxCacheBytes,
 		DefaultTTL:          cfg.CacheTTL,
+		TTLJitter:           cfg.TTLJitter,
 		CleanupInterval:     5 * time.Minute,
 		SimilarityThreshold: cfg.SimilarityThreshold,
-	})
+		HardThreshold:       cfg.HardThreshold,
+		MinCacheTemperature: cfg.MinCacheTemperature,
+		RequireSeed:         cfg.RequireSeed,
+		NegativeTTL:         cfg.NegativeTTL,
+		EmbeddingModel:      embedder.Model(),
+		MinAvgLogprob:       cfg.MinAvgLogprob,
+		LowConfidenceTTL:    cfg.LowConfidenceTTL,
+		ToolCallPolicy:      toolCallPolicy,
+
+		StaleWhileRevalidate: cfg.StaleWhileRevalidate,
+
+		Compaction: cache.CompactionOptions{
+			Threshold: cfg.CompactThreshold,
+			Interval:  cfg.CompactInterval,
+		},
+	}
+	if cfg.PricingFile != "" {
+		pricing, err := cache.LoadPricing(cfg.PricingFile)
+		if err != nil {
+			log.Error("failed to load pricing", "path", cfg.PricingFile, "error", err)
+			os.Exit(1)
+		}
+		cacheOpts.Pricing = pricing
+		log.Info("loaded pricing", "path", cfg.PricingFile, "models", len(pricing))
+	}
+	if cfg.ScrubPII {
+		cacheOpts.Sanitizer = cache.NewPIISanitizer()
+	}
+	if cfg.ProjectionDims > 0 {
+		method, _ := cache.ParseProjectionMethod(cfg.ProjectionMethod) // checked by Validate
+		cacheOpts.Projection = cache.NewProjection(method, cfg.ProjectionDims, cfg.ProjectionSeed)
+		log.Warn("projecting embeddings across models; matches between models are approximate",
+			"projection", cacheOpts.Projection.String())
+	}
+	semanticCache := cache.NewMemoryCache(cacheOpts)
 
 	log.Info("initialized cache",
 		"max_size", cfg.MaxCacheSize,
 		"ttl", cfg.CacheTTL.String(),
 	)
 
+	if cfg.SnapshotPath != "" {
+		n, err := loadSnapshot(semanticCache, cfg.SnapshotPath)
+		if err != nil {
+			log.Warn("failed to load cache snapshot", "path", cfg.SnapshotPath, "error", err)
+		} else {
+			log.Info("loaded cache snapshot", "path", cfg.SnapshotPath, "entries", n)
+		}
+	}
+
 	// Create handler
 	handler := proxy.NewHandler(cfg, semanticCache, embedder, log)
 
@@ -121,6 +217,43 @@ func main() {
 		}
 	}()
 
+	// Serve Prometheus metrics on a separate port
+	var metricsServer *http.Server
+	if cfg.MetricsEnabled {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", handler.Metrics())
+		metricsServer = &http.Server{
+			Addr:        fmt.Sprintf("%s:%d", cfg.Host, cfg.MetricsPort),
+			Handler:     mux,
+			ReadTimeout: 10 * time.Second,
+		}
+		go func() {
+			log.Info("metrics listening", "addr", metricsServer.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error("metrics server error", "error", err)
+			}
+		}()
+	}
+
+	// Serve the cache over gRPC for other services
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort > 0 {
+		addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.GRPCPort)
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Error("failed to listen for gRPC", "addr", addr, "error", err)
+			os.Exit(1)
+		}
+		grpcServer = grpc.NewServer()
+		grpcserver.NewServer(semanticCache).Register(grpcServer)
+		go func() {
+			log.Info("gRPC listening", "addr", addr)
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Error("gRPC server error", "error", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -136,6 +269,13 @@ func main() {
 		log.Error("server forced to shutdown", "error", err)
 		os.Exit(1)
 	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(ctx)
+	}
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	handler.Close()
 
 	// Print final stats
 	stats := semanticCache.Stats(context.Background())
@@ -146,6 +286,52 @@ func main() {
 		"hit_rate", fmt.Sprintf("%.2f%%", stats.HitRate*100),
 		"estimated_saved_usd", fmt.Sprintf("$%.4f", stats.EstimatedSaved),
 	)
+	if cfg.SnapshotPath != "" {
+		if err := saveSnapshot(semanticCache, cfg.SnapshotPath); err != nil {
+			log.Error("failed to save cache snapshot", "path", cfg.SnapshotPath, "error", err)
+		} else {
+			log.Info("saved cache snapshot", "path", cfg.SnapshotPath)
+		}
+	}
+	semanticCache.Close()
 
 	log.Info("server stopped")
 }
+
+// loadSnapshot loads cache entries saved by saveSnapshot. A missing file
+// is not an error.
+func loadSnapshot(c cache.Cache, path string) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return c.LoadFromReader(context.Background(), bufio.NewReader(f))
+}
+
+// saveSnapshot writes the cache's live entries to path, replacing it
+// atomically so a crash mid-write keeps the previous snapshot.
+func saveSnapshot(c cache.Cache, path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	err = c.DumpToWriter(context.Background(), w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// Ensure AsyncCache implements Cache.
+var _ Cache = (*AsyncCache)(nil)
+
+// ErrCacheClosed is returned by AsyncCache.Set after Close.
+var ErrCacheClosed = errors.New("cache is closed")
+
+// AsyncOptions configures an AsyncCache.
+type AsyncOptions struct {
+	// QueueSize is the number of writes buffered before the queue is full.
+	// Defaults to 1024.
+	QueueSize int
+	// Block makes Set wait for queue space (or the context to end) when the
+	// queue is full. By default the write is dropped instead.
+	Block bool
+	// OnError, if set, is called with writes the underlying cache rejected.
+	OnError func(entry *api.CacheEntry, err error)
+}
+
+// asyncWrite is a queued Set, or a Flush marker when done is set.
+type asyncWrite struct {
+	ctx   context.Context
+	entry *api.CacheEntry
+	done  chan struct{}
+}
+
+// AsyncCache takes Set off the request path: writes are queued and stored
+// by a background worker, in order, so a slow backend such as SQLiteCache
+// doesn't add latency to each request. Other methods go straight to the
+// underlying cache and do not wait for queued writes; call Flush first
+// where that matters.
+type AsyncCache struct {
+	Cache
+	opts    *AsyncOptions
+	queue   chan asyncWrite
+	done    chan struct{}
+	dropped atomic.Int64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncCache wraps c with a buffered write queue and starts its worker.
+func NewAsyncCache(c Cache, opts *AsyncOptions) *AsyncCache {
+	if opts == nil {
+		opts = &AsyncOptions{}
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1024
+	}
+
+	a := &AsyncCache{
+		Cache: c,
+		opts:  opts,
+		queue: make(chan asyncWrite, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// run stores queued writes until the queue is closed.
+func (a *AsyncCache) run() {
+	defer close(a.done)
+	for w := range a.queue {
+		if w.done != nil {
+			close(w.done)
+			continue
+		}
+		if err := a.Cache.Set(w.ctx, w.entry); err != nil && a.opts.OnError != nil {
+			a.opts.OnError(w.entry, err)
+		}
+	}
+}
+
+// Set queues the entry for storage and returns without waiting for it.
+// An ID is assigned up front if the entry has none. When the queue is
+// full the entry is dropped and counted, or with AsyncOptions.Block, Set
+// waits and returns the context's error if it ends first.
+//
+// The entry must not be modified after Set. The context's values (e.g.
+// the namespace) apply to the write, but its cancellation does not.
+func (a *AsyncCache) Set(ctx context.Context, entry *api.CacheEntry) error {
+	if entry.ID == "" {
+		entry.ID = NewEntryID()
+	}
+	w := asyncWrite{ctx: context.WithoutCancel(ctx), entry: entry}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return ErrCacheClosed
+	}
+
+	if !a.opts.Block {
+		select {
+		case a.queue <- w:
+		default:
+			a.dropped.Add(1)
+		}
+		return nil
+	}
+
+	select {
+	case a.queue <- w:
+		return nil
+	case <-ctx.Done():
+		a.dropped.Add(1)
+		return ctx.Err()
+	}
+}
+
+// Flush waits until every write queued before it has been stored, or the
+// context ends.
+func (a *AsyncCache) Flush(ctx context.Context) error {
+	marker := asyncWrite{done: make(chan struct{})}
+
+	a.mu.RLock()
+	if a.closed {
+		a.mu.RUnlock()
+		return nil // Close already drained the queue
+	}
+	select {
+	case a.queue <- marker:
+		a.mu.RUnlock()
+	case <-ctx.Done():
+		a.mu.RUnlock()
+		return ctx.Err()
+	}
+
+	select {
+	case <-marker.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dropped returns the number of writes dropped because the queue was full.
+func (a *AsyncCache) Dropped() int64 {
+	return a.dropped.Load()
+}
+
+// LoadFromReader stores entries synchronously after flushing queued writes.
+func (a *AsyncCache) LoadFromReader(ctx context.Context, r io.Reader) (int, error) {
+	if err := a.Flush(ctx); err != nil {
+		return 0, err
+	}
+	return a.Cache.LoadFromReader(ctx, r)
+}
+
+// DumpToWriter flushes queued writes, then dumps the underlying cache.
+func (a *AsyncCache) DumpToWriter(ctx context.Context, w io.Writer) error {
+	if err := a.Flush(ctx); err != nil {
+		return err
+	}
+	return a.Cache.DumpToWriter(ctx, w)
+}
+
+// Entries flushes queued writes, then pages the underlying cache.
+func (a *AsyncCache) Entries(ctx context.Context, offset, limit int) ([]*api.CacheEntry, error) {
+	if err := a.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return a.Cache.Entries(ctx, offset, limit)
+}
+
+// DeleteByModel flushes queued writes, so none of them outlive the
+// deletion, then deletes from the underlying cache.
+func (a *AsyncCache) DeleteByModel(ctx context.Context, model string) (int, error) {
+	if err := a.Flush(ctx); err != nil {
+		return 0, err
+	}
+	return a.Cache.DeleteByModel(ctx, model)
+}
+
+// DeleteOlderThan flushes queued writes, then deletes from the underlying
+// cache.
+func (a *AsyncCache) DeleteOlderThan(ctx context.Context, t time.Time) (int, error) {
+	if err := a.Flush(ctx); err != nil {
+		return 0, err
+	}
+	return a.Cache.DeleteOlderThan(ctx, t)
+}
+
+// Close stops accepting writes, stores those already queued and closes
+// the underlying cache. It is safe to call more than once.
+func (a *AsyncCache) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	<-a.done
+	return a.Cache.Close()
+}
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// blockingCache delays every Set until release is closed.
+type blockingCache struct {
+	*MemoryCache
+	release chan struct{}
+}
+
+func (b *blockingCache) Set(ctx context.Context, entry *api.CacheEntry) error {
+	<-b.release
+	return b.MemoryCache.Set(ctx, entry)
+}
+
+func newTestMemoryCache() *MemoryCache {
+	return NewMemoryCache(&Options{MaxSize: 100, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+}
+
+func TestAsyncCacheSetAndFlush(t *testing.T) {
+	ctx := context.Background()
+	cache := NewAsyncCache(newTestMemoryCache(), nil)
+	defer cache.Close()
+
+	vecs := [][]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for _, v := range vecs {
+		entry := newTestEntry(v, time.Hour)
+		if err := cache.Set(ctx, entry); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		if entry.ID == "" {
+			t.Error("expected Set to assign an ID")
+		}
+	}
+
+	if err := cache.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if cache.Size(ctx) != 3 {
+		t.Errorf("expected 3 entries after Flush, got %d", cache.Size(ctx))
+	}
+	if _, _, found := cache.Get(ctx, vecs[1], 0.99); !found {
+		t.Error("expected hit after Flush")
+	}
+}
+
+func TestAsyncCacheQueueFull(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("drop", func(t *testing.T) {
+		inner := &blockingCache{MemoryCache: newTestMemoryCache(), release: make(chan struct{})}
+		cache := NewAsyncCache(inner, &AsyncOptions{QueueSize: 1})
+		defer cache.Close()
+
+		// The worker holds one write, the queue another; the rest drop
+		for i := 0; i < 5; i++ {
+			if err := cache.Set(ctx, newTestEntry([]float64{float64(i), 1, 0}, time.Hour)); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+		}
+		close(inner.release)
+		cache.Flush(ctx)
+
+		if cache.Dropped() == 0 {
+			t.Error("expected dropped writes")
+		}
+		if got := int64(cache.Size(ctx)) + cache.Dropped(); got != 5 {
+			t.Errorf("expected stored+dropped=5, got %d", got)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		inner := &blockingCache{MemoryCache: newTestMemoryCache(), release: make(chan struct{})}
+		cache := NewAsyncCache(inner, &AsyncOptions{QueueSize: 1, Block: true})
+		defer cache.Close()
+
+		cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour))
+		cache.Set(ctx, newTestEntry([]float64{0, 1, 0}, time.Hour))
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		err := cache.Set(timeoutCtx, newTestEntry([]float64{0, 0, 1}, time.Hour))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected DeadlineExceeded, got %v", err)
+		}
+		close(inner.release)
+	})
+}
+
+func TestAsyncCacheOnError(t *testing.T) {
+	ctx := context.Background()
+	errs := make(chan error, 1)
+	inner := NewMemoryCache(&Options{MaxSize: 100, DefaultTTL: time.Hour, CleanupInterval: time.Hour, Dimensions: 3})
+	cache := NewAsyncCache(inner, &AsyncOptions{
+		OnError: func(entry *api.CacheEntry, err error) { errs <- err },
+	})
+	defer cache.Close()
+
+	cache.Set(ctx, newTestEntry([]float64{1, 0}, time.Hour))
+	cache.Flush(ctx)
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrDimensionMismatch) {
+			t.Errorf("expected ErrDimensionMismatch, got %v", err)
+		}
+	default:
+		t.Error("expected OnError to be called")
+	}
+}
+
+func TestAsyncCacheClose(t *testing.T) {
+	ctx := context.Background()
+	inner := newTestMemoryCache()
+	cache := NewAsyncCache(inner, nil)
+
+	cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour))
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if inner.Size(ctx) != 1 {
+		t.Errorf("expected Close to store queued writes, got %d entries", inner.Size(ctx))
+	}
+	if err := cache.Set(ctx, newTestEntry([]float64{0, 1, 0}, time.Hour)); !errors.Is(err, ErrCacheClosed) {
+		t.Errorf("expected ErrCacheClosed, got %v", err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Errorf("expected second Close to succeed, got %v", err)
+	}
+}
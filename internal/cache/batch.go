@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// scanBatch finds, for each query, the best live entry in namespace ns at
+// or above threshold, ranked by confidence, comparing each entry against
+// every query in one pass. Matches are nil where none was found; similarities
+// are in ordered form. It stops early once ctx is done. Caller must hold
+// the lock guarding entries.
+func (o *Options) scanBatch(ctx context.Context, entries []*api.CacheEntry, queries [][]float64, metric Metric, ns string, threshold float64, now time.Time) ([]*api.CacheEntry, []float64) {
+	model := o.embeddingModel(ctx)
+	best := make([]*api.CacheEntry, len(queries))
+	bestSim := make([]float64, len(queries))
+	bestScore := make([]float64, len(queries))
+
+	scanQueries := make([][]float64, len(queries))
+	scanMetric := metric
+	for i, query := range queries {
+		scanQueries[i], scanMetric = o.unitQuery(query, metric)
+	}
+
+	// Queries that reach the hard threshold drop out of the scan
+	done := make([]bool, len(queries))
+	pending := len(queries)
+	for j, e := range entries {
+		if pending == 0 || (j%scanCheckInterval == 0 && ctx.Err() != nil) {
+			break
+		}
+		if e.Negative || e.Namespace != ns || now.After(e.ExpiresAt) || !sameEmbeddingModel(e, model) {
+			continue
+		}
+		for i, query := range scanQueries {
+			if done[i] {
+				continue
+			}
+			similarity := scanMetric.Similarity(query, e.Embedding)
+			if similarity < threshold {
+				continue
+			}
+			if score := o.confidence(e, similarity, now); best[i] == nil || score > bestScore[i] {
+				best[i], bestSim[i], bestScore[i] = e, similarity, score
+				if o.reachesHardThreshold(metric, similarity) {
+					done[i] = true
+					pending--
+				}
+			}
+		}
+	}
+	return best, bestSim
+}
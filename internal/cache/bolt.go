@@ -0,0 +1,988 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltEntriesBucket    = []byte("entries")
+	boltEmbeddingsBucket = []byte("embeddings")
+	boltCountersBucket   = []byte("counters")
+)
+
+// boltRecord is the stored form of an entry; the embedding is kept in a
+// separate bucket in the compact encoding so records stay small.
+type boltRecord struct {
+	Request   api.ChatCompletionRequest  `json:"request"`
+	Response  api.ChatCompletionResponse `json:"response"`
+	CreatedAt time.Time                  `json:"created_at"`
+	ExpiresAt time.Time                  `json:"expires_at"`
+	HitCount  int64                      `json:"hit_count"`
+	LastHitAt time.Time                  `json:"last_hit_at"`
+	Namespace string                     `json:"namespace,omitempty"`
+	Pinned    bool                       `json:"pinned,omitempty"`
+
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	RequestHash    string `json:"request_hash,omitempty"`
+	Checksum       string `json:"checksum,omitempty"`
+
+	Negative   bool          `json:"negative,omitempty"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      *api.APIError `json:"error,omitempty"`
+
+	SchemaVersion int `json:"schema_version,omitempty"`
+}
+
+// Ensure BoltCache implements Cache.
+var _ Cache = (*BoltCache)(nil)
+
+// BoltCache implements a persistent semantic cache backed by a bbolt file.
+// Like SQLiteCache, all entries are mirrored in memory for similarity
+// scans; the database is only read on open, and hit counts and statistics
+// are written every Options.FlushInterval.
+type BoltCache struct {
+	mu      sync.RWMutex
+	db      *bolt.DB
+	entries []*api.CacheEntry
+	byID    map[string]int // entry ID -> index in entries
+	opts    *Options
+
+	pending pendingWrites
+	flushMu sync.Mutex // serializes flushes with Clear
+
+	done      chan struct{}
+	closeOnce sync.Once
+	loops     sync.WaitGroup
+
+	// Stats (persisted in the counters bucket)
+	hits          atomic.Int64
+	exactHits     atomic.Int64
+	misses        atomic.Int64
+	savedMicroUSD atomic.Int64
+	evictions     atomic.Int64
+	byModel       modelStats
+}
+
+// NewBoltCache opens (or creates) a bbolt cache at path and loads
+// existing entries into memory.
+func NewBoltCache(path string, opts *Options) (*BoltCache, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltEntriesBucket, boltEmbeddingsBucket, boltCountersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create buckets: %w", err)
+	}
+
+	bc := &BoltCache{
+		db:   db,
+		byID: make(map[string]int),
+		opts: opts,
+		done: make(chan struct{}),
+	}
+
+	if err := bc.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	bc.loops.Add(2)
+	go bc.cleanupLoop()
+	go func() {
+		defer bc.loops.Done()
+		opts.flushLoop(bc.done, bc.flush)
+	}()
+
+	return bc, nil
+}
+
+// load reads counters and all entries into memory, upgrading entries of
+// older schema versions, then deletes entries that failed integrity
+// verification or could not be upgraded.
+func (b *BoltCache) load() error {
+	var corrupt, incompatible []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(boltCountersBucket).ForEach(func(k, v []byte) error {
+			value := int64(binary.BigEndian.Uint64(v))
+			if kind, model, ok := strings.Cut(string(k), ":"); ok {
+				c := b.byModel.get(model)
+				switch kind {
+				case "hits":
+					c.hits = value
+				case "misses":
+					c.misses = value
+				case "saved_micro_usd":
+					c.savedUSD = float64(value) / 1e6
+				}
+				return nil
+			}
+			switch string(k) {
+			case "hits":
+				b.hits.Store(value)
+			case "exact_hits":
+				b.exactHits.Store(value)
+			case "misses":
+				b.misses.Store(value)
+			case "saved_micro_usd":
+				b.savedMicroUSD.Store(value)
+			case "evictions":
+				b.evictions.Store(value)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to load counters: %w", err)
+		}
+
+		embeddings := tx.Bucket(boltEmbeddingsBucket)
+		return tx.Bucket(boltEntriesBucket).ForEach(func(k, v []byte) error {
+			id := string(k)
+
+			data, err := decompress(v)
+			if err != nil {
+				return fmt.Errorf("failed to decode entry %s: %w", id, err)
+			}
+			var rec boltRecord
+			if err := json.Unmarshal(data, &rec); err != nil {
+				// A record whose fields changed type can't be upgraded
+				b.opts.logIncompatible(context.Background(), id, fmt.Errorf("%w: %v", ErrIncompatibleEntry, err))
+				incompatible = append(incompatible, id)
+				return nil
+			}
+			emb, err := decodeEmbedding(embeddings.Get(k))
+			if err != nil {
+				return fmt.Errorf("failed to decode embedding for entry %s: %w", id, err)
+			}
+			// Entries written before NormalizeOnSet was enabled are raw;
+			// lookups assume every embedding is unit length
+			if b.opts.NormalizeOnSet {
+				emb = NormalizeVector(emb)
+			}
+
+			entry := &api.CacheEntry{
+				ID:        id,
+				Request:   rec.Request,
+				Response:  rec.Response,
+				Embedding: emb,
+				CreatedAt: rec.CreatedAt,
+				ExpiresAt: rec.ExpiresAt,
+				HitCount:  rec.HitCount,
+				LastHitAt: rec.LastHitAt,
+				Namespace: rec.Namespace,
+				Pinned:    rec.Pinned,
+
+				EmbeddingModel: rec.EmbeddingModel,
+				RequestHash:    rec.RequestHash,
+				Checksum:       rec.Checksum,
+
+				Negative:   rec.Negative,
+				StatusCode: rec.StatusCode,
+				Error:      rec.Error,
+
+				SchemaVersion: rec.SchemaVersion,
+			}
+			if !b.opts.intact(entry) {
+				corrupt = append(corrupt, id)
+				return nil
+			}
+			if err := migrateEntry(entry); err != nil {
+				b.opts.logIncompatible(context.Background(), id, err)
+				incompatible = append(incompatible, id)
+				return nil
+			}
+
+			b.byID[id] = len(b.entries)
+			b.entries = append(b.entries, entry)
+			return nil
+		})
+	})
+	if err != nil || len(corrupt)+len(incompatible) == 0 {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		for _, id := range corrupt {
+			if err := deleteBoltEntry(tx, id); err != nil {
+				return fmt.Errorf("failed to delete corrupt entry %s: %w", id, err)
+			}
+			b.opts.logCorrupt(context.Background(), id)
+		}
+		for _, id := range incompatible {
+			if err := deleteBoltEntry(tx, id); err != nil {
+				return fmt.Errorf("failed to delete incompatible entry %s: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Get retrieves a cached response based on semantic similarity.
+func (b *BoltCache) Get(ctx context.Context, embedding []float64, threshold float64) (*api.CacheEntry, float64, bool) {
+	threshold = b.opts.lookupThreshold(ctx, threshold)
+	b.mu.RLock()
+	var best *api.CacheEntry
+	var bestSimilarity, bestScore float64
+
+	now := time.Now()
+	ns := namespaceFromContext(ctx)
+	model := b.opts.embeddingModel(ctx)
+	metric := b.opts.queryMetric(ctx)
+	query, scanMetric := b.opts.unitQuery(embedding, metric)
+	threshold = metric.ordered(threshold)
+
+	for _, e := range b.entries {
+		if e.Negative || e.Namespace != ns || now.After(e.ExpiresAt) || !sameEmbeddingModel(e, model) {
+			continue
+		}
+
+		similarity := scanMetric.Similarity(query, e.Embedding)
+		if similarity < threshold {
+			continue
+		}
+		if score := b.opts.confidence(e, similarity, now); best == nil || score > bestScore {
+			bestSimilarity, bestScore = similarity, score
+			best = e
+			if b.opts.reachesHardThreshold(metric, similarity) {
+				break
+			}
+		}
+	}
+	b.mu.RUnlock()
+	bestSimilarity = metric.ordered(bestSimilarity)
+
+	if best == nil {
+		b.recordMiss(ctx, embedding)
+		return nil, 0, false
+	}
+
+	hit := b.recordHit(best, now, false)
+	b.opts.onHit(hit, bestSimilarity)
+	return hit, bestSimilarity, true
+}
+
+// GetBatch looks up several embeddings in one pass over the entries.
+func (b *BoltCache) GetBatch(ctx context.Context, embeddings [][]float64, threshold float64) []*SearchResult {
+	threshold = b.opts.modelThreshold(ctx, threshold)
+	now := time.Now()
+	metric := b.opts.queryMetric(ctx)
+
+	b.mu.RLock()
+	best, bestSim := b.opts.scanBatch(ctx, b.entries, embeddings, metric, namespaceFromContext(ctx), metric.ordered(threshold), now)
+	b.mu.RUnlock()
+
+	cancelled := ctx.Err() != nil
+	results := make([]*SearchResult, len(embeddings))
+	for i, embedding := range embeddings {
+		if best[i] == nil || cancelled {
+			b.recordMiss(ctx, embedding)
+			continue
+		}
+		similarity := metric.ordered(bestSim[i])
+		confidence := b.opts.confidence(best[i], bestSim[i], now)
+		hit := b.recordHit(best[i], now, false)
+		b.opts.onHit(hit, similarity)
+		results[i] = &SearchResult{Entry: hit, Similarity: similarity, Confidence: confidence}
+	}
+	return results
+}
+
+// recordMiss updates miss statistics, queueing them to be persisted.
+func (b *BoltCache) recordMiss(ctx context.Context, embedding []float64) {
+	model := modelFromContext(ctx)
+	b.misses.Add(1)
+	b.byModel.recordMiss(model)
+	b.pending.addCounters(map[string]int64{"misses": 1, "misses:" + model: 1})
+	b.opts.onMiss(embedding)
+}
+
+// GetExact retrieves the entry whose request canonicalizes identically to
+// req. OnHit receives a similarity of 1.
+func (b *BoltCache) GetExact(ctx context.Context, req *api.ChatCompletionRequest) (*api.CacheEntry, bool) {
+	hash := api.RequestHash(req)
+	ns := namespaceFromContext(ctx)
+	now := time.Now()
+
+	b.mu.RLock()
+	var match *api.CacheEntry
+	for _, e := range b.entries {
+		if e.RequestHash == hash && e.Namespace == ns && !now.After(e.ExpiresAt) {
+			match = e
+			break
+		}
+	}
+	b.mu.RUnlock()
+	if match == nil {
+		return nil, false
+	}
+
+	hit := b.recordHit(match, now, true)
+	b.opts.onHit(hit, 1)
+	return hit, true
+}
+
+// recordHit updates hit statistics for an entry, queueing them to be
+// persisted, and returns a copy of it for the caller.
+func (b *BoltCache) recordHit(best *api.CacheEntry, now time.Time, exact bool) *api.CacheEntry {
+	saved := int64(b.opts.hitSavings(best) * 1e6)
+	model := best.Request.Model
+	if model == "" {
+		model = unknownModel
+	}
+	b.hits.Add(1)
+	b.savedMicroUSD.Add(saved)
+	b.byModel.recordHit(model, float64(saved)/1e6)
+
+	counters := map[string]int64{
+		"hits":                     1,
+		"saved_micro_usd":          saved,
+		"hits:" + model:            1,
+		"saved_micro_usd:" + model: saved,
+	}
+	if exact {
+		b.exactHits.Add(1)
+		counters["exact_hits"] = 1
+	}
+	b.pending.addCounters(counters)
+
+	b.mu.Lock()
+	best.HitCount++
+	best.LastHitAt = now
+	hit := best.Clone()
+	b.mu.Unlock()
+
+	b.pending.addHit(hit.ID)
+	return hit
+}
+
+// flush persists the counter increments and hit counts recorded since
+// the last flush in one transaction. On failure they are kept for the next.
+func (b *BoltCache) flush(ctx context.Context) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	counters, hits := b.pending.take()
+	if len(counters) == 0 && len(hits) == 0 {
+		return nil
+	}
+	if err := b.writePending(counters, hits); err != nil {
+		b.pending.restore(counters, hits)
+		return err
+	}
+	return nil
+}
+
+// writePending writes counter increments, and the records of the entries
+// hit with their current hit counts, in one transaction.
+func (b *BoltCache) writePending(counters map[string]int64, hits map[string]struct{}) error {
+	// Entries removed since their hit are skipped
+	records := make(map[string][]byte, len(hits))
+	b.mu.RLock()
+	for id := range hits {
+		i, ok := b.byID[id]
+		if !ok {
+			continue
+		}
+		data, err := b.encodeRecord(b.entries[i])
+		if err != nil {
+			b.mu.RUnlock()
+			return err
+		}
+		records[id] = data
+	}
+	b.mu.RUnlock()
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		entries := tx.Bucket(boltEntriesBucket)
+		for id, data := range records {
+			if entries.Get([]byte(id)) == nil {
+				continue
+			}
+			if err := entries.Put([]byte(id), data); err != nil {
+				return err
+			}
+		}
+		return addCounters(tx, counters)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write statistics: %w", err)
+	}
+	return nil
+}
+
+// recordFor returns the stored form of an entry.
+func recordFor(e *api.CacheEntry) boltRecord {
+	return boltRecord{
+		Request:   e.Request,
+		Response:  e.Response,
+		CreatedAt: e.CreatedAt,
+		ExpiresAt: e.ExpiresAt,
+		HitCount:  e.HitCount,
+		LastHitAt: e.LastHitAt,
+		Namespace: e.Namespace,
+		Pinned:    e.Pinned,
+
+		EmbeddingModel: e.EmbeddingModel,
+		RequestHash:    e.RequestHash,
+		Checksum:       e.Checksum,
+
+		Negative:   e.Negative,
+		StatusCode: e.StatusCode,
+		Error:      e.Error,
+
+		SchemaVersion: e.SchemaVersion,
+	}
+}
+
+// encodeRecord returns the stored form of an entry, compressed with
+// Options.Compression.
+func (b *BoltCache) encodeRecord(e *api.CacheEntry) ([]byte, error) {
+	data, err := json.Marshal(recordFor(e))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode entry: %w", err)
+	}
+	return b.opts.Compression.compress(data)
+}
+
+// addCounters adds deltas to the persisted counters within tx.
+func addCounters(tx *bolt.Tx, deltas map[string]int64) error {
+	bucket := tx.Bucket(boltCountersBucket)
+	for name, delta := range deltas {
+		var value int64
+		if v := bucket.Get([]byte(name)); v != nil {
+			value = int64(binary.BigEndian.Uint64(v))
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(value+delta))
+		if err := bucket.Put([]byte(name), buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search returns up to k live entries with similarity at or above
+// threshold, most similar first.
+func (b *BoltCache) Search(ctx context.Context, embedding []float64, threshold float64, k int) []SearchResult {
+	threshold = b.opts.lookupThreshold(ctx, threshold)
+	if k <= 0 {
+		return nil
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := time.Now()
+	ns := namespaceFromContext(ctx)
+	model := b.opts.embeddingModel(ctx)
+	metric := b.opts.queryMetric(ctx)
+	query, scanMetric := b.opts.unitQuery(embedding, metric)
+	threshold = metric.ordered(threshold)
+
+	var results []SearchResult
+	for _, e := range b.entries {
+		if e.Negative || e.Namespace != ns || now.After(e.ExpiresAt) || !sameEmbeddingModel(e, model) {
+			continue
+		}
+		if similarity := scanMetric.Similarity(query, e.Embedding); similarity >= threshold {
+			results = append(results, SearchResult{Entry: e.Clone(), Similarity: similarity, Confidence: b.opts.confidence(e, similarity, now)})
+		}
+	}
+	return metricResults(metric, topResults(results, k))
+}
+
+// GetByID retrieves an entry by its ID without affecting hit statistics.
+func (b *BoltCache) GetByID(ctx context.Context, id string) (*api.CacheEntry, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	i, ok := b.byID[id]
+	if !ok || time.Now().After(b.entries[i].ExpiresAt) {
+		return nil, false
+	}
+	return b.entries[i].Clone(), true
+}
+
+// Set stores a response with its embedding.
+func (b *BoltCache) Set(ctx context.Context, entry *api.CacheEntry) error {
+	b.opts.onSet(entry)
+	if err := checkResponseFormat(entry); err != nil {
+		return err
+	}
+	if err := b.opts.checkToolCalls(entry); err != nil {
+		return err
+	}
+	if err := CheckFinite(entry.Embedding); err != nil {
+		return err
+	}
+	applyNamespace(ctx, entry)
+	b.opts.applyEmbeddingModel(ctx, entry)
+	applyRequestHash(entry)
+	b.opts.sanitize(entry)
+	if b.opts.NormalizeOnSet {
+		entry.Embedding = NormalizeVector(entry.Embedding)
+	}
+	b.opts.resolveExpiry(entry)
+	b.opts.applyNegativeTTL(entry)
+	if err := b.opts.applyConfidence(entry); err != nil {
+		return err
+	}
+	b.opts.applyChecksum(entry)
+	if entry.ID == "" {
+		entry.ID = NewEntryID()
+	}
+	entry.SchemaVersion = api.CacheEntrySchemaVersion
+
+	data, err := b.encodeRecord(entry)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Same ID, or a duplicate by duplicateOf, replaces the existing entry
+	replace, exists := b.byID[entry.ID]
+	if !exists {
+		for i, e := range b.entries {
+			if shadows(e, entry) {
+				return nil
+			}
+			if b.opts.duplicateOf(entry, e) {
+				replace, exists = i, true
+				break
+			}
+		}
+	}
+
+	var victim = -1
+	if exists {
+		victim = replace
+		// Replacements of pinned entries stay pinned
+		if b.entries[replace].Pinned && !entry.Pinned {
+			entry.Pinned = true
+			if data, err = b.encodeRecord(entry); err != nil {
+				return err
+			}
+		}
+	} else if len(b.entries) >= b.opts.MaxSize && len(b.entries) > 0 {
+		if victim = b.oldest(); victim < 0 {
+			return ErrAllPinned
+		}
+	}
+
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		if victim >= 0 {
+			if err := deleteBoltEntry(tx, b.entries[victim].ID); err != nil {
+				return err
+			}
+			if !exists {
+				if err := addCounters(tx, map[string]int64{"evictions": 1}); err != nil {
+					return err
+				}
+			}
+		}
+		if err := tx.Bucket(boltEntriesBucket).Put([]byte(entry.ID), data); err != nil {
+			return err
+		}
+		return tx.Bucket(boltEmbeddingsBucket).Put([]byte(entry.ID), encodeEmbedding(entry.Embedding))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store entry: %w", err)
+	}
+
+	if victim >= 0 {
+		if !exists {
+			b.evictions.Add(1)
+			b.opts.logEviction(ctx, b.entries[victim].ID)
+		}
+		b.removeAt(victim)
+	}
+	b.byID[entry.ID] = len(b.entries)
+	b.entries = append(b.entries, entry)
+	return nil
+}
+
+// oldest returns the index of the least recently hit unpinned entry, or
+// -1 if all are pinned. Caller must hold the lock.
+func (b *BoltCache) oldest() int {
+	oldestIdx := -1
+	for i, e := range b.entries {
+		if !e.Pinned && (oldestIdx < 0 || e.LastHitAt.Before(b.entries[oldestIdx].LastHitAt)) {
+			oldestIdx = i
+		}
+	}
+	return oldestIdx
+}
+
+// deleteBoltEntry removes an entry and its embedding within tx.
+func deleteBoltEntry(tx *bolt.Tx, id string) error {
+	if err := tx.Bucket(boltEntriesBucket).Delete([]byte(id)); err != nil {
+		return err
+	}
+	return tx.Bucket(boltEmbeddingsBucket).Delete([]byte(id))
+}
+
+// removeAt removes the entry at index i from memory.
+// Caller must hold the write lock.
+func (b *BoltCache) removeAt(i int) {
+	id := b.entries[i].ID
+
+	// Remove by swapping with last element
+	last := len(b.entries) - 1
+	b.entries[i] = b.entries[last]
+	b.byID[b.entries[i].ID] = i
+	b.entries[last] = nil
+	b.entries = b.entries[:last]
+	delete(b.byID, id)
+}
+
+// Delete removes an entry by its ID.
+func (b *BoltCache) Delete(ctx context.Context, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	i, ok := b.byID[id]
+	if !ok {
+		return nil
+	}
+	return b.deleteAt(i)
+}
+
+// Pin exempts the entry with the given ID from eviction.
+func (b *BoltCache) Pin(ctx context.Context, id string) error {
+	return b.setPinned(id, true)
+}
+
+// Unpin makes a pinned entry evictable again.
+func (b *BoltCache) Unpin(ctx context.Context, id string) error {
+	return b.setPinned(id, false)
+}
+
+// setPinned updates and persists the pinned flag of the entry with the
+// given ID.
+func (b *BoltCache) setPinned(id string, pinned bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	i, ok := b.byID[id]
+	if !ok {
+		return ErrNotFound
+	}
+	e := b.entries[i]
+	if e.Pinned == pinned {
+		return nil
+	}
+
+	updated := *e
+	updated.Pinned = pinned
+	data, err := b.encodeRecord(&updated)
+	if err != nil {
+		return err
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltEntriesBucket).Put([]byte(id), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update entry: %w", err)
+	}
+	e.Pinned = pinned
+	return nil
+}
+
+// deleteAt removes the entry at index i from the database and memory.
+// Caller must hold the write lock.
+func (b *BoltCache) deleteAt(i int) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return deleteBoltEntry(tx, b.entries[i].ID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete entry: %w", err)
+	}
+	b.removeAt(i)
+	return nil
+}
+
+// DeleteByEmbedding removes the entry nearly identical to the embedding
+// in the context's namespace.
+func (b *BoltCache) DeleteByEmbedding(ctx context.Context, embedding []float64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ns := namespaceFromContext(ctx)
+	for i, e := range b.entries {
+		if e.Namespace == ns && b.opts.Metric.isNearDuplicate(b.opts.Metric.Similarity(embedding, e.Embedding)) {
+			return b.deleteAt(i)
+		}
+	}
+
+	return nil
+}
+
+// Clear removes all entries from the cache.
+func (b *BoltCache) Clear(ctx context.Context) error {
+	// Statistics recorded before Clear must not be flushed after it
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltEntriesBucket, boltEmbeddingsBucket, boltCountersBucket} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear cache: %w", err)
+	}
+
+	b.entries = nil
+	b.byID = make(map[string]int)
+	b.pending.take()
+	b.hits.Store(0)
+	b.exactHits.Store(0)
+	b.misses.Store(0)
+	b.savedMicroUSD.Store(0)
+	b.evictions.Store(0)
+	b.byModel.reset()
+
+	return nil
+}
+
+// ClearNamespace removes all entries in a namespace in a single
+// transaction.
+func (b *BoltCache) ClearNamespace(ctx context.Context, namespace string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for _, e := range b.entries {
+			if e.Namespace != namespace {
+				continue
+			}
+			if err := deleteBoltEntry(tx, e.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear namespace: %w", err)
+	}
+
+	// Iterate backwards so swap-removal doesn't skip entries
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		if b.entries[i].Namespace == namespace {
+			b.removeAt(i)
+		}
+	}
+	return nil
+}
+
+// DeleteByModel removes all entries for the request model.
+func (b *BoltCache) DeleteByModel(ctx context.Context, model string) (int, error) {
+	return b.deleteWhere(func(e *api.CacheEntry) bool { return e.Request.Model == model })
+}
+
+// DeleteOlderThan removes all entries created before t.
+func (b *BoltCache) DeleteOlderThan(ctx context.Context, t time.Time) (int, error) {
+	return b.deleteWhere(func(e *api.CacheEntry) bool { return e.CreatedAt.Before(t) })
+}
+
+// deleteWhere removes matching entries in a single transaction and returns
+// the number removed.
+func (b *BoltCache) deleteWhere(match func(*api.CacheEntry) bool) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	removed := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for _, e := range b.entries {
+			if !match(e) {
+				continue
+			}
+			if err := deleteBoltEntry(tx, e.ID); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete entries: %w", err)
+	}
+
+	// Iterate backwards so swap-removal doesn't skip entries
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		if match(b.entries[i]) {
+			b.removeAt(i)
+		}
+	}
+	return removed, nil
+}
+
+// LoadFromReader stores JSONL entries written by DumpToWriter.
+func (b *BoltCache) LoadFromReader(ctx context.Context, r io.Reader) (int, error) {
+	return loadJSONL(ctx, b, r)
+}
+
+// DumpToWriter writes all live entries as JSONL.
+func (b *BoltCache) DumpToWriter(ctx context.Context, w io.Writer) error {
+	b.mu.RLock()
+	entries := liveEntries(b.entries, time.Now())
+	b.mu.RUnlock()
+
+	return dumpJSONL(w, entries)
+}
+
+// Entries returns copies of a page of live entries, oldest first.
+func (b *BoltCache) Entries(ctx context.Context, offset, limit int) ([]*api.CacheEntry, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return pageEntries(b.entries, time.Now(), offset, limit), nil
+}
+
+// Stats returns cache statistics.
+func (b *BoltCache) Stats(ctx context.Context) *api.CacheStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	hits := b.hits.Load()
+	exactHits := b.exactHits.Load()
+	misses := b.misses.Load()
+	total := hits + misses
+
+	var hitRate float64
+	if total > 0 {
+		hitRate = float64(hits) / float64(total)
+	}
+
+	return &api.CacheStats{
+		TotalEntries:   int64(len(b.entries)),
+		TotalHits:      hits,
+		ExactHits:      exactHits,
+		SemanticHits:   hits - exactHits,
+		TotalMisses:    misses,
+		HitRate:        hitRate,
+		EstimatedSaved: float64(b.savedMicroUSD.Load()) / 1e6,
+		Evictions:      b.evictions.Load(),
+	}
+}
+
+// StatsByModel returns cache statistics broken down by request model.
+func (b *BoltCache) StatsByModel(ctx context.Context) map[string]*api.CacheStats {
+	b.mu.RLock()
+	entries := make(map[string]int64)
+	for _, e := range b.entries {
+		entries[e.Request.Model]++
+	}
+	b.mu.RUnlock()
+
+	return b.byModel.snapshot(entries)
+}
+
+// Cleanup removes expired entries in a single transaction.
+func (b *BoltCache) Cleanup(ctx context.Context) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	var expired []string
+	for _, e := range b.entries {
+		if !now.Before(e.ExpiresAt) {
+			expired = append(expired, e.ID)
+		}
+	}
+	if len(expired) == 0 {
+		return 0
+	}
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for _, id := range expired {
+			if err := deleteBoltEntry(tx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0
+	}
+
+	// Iterate backwards so swap-removal doesn't skip entries
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		if !now.Before(b.entries[i].ExpiresAt) {
+			b.removeAt(i)
+		}
+	}
+	b.opts.logCleanup(ctx, len(expired))
+	return len(expired)
+}
+
+// Size returns the number of entries in the cache.
+func (b *BoltCache) Size(ctx context.Context) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.entries)
+}
+
+// cleanupLoop periodically removes expired entries.
+func (b *BoltCache) cleanupLoop() {
+	defer b.loops.Done()
+	ticker := time.NewTicker(b.opts.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.Cleanup(context.Background())
+		}
+	}
+}
+
+// Close stops the background goroutines, persists pending statistics and
+// closes the database.
+func (b *BoltCache) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		close(b.done)
+		b.loops.Wait()
+		err = b.flush(context.Background())
+		if closeErr := b.db.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
@@ -0,0 +1,425 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestBoltCache(t *testing.T, path string, maxSize int) *BoltCache {
+	t.Helper()
+
+	cache, err := NewBoltCache(path, &Options{
+		MaxSize:         maxSize,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		FlushInterval:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewBoltCache failed: %v", err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+func TestBoltCacheSetAndGet(t *testing.T) {
+	cache := newTestBoltCache(t, filepath.Join(t.TempDir(), "cache.db"), 100)
+	ctx := context.Background()
+
+	embedding := []float64{1, 0, 0}
+	entry := newTestEntry(embedding, time.Hour)
+	if err := cache.Set(ctx, entry); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	result, _, found := cache.Get(ctx, embedding, 0.99)
+	if !found {
+		t.Fatal("expected to find cached entry")
+	}
+	if result.Response.ID != entry.Response.ID {
+		t.Error("returned entry doesn't match stored entry")
+	}
+
+	if _, _, found := cache.Get(ctx, []float64{0, 1, 0}, 0.9); found {
+		t.Error("expected cache miss for dissimilar vector")
+	}
+}
+
+func TestBoltCacheGetBatch(t *testing.T) {
+	cache := newTestBoltCache(t, filepath.Join(t.TempDir(), "cache.db"), 100)
+	ctx := context.Background()
+
+	for _, emb := range [][]float64{{1, 0, 0}, {0, 1, 0}} {
+		if err := cache.Set(ctx, newTestEntry(emb, time.Hour)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	results := cache.GetBatch(ctx, [][]float64{{0, 1, 0}, {0, 0, 1}, {1, 0.01, 0}}, 0.99)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if results[0] == nil || results[0].Entry.Embedding[1] != 1 {
+		t.Errorf("expected first query to match {0,1,0}, got %+v", results[0])
+	}
+	if results[1] != nil {
+		t.Errorf("expected second query to miss, got %+v", results[1])
+	}
+	if results[2] == nil || results[2].Entry.Embedding[0] != 1 {
+		t.Errorf("expected third query to match {1,0,0}, got %+v", results[2])
+	}
+
+	if stats := cache.Stats(ctx); stats.TotalHits != 2 || stats.TotalMisses != 1 {
+		t.Errorf("expected 2 hits and 1 miss, got %+v", stats)
+	}
+}
+
+func TestBoltCachePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	ctx := context.Background()
+
+	cache := newTestBoltCache(t, path, 100)
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	entry.EmbeddingModel = "embed-v1"
+	cache.Set(ctx, entry)
+	cache.Get(ctx, []float64{1, 0, 0}, 0.9) // hit
+	cache.Get(ctx, []float64{0, 1, 0}, 0.9) // miss
+	cache.Close()
+
+	reopened := newTestBoltCache(t, path, 100)
+	if reopened.Size(ctx) != 1 {
+		t.Fatalf("expected 1 entry after reopen, got %d", reopened.Size(ctx))
+	}
+
+	stats := reopened.Stats(ctx)
+	if stats.TotalHits != 1 || stats.TotalMisses != 1 {
+		t.Errorf("expected persisted hits=1 misses=1, got hits=%d misses=%d", stats.TotalHits, stats.TotalMisses)
+	}
+
+	result, ok := reopened.GetByID(ctx, entry.ID)
+	if !ok {
+		t.Fatal("expected to find persisted entry by ID")
+	}
+	if result.HitCount != 1 {
+		t.Errorf("expected HitCount=1, got %d", result.HitCount)
+	}
+	if len(result.Embedding) != 3 || result.Embedding[0] != 1 {
+		t.Errorf("expected embedding to round-trip, got %v", result.Embedding)
+	}
+	if result.EmbeddingModel != "embed-v1" {
+		t.Errorf("expected embedding model to round-trip, got %q", result.EmbeddingModel)
+	}
+}
+
+func TestBoltCacheFlush(t *testing.T) {
+	cache := newTestBoltCache(t, filepath.Join(t.TempDir(), "cache.db"), 100)
+	ctx := context.Background()
+
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	cache.Set(ctx, entry)
+	cache.Get(ctx, []float64{1, 0, 0}, 0.9) // hit
+
+	// storedHits returns the persisted hit count of entry and hits counter
+	storedHits := func() (hitCount, hits int64) {
+		cache.db.View(func(tx *bolt.Tx) error {
+			data, err := decompress(tx.Bucket(boltEntriesBucket).Get([]byte(entry.ID)))
+			if err != nil {
+				return err
+			}
+			var rec boltRecord
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return err
+			}
+			hitCount = rec.HitCount
+			if v := tx.Bucket(boltCountersBucket).Get([]byte("hits")); v != nil {
+				hits = int64(binary.BigEndian.Uint64(v))
+			}
+			return nil
+		})
+		return hitCount, hits
+	}
+
+	// Hits are written by the flush, not by the lookup
+	if hitCount, hits := storedHits(); hitCount != 0 || hits != 0 {
+		t.Errorf("expected nothing persisted before flush, got hit_count=%d hits=%d", hitCount, hits)
+	}
+	if err := cache.flush(ctx); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	if hitCount, hits := storedHits(); hitCount != 1 || hits != 1 {
+		t.Errorf("expected hit_count=1 hits=1 after flush, got hit_count=%d hits=%d", hitCount, hits)
+	}
+
+	// Statistics recorded before Clear are dropped with it
+	cache.Get(ctx, []float64{1, 0, 0}, 0.9)
+	cache.Clear(ctx)
+	if err := cache.flush(ctx); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	cache.db.View(func(tx *bolt.Tx) error {
+		if n := tx.Bucket(boltCountersBucket).Stats().KeyN; n != 0 {
+			t.Errorf("expected no counters after Clear, got %d", n)
+		}
+		return nil
+	})
+}
+
+func TestBoltCacheEviction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	cache := newTestBoltCache(t, path, 2)
+	ctx := context.Background()
+
+	first := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	first.LastHitAt = time.Now().Add(-time.Minute)
+	cache.Set(ctx, first)
+	cache.Set(ctx, newTestEntry([]float64{0, 1, 0}, time.Hour))
+	cache.Set(ctx, newTestEntry([]float64{0, 0, 1}, time.Hour))
+
+	if cache.Size(ctx) != 2 {
+		t.Errorf("expected size=2 after eviction, got %d", cache.Size(ctx))
+	}
+	if _, ok := cache.GetByID(ctx, first.ID); ok {
+		t.Error("expected least recently hit entry to be evicted")
+	}
+	if stats := cache.Stats(ctx); stats.Evictions != 1 {
+		t.Errorf("expected 1 eviction, got %d", stats.Evictions)
+	}
+}
+
+func TestBoltCacheEvictionSparesNewEntries(t *testing.T) {
+	cache := newTestBoltCache(t, filepath.Join(t.TempDir(), "cache.db"), 2)
+	ctx := context.Background()
+
+	old := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	old.CreatedAt = time.Now().Add(-time.Hour)
+	old.LastHitAt = time.Now().Add(-time.Minute)
+	cache.Set(ctx, old)
+
+	// Never hit, so LastHitAt is unset
+	fresh := newTestEntry([]float64{0, 1, 0}, time.Hour)
+	fresh.CreatedAt, fresh.LastHitAt = time.Time{}, time.Time{}
+	cache.Set(ctx, fresh)
+
+	// The cache is full; the entry hit a minute ago is older than the
+	// one inserted just now
+	cache.Set(ctx, newTestEntry([]float64{0, 0, 1}, time.Hour))
+
+	if _, ok := cache.GetByID(ctx, fresh.ID); !ok {
+		t.Error("expected just-inserted entry to survive eviction")
+	}
+	if _, ok := cache.GetByID(ctx, old.ID); ok {
+		t.Error("expected least recently hit entry to be evicted")
+	}
+}
+
+func TestBoltCachePinning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	cache := newTestBoltCache(t, path, 2)
+	ctx := context.Background()
+
+	first := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	first.LastHitAt = time.Now().Add(-time.Minute)
+	cache.Set(ctx, first)
+	second := newTestEntry([]float64{0, 1, 0}, time.Hour)
+	cache.Set(ctx, second)
+
+	if err := cache.Pin(ctx, first.ID); err != nil {
+		t.Fatalf("Pin failed: %v", err)
+	}
+	third := newTestEntry([]float64{0, 0, 1}, time.Hour)
+	third.Pinned = true
+	if err := cache.Set(ctx, third); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, ok := cache.GetByID(ctx, first.ID); !ok {
+		t.Error("expected pinned entry to survive eviction")
+	}
+	if _, ok := cache.GetByID(ctx, second.ID); ok {
+		t.Error("expected unpinned entry to be evicted")
+	}
+	if err := cache.Pin(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	cache.Close()
+
+	// The pin is persisted
+	reopened := newTestBoltCache(t, path, 2)
+	got, ok := reopened.GetByID(ctx, first.ID)
+	if !ok || !got.Pinned {
+		t.Fatalf("expected pinned entry after reopen, got %+v", got)
+	}
+	if err := reopened.Set(ctx, newTestEntry([]float64{1, 1, 0}, time.Hour)); !errors.Is(err, ErrAllPinned) {
+		t.Errorf("expected ErrAllPinned, got %v", err)
+	}
+}
+
+func TestBoltCacheCleanup(t *testing.T) {
+	cache := newTestBoltCache(t, filepath.Join(t.TempDir(), "cache.db"), 100)
+	ctx := context.Background()
+
+	cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour))
+	cache.Set(ctx, newTestEntry([]float64{0, 1, 0}, -time.Hour)) // Already expired
+	cache.Set(ctx, newTestEntry([]float64{0, 0, 1}, -time.Hour)) // Already expired
+
+	if removed := cache.Cleanup(ctx); removed != 2 {
+		t.Errorf("expected 2 removed, got %d", removed)
+	}
+
+	var stored int
+	cache.db.View(func(tx *bolt.Tx) error {
+		stored = tx.Bucket(boltEntriesBucket).Stats().KeyN
+		return nil
+	})
+	if stored != 1 {
+		t.Errorf("expected 1 stored entry after cleanup, got %d", stored)
+	}
+}
+
+func TestBoltCacheDeleteByModel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	cache := newTestBoltCache(t, path, 100)
+	ctx := context.Background()
+
+	for i, model := range []string{"gpt-4", "gpt-4o", "gpt-4"} {
+		entry := newTestEntry([]float64{float64(i), 1, 0}, time.Hour)
+		entry.Request.Model = model
+		cache.Set(ctx, entry)
+	}
+
+	removed, err := cache.DeleteByModel(ctx, "gpt-4")
+	if err != nil {
+		t.Fatalf("DeleteByModel failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 removed, got %d", removed)
+	}
+	cache.Close()
+
+	// The deletion is persisted
+	reopened := newTestBoltCache(t, path, 100)
+	if reopened.Size(ctx) != 1 {
+		t.Errorf("expected 1 entry after reopen, got %d", reopened.Size(ctx))
+	}
+}
+
+func TestBoltCacheGetExact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	cache := newTestBoltCache(t, path, 100)
+	ctx := context.Background()
+
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	cache.Set(ctx, entry)
+	cache.Close()
+
+	// The hash survives a reopen
+	reopened := newTestBoltCache(t, path, 100)
+	if _, found := reopened.GetExact(ctx, &entry.Request); !found {
+		t.Fatal("expected exact hit after reopen")
+	}
+	if stats := reopened.Stats(ctx); stats.ExactHits != 1 {
+		t.Errorf("expected 1 exact hit, got %d", stats.ExactHits)
+	}
+}
+
+func TestBoltCacheNormalizeOnSetReload(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	// Written raw, before NormalizeOnSet was enabled
+	raw := newTestBoltCache(t, path, 10)
+	if err := raw.Set(ctx, newTestEntry([]float64{3, 4, 0}, time.Hour)); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	raw.Close()
+
+	cache, err := NewBoltCache(path, &Options{
+		MaxSize:         10,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		NormalizeOnSet:  true,
+	})
+	if err != nil {
+		t.Fatalf("NewBoltCache failed: %v", err)
+	}
+	defer cache.Close()
+
+	_, similarity, found := cache.Get(ctx, []float64{6, 8, 0}, 0.99)
+	if !found || math.Abs(similarity-1) > 1e-9 {
+		t.Errorf("expected reloaded entry to match as unit length, got %f (found %v)", similarity, found)
+	}
+}
+
+func TestBoltCacheVerifyIntegrity(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.db")
+	opts := func() *Options {
+		return &Options{
+			MaxSize:         10,
+			DefaultTTL:      time.Hour,
+			CleanupInterval: time.Hour,
+			VerifyIntegrity: true,
+		}
+	}
+
+	cache, err := NewBoltCache(path, opts())
+	if err != nil {
+		t.Fatalf("NewBoltCache failed: %v", err)
+	}
+	intact := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	intact.Request.Messages[0].Content = "intact"
+	tampered := newTestEntry([]float64{0, 1, 0}, time.Hour)
+	tampered.Request.Messages[0].Content = "tampered"
+	for _, e := range []*api.CacheEntry{intact, tampered} {
+		if err := cache.Set(ctx, e); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		if e.Checksum == "" {
+			t.Fatal("expected Set to record a checksum")
+		}
+	}
+
+	// Rewrite the stored response behind the cache's back
+	rec := recordFor(tampered)
+	rec.Response.Choices[0].Message.Content = "altered"
+	err = cache.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(boltEntriesBucket).Put([]byte(tampered.ID), data)
+	})
+	if err != nil {
+		t.Fatalf("failed to tamper with entry: %v", err)
+	}
+	cache.Close()
+
+	for i := 0; i < 2; i++ {
+		cache, err := NewBoltCache(path, opts())
+		if err != nil {
+			t.Fatalf("NewBoltCache failed: %v", err)
+		}
+		if _, _, found := cache.Get(ctx, []float64{0, 1, 0}, 0.99); found {
+			t.Error("expected tampered entry to miss")
+		}
+		if _, _, found := cache.Get(ctx, []float64{1, 0, 0}, 0.99); !found {
+			t.Error("expected intact entry to hit")
+		}
+		var stored int
+		cache.db.View(func(tx *bolt.Tx) error {
+			stored = tx.Bucket(boltEntriesBucket).Stats().KeyN
+			return nil
+		})
+		if stored != 1 {
+			t.Errorf("expected tampered entry to be deleted, %d stored", stored)
+		}
+		cache.Close()
+	}
+}
@@ -2,56 +2,430 @@ package cache
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
 	"time"
 
 	"github.com/aqstack/mimir/pkg/api"
 )
 
+// ErrCacheFull is returned by Set when the cache is at capacity and the
+// eviction policy refuses to evict a live entry.
+var ErrCacheFull = errors.New("cache is full")
+
+// ErrDimensionMismatch is returned when an embedding's length differs from
+// the cache's expected dimension, typically after switching embedding models.
+var ErrDimensionMismatch = errors.New("embedding dimension mismatch")
+
+// ErrAllPinned is returned by Set when the cache is full and every entry
+// is pinned, so none may be evicted to make room.
+var ErrAllPinned = fmt.Errorf("%w: all entries are pinned", ErrCacheFull)
+
+// ErrNotFound is returned by Pin and Unpin when no entry has the ID.
+var ErrNotFound = errors.New("entry not found")
+
+// ErrInvalidEmbedding is returned by Set when an embedding contains NaN or
+// infinite values.
+var ErrInvalidEmbedding = errors.New("embedding contains non-finite values")
+
 // Cache defines the interface for semantic caching.
 type Cache interface {
 	// Get retrieves a cached response based on semantic similarity.
 	// Returns the cached response, similarity score, and whether a match was found.
+	// Returned entries are copies the caller may modify.
 	Get(ctx context.Context, embedding []float64, threshold float64) (*api.CacheEntry, float64, bool)
 
+	// GetBatch looks up several embeddings in one pass over the entries.
+	// Results are in query order, nil for misses; each lookup counts as a
+	// hit or miss as it would for Get.
+	GetBatch(ctx context.Context, embeddings [][]float64, threshold float64) []*SearchResult
+
+	// GetExact retrieves the live entry, in the context's namespace, whose
+	// request canonicalizes identically to req (see api.CanonicalizeRequest),
+	// so repeated prompts skip embedding and similarity search. Hits count
+	// as exact hits; misses are not counted, since callers fall back to Get.
+	GetExact(ctx context.Context, req *api.ChatCompletionRequest) (*api.CacheEntry, bool)
+
+	// Search returns up to k live entries with similarity at or above
+	// threshold, most similar first. It does not affect hit statistics.
+	Search(ctx context.Context, embedding []float64, threshold float64, k int) []SearchResult
+
+	// GetByID retrieves an entry by its ID without affecting hit statistics.
+	GetByID(ctx context.Context, id string) (*api.CacheEntry, bool)
+
 	// Set stores a response with its embedding.
+	// If entry.ID is empty, a new ID is assigned; an existing ID is updated.
+	// Responses that don't satisfy the request's response_format are
+	// rejected with ErrFormatMismatch, low-confidence responses with
+	// ErrLowConfidence (see Options.MinAvgLogprob), and responses whose
+	// tool calls Options.ToolCallPolicy disallows with ErrToolCalls.
 	Set(ctx context.Context, entry *api.CacheEntry) error
 
-	// Delete removes an entry by its embedding.
-	Delete(ctx context.Context, embedding []float64) error
+	// Delete removes an entry by its ID.
+	Delete(ctx context.Context, id string) error
+
+	// Pin exempts the entry with the given ID from eviction, so it stays
+	// cached until it expires or is deleted; when only pinned entries
+	// remain, Set fails with ErrAllPinned rather than evict one. Unpin
+	// makes it evictable again. Both return ErrNotFound for unknown IDs.
+	Pin(ctx context.Context, id string) error
+	Unpin(ctx context.Context, id string) error
+
+	// DeleteByEmbedding removes the entry nearly identical to the embedding.
+	DeleteByEmbedding(ctx context.Context, embedding []float64) error
 
 	// Clear removes all entries from the cache.
 	Clear(ctx context.Context) error
 
+	// ClearNamespace removes all entries in a namespace. Statistics are
+	// kept.
+	ClearNamespace(ctx context.Context, namespace string) error
+
+	// DeleteByModel removes all entries for the request model, in every
+	// namespace, and returns the number removed.
+	DeleteByModel(ctx context.Context, model string) (int, error)
+
+	// DeleteOlderThan removes all entries created before t, in every
+	// namespace, and returns the number removed.
+	DeleteOlderThan(ctx context.Context, t time.Time) (int, error)
+
+	// LoadFromReader stores entries read as JSONL (one api.CacheEntry per
+	// line, as written by DumpToWriter), skipping expired ones, and returns
+	// the number stored.
+	LoadFromReader(ctx context.Context, r io.Reader) (int, error)
+
+	// DumpToWriter writes all live entries, including embeddings, as JSONL.
+	DumpToWriter(ctx context.Context, w io.Writer) error
+
+	// Entries returns copies of live entries in every namespace, oldest
+	// first, for offline analysis of what gets hit. It skips the first
+	// offset entries and returns at most limit; limit <= 0 returns the
+	// rest.
+	Entries(ctx context.Context, offset, limit int) ([]*api.CacheEntry, error)
+
 	// Stats returns cache statistics.
 	Stats(ctx context.Context) *api.CacheStats
 
+	// StatsByModel returns cache statistics broken down by request model.
+	// Misses are attributed to the model set on the context via WithModel.
+	StatsByModel(ctx context.Context) map[string]*api.CacheStats
+
 	// Cleanup removes expired entries.
 	Cleanup(ctx context.Context) int
 
 	// Size returns the number of entries in the cache.
 	Size(ctx context.Context) int
+
+	// Close stops background cleanup and releases any underlying storage.
+	// It is safe to call more than once; the cache must not be used after.
+	Close() error
 }
 
 // SearchResult represents a cache search result.
 type SearchResult struct {
 	Entry      *api.CacheEntry
 	Similarity float64
+	// Confidence ranks the result under Options.Scoring, higher being
+	// better. Without scoring it equals Similarity, or the negated
+	// distance under a distance metric.
+	Confidence float64
+}
+
+// topResults sorts results by descending confidence and keeps the first k.
+func topResults(results []SearchResult, k int) []SearchResult {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Confidence > results[j].Confidence
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
 }
 
 // Options configures cache behavior.
 type Options struct {
-	MaxSize             int
+	MaxSize int
+	// MaxBytes, if set, also bounds MemoryCache by the approximate memory
+	// its entries take (request and response JSON plus embedding), evicting
+	// until a new entry fits. Entries larger than MaxBytes are rejected
+	// with ErrCacheFull.
+	MaxBytes            int64
 	DefaultTTL          time.Duration
 	CleanupInterval     time.Duration
 	SimilarityThreshold float64
+
+	// HardThreshold, if set, ends a linear Get scan at the first live entry
+	// this similar (or, under a distance metric, this close) instead of
+	// looking for a closer one. Matches beyond it are treated as
+	// equivalent, so the earliest wins.
+	HardThreshold float64
+
+	// TTLFunc computes an entry's TTL from its response, e.g. shorter for
+	// tool-call results or volatile data. Returning zero falls back to
+	// DefaultTTL. Entries with their own TTL or ExpiresAt skip the hook.
+	TTLFunc func(*api.CacheEntry) time.Duration
+
+	// TTLJitter randomizes each entry's lifetime within this fraction of
+	// its TTL either way (e.g. 0.1 for ±10%), so entries stored in a burst
+	// don't expire, and miss, in a burst. Entries given an explicit
+	// ExpiresAt are not jittered. Values above 1 are treated as 1.
+	TTLJitter float64
+
+	// StaleWhileRevalidate keeps expired entries servable for this long:
+	// MemoryCache's Get and GetExact return them flagged Stale, and
+	// Cleanup keeps them until the window ends, so the serving layer can
+	// answer at once and refresh the entry in the background instead of
+	// making the client wait for a recompute. Zero disables it.
+	StaleWhileRevalidate time.Duration
+
+	// NegativeTTL caps the lifetime of negative entries (remembered
+	// upstream failures) so known-bad prompts are retried eventually.
+	// Zero keeps the ExpiresAt given to Set.
+	NegativeTTL time.Duration
+
+	// MinAvgLogprob, if set (e.g. -1.0), marks responses whose average
+	// token logprob falls below it as low-confidence. Set rejects them
+	// with ErrLowConfidence, or, when LowConfidenceTTL is set, caps their
+	// lifetime to it instead. Responses without logprobs are unaffected.
+	MinAvgLogprob    float64
+	LowConfidenceTTL time.Duration
+
+	// MinCacheTemperature skips caching for seedless requests whose
+	// temperature is at or above it. Zero disables the check.
+	MinCacheTemperature float64
+	// RequireSeed skips caching for seedless requests with a nonzero
+	// temperature. Requests that omit temperature use the API default of 1.
+	RequireSeed bool
+
+	// EvictionPolicy selects which entry is removed when the cache is
+	// full. Defaults to EvictLRU.
+	EvictionPolicy EvictionPolicy
+
+	// ModelQuotas caps the share of MaxSize held by the request models
+	// listed; unlisted models share what the listed quotas leave. Once
+	// MemoryCache is full it evicts from models over their share before
+	// applying EvictionPolicy to all entries. See ModelQuota.
+	ModelQuotas map[string]ModelQuota
+
+	// Dimensions is the expected embedding length. MemoryCache rejects Set
+	// and counts Get as a dimension mismatch for other lengths. Zero takes
+	// the dimension from the first entry stored.
+	Dimensions int
+
+	// Projection, if set, bridges a migration between embedding models of
+	// different dimensions in MemoryCache: embeddings of another length
+	// are projected to its dimension on Set and on lookup, and entries of
+	// every embedding model are compared with each other rather than kept
+	// apart by EmbeddingModel. Matches across models are approximate; see
+	// Projection. It also sets the expected Dimensions.
+	Projection *Projection
+
+	// EmbeddingModel names the model producing query embeddings. Set
+	// tags entries without an EmbeddingModel with it, and Get, GetBatch,
+	// Search and near-duplicate detection skip entries embedded by another
+	// model, so swapping embedders does not produce garbage matches while
+	// old entries age out. Exact matches are unaffected.
+	EmbeddingModel string
+
+	// ModelThresholds maps embedding models to their similarity threshold,
+	// since models spread similarity scores differently (some put every
+	// pair above 0.9). Get, GetBatch and Search use the threshold of the
+	// query's embedding model in place of the one passed to them; unlisted
+	// models use the passed threshold.
+	ModelThresholds map[string]float64
+
+	// LengthAdjustments raise or lower the similarity threshold of Get
+	// and Search by the length of the lookup's input, set on the context
+	// with WithInputLength, so trivial prompts like "hi" and "ok" need a
+	// closer match than long ones. Points are in increasing Chars order;
+	// deltas are interpolated linearly between them and held beyond the
+	// ends. GetBatch, whose queries have lengths of their own, ignores
+	// them.
+	LengthAdjustments []LengthAdjustment
+
+	// MaxInputChars caps the length, in characters, of the text
+	// EmbeddingInput builds, so prompts longer than the embedding model's
+	// context window embed predictably. Truncation selects the part kept.
+	// Zero disables truncation.
+	MaxInputChars int
+	Truncation    Truncation
+
+	// Conversation selects how the messages of a request make up its
+	// embedding input. TurnDecay is the weight of each message relative
+	// to the one after it under ConversationWeighted; it defaults to 0.5.
+	Conversation Conversation
+	TurnDecay    float64
+
+	// ToolCallPolicy selects whether Set caches responses that call tools;
+	// rejected ones return ErrToolCalls. Defaults to ToolCallsCache.
+	ToolCallPolicy ToolCallPolicy
+
+	// OnEmbedError selects whether a failure to embed a response being
+	// stored is skipped silently or returned to the caller. The cache
+	// itself stores precomputed embeddings; the policy is for the layers
+	// embedding on its behalf, such as the proxy. Defaults to
+	// EmbedErrorSkip.
+	OnEmbedError EmbedErrorPolicy
+
+	// DisableDedupOnSet skips the near-duplicate check in Set, which
+	// compares a new entry's embedding with every entry in its namespace
+	// (or searches the HNSW index) and replaces a match rather than adding
+	// an entry. The check makes Set O(n); under write-heavy workloads where
+	// near-duplicates are rare, disabling it raises Set throughput at the
+	// cost of storing paraphrases side by side. MemoryCache still replaces
+	// an entry for the identical request, found in O(1) through the exact
+	// match index.
+	DisableDedupOnSet bool
+
+	// Metric selects the similarity function used by Get, Set and Delete.
+	Metric Metric
+	// NormalizeOnSet normalizes embeddings to unit length before storing,
+	// and on load for persistent caches, so every stored embedding is unit
+	// length. Cosine lookups then normalize the query once and compare by
+	// the cheaper dot product.
+	// Enable this when using MetricDotProduct.
+	NormalizeOnSet bool
+
+	// Quantization selects how MemoryCache stores embeddings. With
+	// QuantizationInt8, vectors take a quarter of the memory at a small
+	// cost in similarity accuracy, and linear scans are slower since
+	// vectors are dequantized as they are compared. The HNSW index, if
+	// enabled, still keeps a float32 copy of each vector.
+	Quantization Quantization
+
+	// VerifyIntegrity makes persistent caches record a checksum of each
+	// entry's request and response (api.CacheEntry.ContentChecksum) and
+	// verify it when the entry is read back: on open for SQLiteCache and
+	// BoltCache, on lookup for PgVectorCache. An entry that fails is
+	// treated as a miss and deleted, guarding against partial writes and
+	// serialization bugs across versions sharing a backend. It detects
+	// corruption, not deliberate tampering by a writer able to recompute
+	// the checksum.
+	VerifyIntegrity bool
+
+	// FlushInterval is how often SQLiteCache and BoltCache write hit
+	// counts and statistics counters to disk. Lookups record them in
+	// memory, so a hit never waits on a write; up to one interval of them
+	// is lost on a crash. Defaults to one second.
+	FlushInterval time.Duration
+
+	// Compression selects how SQLiteCache and BoltCache compress stored
+	// requests and responses. Entries written with any setting remain
+	// readable after changing it. Embeddings are stored uncompressed.
+	Compression Compression
+
+	// ParallelScanThreshold is the entry count from which MemoryCache
+	// splits its linear similarity scan across goroutines. Zero disables
+	// parallel scans.
+	ParallelScanThreshold int
+	// ParallelScanWorkers caps the number of scan goroutines.
+	// Defaults to GOMAXPROCS.
+	ParallelScanWorkers int
+
+	// HNSW configures an approximate nearest-neighbor index used by
+	// MemoryCache to avoid scanning every entry. Disabled by default.
+	HNSW HNSWOptions
+
+	// Tuning enables sampling of hit similarities for
+	// MemoryCache.SuggestThreshold.
+	Tuning TuningOptions
+
+	// Compaction enables MemoryCache's background merging of
+	// near-duplicate entries on the cleanup loop.
+	Compaction CompactionOptions
+
+	// StripPrefixes are removed from the start of message text by
+	// EmbeddingInput, e.g. a system preamble or template shared by every
+	// request, so similarity reflects the content that varies.
+	StripPrefixes []string
+
+	// Sanitizer, if set, scrubs request and response message content
+	// before entries are stored, e.g. NewPIISanitizer for compliance.
+	Sanitizer Sanitizer
+
+	// OnHit, OnMiss and OnSet are optional callbacks for logging, tracing
+	// or redaction. They run without the cache lock held. OnSet runs before
+	// the entry is stored, so it may modify it, e.g. to scrub PII.
+	OnHit  func(entry *api.CacheEntry, similarity float64)
+	OnMiss func(embedding []float64)
+	OnSet  func(entry *api.CacheEntry)
+
+	// OnEvict, if set, receives a copy of each entry MemoryCache evicts
+	// to make room, whichever EvictionPolicy or ModelQuotas chose it, e.g.
+	// to write it back to a persistent tier instead of losing it. With
+	// EvictExpired it also receives the entries Cleanup removes as
+	// expired. It runs without the cache lock held, so it may do I/O, but
+	// before the Set or Cleanup that evicted returns.
+	OnEvict      func(entry *api.CacheEntry)
+	EvictExpired bool
+
+	// Scoring, if enabled, makes Get choose among candidates at or above
+	// the threshold by a confidence combining similarity with entry age
+	// and hit count, rather than by similarity alone, and Search rank by
+	// it. See SearchResult.Confidence.
+	Scoring ScoringOptions
+
+	// Logger, if set, receives debug records for hits (with their
+	// similarity), misses and evictions, and an info record for each
+	// cleanup that removed expired entries and each compaction that merged
+	// entries. Records below the logger's
+	// level cost a level check.
+	Logger *slog.Logger
+
+	// ShadowMode tells the serving layer to look up the cache as usual but
+	// never serve a hit: every request goes upstream, and would-be hits
+	// are reported to OnShadow with the live response, to measure the
+	// false-hit rate of a threshold on real traffic without risk. live is
+	// nil when upstream returned an error. The cache itself behaves the
+	// same either way.
+	ShadowMode bool
+	OnShadow   func(hit *api.CacheEntry, similarity float64, live *api.ChatCompletionResponse)
+
+	// Pricing overrides or extends DefaultPricing for savings estimates,
+	// e.g. for negotiated rates or prices loaded with LoadPricing.
+	Pricing Pricing
+	// DefaultPrice applies to models not found in Pricing or DefaultPricing.
+	// If unset, $0.002 per 1K tokens is assumed.
+	DefaultPrice ModelPrice
 }
 
 // DefaultOptions returns sensible defaults for cache options.
 func DefaultOptions() *Options {
 	return &Options{
-		MaxSize:             10000,
-		DefaultTTL:          24 * time.Hour,
-		CleanupInterval:     5 * time.Minute,
-		SimilarityThreshold: 0.95,
+		MaxSize:               10000,
+		DefaultTTL:            24 * time.Hour,
+		CleanupInterval:       5 * time.Minute,
+		SimilarityThreshold:   0.95,
+		Metric:                MetricCosine,
+		ParallelScanThreshold: 20000,
+	}
+}
+
+// NewEntryID returns a random RFC 4122 version 4 UUID for a cache entry.
+func NewEntryID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// reachesHardThreshold reports whether a match, as returned by
+// metric.Similarity, is close enough to end a scan early.
+func (o *Options) reachesHardThreshold(metric Metric, similarity float64) bool {
+	return o.HardThreshold > 0 && similarity >= metric.ordered(o.HardThreshold)
+}
+
+// metricResults converts result similarities into the metric's own terms.
+func metricResults(metric Metric, results []SearchResult) []SearchResult {
+	if metric.LowerIsBetter() {
+		for i := range results {
+			results[i].Similarity = metric.ordered(results[i].Similarity)
+		}
 	}
+	return results
 }
@@ -0,0 +1,290 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// ErrFormatMismatch is returned by Set when a response doesn't satisfy its
+// request's response_format, e.g. non-JSON content for json_object.
+var ErrFormatMismatch = errors.New("response does not match requested format")
+
+// ErrLowConfidence is returned by Set when a response's average token
+// logprob is below Options.MinAvgLogprob and LowConfidenceTTL is unset.
+var ErrLowConfidence = errors.New("response confidence below threshold")
+
+// ErrToolCalls is returned by Set when a response's tool calls may not be
+// cached under Options.ToolCallPolicy.
+var ErrToolCalls = errors.New("response tool calls not cacheable")
+
+// ToolCallPolicy selects how Set treats responses that call tools. Tool
+// call arguments are often specific to the request that produced them,
+// so replaying them for a merely similar prompt can act on the wrong
+// values.
+type ToolCallPolicy int
+
+const (
+	// ToolCallsCache caches responses with tool calls like any other.
+	ToolCallsCache ToolCallPolicy = iota
+	// ToolCallsNever rejects responses with tool calls.
+	ToolCallsNever
+	// ToolCallsArgumentFree caches responses only when every tool call
+	// takes no arguments, so replaying it cannot carry over values from
+	// another prompt.
+	ToolCallsArgumentFree
+)
+
+// String returns the policy name.
+func (p ToolCallPolicy) String() string {
+	switch p {
+	case ToolCallsCache:
+		return "cache"
+	case ToolCallsNever:
+		return "never"
+	case ToolCallsArgumentFree:
+		return "argument-free"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseToolCallPolicy returns the policy with the given name. The empty
+// string is ToolCallsCache.
+func ParseToolCallPolicy(name string) (ToolCallPolicy, error) {
+	switch name {
+	case "", "cache":
+		return ToolCallsCache, nil
+	case "never":
+		return ToolCallsNever, nil
+	case "argument-free":
+		return ToolCallsArgumentFree, nil
+	default:
+		return 0, fmt.Errorf("unknown tool call policy %q", name)
+	}
+}
+
+// checkToolCalls rejects responses whose tool calls, or legacy function
+// calls, the ToolCallPolicy does not allow caching.
+func (o *Options) checkToolCalls(entry *api.CacheEntry) error {
+	if o.ToolCallPolicy == ToolCallsCache {
+		return nil
+	}
+	for _, choice := range entry.Response.Choices {
+		calls := make([]api.FunctionCall, 0, len(choice.Message.ToolCalls)+1)
+		for _, tc := range choice.Message.ToolCalls {
+			calls = append(calls, tc.Function)
+		}
+		if choice.Message.FunctionCall != nil {
+			calls = append(calls, *choice.Message.FunctionCall)
+		}
+		for _, call := range calls {
+			if o.ToolCallPolicy == ToolCallsNever || !argumentFree(call.Arguments) {
+				return ErrToolCalls
+			}
+		}
+	}
+	return nil
+}
+
+// argumentFree reports whether tool call arguments are empty: blank or an
+// empty JSON object.
+func argumentFree(arguments string) bool {
+	if strings.TrimSpace(arguments) == "" {
+		return true
+	}
+	var args map[string]json.RawMessage
+	return json.Unmarshal([]byte(arguments), &args) == nil && len(args) == 0
+}
+
+// defaultTemperature is the sampling temperature OpenAI applies when a
+// request omits it.
+const defaultTemperature = 1.0
+
+// ShouldCache reports whether a request may be served from or stored in
+// the cache. Seeded requests are always cacheable since the same seed and
+// prompt reproduce the same completion; seedless requests are rejected
+// when their temperature makes the output deliberately random.
+func (o *Options) ShouldCache(req *api.ChatCompletionRequest) bool {
+	if req.Seed != nil {
+		return true
+	}
+
+	temperature := defaultTemperature
+	if req.Temperature != nil {
+		temperature = *req.Temperature
+	}
+
+	if o.RequireSeed && temperature > 0 {
+		return false
+	}
+	if o.MinCacheTemperature > 0 && temperature >= o.MinCacheTemperature {
+		return false
+	}
+	return true
+}
+
+// ResponseMatchesFormat reports whether every choice in resp satisfies the
+// response_format of req: for "json_object" and "json_schema", the
+// assistant content must parse as JSON (the schema itself is not checked).
+// Other formats always match.
+func ResponseMatchesFormat(req *api.ChatCompletionRequest, resp *api.ChatCompletionResponse) bool {
+	if req.ResponseFormat == nil {
+		return true
+	}
+	switch req.ResponseFormat.Type {
+	case "json_object", "json_schema":
+	default:
+		return true
+	}
+
+	for _, choice := range resp.Choices {
+		content, ok := choice.Message.Content.(string)
+		if !ok || !json.Valid([]byte(content)) {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestedChoices returns the number of choices req asks for with n.
+func RequestedChoices(req *api.ChatCompletionRequest) int {
+	if req.N != nil && *req.N > 1 {
+		return *req.N
+	}
+	return 1
+}
+
+// ResponseHasChoices reports whether resp has at least as many choices as
+// req asks for, so it can serve req. A semantic match may come from a
+// request with a different n.
+func ResponseHasChoices(req *api.ChatCompletionRequest, resp *api.ChatCompletionResponse) bool {
+	return len(resp.Choices) >= RequestedChoices(req)
+}
+
+// TrimChoices drops choices from resp beyond those req asks for.
+func TrimChoices(req *api.ChatCompletionRequest, resp *api.ChatCompletionResponse) {
+	if n := RequestedChoices(req); len(resp.Choices) > n {
+		resp.Choices = resp.Choices[:n]
+	}
+}
+
+// GenerationMatches reports whether a response cached for the request
+// cached was generated under parameters compatible with req's, so a
+// semantic match isn't served truncated or formatted differently than req
+// asked for. Stop sequences must be the same set and response formats the
+// same type. A different max_tokens is fine when every choice finished on
+// its own within req's limit.
+func GenerationMatches(req, cached *api.ChatCompletionRequest, resp *api.ChatCompletionResponse) bool {
+	if !sameStops(req.Stop, cached.Stop) || responseFormatType(req) != responseFormatType(cached) {
+		return false
+	}
+	if equalIntPtr(req.MaxTokens, cached.MaxTokens) {
+		return true
+	}
+	for _, choice := range resp.Choices {
+		if choice.FinishReason != "stop" {
+			return false
+		}
+	}
+	return req.MaxTokens == nil || resp.Usage.CompletionTokens <= *req.MaxTokens
+}
+
+// sameStops reports whether a and b hold the same stop sequences, in any
+// order.
+func sameStops(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int, len(a))
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		if counts[s] == 0 {
+			return false
+		}
+		counts[s]--
+	}
+	return true
+}
+
+// responseFormatType returns req's response format, "text" if unset.
+func responseFormatType(req *api.ChatCompletionRequest) string {
+	if req.ResponseFormat == nil || req.ResponseFormat.Type == "" {
+		return "text"
+	}
+	return req.ResponseFormat.Type
+}
+
+// equalIntPtr reports whether a and b are both nil or point at equal
+// values.
+func equalIntPtr(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// checkResponseFormat rejects completions that don't match their request's
+// response_format, so they are never served to a strict client.
+func checkResponseFormat(entry *api.CacheEntry) error {
+	if entry.Negative || ResponseMatchesFormat(&entry.Request, &entry.Response) {
+		return nil
+	}
+	return ErrFormatMismatch
+}
+
+// applyNegativeTTL shortens a negative entry's lifetime to NegativeTTL.
+func (o *Options) applyNegativeTTL(entry *api.CacheEntry) {
+	if !entry.Negative || o.NegativeTTL <= 0 {
+		return
+	}
+	if expires := time.Now().Add(o.NegativeTTL); expires.Before(entry.ExpiresAt) || entry.ExpiresAt.IsZero() {
+		entry.ExpiresAt = expires
+	}
+}
+
+// AverageLogprob returns the mean logprob over every token of resp's
+// choices, and false if no choice carries logprobs.
+func AverageLogprob(resp *api.ChatCompletionResponse) (float64, bool) {
+	var sum float64
+	var n int
+	for _, choice := range resp.Choices {
+		if choice.Logprobs == nil {
+			continue
+		}
+		for _, tok := range choice.Logprobs.Content {
+			sum += tok.Logprob
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+// applyConfidence rejects, or shortens the lifetime of, responses the
+// model was unsure of, so an uncertain guess isn't served repeatedly.
+// Responses without logprobs are left alone.
+func (o *Options) applyConfidence(entry *api.CacheEntry) error {
+	if o.MinAvgLogprob == 0 || entry.Negative {
+		return nil
+	}
+	avg, ok := AverageLogprob(&entry.Response)
+	if !ok || avg >= o.MinAvgLogprob {
+		return nil
+	}
+	if o.LowConfidenceTTL <= 0 {
+		return ErrLowConfidence
+	}
+	if expires := time.Now().Add(o.LowConfidenceTTL); expires.Before(entry.ExpiresAt) || entry.ExpiresAt.IsZero() {
+		entry.ExpiresAt = expires
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+func TestShouldCache(t *testing.T) {
+	temp := func(v float64) *float64 { return &v }
+	seed := 42
+
+	tests := []struct {
+		name     string
+		opts     Options
+		req      api.ChatCompletionRequest
+		expected bool
+	}{
+		{"no policy", Options{}, api.ChatCompletionRequest{Temperature: temp(1.5)}, true},
+		{"require seed, zero temperature", Options{RequireSeed: true}, api.ChatCompletionRequest{Temperature: temp(0)}, true},
+		{"require seed, high temperature", Options{RequireSeed: true}, api.ChatCompletionRequest{Temperature: temp(0.7)}, false},
+		{"require seed, default temperature", Options{RequireSeed: true}, api.ChatCompletionRequest{}, false},
+		{"require seed, seeded", Options{RequireSeed: true}, api.ChatCompletionRequest{Temperature: temp(0.7), Seed: &seed}, true},
+		{"below min temperature", Options{MinCacheTemperature: 0.8}, api.ChatCompletionRequest{Temperature: temp(0.5)}, true},
+		{"at min temperature", Options{MinCacheTemperature: 0.8}, api.ChatCompletionRequest{Temperature: temp(0.8)}, false},
+		{"above min temperature, seeded", Options{MinCacheTemperature: 0.8}, api.ChatCompletionRequest{Temperature: temp(1.2), Seed: &seed}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.ShouldCache(&tt.req); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestResponseMatchesFormat(t *testing.T) {
+	jsonObject := &api.ResponseFormat{Type: "json_object"}
+	resp := func(contents ...interface{}) *api.ChatCompletionResponse {
+		r := &api.ChatCompletionResponse{}
+		for _, c := range contents {
+			r.Choices = append(r.Choices, api.Choice{Message: api.Message{Role: "assistant", Content: c}})
+		}
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		format   *api.ResponseFormat
+		resp     *api.ChatCompletionResponse
+		expected bool
+	}{
+		{"no format", nil, resp("plain text"), true},
+		{"text format", &api.ResponseFormat{Type: "text"}, resp("plain text"), true},
+		{"json object", jsonObject, resp(`{"answer": 42}`), true},
+		{"json schema", &api.ResponseFormat{Type: "json_schema"}, resp(`{"answer": 42}`), true},
+		{"invalid json", jsonObject, resp("Sure! Here is the JSON: {"), false},
+		{"one invalid choice", jsonObject, resp(`{}`, "nope"), false},
+		{"null content", jsonObject, resp(nil), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &api.ChatCompletionRequest{ResponseFormat: tt.format}
+			if got := ResponseMatchesFormat(req, tt.resp); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestResponseHasChoices(t *testing.T) {
+	n := func(v int) *int { return &v }
+	resp := func(count int) *api.ChatCompletionResponse {
+		r := &api.ChatCompletionResponse{}
+		for i := 0; i < count; i++ {
+			r.Choices = append(r.Choices, api.Choice{Index: i})
+		}
+		return r
+	}
+
+	tests := []struct {
+		name        string
+		n           *int
+		choices     int
+		expected    bool
+		wantTrimmed int
+	}{
+		{"n unset", nil, 1, true, 1},
+		{"n unset, several cached", nil, 3, true, 1},
+		{"n=1", n(1), 1, true, 1},
+		{"n=3, one cached", n(3), 1, false, 1},
+		{"n=3, three cached", n(3), 3, true, 3},
+		{"n=2, three cached", n(2), 3, true, 2},
+		{"n=0", n(0), 1, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &api.ChatCompletionRequest{N: tt.n}
+			r := resp(tt.choices)
+			if got := ResponseHasChoices(req, r); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			TrimChoices(req, r)
+			if len(r.Choices) != tt.wantTrimmed {
+				t.Errorf("expected %d choices after trimming, got %d", tt.wantTrimmed, len(r.Choices))
+			}
+		})
+	}
+}
+
+func TestGenerationMatches(t *testing.T) {
+	n := func(v int) *int { return &v }
+	resp := func(finish string, tokens int) *api.ChatCompletionResponse {
+		return &api.ChatCompletionResponse{
+			Choices: []api.Choice{{FinishReason: finish}},
+			Usage:   api.Usage{CompletionTokens: tokens},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		req      api.ChatCompletionRequest
+		cached   api.ChatCompletionRequest
+		resp     *api.ChatCompletionResponse
+		expected bool
+	}{
+		{"same parameters", api.ChatCompletionRequest{Stop: []string{"a"}, MaxTokens: n(10)}, api.ChatCompletionRequest{Stop: []string{"a"}, MaxTokens: n(10)}, resp("length", 10), true},
+		{"stop order", api.ChatCompletionRequest{Stop: []string{"a", "b"}}, api.ChatCompletionRequest{Stop: []string{"b", "a"}}, resp("stop", 5), true},
+		{"different stop", api.ChatCompletionRequest{Stop: []string{"a"}}, api.ChatCompletionRequest{}, resp("stop", 5), false},
+		{"text format is the default", api.ChatCompletionRequest{ResponseFormat: &api.ResponseFormat{Type: "text"}}, api.ChatCompletionRequest{}, resp("stop", 5), true},
+		{"different format", api.ChatCompletionRequest{ResponseFormat: &api.ResponseFormat{Type: "json_object"}}, api.ChatCompletionRequest{}, resp("stop", 5), false},
+		{"finished within limit", api.ChatCompletionRequest{MaxTokens: n(100)}, api.ChatCompletionRequest{}, resp("stop", 20), true},
+		{"finished over limit", api.ChatCompletionRequest{MaxTokens: n(10)}, api.ChatCompletionRequest{}, resp("stop", 20), false},
+		{"cached was truncated", api.ChatCompletionRequest{}, api.ChatCompletionRequest{MaxTokens: n(10)}, resp("length", 10), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GenerationMatches(&tt.req, &tt.cached, tt.resp); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestApplyConfidence(t *testing.T) {
+	withLogprobs := func(logprobs ...float64) *api.CacheEntry {
+		lp := &api.Logprob{}
+		for _, v := range logprobs {
+			lp.Content = append(lp.Content, api.TokenLogprob{Token: "t", Logprob: v})
+		}
+		return &api.CacheEntry{Response: api.ChatCompletionResponse{
+			Choices: []api.Choice{{Logprobs: lp}},
+		}}
+	}
+
+	tests := []struct {
+		name       string
+		opts       Options
+		entry      *api.CacheEntry
+		wantErr    error
+		wantCapped bool
+	}{
+		{"disabled", Options{}, withLogprobs(-5, -5), nil, false},
+		{"confident", Options{MinAvgLogprob: -1}, withLogprobs(-0.1, -0.5), nil, false},
+		{"no logprobs", Options{MinAvgLogprob: -1}, &api.CacheEntry{}, nil, false},
+		{"low confidence rejected", Options{MinAvgLogprob: -1}, withLogprobs(-0.1, -3), ErrLowConfidence, false},
+		{"low confidence shortened", Options{MinAvgLogprob: -1, LowConfidenceTTL: time.Minute}, withLogprobs(-2, -3), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.entry.ExpiresAt = time.Now().Add(time.Hour)
+			if err := tt.opts.applyConfidence(tt.entry); err != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			capped := time.Until(tt.entry.ExpiresAt) <= time.Minute
+			if capped != tt.wantCapped {
+				t.Errorf("expected capped=%v, expires in %v", tt.wantCapped, time.Until(tt.entry.ExpiresAt))
+			}
+		})
+	}
+}
+
+func TestResponsesMatch(t *testing.T) {
+	text := func(texts ...string) *api.ChatCompletionResponse {
+		resp := &api.ChatCompletionResponse{}
+		for _, s := range texts {
+			resp.Choices = append(resp.Choices, api.Choice{Message: api.Message{Role: "assistant", Content: s}})
+		}
+		return resp
+	}
+	tool := func(args string) *api.ChatCompletionResponse {
+		return &api.ChatCompletionResponse{Choices: []api.Choice{{Message: api.Message{
+			Role:      "assistant",
+			ToolCalls: []api.ToolCall{{ID: "call_" + args, Type: "function", Function: api.FunctionCall{Name: "lookup", Arguments: args}}},
+		}}}}
+	}
+
+	tests := []struct {
+		name string
+		a, b *api.ChatCompletionResponse
+		want bool
+	}{
+		{"same text", text("Paris"), text("Paris"), true},
+		{"different text", text("Paris"), text("Lyon"), false},
+		{"different choice count", text("Paris"), text("Paris", "Paris"), false},
+		{"same tool call", tool(`{"q":1}`), tool(`{"q":1}`), true},
+		{"different tool arguments", tool(`{"q":1}`), tool(`{"q":2}`), false},
+		{"tool call versus text", tool(`{"q":1}`), text(""), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResponsesMatch(tt.a, tt.b); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckToolCalls(t *testing.T) {
+	withCalls := func(arguments ...string) *api.CacheEntry {
+		msg := api.Message{Role: "assistant"}
+		for _, args := range arguments {
+			msg.ToolCalls = append(msg.ToolCalls, api.ToolCall{ID: "call", Type: "function", Function: api.FunctionCall{Name: "lookup", Arguments: args}})
+		}
+		return &api.CacheEntry{Response: api.ChatCompletionResponse{Choices: []api.Choice{{Message: msg}}}}
+	}
+	legacy := &api.CacheEntry{Response: api.ChatCompletionResponse{Choices: []api.Choice{{
+		Message: api.Message{Role: "assistant", FunctionCall: &api.FunctionCall{Name: "lookup", Arguments: `{"city":"Paris"}`}},
+	}}}}
+
+	tests := []struct {
+		name    string
+		policy  ToolCallPolicy
+		entry   *api.CacheEntry
+		wantErr error
+	}{
+		{"cache allows arguments", ToolCallsCache, withCalls(`{"city":"Paris"}`), nil},
+		{"never allows plain text", ToolCallsNever, withCalls(), nil},
+		{"never rejects argument-free calls", ToolCallsNever, withCalls(`{}`), ErrToolCalls},
+		{"argument-free allows empty object", ToolCallsArgumentFree, withCalls(`{}`, ` { } `), nil},
+		{"argument-free allows blank", ToolCallsArgumentFree, withCalls(""), nil},
+		{"argument-free rejects arguments", ToolCallsArgumentFree, withCalls(`{}`, `{"city":"Paris"}`), ErrToolCalls},
+		{"argument-free rejects legacy function call", ToolCallsArgumentFree, legacy, ErrToolCalls},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &Options{ToolCallPolicy: tt.policy}
+			if err := opts.checkToolCalls(tt.entry); err != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseToolCallPolicy(t *testing.T) {
+	for _, p := range []ToolCallPolicy{ToolCallsCache, ToolCallsNever, ToolCallsArgumentFree} {
+		got, err := ParseToolCallPolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("expected %v to round-trip, got %v (%v)", p, got, err)
+		}
+	}
+	if got, err := ParseToolCallPolicy(""); err != nil || got != ToolCallsCache {
+		t.Errorf("expected empty name to be ToolCallsCache, got %v (%v)", got, err)
+	}
+	if _, err := ParseToolCallPolicy("sometimes"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
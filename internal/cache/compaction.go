@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// CompactionOptions configures MemoryCache's background compaction, which
+// merges clusters of near-duplicate entries that would all match the same
+// queries into one, so paraphrases stored before Set's near-duplicate
+// check caught them (or with it disabled) don't crowd out distinct
+// entries. See MemoryCache.Compact.
+type CompactionOptions struct {
+	// Threshold is the similarity (or, under a distance metric, the
+	// distance) at which entries are merged, e.g. 0.97. It is independent
+	// of the serving threshold, which it should not be below. Zero
+	// disables compaction.
+	Threshold float64
+	// Interval is how often the cleanup loop compacts. It is checked on
+	// each cleanup, so it is rounded up to a multiple of CleanupInterval.
+	// Defaults to CleanupInterval.
+	Interval time.Duration
+}
+
+// interval returns Interval with the default applied.
+func (c CompactionOptions) interval(cleanup time.Duration) time.Duration {
+	if c.Interval <= 0 {
+		return cleanup
+	}
+	return c.Interval
+}
+
+// compactionMember is an entry considered by Compact, with the entry it
+// held when clusters were formed, to detect replacement since.
+type compactionMember struct {
+	me    *memoryEntry
+	entry *api.CacheEntry
+}
+
+// Compact merges near-duplicate entries: each cluster of entries at least
+// Options.Compaction.Threshold similar to the most-hit entry among them,
+// in the same namespace and embedding model, is reduced to that entry.
+// An entry is merged only if the representative's response could answer
+// its request, so entries generated with other parameters, or for another
+// response_format or n, are kept. Pinned and negative entries are left
+// out, neither merged nor merged into. It returns the number of entries
+// removed, which Stats reports as Merged.
+//
+// Clusters are formed under the read lock, so lookups proceed meanwhile;
+// comparisons are pairwise unless the HNSW index is in use, so compacting
+// a large cache without it is slow, though still off the request path.
+func (m *MemoryCache) Compact(ctx context.Context) int {
+	threshold := m.opts.Compaction.Threshold
+	if threshold == 0 {
+		return 0
+	}
+	metric := m.opts.Metric
+	floor := metric.ordered(threshold)
+
+	m.mu.RLock()
+	// Representatives first: most hit, then most recently hit
+	order := make([]*memoryEntry, 0, len(m.entries))
+	for _, me := range m.entries {
+		if !me.entry.Pinned && !me.entry.Negative {
+			order = append(order, me)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i].entry, order[j].entry
+		if a.HitCount != b.HitCount {
+			return a.HitCount > b.HitCount
+		}
+		return a.LastHitAt.After(b.LastHitAt)
+	})
+
+	seen := make(map[*memoryEntry]bool) // representatives and merged entries
+	var victims []compactionMember
+	absorb := func(rep, me *memoryEntry, similarity float64) {
+		if seen[me] || me.entry.Pinned || me.entry.Negative || me.entry.Namespace != rep.entry.Namespace ||
+			!sameEmbeddingModel(me.entry, rep.entry.EmbeddingModel) || metric.ordered(similarity) < floor ||
+			!answers(rep.entry, &me.entry.Request) {
+			return
+		}
+		seen[me] = true
+		victims = append(victims, compactionMember{me, me.entry})
+	}
+	indexed := m.indexed()
+	for i, rep := range order {
+		if seen[rep] {
+			continue
+		}
+		seen[rep] = true
+		vec := rep.vector()
+		if indexed {
+			for _, c := range m.index.search(vec, m.index.efSearch) {
+				absorb(rep, c.node.value, c.sim)
+			}
+			continue
+		}
+		// Entries before rep were representatives or merged already
+		for _, me := range order[i+1:] {
+			if !seen[me] {
+				absorb(rep, me, me.similarity(metric, vec))
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(victims) == 0 {
+		return 0
+	}
+
+	m.mu.Lock()
+	removed := 0
+	for _, v := range victims {
+		// Skip entries removed or replaced since
+		if m.byID[v.entry.ID] == v.me && v.me.entry == v.entry {
+			m.remove(v.me)
+			removed++
+		}
+	}
+	m.mu.Unlock()
+
+	m.merged.Add(int64(removed))
+	m.opts.logCompaction(ctx, removed)
+	return removed
+}
+
+// answers reports whether entry's response could be served for req.
+func answers(entry *api.CacheEntry, req *api.ChatCompletionRequest) bool {
+	return ResponseMatchesFormat(req, &entry.Response) && ResponseHasChoices(req, &entry.Response) &&
+		GenerationMatches(req, &entry.Request, &entry.Response)
+}
+
+// logCompaction logs the number of entries a compaction merged at info
+// level, if any.
+func (o *Options) logCompaction(ctx context.Context, merged int) {
+	if merged > 0 && o.logEnabled(ctx, slog.LevelInfo) {
+		o.Logger.LogAttrs(ctx, slog.LevelInfo, "near-duplicate cache entries merged", slog.Int("count", merged))
+	}
+}
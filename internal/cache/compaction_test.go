@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+func TestMemoryCacheCompact(t *testing.T) {
+	tests := []struct {
+		name string
+		hnsw HNSWOptions
+	}{
+		{"linear", HNSWOptions{}},
+		{"indexed", HNSWOptions{Enabled: true, MinEntries: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := NewMemoryCache(&Options{
+				MaxSize:         100,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+				Metric:          MetricCosine,
+				HNSW:            tt.hnsw,
+				Compaction:      CompactionOptions{Threshold: 0.96},
+
+				// Keep the near-duplicates Set would otherwise replace
+				DisableDedupOnSet: true,
+			})
+			defer c.Close()
+
+			entries := []struct {
+				content   string
+				embedding []float64
+				hits      int64
+				namespace string
+				pinned    bool
+			}{
+				{"a", []float64{1, 0, 0}, 1, "", false},
+				{"b", []float64{1, 0.2, 0}, 5, "", false}, // most hit of a, b and c
+				{"c", []float64{1, 0.25, 0}, 0, "", false},
+				{"pinned", []float64{1, 0.1, 0}, 0, "", true},
+				{"other namespace", []float64{1, 0, 0}, 0, "other", false},
+				{"distinct", []float64{0, 1, 0}, 0, "", false},
+			}
+			ids := make(map[string]string)
+			for _, e := range entries {
+				entry := newTestEntry(e.embedding, time.Hour)
+				entry.Request.Messages[0].Content = e.content
+				entry.HitCount = e.hits
+				entry.Namespace = e.namespace
+				entry.Pinned = e.pinned
+				if err := c.Set(ctx, entry); err != nil {
+					t.Fatalf("Set failed: %v", err)
+				}
+				ids[e.content] = entry.ID
+			}
+
+			if merged := c.Compact(ctx); merged != 2 {
+				t.Errorf("expected 2 entries merged, got %d", merged)
+			}
+			if merged := c.Stats(ctx).Merged; merged != 2 {
+				t.Errorf("expected Stats to report 2 merged, got %d", merged)
+			}
+
+			for _, e := range entries {
+				_, found := c.GetByID(ctx, ids[e.content])
+				if merged := e.content == "a" || e.content == "c"; found == merged {
+					t.Errorf("entry %q: expected merged %v, found %v", e.content, merged, found)
+				}
+			}
+
+			if merged := c.Compact(ctx); merged != 0 {
+				t.Errorf("expected a second compaction to merge nothing, got %d", merged)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheCompactDisabled(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(&Options{MaxSize: 10, DefaultTTL: time.Hour, CleanupInterval: time.Hour, DisableDedupOnSet: true})
+	defer c.Close()
+
+	for _, content := range []string{"a", "b"} {
+		entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+		entry.Request.Messages[0].Content = content
+		if err := c.Set(ctx, entry); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if merged := c.Compact(ctx); merged != 0 || c.Size(ctx) != 2 {
+		t.Errorf("expected nothing merged without a threshold, got %d (size %d)", merged, c.Size(ctx))
+	}
+}
+
+func TestMemoryCacheCompactKeepsIncompatible(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(&Options{
+		MaxSize:           10,
+		DefaultTTL:        time.Hour,
+		CleanupInterval:   time.Hour,
+		Compaction:        CompactionOptions{Threshold: 0.96},
+		DisableDedupOnSet: true,
+	})
+	defer c.Close()
+
+	rep := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	rep.HitCount = 5
+
+	// A response generated with other stop sequences can't answer it
+	stops := newTestEntry([]float64{1, 0.1, 0}, time.Hour)
+	stops.Request.Messages[0].Content = "stops"
+	stops.Request.Stop = []string{"\n"}
+
+	// Nor can it answer a request for a JSON object
+	format := newTestEntry([]float64{1, 0.1, 0}, time.Hour)
+	format.Request.Messages[0].Content = "format"
+	format.Request.ResponseFormat = &api.ResponseFormat{Type: "json_object"}
+	format.Response.Choices[0].Message.Content = `{"answer": 1}`
+
+	negative := newTestEntry([]float64{1, 0.1, 0}, time.Hour)
+	negative.Request.Messages[0].Content = "negative"
+	negative.Negative = true
+	negative.StatusCode = 400
+
+	for _, entry := range []*api.CacheEntry{rep, stops, format, negative} {
+		if err := c.Set(ctx, entry); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	if merged := c.Compact(ctx); merged != 0 {
+		t.Errorf("expected nothing merged, got %d", merged)
+	}
+	if c.Size(ctx) != 4 {
+		t.Errorf("expected 4 entries, got %d", c.Size(ctx))
+	}
+}
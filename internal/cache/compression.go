@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compression selects how persistent caches compress stored requests and
+// responses. Embeddings are never compressed.
+type Compression int
+
+const (
+	// CompressionNone stores entries as plain JSON.
+	CompressionNone Compression = iota
+	// CompressionGzip stores entries as gzipped JSON.
+	CompressionGzip
+)
+
+// String returns the compression name.
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	default:
+		return "unknown"
+	}
+}
+
+// gzipMagic starts every gzip stream; JSON never does.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// compress encodes data with the codec.
+func (c Compression) compress(data []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to compress entry: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress entry: %w", err)
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %d", c)
+	}
+}
+
+// decompress decodes data written with any codec, detected from its
+// header, so changing Options.Compression doesn't strand stored entries.
+func decompress(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress entry: %w", err)
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress entry: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	data := []byte(`{"response":"` + strings.Repeat("a long completion ", 100) + `"}`)
+
+	for _, c := range []Compression{CompressionNone, CompressionGzip} {
+		t.Run(c.String(), func(t *testing.T) {
+			compressed, err := c.compress(data)
+			if err != nil {
+				t.Fatalf("compress failed: %v", err)
+			}
+			if c == CompressionGzip && len(compressed) >= len(data) {
+				t.Errorf("expected gzip to shrink %d bytes, got %d", len(data), len(compressed))
+			}
+
+			got, err := decompress(compressed)
+			if err != nil {
+				t.Fatalf("decompress failed: %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("expected decompressed data to match")
+			}
+		})
+	}
+
+	t.Run("corrupt", func(t *testing.T) {
+		if _, err := decompress(append([]byte{0x1f, 0x8b}, "garbage"...)); err == nil {
+			t.Error("expected error for corrupt gzip data")
+		}
+	})
+}
+
+func TestBoltCacheCompression(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	cache, err := NewBoltCache(path, &Options{
+		MaxSize:         100,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		Compression:     CompressionGzip,
+	})
+	if err != nil {
+		t.Fatalf("NewBoltCache failed: %v", err)
+	}
+
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	entry.Response.Choices[0].Message.Content = strings.Repeat("a long completion ", 100)
+	if err := cache.Set(ctx, entry); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	cache.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltEntriesBucket).Get([]byte(entry.ID)); !bytes.HasPrefix(v, gzipMagic) {
+			t.Error("expected stored entry to be gzipped")
+		}
+		return nil
+	})
+	cache.Close()
+
+	// Compressed entries stay readable with compression turned off
+	reopened := newTestBoltCache(t, path, 100)
+	got, ok := reopened.GetByID(ctx, entry.ID)
+	if !ok {
+		t.Fatal("expected entry after reopen")
+	}
+	if !reflect.DeepEqual(got.Request, entry.Request) || !reflect.DeepEqual(got.Response, entry.Response) {
+		t.Errorf("expected identical entry after round trip, got %+v", got)
+	}
+	if !reflect.DeepEqual(got.Embedding, entry.Embedding) {
+		t.Errorf("expected embedding %v, got %v", entry.Embedding, got.Embedding)
+	}
+}
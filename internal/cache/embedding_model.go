@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+type embeddingModelContextKey struct{}
+
+// WithEmbeddingModel returns a context whose lookups and stores use model
+// in place of Options.EmbeddingModel, for embeddings produced by another
+// model than usual, e.g. a fallback in an embedding.ChainEmbedder.
+func WithEmbeddingModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, embeddingModelContextKey{}, model)
+}
+
+// embeddingModel returns the model set by WithEmbeddingModel, or
+// Options.EmbeddingModel.
+func (o *Options) embeddingModel(ctx context.Context) string {
+	if model, ok := ctx.Value(embeddingModelContextKey{}).(string); ok && model != "" {
+		return model
+	}
+	return o.EmbeddingModel
+}
+
+// applyEmbeddingModel tags an entry without an embedding model with the
+// context's.
+func (o *Options) applyEmbeddingModel(ctx context.Context, entry *api.CacheEntry) {
+	if entry.EmbeddingModel == "" {
+		entry.EmbeddingModel = o.embeddingModel(ctx)
+	}
+}
+
+// sameEmbeddingModel reports whether an entry's embedding can be compared
+// with query embeddings from model. Untagged entries, stored before
+// tagging, compare with everything, as do queries of unknown model.
+func sameEmbeddingModel(entry *api.CacheEntry, model string) bool {
+	return model == "" || entry.EmbeddingModel == "" || entry.EmbeddingModel == model
+}
+
+// scope is the part of the cache a lookup searches: entries in its
+// namespace whose embeddings compare with its query's, and, for lookups
+// that may serve stale entries, that expired less than grace ago.
+type scope struct {
+	namespace string
+	model     string
+	grace     time.Duration
+}
+
+// scopeFor returns the scope of lookups made with ctx. Under a
+// Projection it spans every embedding model.
+func (o *Options) scopeFor(ctx context.Context) scope {
+	if o.Projection != nil {
+		return scope{namespace: namespaceFromContext(ctx)}
+	}
+	return scope{namespace: namespaceFromContext(ctx), model: o.embeddingModel(ctx)}
+}
+
+// modelThreshold returns the similarity threshold for lookups made with
+// ctx: Options.ModelThresholds' entry for the context's embedding model,
+// or threshold for unlisted models.
+func (o *Options) modelThreshold(ctx context.Context, threshold float64) float64 {
+	if t, ok := o.ModelThresholds[o.embeddingModel(ctx)]; ok {
+		return t
+	}
+	return threshold
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrEmbedFailed wraps embedding errors surfaced by EmbedErrorPropagate.
+var ErrEmbedFailed = errors.New("failed to embed entry")
+
+// EmbedErrorPolicy selects what a store does when the request it would
+// cache cannot be embedded. Either way the entry is not stored; the
+// policy only decides whether the failure reaches the caller. Callers
+// serving clients must not fail a request over it, since the response
+// itself was obtained.
+type EmbedErrorPolicy int
+
+const (
+	// EmbedErrorSkip skips caching the entry silently (fail-open).
+	EmbedErrorSkip EmbedErrorPolicy = iota
+	// EmbedErrorPropagate returns the failure, wrapped in ErrEmbedFailed.
+	EmbedErrorPropagate
+)
+
+// String returns the policy name.
+func (p EmbedErrorPolicy) String() string {
+	switch p {
+	case EmbedErrorSkip:
+		return "skip"
+	case EmbedErrorPropagate:
+		return "propagate"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseEmbedErrorPolicy returns the policy with the given name. The empty
+// string is EmbedErrorSkip.
+func ParseEmbedErrorPolicy(name string) (EmbedErrorPolicy, error) {
+	switch name {
+	case "", "skip":
+		return EmbedErrorSkip, nil
+	case "propagate":
+		return EmbedErrorPropagate, nil
+	default:
+		return 0, fmt.Errorf("unknown embed error policy %q", name)
+	}
+}
+
+// Handle applies the policy to an embedding error from the store path:
+// it returns nil under EmbedErrorSkip, and err wrapped in ErrEmbedFailed
+// under EmbedErrorPropagate. A nil err is returned as is.
+func (p EmbedErrorPolicy) Handle(err error) error {
+	if err == nil || p == EmbedErrorSkip {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrEmbedFailed, err)
+}
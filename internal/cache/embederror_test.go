@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEmbedErrorPolicy(t *testing.T) {
+	embedErr := errors.New("connection refused")
+	tests := []struct {
+		name    string
+		policy  EmbedErrorPolicy
+		err     error
+		wantErr bool
+	}{
+		{name: "skip", policy: EmbedErrorSkip, err: embedErr},
+		{name: "propagate", policy: EmbedErrorPropagate, err: embedErr, wantErr: true},
+		{name: "propagate without error", policy: EmbedErrorPropagate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Handle(tt.err)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("expected nil, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrEmbedFailed) || !errors.Is(err, embedErr) {
+				t.Errorf("expected error wrapping ErrEmbedFailed and the cause, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseEmbedErrorPolicy(t *testing.T) {
+	for _, p := range []EmbedErrorPolicy{EmbedErrorSkip, EmbedErrorPropagate} {
+		got, err := ParseEmbedErrorPolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("expected %v to round-trip, got %v (%v)", p, got, err)
+		}
+	}
+	if got, err := ParseEmbedErrorPolicy(""); err != nil || got != EmbedErrorSkip {
+		t.Errorf("expected empty name to be EmbedErrorSkip, got %v (%v)", got, err)
+	}
+	if _, err := ParseEmbedErrorPolicy("retry"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// encodeEmbedding packs an embedding into a little-endian float64 byte slice.
+func encodeEmbedding(v []float64) []byte {
+	buf := make([]byte, 8*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint64(buf[i*8:], math.Float64bits(f))
+	}
+	return buf
+}
+
+// decodeEmbedding unpacks an embedding produced by encodeEmbedding.
+func decodeEmbedding(buf []byte) ([]float64, error) {
+	if len(buf)%8 != 0 {
+		return nil, fmt.Errorf("invalid embedding length %d", len(buf))
+	}
+	v := make([]float64, len(buf)/8)
+	for i := range v {
+		v[i] = math.Float64frombits(binary.LittleEndian.Uint64(buf[i*8:]))
+	}
+	return v, nil
+}
@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"time"
+)
+
+// EvictionPolicy selects which entry MemoryCache removes when full.
+type EvictionPolicy int
+
+const (
+	// EvictLRU evicts the least recently used entry.
+	EvictLRU EvictionPolicy = iota
+	// EvictLFU evicts the entry with the fewest hits, breaking ties by
+	// least recent use.
+	EvictLFU
+	// EvictFIFO evicts the oldest entry by insertion time.
+	EvictFIFO
+	// EvictTTL never evicts live entries: Set only makes room by removing
+	// an expired entry and returns ErrCacheFull otherwise.
+	EvictTTL
+	// EvictTinyLFU admits new entries past a small LRU window only if they
+	// are estimated to be requested more often than the entry they would
+	// replace, resisting scans better than LRU and forgetting stale entries
+	// unlike LFU.
+	EvictTinyLFU
+)
+
+// String returns the policy name.
+func (p EvictionPolicy) String() string {
+	switch p {
+	case EvictLRU:
+		return "lru"
+	case EvictLFU:
+		return "lfu"
+	case EvictFIFO:
+		return "fifo"
+	case EvictTTL:
+		return "ttl"
+	case EvictTinyLFU:
+		return "tinylfu"
+	default:
+		return "unknown"
+	}
+}
+
+// evictor tracks entries in the order a policy would evict them.
+// Callers must hold MemoryCache's write lock.
+type evictor interface {
+	// add starts tracking a new or replaced entry.
+	add(me *memoryEntry)
+	// touch records a cache hit on the entry. It is a no-op if the
+	// entry is no longer tracked.
+	touch(me *memoryEntry)
+	// remove stops tracking the entry.
+	remove(me *memoryEntry)
+	// victim returns the entry to evict, or nil if none may be evicted.
+	victim(now time.Time) *memoryEntry
+	// victimAmong returns the entry the policy would evict first among
+	// those eligible, or nil if none may be evicted.
+	victimAmong(now time.Time, eligible func(*memoryEntry) bool) *memoryEntry
+	// reset stops tracking all entries.
+	reset()
+}
+
+// newEvictor returns the evictor implementing the policy for a cache
+// holding up to capacity entries.
+func newEvictor(policy EvictionPolicy, capacity int) evictor {
+	switch policy {
+	case EvictLFU:
+		return &heapEvictor{entries: entryHeap{less: func(a, b *memoryEntry) bool {
+			if a.entry.HitCount != b.entry.HitCount {
+				return a.entry.HitCount < b.entry.HitCount
+			}
+			return a.entry.LastHitAt.Before(b.entry.LastHitAt)
+		}}}
+	case EvictFIFO:
+		return &listEvictor{list: list.New()}
+	case EvictTTL:
+		return &heapEvictor{
+			entries: entryHeap{less: func(a, b *memoryEntry) bool {
+				return a.entry.ExpiresAt.Before(b.entry.ExpiresAt)
+			}},
+			expiredOnly: true,
+		}
+	case EvictTinyLFU:
+		return newTinyLFUEvictor(capacity)
+	default:
+		return &listEvictor{list: list.New(), moveOnTouch: true}
+	}
+}
+
+// listEvictor evicts in insertion order, or in recency order when
+// moveOnTouch is set.
+type listEvictor struct {
+	list        *list.List // front = newest
+	moveOnTouch bool
+}
+
+func (e *listEvictor) add(me *memoryEntry) {
+	me.elem = e.list.PushFront(me)
+}
+
+func (e *listEvictor) touch(me *memoryEntry) {
+	if e.moveOnTouch && me.elem != nil {
+		e.list.MoveToFront(me.elem)
+	}
+}
+
+func (e *listEvictor) remove(me *memoryEntry) {
+	e.list.Remove(me.elem)
+}
+
+func (e *listEvictor) victim(now time.Time) *memoryEntry {
+	if back := e.list.Back(); back != nil {
+		return back.Value.(*memoryEntry)
+	}
+	return nil
+}
+
+func (e *listEvictor) victimAmong(now time.Time, eligible func(*memoryEntry) bool) *memoryEntry {
+	return backmost(e.list, eligible)
+}
+
+func (e *listEvictor) reset() {
+	untrackList(e.list)
+}
+
+// heapEvictor evicts the minimum entry of a heap. With expiredOnly set,
+// the minimum is only returned once it has expired.
+type heapEvictor struct {
+	entries     entryHeap
+	expiredOnly bool
+}
+
+func (e *heapEvictor) add(me *memoryEntry) {
+	heap.Push(&e.entries, me)
+}
+
+func (e *heapEvictor) touch(me *memoryEntry) {
+	if me.heapIdx >= 0 {
+		heap.Fix(&e.entries, me.heapIdx)
+	}
+}
+
+func (e *heapEvictor) remove(me *memoryEntry) {
+	if me.heapIdx >= 0 {
+		heap.Remove(&e.entries, me.heapIdx)
+	}
+}
+
+func (e *heapEvictor) victim(now time.Time) *memoryEntry {
+	if len(e.entries.items) == 0 {
+		return nil
+	}
+	me := e.entries.items[0]
+	if e.expiredOnly && now.Before(me.entry.ExpiresAt) {
+		return nil
+	}
+	return me
+}
+
+// victimAmong scans the heap, since eligible entries may sit anywhere in
+// it.
+func (e *heapEvictor) victimAmong(now time.Time, eligible func(*memoryEntry) bool) *memoryEntry {
+	var victim *memoryEntry
+	for _, me := range e.entries.items {
+		if e.expiredOnly && now.Before(me.entry.ExpiresAt) {
+			continue
+		}
+		if eligible(me) && (victim == nil || e.entries.less(me, victim)) {
+			victim = me
+		}
+	}
+	return victim
+}
+
+func (e *heapEvictor) reset() {
+	for _, me := range e.entries.items {
+		me.heapIdx = -1
+	}
+	e.entries.items = nil
+}
+
+// untrackList empties l, clearing each entry's element. Init alone would
+// leave the elements pointing at l, so a late touch could move one back
+// into it.
+func untrackList(l *list.List) {
+	for el := l.Front(); el != nil; el = el.Next() {
+		el.Value.(*memoryEntry).elem = nil
+	}
+	l.Init()
+}
+
+// backmost returns the entry closest to the back of l that is eligible.
+func backmost(l *list.List, eligible func(*memoryEntry) bool) *memoryEntry {
+	for el := l.Back(); el != nil; el = el.Prev() {
+		if me := el.Value.(*memoryEntry); eligible(me) {
+			return me
+		}
+	}
+	return nil
+}
+
+// entryHeap is a min-heap of entries ordered by less.
+type entryHeap struct {
+	items []*memoryEntry
+	less  func(a, b *memoryEntry) bool
+}
+
+func (h *entryHeap) Len() int { return len(h.items) }
+
+func (h *entryHeap) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+
+func (h *entryHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].heapIdx = i
+	h.items[j].heapIdx = j
+}
+
+func (h *entryHeap) Push(x interface{}) {
+	me := x.(*memoryEntry)
+	me.heapIdx = len(h.items)
+	h.items = append(h.items, me)
+}
+
+func (h *entryHeap) Pop() interface{} {
+	old := h.items
+	me := old[len(old)-1]
+	old[len(old)-1] = nil
+	h.items = old[:len(old)-1]
+	me.heapIdx = -1
+	return me
+}
@@ -0,0 +1,49 @@
+package cache
+
+import "github.com/aqstack/mimir/pkg/api"
+
+// exactKey identifies entries in MemoryCache's exact-match index.
+type exactKey struct {
+	namespace string
+	hash      string
+}
+
+// exactKeyFor returns the exact-match key of an entry.
+func exactKeyFor(entry *api.CacheEntry) exactKey {
+	return exactKey{namespace: entry.Namespace, hash: entry.RequestHash}
+}
+
+// applyRequestHash records the hash GetExact matches on, unless the entry
+// already has one (e.g. when loaded from a snapshot). It must run before
+// sanitization, since lookups use the request as received.
+func applyRequestHash(entry *api.CacheEntry) {
+	if entry.RequestHash == "" {
+		entry.RequestHash = api.RequestHash(&entry.Request)
+	}
+}
+
+// Negative entries remember an upstream failure of one exact request. A
+// similar prompt may well succeed, so semantic lookups pass over them and
+// they are found by GetExact alone.
+
+// duplicateOf reports whether Set replaces existing with entry: a negative
+// entry for the same request or, unless DisableDedupOnSet, a response to a
+// nearly identical prompt. Negative entries never replace, nor are
+// replaced by, responses to other prompts.
+func (o *Options) duplicateOf(entry, existing *api.CacheEntry) bool {
+	if existing.Namespace != entry.Namespace {
+		return false
+	}
+	if entry.Negative || existing.Negative {
+		return existing.Negative && existing.RequestHash == entry.RequestHash
+	}
+	return !o.DisableDedupOnSet && sameEmbeddingModel(existing, entry.EmbeddingModel) &&
+		o.Metric.isNearDuplicate(o.Metric.Similarity(entry.Embedding, existing.Embedding))
+}
+
+// shadows reports whether existing holds a response to the request a
+// negative entry remembers failing. Set keeps the response and drops the
+// failure.
+func shadows(existing, entry *api.CacheEntry) bool {
+	return entry.Negative && !existing.Negative && existing.Namespace == entry.Namespace && existing.RequestHash == entry.RequestHash
+}
@@ -0,0 +1,389 @@
+package cache
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// HNSWOptions configures the approximate nearest-neighbor index.
+// The zero value disables the index and Get scans every entry.
+type HNSWOptions struct {
+	// Enabled turns on the index. Lookups use it once the cache holds
+	// MinEntries entries; below that a linear scan is faster and exact.
+	Enabled bool
+	// M is the number of neighbors kept per node on upper layers
+	// (twice this on the bottom layer). Default 16.
+	M int
+	// EfConstruction is the candidate list size used while inserting.
+	// Higher builds a better graph at the cost of slower Set. Default 200.
+	EfConstruction int
+	// EfSearch is the candidate list size used by Get. Higher improves
+	// recall at the cost of latency. Default 64.
+	EfSearch int
+	// MinEntries is the entry count below which lookups scan linearly
+	// instead of searching the index, since scanning a small cache is
+	// faster and exact. The index is kept up to date either way. Default
+	// 4000, where BenchmarkMemoryCacheIndexCrossover puts the crossover;
+	// negative always searches the index.
+	MinEntries int
+}
+
+const (
+	defaultHNSWM              = 16
+	defaultHNSWEfConstruction = 200
+	defaultHNSWEfSearch       = 64
+	defaultHNSWMinEntries     = 4000
+)
+
+// minEntries returns MinEntries with the default applied.
+func (o HNSWOptions) minEntries() int {
+	switch {
+	case o.MinEntries == 0:
+		return defaultHNSWMinEntries
+	case o.MinEntries < 0:
+		return 0
+	}
+	return o.MinEntries
+}
+
+// hnswNode is a vector in the graph.
+type hnswNode struct {
+	vec     []float32
+	value   *memoryEntry
+	level   int
+	friends [][]*hnswNode // neighbors per layer, 0 = bottom
+	deleted bool
+}
+
+// hnswIndex is a hierarchical navigable small world graph
+// (Malkov & Yashunin, 2016) answering top-k similarity queries.
+//
+// Removal only marks nodes deleted: they stay in the graph to keep it
+// connected and are skipped in results. The graph is rebuilt from live
+// nodes once tombstones outnumber them.
+//
+// The index is not safe for concurrent use; search may run concurrently
+// with other searches but not with insert or remove.
+type hnswIndex struct {
+	metric         Metric
+	m              int
+	mMax0          int
+	efConstruction int
+	efSearch       int
+	levelMult      float64
+
+	nodes    []*hnswNode
+	entry    *hnswNode
+	maxLevel int
+	deleted  int
+	rng      *rand.Rand
+}
+
+// newHNSWIndex creates an empty index, applying defaults to unset options.
+func newHNSWIndex(metric Metric, opts HNSWOptions) *hnswIndex {
+	if opts.M <= 1 {
+		opts.M = defaultHNSWM
+	}
+	if opts.EfConstruction <= 0 {
+		opts.EfConstruction = defaultHNSWEfConstruction
+	}
+	if opts.EfSearch <= 0 {
+		opts.EfSearch = defaultHNSWEfSearch
+	}
+	return &hnswIndex{
+		metric:         metric,
+		m:              opts.M,
+		mMax0:          2 * opts.M,
+		efConstruction: opts.EfConstruction,
+		efSearch:       opts.EfSearch,
+		levelMult:      1 / math.Log(float64(opts.M)),
+		rng:            rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+// len returns the number of live nodes.
+func (h *hnswIndex) len() int {
+	return len(h.nodes) - h.deleted
+}
+
+// insert adds a vector to the index and returns its node.
+func (h *hnswIndex) insert(vec []float32, value *memoryEntry) *hnswNode {
+	level := int(math.Floor(-math.Log(1-h.rng.Float64()) * h.levelMult))
+	n := &hnswNode{
+		vec:     vec,
+		value:   value,
+		level:   level,
+		friends: make([][]*hnswNode, level+1),
+	}
+	h.nodes = append(h.nodes, n)
+	h.link(n)
+	return n
+}
+
+// link connects n into the graph.
+func (h *hnswIndex) link(n *hnswNode) {
+	if h.entry == nil {
+		h.entry = n
+		h.maxLevel = n.level
+		return
+	}
+
+	// Greedy descent through layers above the node's level
+	ep := h.entry
+	epSim := h.metric.Similarity32(n.vec, ep.vec)
+	for l := h.maxLevel; l > n.level; l-- {
+		ep, epSim = h.greedyClosest(n.vec, ep, epSim, l)
+	}
+
+	top := n.level
+	if top > h.maxLevel {
+		top = h.maxLevel
+	}
+	eps := []candidate{{ep, epSim}}
+	for l := top; l >= 0; l-- {
+		found := h.searchLayer(n.vec, eps, h.efConstruction, l)
+		neighbors := h.selectNeighbors(found, h.m)
+		n.friends[l] = make([]*hnswNode, 0, len(neighbors))
+		for _, c := range neighbors {
+			n.friends[l] = append(n.friends[l], c.node)
+			h.addFriend(c.node, n, l)
+		}
+		eps = found
+	}
+
+	if n.level > h.maxLevel {
+		h.entry = n
+		h.maxLevel = n.level
+	}
+}
+
+// addFriend adds n to node's neighbor list on layer l, pruning the list
+// back to capacity if needed.
+func (h *hnswIndex) addFriend(node, n *hnswNode, l int) {
+	maxFriends := h.m
+	if l == 0 {
+		maxFriends = h.mMax0
+	}
+
+	node.friends[l] = append(node.friends[l], n)
+	if len(node.friends[l]) <= maxFriends {
+		return
+	}
+
+	cands := make([]candidate, len(node.friends[l]))
+	for i, f := range node.friends[l] {
+		cands[i] = candidate{f, h.metric.Similarity32(node.vec, f.vec)}
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].sim > cands[j].sim })
+
+	kept := h.selectNeighbors(cands, maxFriends)
+	node.friends[l] = node.friends[l][:0]
+	for _, c := range kept {
+		node.friends[l] = append(node.friends[l], c.node)
+	}
+}
+
+// selectNeighbors picks up to m neighbors from candidates sorted by
+// descending similarity, preferring candidates that are closer to the base
+// than to any already selected neighbor so the graph spans clusters.
+// Remaining slots are filled with the closest skipped candidates.
+func (h *hnswIndex) selectNeighbors(cands []candidate, m int) []candidate {
+	if len(cands) <= m {
+		return cands
+	}
+
+	selected := make([]candidate, 0, m)
+	var skipped []candidate
+	for _, c := range cands {
+		if len(selected) >= m {
+			break
+		}
+		good := true
+		for _, s := range selected {
+			if h.metric.Similarity32(c.node.vec, s.node.vec) > c.sim {
+				good = false
+				break
+			}
+		}
+		if good {
+			selected = append(selected, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+	for _, c := range skipped {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+// greedyClosest walks layer l from ep towards the node most similar to q.
+func (h *hnswIndex) greedyClosest(q []float32, ep *hnswNode, epSim float64, l int) (*hnswNode, float64) {
+	for changed := true; changed; {
+		changed = false
+		for _, f := range ep.friends[l] {
+			if sim := h.metric.Similarity32(q, f.vec); sim > epSim {
+				ep, epSim, changed = f, sim, true
+			}
+		}
+	}
+	return ep, epSim
+}
+
+// searchLayer returns up to ef nodes on layer l most similar to q,
+// sorted by descending similarity. Deleted nodes are included.
+func (h *hnswIndex) searchLayer(q []float32, eps []candidate, ef, l int) []candidate {
+	visited := make(map[*hnswNode]struct{}, ef*4)
+	frontier := &candidateHeap{max: true}
+	results := &candidateHeap{}
+
+	for _, ep := range eps {
+		visited[ep.node] = struct{}{}
+		heap.Push(frontier, ep)
+		heap.Push(results, ep)
+		if results.Len() > ef {
+			heap.Pop(results)
+		}
+	}
+
+	for frontier.Len() > 0 {
+		c := heap.Pop(frontier).(candidate)
+		if results.Len() >= ef && c.sim < results.items[0].sim {
+			break
+		}
+		for _, f := range c.node.friends[l] {
+			if _, ok := visited[f]; ok {
+				continue
+			}
+			visited[f] = struct{}{}
+
+			sim := h.metric.Similarity32(q, f.vec)
+			if results.Len() < ef || sim > results.items[0].sim {
+				heap.Push(frontier, candidate{f, sim})
+				heap.Push(results, candidate{f, sim})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	out := results.items
+	sort.Slice(out, func(i, j int) bool { return out[i].sim > out[j].sim })
+	return out
+}
+
+// search returns up to k live nodes most similar to q, sorted by
+// descending similarity.
+func (h *hnswIndex) search(q []float32, k int) []candidate {
+	if h.entry == nil || k <= 0 {
+		return nil
+	}
+
+	ep := h.entry
+	epSim := h.metric.Similarity32(q, ep.vec)
+	for l := h.maxLevel; l > 0; l-- {
+		ep, epSim = h.greedyClosest(q, ep, epSim, l)
+	}
+
+	ef := h.efSearch
+	if k > ef {
+		ef = k
+	}
+	found := h.searchLayer(q, []candidate{{ep, epSim}}, ef, 0)
+	results := make([]candidate, 0, k)
+	for _, c := range found {
+		if c.node.deleted {
+			continue
+		}
+		results = append(results, c)
+		if len(results) == k {
+			break
+		}
+	}
+	return results
+}
+
+// remove marks n deleted, rebuilding the graph once most nodes are deleted.
+func (h *hnswIndex) remove(n *hnswNode) {
+	if n.deleted {
+		return
+	}
+	n.deleted = true
+	n.value = nil
+	h.deleted++
+
+	if h.deleted > len(h.nodes)/2 {
+		h.rebuild()
+	}
+}
+
+// rebuild re-links all live nodes into a fresh graph. Node pointers held
+// by callers stay valid.
+func (h *hnswIndex) rebuild() {
+	live := make([]*hnswNode, 0, h.len())
+	for _, n := range h.nodes {
+		if !n.deleted {
+			live = append(live, n)
+		}
+	}
+
+	h.nodes = live
+	h.entry = nil
+	h.maxLevel = 0
+	h.deleted = 0
+	for _, n := range live {
+		for l := range n.friends {
+			n.friends[l] = nil
+		}
+	}
+	for _, n := range live {
+		h.link(n)
+	}
+}
+
+// reset removes all nodes.
+func (h *hnswIndex) reset() {
+	h.nodes = nil
+	h.entry = nil
+	h.maxLevel = 0
+	h.deleted = 0
+}
+
+// candidate is a node paired with its similarity to a query.
+type candidate struct {
+	node *hnswNode
+	sim  float64
+}
+
+// candidateHeap is a heap of candidates ordered by similarity: the least
+// similar on top by default, the most similar when max is set.
+type candidateHeap struct {
+	items []candidate
+	max   bool
+}
+
+func (h *candidateHeap) Len() int { return len(h.items) }
+
+func (h *candidateHeap) Less(i, j int) bool {
+	if h.max {
+		return h.items[i].sim > h.items[j].sim
+	}
+	return h.items[i].sim < h.items[j].sim
+}
+
+func (h *candidateHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *candidateHeap) Push(x interface{}) { h.items = append(h.items, x.(candidate)) }
+
+func (h *candidateHeap) Pop() interface{} {
+	old := h.items
+	c := old[len(old)-1]
+	h.items = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,321 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func randomVectors(rng *rand.Rand, n, dim int) [][]float64 {
+	vecs := make([][]float64, n)
+	for i := range vecs {
+		v := make([]float64, dim)
+		for j := range v {
+			v[j] = rng.NormFloat64()
+		}
+		vecs[i] = v
+	}
+	return vecs
+}
+
+// linearTop1 returns the index of the vector most similar to q.
+func linearTop1(vecs [][]float64, q []float64) int {
+	best, bestSim := -1, -2.0
+	for i, v := range vecs {
+		if sim := CosineSimilarity(q, v); sim > bestSim {
+			best, bestSim = i, sim
+		}
+	}
+	return best
+}
+
+func TestHNSWRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	vecs := randomVectors(rng, 2000, 32)
+	queries := randomVectors(rng, 100, 32)
+
+	index := newHNSWIndex(MetricCosine, HNSWOptions{})
+	values := make(map[*hnswNode]int, len(vecs))
+	for i, v := range vecs {
+		values[index.insert(toFloat32(v), nil)] = i
+	}
+
+	hits := 0
+	for _, q := range queries {
+		results := index.search(toFloat32(q), 1)
+		if len(results) == 1 && values[results[0].node] == linearTop1(vecs, q) {
+			hits++
+		}
+	}
+
+	if recall := float64(hits) / float64(len(queries)); recall < 0.95 {
+		t.Errorf("expected recall@1 >= 0.95, got %.2f", recall)
+	}
+}
+
+func TestHNSWSearchOrder(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	index := newHNSWIndex(MetricCosine, HNSWOptions{M: 4, EfConstruction: 20, EfSearch: 20})
+	for _, v := range randomVectors(rng, 200, 8) {
+		index.insert(toFloat32(v), nil)
+	}
+
+	results := index.search(toFloat32(randomVectors(rng, 1, 8)[0]), 10)
+	if len(results) != 10 {
+		t.Fatalf("expected 10 results, got %d", len(results))
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].sim > results[i-1].sim {
+			t.Fatal("expected results sorted by descending similarity")
+		}
+	}
+}
+
+func TestHNSWRemove(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	index := newHNSWIndex(MetricCosine, HNSWOptions{})
+	vecs := randomVectors(rng, 100, 8)
+	nodes := make([]*hnswNode, len(vecs))
+	for i, v := range vecs {
+		nodes[i] = index.insert(toFloat32(v), nil)
+	}
+
+	// Removed nodes are never returned, even for an exact query
+	index.remove(nodes[0])
+	for _, c := range index.search(toFloat32(vecs[0]), 5) {
+		if c.node == nodes[0] {
+			t.Fatal("expected removed node to be excluded from results")
+		}
+	}
+
+	// Removing most nodes triggers a rebuild that keeps survivors reachable
+	for _, n := range nodes[1:80] {
+		index.remove(n)
+	}
+	if index.len() != 20 {
+		t.Errorf("expected 20 live nodes, got %d", index.len())
+	}
+	if len(index.nodes) >= 100 {
+		t.Errorf("expected tombstones to be dropped by rebuild, got %d nodes", len(index.nodes))
+	}
+	for i := 80; i < 100; i++ {
+		results := index.search(toFloat32(vecs[i]), 1)
+		if len(results) != 1 || results[0].node != nodes[i] {
+			t.Errorf("expected survivor %d to be found after rebuild", i)
+		}
+	}
+}
+
+func TestMemoryCacheHNSW(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(&Options{
+		MaxSize:         3,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		HNSW:            HNSWOptions{Enabled: true, MinEntries: -1},
+	})
+
+	cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour))
+	cache.Set(ctx, newTestEntry([]float64{0, 1, 0}, time.Hour))
+	expired := newTestEntry([]float64{0, 0, 1}, time.Hour)
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	cache.Set(ctx, expired)
+
+	if _, sim, found := cache.Get(ctx, []float64{0.99, 0.1, 0}, 0.9); !found || sim < 0.99 {
+		t.Errorf("expected hit via index, got found=%v sim=%f", found, sim)
+	}
+	if _, _, found := cache.Get(ctx, []float64{0, 0, 1}, 0.9); found {
+		t.Error("expected expired entry to be skipped")
+	}
+
+	// Near-duplicate updates in place through the index
+	cache.Set(ctx, newTestEntry([]float64{0.999, 0.01, 0}, time.Hour))
+	if size := cache.Size(ctx); size != 3 {
+		t.Errorf("expected near-duplicate to update in place, got size %d", size)
+	}
+
+	// Eviction removes the entry from the index
+	cache.Set(ctx, newTestEntry([]float64{1, 1, 0}, time.Hour))
+	if _, _, found := cache.Get(ctx, []float64{0, 1, 0}, 0.99); found {
+		t.Error("expected evicted entry to be gone from the index")
+	}
+
+	if err := cache.DeleteByEmbedding(ctx, []float64{0.999, 0.01, 0}); err != nil {
+		t.Fatalf("DeleteByEmbedding failed: %v", err)
+	}
+	if _, _, found := cache.Get(ctx, []float64{1, 0, 0}, 0.99); found {
+		t.Error("expected deleted entry to be gone from the index")
+	}
+}
+
+// The 100k-entry benchmarks share one dataset and index; building it takes
+// a while, so run them explicitly:
+//
+//	go test ./internal/cache -run '^$' -bench 'Search100k'
+const (
+	benchEntries = 100000
+	benchDim     = 64
+	benchQueries = 200
+)
+
+var (
+	benchOnce    sync.Once
+	benchVecs    [][]float64
+	benchQueryVs [][]float64
+	benchTruth   []int
+	benchIndex   *hnswIndex
+	benchNodeIdx map[*hnswNode]int
+)
+
+func setupSearchBenchmark(b *testing.B) {
+	benchOnce.Do(func() {
+		rng := rand.New(rand.NewSource(42))
+		benchVecs = randomVectors(rng, benchEntries, benchDim)
+		// Cache lookups that matter are close to a stored entry, so query
+		// with perturbed copies of random entries.
+		benchQueryVs = make([][]float64, benchQueries)
+		for i := range benchQueryVs {
+			src := benchVecs[rng.Intn(benchEntries)]
+			q := make([]float64, benchDim)
+			for j := range q {
+				q[j] = src[j] + 0.3*rng.NormFloat64()
+			}
+			benchQueryVs[i] = q
+		}
+
+		benchTruth = make([]int, len(benchQueryVs))
+		for i, q := range benchQueryVs {
+			benchTruth[i] = linearTop1(benchVecs, q)
+		}
+
+		benchIndex = newHNSWIndex(MetricCosine, HNSWOptions{})
+		benchNodeIdx = make(map[*hnswNode]int, benchEntries)
+		for i, v := range benchVecs {
+			benchNodeIdx[benchIndex.insert(toFloat32(v), nil)] = i
+		}
+	})
+	b.ResetTimer()
+}
+
+func BenchmarkSearch100kLinear(b *testing.B) {
+	setupSearchBenchmark(b)
+	for i := 0; i < b.N; i++ {
+		linearTop1(benchVecs, benchQueryVs[i%benchQueries])
+	}
+	b.ReportMetric(1, "recall@1")
+}
+
+func BenchmarkSearch100kHNSW(b *testing.B) {
+	setupSearchBenchmark(b)
+	hits := 0
+	for i := 0; i < b.N; i++ {
+		q := i % benchQueries
+		if r := benchIndex.search(toFloat32(benchQueryVs[q]), 1); len(r) == 1 && benchNodeIdx[r[0].node] == benchTruth[q] {
+			hits++
+		}
+	}
+	b.ReportMetric(float64(hits)/float64(b.N), "recall@1")
+}
+
+func TestMemoryCacheIndexCrossover(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		minEntries int
+		wantBelow  bool // indexed with 2 entries
+		wantAt     bool // indexed with 3 entries
+	}{
+		{minEntries: 3, wantBelow: false, wantAt: true},
+		{minEntries: -1, wantBelow: true, wantAt: true},
+		{minEntries: 0, wantBelow: false, wantAt: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("min=%d", tt.minEntries), func(t *testing.T) {
+			c := NewMemoryCache(&Options{
+				MaxSize:         10,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+				HNSW:            HNSWOptions{Enabled: true, MinEntries: tt.minEntries},
+			})
+			defer c.Close()
+
+			c.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour))
+			c.Set(ctx, newTestEntry([]float64{0, 1, 0}, time.Hour))
+			if got := c.indexed(); got != tt.wantBelow {
+				t.Errorf("expected indexed=%v with 2 entries, got %v", tt.wantBelow, got)
+			}
+			c.Set(ctx, newTestEntry([]float64{0, 0, 1}, time.Hour))
+			if got := c.indexed(); got != tt.wantAt {
+				t.Errorf("expected indexed=%v with 3 entries, got %v", tt.wantAt, got)
+			}
+			// Both paths find the same entry
+			if _, sim, found := c.Get(ctx, []float64{0.99, 0.1, 0}, 0.9); !found || sim < 0.99 {
+				t.Errorf("expected hit, got found=%v sim=%f", found, sim)
+			}
+		})
+	}
+}
+
+// BenchmarkMemoryCacheIndexCrossover compares Get by linear scan and by
+// HNSW index as a cache grows, to place HNSWOptions.MinEntries. One cache
+// is filled in stages and queried both ways at each size; building the
+// 100k-entry index takes a while, so run it explicitly:
+//
+//	go test ./internal/cache -run '^$' -bench 'IndexCrossover' -benchtime 2000x
+//
+// The scan wins below a few thousand entries (8µs against 67µs at 100,
+// 71µs against 164µs at 1k) and loses beyond (842µs against 347µs at 10k,
+// 19ms against 0.9ms at 100k); runs at intermediate sizes put the
+// crossover between 3k and 4k.
+func BenchmarkMemoryCacheIndexCrossover(b *testing.B) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(42))
+	opts := &Options{
+		MaxSize:           benchEntries,
+		DefaultTTL:        time.Hour,
+		CleanupInterval:   time.Hour,
+		Metric:            MetricCosine,
+		DisableDedupOnSet: true,
+		HNSW:              HNSWOptions{Enabled: true},
+	}
+	c := NewMemoryCache(opts)
+	defer c.Close()
+
+	var vecs [][]float64
+	for _, size := range []int{100, 1000, 10000, 100000} {
+		for len(vecs) < size {
+			v := randomVectors(rng, 1, benchDim)[0]
+			vecs = append(vecs, v)
+			entry := newTestEntry(v, time.Hour)
+			entry.Request.Messages[0].Content = fmt.Sprint(len(vecs))
+			c.Set(ctx, entry)
+		}
+		queries := make([][]float64, benchQueries)
+		for i := range queries {
+			src := vecs[rng.Intn(len(vecs))]
+			q := make([]float64, benchDim)
+			for j := range q {
+				q[j] = src[j] + 0.3*rng.NormFloat64()
+			}
+			queries[i] = q
+		}
+
+		for _, mode := range []struct {
+			name       string
+			minEntries int
+		}{
+			{"scan", size + 1},
+			{"hnsw", -1},
+		} {
+			b.Run(fmt.Sprintf("%d/%s", size, mode.name), func(b *testing.B) {
+				opts.HNSW.MinEntries = mode.minEntries
+				for i := 0; i < b.N; i++ {
+					c.Get(ctx, queries[i%len(queries)], 0.5)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package cache
+
+import "github.com/aqstack/mimir/pkg/api"
+
+// onHit logs a hit and invokes Options.OnHit if set. Callers must not
+// hold the cache lock.
+func (o *Options) onHit(entry *api.CacheEntry, similarity float64) {
+	o.logHit(entry, similarity)
+	if o.OnHit != nil {
+		o.OnHit(entry, similarity)
+	}
+}
+
+// onMiss logs a miss and invokes Options.OnMiss if set. Callers must not
+// hold the cache lock.
+func (o *Options) onMiss(embedding []float64) {
+	o.logMiss()
+	if o.OnMiss != nil {
+		o.OnMiss(embedding)
+	}
+}
+
+// onSet invokes Options.OnSet if set. Callers must not hold the cache lock.
+func (o *Options) onSet(entry *api.CacheEntry) {
+	if o.OnSet != nil {
+		o.OnSet(entry)
+	}
+}
+
+// onEvict invokes Options.OnEvict for each entry in turn. Callers must
+// not hold the cache lock.
+func (o *Options) onEvict(entries []*api.CacheEntry) {
+	if o.OnEvict == nil {
+		return
+	}
+	for _, entry := range entries {
+		o.OnEvict(entry)
+	}
+}
+
+// Shadow invokes Options.OnShadow if set, for serving layers running in
+// ShadowMode.
+func (o *Options) Shadow(hit *api.CacheEntry, similarity float64, live *api.ChatCompletionResponse) {
+	if o.OnShadow != nil {
+		o.OnShadow(hit, similarity, live)
+	}
+}
+
+// ResponsesMatch reports whether two responses say the same thing: the
+// same number of choices, each with the same text and tool calls. IDs,
+// timestamps and usage are ignored.
+func ResponsesMatch(a, b *api.ChatCompletionResponse) bool {
+	if len(a.Choices) != len(b.Choices) {
+		return false
+	}
+	for i := range a.Choices {
+		ma, mb := a.Choices[i].Message, b.Choices[i].Message
+		if api.MessageText(ma) != api.MessageText(mb) || len(ma.ToolCalls) != len(mb.ToolCalls) {
+			return false
+		}
+		for j := range ma.ToolCalls {
+			if ma.ToolCalls[j].Function != mb.ToolCalls[j].Function {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// Truncation selects which part of an embedding input longer than
+// Options.MaxInputChars is kept.
+type Truncation int
+
+const (
+	// TruncateTail keeps the end of the input, where the latest turn of
+	// a conversation is.
+	TruncateTail Truncation = iota
+	// TruncateHead keeps the start of the input, e.g. a system prompt that
+	// distinguishes otherwise similar requests.
+	TruncateHead
+	// TruncateMiddle keeps the start and end in equal parts and drops the
+	// middle.
+	TruncateMiddle
+)
+
+// String returns the strategy name.
+func (t Truncation) String() string {
+	switch t {
+	case TruncateTail:
+		return "tail"
+	case TruncateHead:
+		return "head"
+	case TruncateMiddle:
+		return "middle"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseTruncation returns the strategy with the given name. The empty
+// string is TruncateTail.
+func ParseTruncation(name string) (Truncation, error) {
+	switch name {
+	case "", "tail":
+		return TruncateTail, nil
+	case "head":
+		return TruncateHead, nil
+	case "middle":
+		return TruncateMiddle, nil
+	default:
+		return 0, fmt.Errorf("unknown truncation %q", name)
+	}
+}
+
+// Conversation selects how the messages of a multi-turn request make up
+// its embedding input.
+type Conversation int
+
+const (
+	// ConversationFull embeds all messages concatenated.
+	ConversationFull Conversation = iota
+	// ConversationLast embeds only the last message, so conversations
+	// that end in the same question match whatever led up to it.
+	ConversationLast
+	// ConversationWeighted embeds each message separately and averages
+	// the embeddings, weighting recent messages higher by TurnDecay.
+	ConversationWeighted
+)
+
+// String returns the strategy name.
+func (c Conversation) String() string {
+	switch c {
+	case ConversationFull:
+		return "full"
+	case ConversationLast:
+		return "last"
+	case ConversationWeighted:
+		return "weighted"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseConversation returns the strategy with the given name. The empty
+// string is ConversationFull.
+func ParseConversation(name string) (Conversation, error) {
+	switch name {
+	case "", "full":
+		return ConversationFull, nil
+	case "last":
+		return ConversationLast, nil
+	case "weighted":
+		return ConversationWeighted, nil
+	default:
+		return 0, fmt.Errorf("unknown conversation input %q", name)
+	}
+}
+
+// defaultTurnDecay is the weight of a message relative to the one after
+// it when Options.TurnDecay is unset.
+const defaultTurnDecay = 0.5
+
+// EmbeddingInput builds the text embedded for a cache lookup, like
+// api.RequestEmbeddingInput but with StripPrefixes removed from each
+// message, so shared boilerplate doesn't dominate similarity. Messages
+// left empty are dropped; if nothing remains, the full input is used.
+// With ConversationLast only the last message is kept. The result is cut
+// to MaxInputChars as selected by Truncation.
+//
+// With ConversationWeighted the messages are embedded as returned by
+// EmbeddingTurns instead; EmbeddingInput still describes the request in
+// logs and reports.
+func (o *Options) EmbeddingInput(req *api.ChatCompletionRequest) string {
+	turns := o.inputTurns(req)
+	if o.Conversation == ConversationLast && len(turns) > 0 {
+		turns = turns[len(turns)-1:]
+	}
+	return o.truncateInput(strings.Join(turns, ""))
+}
+
+// EmbeddingTurns returns the messages of req to embed one by one and
+// merge with CombineTurns, each prepared like EmbeddingInput. It returns
+// nil unless Conversation is ConversationWeighted and req has more than
+// one message, in which case EmbeddingInput is embedded whole.
+func (o *Options) EmbeddingTurns(req *api.ChatCompletionRequest) []string {
+	if o.Conversation != ConversationWeighted {
+		return nil
+	}
+	turns := o.inputTurns(req)
+	if len(turns) < 2 {
+		return nil
+	}
+	for i, turn := range turns {
+		turns[i] = o.truncateInput(turn)
+	}
+	return turns
+}
+
+// CombineTurns merges the embeddings of the turns returned by
+// EmbeddingTurns into one: the average of their normalized vectors, each
+// weighted TurnDecay times the one after it, so the latest message
+// weighs most.
+func (o *Options) CombineTurns(embeddings [][]float64) []float64 {
+	if len(embeddings) == 0 {
+		return nil
+	}
+	decay := o.TurnDecay
+	if decay <= 0 {
+		decay = defaultTurnDecay
+	}
+
+	combined := make([]float64, len(embeddings[0]))
+	weight, total := 1.0, 0.0
+	for i := len(embeddings) - 1; i >= 0; i-- {
+		emb := embeddings[i]
+		var norm float64
+		for _, v := range emb {
+			norm += v * v
+		}
+		if norm == 0 || len(emb) != len(combined) {
+			weight *= decay
+			continue
+		}
+		scale := weight / math.Sqrt(norm)
+		for j, v := range emb {
+			combined[j] += v * scale
+		}
+		total += weight
+		weight *= decay
+	}
+	if total == 0 {
+		return combined
+	}
+	for j := range combined {
+		combined[j] /= total
+	}
+	return combined
+}
+
+// inputTurns returns the "role: text" line of each message, with
+// StripPrefixes removed and messages left empty dropped. If nothing
+// remains, the unstripped lines are returned.
+func (o *Options) inputTurns(req *api.ChatCompletionRequest) []string {
+	var turns []string
+	if len(o.StripPrefixes) > 0 {
+		for _, msg := range req.Messages {
+			if text := o.stripPrefixes(api.MessageText(msg)); text != "" {
+				turns = append(turns, inputLine(msg.Role, text))
+			}
+		}
+	}
+	if len(turns) == 0 {
+		for _, msg := range req.Messages {
+			turns = append(turns, inputLine(msg.Role, api.MessageText(msg)))
+		}
+	}
+	return turns
+}
+
+// inputLine formats a message as api.RequestEmbeddingInput does.
+func inputLine(role, text string) string {
+	return role + ": " + text + "\n"
+}
+
+// truncateInput cuts text to MaxInputChars characters, keeping the part
+// selected by Truncation. Prompts past the embedding model's context
+// window would otherwise fail to embed or be cut by the model in ways
+// that vary between providers.
+func (o *Options) truncateInput(text string) string {
+	if o.MaxInputChars <= 0 || len(text) <= o.MaxInputChars {
+		return text
+	}
+	runes := []rune(text)
+	n := o.MaxInputChars
+	if len(runes) <= n {
+		return text
+	}
+
+	switch o.Truncation {
+	case TruncateHead:
+		return string(runes[:n])
+	case TruncateMiddle:
+		head := (n + 1) / 2
+		return string(runes[:head]) + string(runes[len(runes)-(n-head):])
+	default:
+		return string(runes[len(runes)-n:])
+	}
+}
+
+// stripPrefixes removes each matching prefix in turn, along with the
+// whitespace around the remaining text.
+func (o *Options) stripPrefixes(text string) string {
+	for _, prefix := range o.StripPrefixes {
+		if prefix != "" && strings.HasPrefix(text, prefix) {
+			text = strings.TrimSpace(text[len(prefix):])
+		}
+	}
+	return text
+}
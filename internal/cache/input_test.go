@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+func TestEmbeddingInput(t *testing.T) {
+	preamble := "You are a helpful assistant for Acme Corp. Answer politely."
+	opts := &Options{StripPrefixes: []string{preamble, "Question:"}}
+
+	tests := []struct {
+		name     string
+		messages []api.Message
+		expected string
+	}{
+		{
+			name: "strips system preamble",
+			messages: []api.Message{
+				{Role: "system", Content: preamble},
+				{Role: "user", Content: "Question: what are your hours?"},
+			},
+			expected: "user: what are your hours?\n",
+		},
+		{
+			name: "keeps text after preamble",
+			messages: []api.Message{
+				{Role: "system", Content: preamble + "\nToday is Monday."},
+				{Role: "user", Content: "hi"},
+			},
+			expected: "system: Today is Monday.\nuser: hi\n",
+		},
+		{
+			name: "prefix only in the middle",
+			messages: []api.Message{
+				{Role: "user", Content: "My Question: why?"},
+			},
+			expected: "user: My Question: why?\n",
+		},
+		{
+			name: "falls back when everything is stripped",
+			messages: []api.Message{
+				{Role: "system", Content: preamble},
+				{Role: "user", Content: "Question:"},
+			},
+			expected: "system: " + preamble + "\nuser: Question:\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &api.ChatCompletionRequest{Messages: tt.messages}
+			if got := opts.EmbeddingInput(req); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("no prefixes", func(t *testing.T) {
+		req := &api.ChatCompletionRequest{Messages: []api.Message{{Role: "system", Content: preamble}}}
+		if got, want := (&Options{}).EmbeddingInput(req), api.RequestEmbeddingInput(req); got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	})
+}
+
+func TestTruncateInput(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxChars   int
+		truncation Truncation
+		input      string
+		expected   string
+	}{
+		{"disabled", 0, TruncateTail, "abcdefghij", "abcdefghij"},
+		{"short input kept", 20, TruncateHead, "abcdefghij", "abcdefghij"},
+		{"tail", 4, TruncateTail, "abcdefghij", "ghij"},
+		{"head", 4, TruncateHead, "abcdefghij", "abcd"},
+		{"middle", 5, TruncateMiddle, "abcdefghij", "abcij"},
+		{"counts characters not bytes", 3, TruncateHead, "héllo wörld", "hél"},
+		{"multi-byte within limit", 5, TruncateTail, "héllo", "héllo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &Options{MaxInputChars: tt.maxChars, Truncation: tt.truncation}
+			if got := opts.truncateInput(tt.input); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEmbeddingInputTruncates(t *testing.T) {
+	long := strings.Repeat("context ", 100)
+	req := &api.ChatCompletionRequest{Messages: []api.Message{
+		{Role: "system", Content: long},
+		{Role: "user", Content: "what changed?"},
+	}}
+	opts := &Options{MaxInputChars: 32}
+
+	got := opts.EmbeddingInput(req)
+	if len([]rune(got)) != 32 || !strings.HasSuffix(got, "user: what changed?\n") {
+		t.Errorf("expected the last 32 characters ending with the user turn, got %q", got)
+	}
+}
+
+func TestParseTruncation(t *testing.T) {
+	for _, tr := range []Truncation{TruncateTail, TruncateHead, TruncateMiddle} {
+		got, err := ParseTruncation(tr.String())
+		if err != nil || got != tr {
+			t.Errorf("expected %v to round-trip, got %v (%v)", tr, got, err)
+		}
+	}
+	if _, err := ParseTruncation("sideways"); err == nil {
+		t.Error("expected error for unknown truncation")
+	}
+}
+
+func TestConversationInput(t *testing.T) {
+	req := &api.ChatCompletionRequest{Messages: []api.Message{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "What is Go?"},
+		{Role: "assistant", Content: "A language."},
+		{Role: "user", Content: "Who made it?"},
+	}}
+
+	tests := []struct {
+		name         string
+		conversation Conversation
+		input        string
+		turns        int
+	}{
+		{
+			name:         "full",
+			conversation: ConversationFull,
+			input:        api.RequestEmbeddingInput(req),
+		},
+		{
+			name:         "last",
+			conversation: ConversationLast,
+			input:        "user: Who made it?\n",
+		},
+		{
+			name:         "weighted",
+			conversation: ConversationWeighted,
+			input:        api.RequestEmbeddingInput(req),
+			turns:        4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &Options{Conversation: tt.conversation}
+			if got := opts.EmbeddingInput(req); got != tt.input {
+				t.Errorf("expected input %q, got %q", tt.input, got)
+			}
+			if got := opts.EmbeddingTurns(req); len(got) != tt.turns {
+				t.Errorf("expected %d turns, got %d", tt.turns, len(got))
+			}
+		})
+	}
+}
+
+func TestCombineTurns(t *testing.T) {
+	opts := &Options{TurnDecay: 0.5}
+	got := opts.CombineTurns([][]float64{{2, 0}, {0, 3}})
+
+	// The last turn weighs twice the first
+	want := []float64{1.0 / 3, 2.0 / 3}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestParseConversation(t *testing.T) {
+	for _, c := range []Conversation{ConversationFull, ConversationLast, ConversationWeighted} {
+		got, err := ParseConversation(c.String())
+		if err != nil || got != c {
+			t.Errorf("ParseConversation(%q) = %v, %v", c.String(), got, err)
+		}
+	}
+	if got, err := ParseConversation(""); err != nil || got != ConversationFull {
+		t.Errorf("expected empty name to be full, got %v, %v", got, err)
+	}
+	if _, err := ParseConversation("first"); err == nil {
+		t.Error("expected error for unknown conversation input")
+	}
+}
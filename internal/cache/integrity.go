@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// ErrChecksumMismatch is returned when a stored entry's content no longer
+// matches the checksum recorded when it was written.
+var ErrChecksumMismatch = errors.New("entry checksum mismatch")
+
+// applyChecksum records the entry's content checksum when
+// Options.VerifyIntegrity is set. It runs after every step of Set that
+// changes the request or response.
+func (o *Options) applyChecksum(entry *api.CacheEntry) {
+	if o.VerifyIntegrity {
+		entry.Checksum = entry.ContentChecksum()
+	}
+}
+
+// intact reports whether a loaded entry matches its checksum. Entries
+// without one, written before VerifyIntegrity was enabled, are trusted.
+func (o *Options) intact(entry *api.CacheEntry) bool {
+	return !o.VerifyIntegrity || validChecksum(entry)
+}
+
+// validChecksum reports whether entry has no checksum or matches it.
+func validChecksum(entry *api.CacheEntry) bool {
+	return entry.Checksum == "" || entry.Checksum == entry.ContentChecksum()
+}
+
+// logCorrupt logs the removal of an entry that failed verification at warn
+// level, since it points at a storage or serialization fault.
+func (o *Options) logCorrupt(ctx context.Context, id string) {
+	if o.logEnabled(ctx, slog.LevelWarn) {
+		o.Logger.LogAttrs(ctx, slog.LevelWarn, "corrupt cache entry removed", slog.String("id", id))
+	}
+}
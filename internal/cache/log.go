@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// logEnabled reports whether Options.Logger emits records at level, so
+// callers only build attributes that will be written.
+func (o *Options) logEnabled(ctx context.Context, level slog.Level) bool {
+	return o.Logger != nil && o.Logger.Enabled(ctx, level)
+}
+
+// logHit logs a hit at debug level.
+func (o *Options) logHit(entry *api.CacheEntry, similarity float64) {
+	ctx := context.Background()
+	if o.logEnabled(ctx, slog.LevelDebug) {
+		o.Logger.LogAttrs(ctx, slog.LevelDebug, "cache hit",
+			slog.String("id", entry.ID),
+			slog.Float64("similarity", similarity),
+			slog.String("model", entry.Request.Model))
+	}
+}
+
+// logMiss logs a miss at debug level.
+func (o *Options) logMiss() {
+	ctx := context.Background()
+	if o.logEnabled(ctx, slog.LevelDebug) {
+		o.Logger.LogAttrs(ctx, slog.LevelDebug, "cache miss")
+	}
+}
+
+// logEviction logs the eviction of the entry with the given ID at debug
+// level.
+func (o *Options) logEviction(ctx context.Context, id string) {
+	if o.logEnabled(ctx, slog.LevelDebug) {
+		o.Logger.LogAttrs(ctx, slog.LevelDebug, "cache entry evicted", slog.String("id", id))
+	}
+}
+
+// logCleanup logs the number of expired entries a cleanup removed at info
+// level, if any.
+func (o *Options) logCleanup(ctx context.Context, removed int) {
+	if removed > 0 && o.logEnabled(ctx, slog.LevelInfo) {
+		o.Logger.LogAttrs(ctx, slog.LevelInfo, "expired cache entries removed", slog.Int("count", removed))
+	}
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheLogger(t *testing.T) {
+	tests := []struct {
+		name  string
+		level slog.Level
+		want  []string
+		skip  []string
+	}{
+		{
+			name:  "debug",
+			level: slog.LevelDebug,
+			want:  []string{"msg=\"cache hit\"", "similarity=1", "msg=\"cache miss\"", "msg=\"cache entry evicted\"", "msg=\"expired cache entries removed\" count=1"},
+		},
+		{
+			name:  "info",
+			level: slog.LevelInfo,
+			want:  []string{"msg=\"expired cache entries removed\" count=1"},
+			skip:  []string{"cache hit", "cache miss", "evicted"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			ctx := context.Background()
+			cache := NewMemoryCache(&Options{
+				MaxSize:         1,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+				Logger:          slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: tt.level})),
+			})
+			defer cache.Close()
+
+			if err := cache.Set(ctx, newTestEntry([]float64{1, 0}, time.Hour)); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			cache.Get(ctx, []float64{1, 0}, 0.9)
+			cache.Get(ctx, []float64{0, 1}, 0.9)
+
+			// Evicts the first entry, then expires
+			expiring := newTestEntry([]float64{0, 1}, time.Hour)
+			expiring.Request.Messages[0].Content = "other"
+			expiring.ExpiresAt = time.Now().Add(-time.Second)
+			if err := cache.Set(ctx, expiring); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			cache.Cleanup(ctx)
+
+			out := buf.String()
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected log to contain %q, got:\n%s", want, out)
+				}
+			}
+			for _, skip := range tt.skip {
+				if strings.Contains(out, skip) {
+					t.Errorf("expected log not to contain %q, got:\n%s", skip, out)
+				}
+			}
+		})
+	}
+}
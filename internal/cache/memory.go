@@ -1,7 +1,13 @@
 package cache
 
 import (
+	"container/list"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -9,15 +15,58 @@ import (
 	"github.com/aqstack/mimir/pkg/api"
 )
 
+// Ensure MemoryCache implements Cache.
+var _ Cache = (*MemoryCache)(nil)
+
+// memoryEntry is the internal bookkeeping for a cached entry.
+type memoryEntry struct {
+	entry *api.CacheEntry // stored without Embedding; see vec
+	vec   []float32       // the embedding, kept at float32 precision
+	qvec  int8Vector      // the embedding with QuantizationInt8; vec is nil
+	idx   int             // position in MemoryCache.entries
+	bytes int64           // approximate memory footprint; see entryBytes
+
+	// Eviction bookkeeping, owned by the evictor. Pinned entries are not
+	// tracked.
+	elem      *list.Element
+	heapIdx   int
+	sketchKey uint64 // TinyLFU frequency key
+	inMain    bool   // TinyLFU region; false = window
+
+	node *hnswNode // position in the HNSW index, if enabled
+}
+
 // MemoryCache implements an in-memory semantic cache.
+// Entries are kept in a dense slice for fast similarity scans and tracked
+// by an evictor implementing Options.EvictionPolicy. Embeddings are stored
+// as float32, halving memory and scan bandwidth; entries returned by Get
+// and GetByID are copies with the embedding converted back to float64.
 type MemoryCache struct {
 	mu      sync.RWMutex
-	entries []*api.CacheEntry
+	entries []*memoryEntry
+	byID    map[string]*memoryEntry
+	byHash  map[exactKey]*memoryEntry
+	evictor evictor
+	index   *hnswIndex      // nil unless Options.HNSW.Enabled
+	tuner   *thresholdTuner // nil unless Options.Tuning.SampleRate is set
+	dims    int             // expected embedding length, 0 until known
 	opts    *Options
 
+	done      chan struct{}
+	closeOnce sync.Once
+
 	// Stats
-	hits   atomic.Int64
-	misses atomic.Int64
+	hits       atomic.Int64
+	exactHits  atomic.Int64
+	misses     atomic.Int64
+	evictions  atomic.Int64
+	merged     atomic.Int64
+	mismatches atomic.Int64
+	savedUSD   float64 // guarded by mu
+	bytes      int64   // sum of entry sizes, guarded by mu
+	pinned     int     // pinned entries, guarded by mu
+	byModel    modelStats
+	models     map[string]int // entries by request model, guarded by mu
 }
 
 // NewMemoryCache creates a new in-memory cache.
@@ -27,8 +76,23 @@ func NewMemoryCache(opts *Options) *MemoryCache {
 	}
 
 	mc := &MemoryCache{
-		entries: make([]*api.CacheEntry, 0, opts.MaxSize),
+		entries: make([]*memoryEntry, 0, opts.MaxSize),
+		byID:    make(map[string]*memoryEntry, opts.MaxSize),
+		byHash:  make(map[exactKey]*memoryEntry, opts.MaxSize),
+		evictor: newEvictor(opts.EvictionPolicy, opts.MaxSize),
+		models:  make(map[string]int),
+		dims:    opts.Dimensions,
 		opts:    opts,
+		done:    make(chan struct{}),
+	}
+	if opts.Projection != nil {
+		mc.dims = opts.Projection.Dims()
+	}
+	if opts.HNSW.Enabled {
+		mc.index = newHNSWIndex(opts.Metric, opts.HNSW)
+	}
+	if opts.Tuning.SampleRate > 0 {
+		mc.tuner = newThresholdTuner(opts.Tuning)
 	}
 
 	// Start cleanup goroutine
@@ -37,105 +101,808 @@ func NewMemoryCache(opts *Options) *MemoryCache {
 	return mc
 }
 
-// Get retrieves a cached response based on semantic similarity.
+// Get retrieves a cached response based on semantic similarity. The scan
+// stops once ctx is done and Get reports a miss; callers can tell the two
+// apart by checking ctx.Err().
 func (m *MemoryCache) Get(ctx context.Context, embedding []float64, threshold float64) (*api.CacheEntry, float64, bool) {
+	threshold = m.opts.lookupThreshold(ctx, threshold)
+	embedding = m.opts.project(embedding)
 	m.mu.RLock()
-	defer m.mu.RUnlock()
 
-	var bestMatch *api.CacheEntry
+	if m.dims != 0 && len(embedding) != m.dims {
+		m.mu.RUnlock()
+		m.mismatch(ctx, embedding)
+		return nil, 0, false
+	}
+	// Nothing can match a non-finite query, and it would misdirect the
+	// index search
+	if CheckFinite(embedding) != nil {
+		m.mu.RUnlock()
+		m.miss(ctx, embedding, nil)
+		return nil, 0, false
+	}
+
+	var bestMatch *memoryEntry
 	var bestSimilarity float64
 
 	now := time.Now()
+	query := toFloat32(embedding)
+	sc := m.opts.scopeFor(ctx)
+	sc.grace = m.opts.StaleWhileRevalidate
+	metric := m.opts.queryMetric(ctx)
+	threshold = metric.ordered(threshold)
 
-	for _, entry := range m.entries {
-		// Skip expired entries
-		if now.After(entry.ExpiresAt) {
-			continue
+	// The index is ordered by the configured metric only
+	if m.indexed() && metric == m.opts.Metric {
+		bestMatch, bestSimilarity = m.indexLookup(query, sc, threshold, now)
+	} else {
+		unit, scanMetric := m.opts.unitQuery(embedding, metric)
+		bestMatch, bestSimilarity = m.scan(ctx, toFloat32(unit), scanMetric, sc, threshold, now)
+	}
+
+	m.mu.RUnlock()
+
+	// A scan cut short by the context found nothing the caller can use
+	if ctx.Err() != nil {
+		bestMatch = nil
+	}
+
+	if bestMatch != nil {
+		bestSimilarity = metric.ordered(bestSimilarity)
+		return m.hit(bestMatch, bestSimilarity, metric, now), bestSimilarity, true
+	}
+
+	m.miss(ctx, embedding, query)
+	return nil, 0, false
+}
+
+// GetBatch looks up several embeddings at once, comparing each entry
+// against every query in one pass under a single read lock, which is
+// much faster than separate Get calls for large batches. Results are in
+// query order, nil for misses; each lookup counts as a hit or miss as it
+// would for Get. Once ctx is done, the remaining queries miss.
+func (m *MemoryCache) GetBatch(ctx context.Context, embeddings [][]float64, threshold float64) []*SearchResult {
+	threshold = m.opts.modelThreshold(ctx, threshold)
+	now := time.Now()
+	sc := m.opts.scopeFor(ctx)
+	metric := m.opts.queryMetric(ctx)
+	threshold = metric.ordered(threshold)
+
+	queries := make([][]float32, len(embeddings))
+	projected := make([][]float64, len(embeddings))
+	best := make([]*memoryEntry, len(embeddings))
+	bestSim := make([]float64, len(embeddings))
+	bestScore := make([]float64, len(embeddings))
+
+	m.mu.RLock()
+	pending := 0
+	for i, emb := range embeddings {
+		emb = m.opts.project(emb)
+		if (m.dims == 0 || len(emb) == m.dims) && CheckFinite(emb) == nil {
+			projected[i] = emb
+			queries[i] = toFloat32(emb)
+			pending++
 		}
+	}
 
-		similarity := CosineSimilarity(embedding, entry.Embedding)
-		if similarity >= threshold && similarity > bestSimilarity {
-			bestSimilarity = similarity
-			bestMatch = entry
+	if m.indexed() && metric == m.opts.Metric {
+		for i, query := range queries {
+			if query != nil {
+				best[i], bestSim[i] = m.indexLookup(query, sc, threshold, now)
+				if best[i] != nil {
+					bestScore[i] = m.opts.confidence(best[i].entry, bestSim[i], now)
+				}
+			}
+		}
+	} else {
+		// Queries that reach the hard threshold drop out of the scan
+		done := make([]bool, len(queries))
+		scanQueries := make([][]float32, len(queries))
+		scanMetric := metric
+		for i, query := range queries {
+			if query != nil {
+				var unit []float64
+				unit, scanMetric = m.opts.unitQuery(projected[i], metric)
+				scanQueries[i] = toFloat32(unit)
+			}
+		}
+		for j, me := range m.entries {
+			if pending == 0 || (j%scanCheckInterval == 0 && ctx.Err() != nil) {
+				break
+			}
+			if !m.searchable(me, sc, now) {
+				continue
+			}
+			for i, query := range scanQueries {
+				if query == nil || done[i] {
+					continue
+				}
+				similarity := me.similarity(scanMetric, query)
+				if similarity < threshold {
+					continue
+				}
+				if score := m.opts.confidence(me.entry, similarity, now); best[i] == nil || score > bestScore[i] {
+					best[i], bestSim[i], bestScore[i] = me, similarity, score
+					if m.opts.reachesHardThreshold(metric, similarity) {
+						done[i] = true
+						pending--
+					}
+				}
+			}
 		}
 	}
+	m.mu.RUnlock()
 
-	if bestMatch != nil {
-		m.hits.Add(1)
-		// Update hit stats (requires write lock, but we defer to avoid complexity)
-		go m.updateHitStats(bestMatch)
-		return bestMatch, bestSimilarity, true
+	cancelled := ctx.Err() != nil
+	results := make([]*SearchResult, len(embeddings))
+	for i, embedding := range embeddings {
+		switch {
+		case queries[i] == nil && CheckFinite(embedding) != nil:
+			m.miss(ctx, embedding, nil)
+		case queries[i] == nil:
+			m.mismatch(ctx, embedding)
+		case best[i] != nil && !cancelled:
+			similarity := metric.ordered(bestSim[i])
+			results[i] = &SearchResult{Entry: m.hit(best[i], similarity, metric, now), Similarity: similarity, Confidence: bestScore[i]}
+		default:
+			m.miss(ctx, embedding, queries[i])
+		}
+	}
+	return results
+}
+
+// indexLookup returns the best live entry in the lookup's scope from the
+// HNSW index, if at or above threshold. Caller must hold the read lock.
+func (m *MemoryCache) indexLookup(query []float32, sc scope, threshold float64, now time.Time) (*memoryEntry, float64) {
+	// Candidates come back most similar first; without scoring, take the
+	// first live one
+	scoring := m.opts.Scoring.enabled()
+	var best *memoryEntry
+	var bestSim, bestScore float64
+	for _, c := range m.index.search(query, m.index.efSearch) {
+		if c.sim < threshold {
+			break
+		}
+		if !m.searchable(c.node.value, sc, now) {
+			continue
+		}
+		if !scoring {
+			return c.node.value, c.sim
+		}
+		if score := m.opts.confidence(c.node.value.entry, c.sim, now); best == nil || score > bestScore {
+			best, bestSim, bestScore = c.node.value, c.sim, score
+		}
+	}
+	return best, bestSim
+}
+
+// hit records a semantic hit on me and returns the entry for the caller.
+func (m *MemoryCache) hit(me *memoryEntry, similarity float64, metric Metric, now time.Time) *api.CacheEntry {
+	entry := m.updateHitStats(me, now, false)
+	if m.tuner != nil && !metric.LowerIsBetter() {
+		m.tuner.recordHit(similarity)
 	}
+	m.opts.onHit(entry, similarity)
+	return entry
+}
 
+// miss records a lookup that found no match.
+func (m *MemoryCache) miss(ctx context.Context, embedding []float64, query []float32) {
+	if lfu, ok := m.evictor.(*tinyLFUEvictor); ok && query != nil {
+		lfu.recordMiss(query)
+	}
 	m.misses.Add(1)
-	return nil, 0, false
+	m.byModel.recordMiss(modelFromContext(ctx))
+	m.opts.onMiss(embedding)
+}
+
+// mismatch records a lookup whose embedding dimension differs from the
+// cache's as a miss.
+func (m *MemoryCache) mismatch(ctx context.Context, embedding []float64) {
+	m.mismatches.Add(1)
+	m.misses.Add(1)
+	m.byModel.recordMiss(modelFromContext(ctx))
+	m.opts.onMiss(embedding)
+}
+
+// RecordFeedback reports whether a hit returned by Get at the given
+// similarity was a false hit, i.e. its response didn't fit the prompt.
+// It is a no-op unless Options.Tuning is enabled.
+func (m *MemoryCache) RecordFeedback(similarity float64, falseHit bool) {
+	if m.tuner != nil {
+		m.tuner.recordFeedback(similarity, falseHit)
+	}
 }
 
-// updateHitStats updates the hit statistics for an entry.
-func (m *MemoryCache) updateHitStats(entry *api.CacheEntry) {
+// SuggestThreshold recommends a similarity threshold that keeps the false
+// hit rate within Options.Tuning.FalseHitTolerance, based on sampled hits
+// and RecordFeedback reports. It returns Options.SimilarityThreshold until
+// enough data is collected or if tuning is disabled. Hits under distance
+// metrics are not sampled.
+func (m *MemoryCache) SuggestThreshold() float64 {
+	if m.tuner == nil {
+		return m.opts.SimilarityThreshold
+	}
+	return m.tuner.suggest(m.opts.SimilarityThreshold)
+}
+
+// GetExact retrieves the entry whose request canonicalizes identically to
+// req. OnHit receives a similarity of 1.
+func (m *MemoryCache) GetExact(ctx context.Context, req *api.ChatCompletionRequest) (*api.CacheEntry, bool) {
+	key := exactKey{namespace: namespaceFromContext(ctx), hash: api.RequestHash(req)}
+	now := time.Now()
+
+	m.mu.RLock()
+	me, ok := m.byHash[key]
+	ok = ok && me.matches(key.namespace, now.Add(-m.opts.StaleWhileRevalidate))
+	m.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	entry := m.updateHitStats(me, now, true)
+	m.opts.onHit(entry, 1)
+	return entry, true
+}
+
+// Search returns up to k live entries with similarity at or above
+// threshold, most similar first, or by confidence under Options.Scoring.
+// Under a distance metric (see WithMetric) the threshold is a maximum
+// distance and results carry distances.
+func (m *MemoryCache) Search(ctx context.Context, embedding []float64, threshold float64, k int) []SearchResult {
+	threshold = m.opts.lookupThreshold(ctx, threshold)
+	if k <= 0 {
+		return nil
+	}
+
+	embedding = m.opts.project(embedding)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if (m.dims != 0 && len(embedding) != m.dims) || CheckFinite(embedding) != nil {
+		return nil
+	}
+
+	now := time.Now()
+	query := toFloat32(embedding)
+	sc := m.opts.scopeFor(ctx)
+	metric := m.opts.queryMetric(ctx)
+	threshold = metric.ordered(threshold)
+
+	var results []SearchResult
+	if m.indexed() && metric == m.opts.Metric {
+		ef := m.index.efSearch
+		if k > ef {
+			ef = k
+		}
+		// With scoring, any candidate above threshold may rank in the top k
+		scoring := m.opts.Scoring.enabled()
+		for _, c := range m.index.search(query, ef) {
+			if c.sim < threshold || (len(results) == k && !scoring) {
+				break
+			}
+			if !m.searchable(c.node.value, sc, now) {
+				continue
+			}
+			me := c.node.value
+			results = append(results, SearchResult{Entry: me.export(), Similarity: c.sim, Confidence: m.opts.confidence(me.entry, c.sim, now)})
+		}
+		return metricResults(metric, topResults(results, k))
+	}
+
+	unit, scanMetric := m.opts.unitQuery(embedding, metric)
+	query = toFloat32(unit)
+	for i, me := range m.entries {
+		if i%scanCheckInterval == 0 && ctx.Err() != nil {
+			return nil
+		}
+		if !m.searchable(me, sc, now) {
+			continue
+		}
+		if similarity := me.similarity(scanMetric, query); similarity >= threshold {
+			results = append(results, SearchResult{Entry: me.export(), Similarity: similarity, Confidence: m.opts.confidence(me.entry, similarity, now)})
+		}
+	}
+	return metricResults(metric, topResults(results, k))
+}
+
+// scanCheckInterval is how many entries a scan compares between checks
+// for cancellation of its context.
+const scanCheckInterval = 1024
+
+// scan finds the most similar live entry in namespace ns at or above
+// threshold by comparing against every entry, fanning out across
+// goroutines for large caches. It stops early, with a partial result,
+// once ctx is done. Caller must hold the read lock.
+func (m *MemoryCache) scan(ctx context.Context, embedding []float32, metric Metric, sc scope, threshold float64, now time.Time) (*memoryEntry, float64) {
+	workers := m.opts.ParallelScanWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if m.opts.ParallelScanThreshold <= 0 || len(m.entries) < m.opts.ParallelScanThreshold || workers < 2 {
+		return m.scanRange(ctx, m.entries, embedding, metric, sc, threshold, now)
+	}
+
+	type result struct {
+		entry      *memoryEntry
+		similarity float64
+	}
+	results := make([]result, workers)
+	chunk := (len(m.entries) + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		start := w * chunk
+		if start >= len(m.entries) {
+			break
+		}
+		end := start + chunk
+		if end > len(m.entries) {
+			end = len(m.entries)
+		}
+
+		wg.Add(1)
+		go func(w int, entries []*memoryEntry) {
+			defer wg.Done()
+			me, sim := m.scanRange(ctx, entries, embedding, metric, sc, threshold, now)
+			results[w] = result{me, sim}
+		}(w, m.entries[start:end])
+	}
+	wg.Wait()
+
+	// Reduce in chunk order so ties resolve as in a sequential scan
+	var best result
+	var bestScore float64
+	for _, r := range results {
+		if r.entry == nil {
+			continue
+		}
+		if score := m.opts.confidence(r.entry.entry, r.similarity, now); best.entry == nil || score > bestScore {
+			best, bestScore = r, score
+		}
+	}
+	return best.entry, best.similarity
+}
+
+// scanRange finds the best match within entries.
+func (m *MemoryCache) scanRange(ctx context.Context, entries []*memoryEntry, embedding []float32, metric Metric, sc scope, threshold float64, now time.Time) (*memoryEntry, float64) {
+	var bestMatch *memoryEntry
+	var bestSimilarity, bestScore float64
+	scoring := m.opts.Scoring.enabled()
+
+	for i, me := range entries {
+		if i%scanCheckInterval == 0 && ctx.Err() != nil {
+			break
+		}
+		// Skip expired entries and other namespaces
+		if !m.searchable(me, sc, now) {
+			continue
+		}
+
+		// Without scoring only entries more similar than the best so far
+		// matter, which lets distance metrics stop comparing early
+		floor := threshold
+		if bestMatch != nil && !scoring {
+			floor = bestSimilarity
+		}
+		similarity, ok := me.similarityAbove(metric, embedding, floor)
+		if !ok {
+			continue
+		}
+		if score := m.opts.confidence(me.entry, similarity, now); bestMatch == nil || score > bestScore {
+			bestSimilarity, bestScore = similarity, score
+			bestMatch = me
+			if m.opts.reachesHardThreshold(metric, similarity) {
+				break
+			}
+		}
+	}
+
+	return bestMatch, bestSimilarity
+}
+
+// matches reports whether the entry is live and in namespace ns.
+func (me *memoryEntry) matches(ns string, now time.Time) bool {
+	return me.entry.Namespace == ns && !now.After(me.entry.ExpiresAt)
+}
+
+// searchable reports whether me is a response, live or stale within the
+// lookup's grace period, and in the lookup's scope.
+func (m *MemoryCache) searchable(me *memoryEntry, sc scope, now time.Time) bool {
+	return !me.entry.Negative && me.matches(sc.namespace, now.Add(-sc.grace)) && sameEmbeddingModel(me.entry, sc.model)
+}
+
+// updateHitStats updates the hit statistics for an entry, reports the
+// hit to the evictor and returns a copy of the updated entry. The hit
+// count and savings change together under the lock, so Stats never sees
+// one without the other.
+func (m *MemoryCache) updateHitStats(me *memoryEntry, now time.Time, exact bool) *api.CacheEntry {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	entry.HitCount++
-	entry.LastHitAt = time.Now()
+	m.hits.Add(1)
+	if exact {
+		m.exactHits.Add(1)
+	}
+	me.entry.HitCount++
+	me.entry.LastHitAt = now
+	saved := m.opts.hitSavings(me.entry)
+	m.savedUSD += saved
+	m.byModel.recordHit(me.entry.Request.Model, saved)
+	// The entry may have been removed, or the cache cleared, since the
+	// scan; touching it then would track an entry no longer stored
+	if !me.entry.Pinned && m.byID[me.entry.ID] == me {
+		m.evictor.touch(me)
+	}
+	entry := me.export()
+	entry.Stale = now.After(entry.ExpiresAt)
+	return entry
+}
+
+// export returns a deep copy of the entry with its embedding restored, so
+// callers never share memory with the cache. Caller must hold the lock.
+func (me *memoryEntry) export() *api.CacheEntry {
+	entry := me.entry.Clone()
+	entry.Embedding = toFloat64(me.vector())
+	return entry
+}
+
+// similarity compares the query to the entry's embedding.
+func (me *memoryEntry) similarity(metric Metric, query []float32) float64 {
+	if me.vec == nil {
+		return metric.similarityInt8(query, me.qvec)
+	}
+	return metric.Similarity32(query, me.vec)
+}
+
+// similarityAbove compares the query to the entry's embedding, reporting
+// whether it scores at least floor; see Metric.similarityAbove.
+func (me *memoryEntry) similarityAbove(metric Metric, query []float32, floor float64) (float64, bool) {
+	if me.vec == nil {
+		s := metric.similarityInt8(query, me.qvec)
+		return s, s >= floor
+	}
+	return metric.similarityAbove(query, me.vec, floor)
+}
+
+// vector returns the entry's embedding, dequantizing it if needed.
+func (me *memoryEntry) vector() []float32 {
+	if me.vec == nil {
+		return me.qvec.dequantize()
+	}
+	return me.vec
+}
+
+// setVector stores vec in the entry, quantizing it if configured.
+func (me *memoryEntry) setVector(vec []float32, q Quantization) {
+	if q == QuantizationInt8 {
+		me.vec, me.qvec = nil, quantizeInt8(vec)
+		return
+	}
+	me.vec, me.qvec = vec, int8Vector{}
+}
+
+// entryOverhead approximates the per-entry cost of the structs, maps and
+// slice headers that track an entry.
+const entryOverhead = 256
+
+// entryBytes approximates the memory an entry takes: its request and
+// response as JSON, its embedding as stored, and fixed overhead.
+func entryBytes(entry *api.CacheEntry, dims int, q Quantization) int64 {
+	size := int64(entryOverhead)
+	if data, err := json.Marshal(entry); err == nil {
+		size += int64(len(data))
+	}
+	if q == QuantizationInt8 {
+		size += int64(dims) + 8 // int8 values, scale and norm
+	} else {
+		size += 4 * int64(dims)
+	}
+	return size
 }
 
 // Set stores a response with its embedding.
 func (m *MemoryCache) Set(ctx context.Context, entry *api.CacheEntry) error {
+	m.opts.onSet(entry)
+	if err := checkResponseFormat(entry); err != nil {
+		return err
+	}
+	if err := m.opts.checkToolCalls(entry); err != nil {
+		return err
+	}
+	if err := CheckFinite(entry.Embedding); err != nil {
+		return err
+	}
+	applyNamespace(ctx, entry)
+	m.opts.applyEmbeddingModel(ctx, entry)
+	if err := m.opts.applyProjection(entry); err != nil {
+		return err
+	}
+	applyRequestHash(entry)
+	m.opts.sanitize(entry)
+	if m.opts.NormalizeOnSet {
+		entry.Embedding = NormalizeVector(entry.Embedding)
+	}
+	m.opts.resolveExpiry(entry)
+	m.opts.applyNegativeTTL(entry)
+	if err := m.opts.applyConfidence(entry); err != nil {
+		return err
+	}
+
+	if entry.ID == "" {
+		entry.ID = NewEntryID()
+	}
+	entry.SchemaVersion = api.CacheEntrySchemaVersion
+
+	// Keep the embedding only in float32 form
+	vec := toFloat32(entry.Embedding)
+	stored := *entry
+	stored.Embedding = nil
+	size := entryBytes(&stored, len(vec), m.opts.Quantization)
+	if m.opts.MaxBytes > 0 && size > m.opts.MaxBytes {
+		return ErrCacheFull
+	}
+
+	// Evicted entries go to OnEvict once the lock is released
+	var evicted []*api.CacheEntry
+	defer func() { m.opts.onEvict(evicted) }()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Check for duplicate (update if exists)
-	for i, e := range m.entries {
-		similarity := CosineSimilarity(entry.Embedding, e.Embedding)
-		if similarity > 0.99 {
-			// Update existing entry
-			m.entries[i] = entry
-			return nil
-		}
+	if m.dims == 0 {
+		m.dims = len(vec)
+	} else if len(vec) != m.dims {
+		return fmt.Errorf("%w: got %d, want %d", ErrDimensionMismatch, len(vec), m.dims)
+	}
+
+	// Same ID: update in place
+	if me, ok := m.byID[entry.ID]; ok {
+		m.replace(me, &stored, vec, size)
+		return nil
+	}
+
+	if same := m.byHash[exactKeyFor(&stored)]; same != nil && shadows(same.entry, &stored) {
+		return nil
+	}
+
+	// Check for a duplicate (update if exists)
+	if me := m.findDuplicate(&stored, vec); me != nil {
+		delete(m.byID, me.entry.ID)
+		m.byID[entry.ID] = me
+		m.replace(me, &stored, vec, size)
+		return nil
 	}
 
-	// Evict if at capacity (LRU-style: remove oldest)
-	if len(m.entries) >= m.opts.MaxSize {
-		m.evictOldest()
+	// Evict if at capacity, by count or by bytes
+	for len(m.entries) >= m.opts.MaxSize || (m.opts.MaxBytes > 0 && m.bytes+size > m.opts.MaxBytes) {
+		victim := m.evict(stored.Request.Model)
+		if victim == nil {
+			if m.pinned > 0 && m.pinned == len(m.entries) {
+				return ErrAllPinned
+			}
+			return ErrCacheFull
+		}
+		if m.opts.OnEvict != nil {
+			evicted = append(evicted, victim.export())
+		}
 	}
 
-	m.entries = append(m.entries, entry)
+	me := &memoryEntry{
+		entry: &stored,
+		idx:   len(m.entries),
+		bytes: size,
+	}
+	m.bytes += size
+	me.setVector(vec, m.opts.Quantization)
+	m.track(me)
+	m.entries = append(m.entries, me)
+	m.byID[entry.ID] = me
+	m.byHash[exactKeyFor(&stored)] = me
+	if m.index != nil {
+		me.node = m.index.insert(vec, me)
+	}
 	return nil
 }
 
-// evictOldest removes the oldest entry based on last hit time.
-func (m *MemoryCache) evictOldest() {
-	if len(m.entries) == 0 {
-		return
+// indexed reports whether lookups search the HNSW index rather than scan:
+// the index is enabled and the cache holds at least HNSW.MinEntries
+// entries. Caller must hold the lock.
+func (m *MemoryCache) indexed() bool {
+	return m.index != nil && len(m.entries) >= m.opts.HNSW.minEntries()
+}
+
+// findDuplicate returns the entry a new one replaces: the entry nearly
+// identical in embedding or, with DisableDedupOnSet or for negative
+// entries, the entry for the same request. Caller must hold the lock.
+func (m *MemoryCache) findDuplicate(entry *api.CacheEntry, vec []float32) *memoryEntry {
+	same := m.byHash[exactKeyFor(entry)]
+	if m.opts.DisableDedupOnSet || entry.Negative || (same != nil && same.entry.Negative) {
+		return same
 	}
+	return m.findNearDuplicate(vec, scope{namespace: entry.Namespace, model: entry.EmbeddingModel})
+}
 
-	oldestIdx := 0
-	oldestTime := m.entries[0].LastHitAt
+// findNearDuplicate returns the response in namespace ns nearly identical
+// to the embedding, or nil. Caller must hold the lock.
+func (m *MemoryCache) findNearDuplicate(embedding []float32, sc scope) *memoryEntry {
+	if m.indexed() {
+		// Near-duplicates in other namespaces may rank first
+		for _, c := range m.index.search(embedding, m.index.efSearch) {
+			if !m.opts.Metric.isNearDuplicate(c.sim) {
+				break
+			}
+			if e := c.node.value.entry; !e.Negative && e.Namespace == sc.namespace && sameEmbeddingModel(e, sc.model) {
+				return c.node.value
+			}
+		}
+		return nil
+	}
 
-	for i, e := range m.entries {
-		if e.LastHitAt.Before(oldestTime) {
-			oldestIdx = i
-			oldestTime = e.LastHitAt
+	for _, me := range m.entries {
+		if !me.entry.Negative && me.entry.Namespace == sc.namespace && sameEmbeddingModel(me.entry, sc.model) && m.opts.Metric.isNearDuplicate(me.similarity(m.opts.Metric, embedding)) {
+			return me
 		}
 	}
+	return nil
+}
+
+// replace swaps the entry stored in me, re-tracking it as if newly
+// inserted. The replacement stays pinned if the entry was. A larger
+// replacement may exceed MaxBytes until the next insert evicts. Caller
+// must hold the write lock.
+func (m *MemoryCache) replace(me *memoryEntry, entry *api.CacheEntry, vec []float32, size int64) {
+	m.untrack(me)
+	entry.Pinned = entry.Pinned || me.entry.Pinned
+	m.unindexHash(me)
+	m.bytes += size - me.bytes
+	me.bytes = size
+	me.entry = entry
+	me.setVector(vec, m.opts.Quantization)
+	m.track(me)
+	m.byHash[exactKeyFor(entry)] = me
+
+	if m.index != nil {
+		m.index.remove(me.node)
+		me.node = m.index.insert(vec, me)
+	}
+}
+
+// evict removes the entry chosen by the eviction policy, preferring
+// models over their Options.ModelQuotas share with an entry for model
+// about to be stored, and returns it, or nil if no entry may be evicted.
+// Caller must hold the write lock.
+func (m *MemoryCache) evict(model string) *memoryEntry {
+	now := time.Now()
+	victim := m.quotaVictim(now, model)
+	if victim == nil {
+		victim = m.evictor.victim(now)
+	}
+	if victim == nil {
+		return nil
+	}
+	m.remove(victim)
+	m.evictions.Add(1)
+	m.opts.logEviction(context.Background(), victim.entry.ID)
+	return victim
+}
 
+// remove deletes an entry from the slice, evictor and indexes.
+// Caller must hold the write lock.
+func (m *MemoryCache) remove(me *memoryEntry) {
 	// Remove by swapping with last element
-	m.entries[oldestIdx] = m.entries[len(m.entries)-1]
+	last := m.entries[len(m.entries)-1]
+	m.entries[me.idx] = last
+	last.idx = me.idx
+	m.entries[len(m.entries)-1] = nil
 	m.entries = m.entries[:len(m.entries)-1]
+
+	m.untrack(me)
+	delete(m.byID, me.entry.ID)
+	m.unindexHash(me)
+	m.bytes -= me.bytes
+	if m.index != nil {
+		m.index.remove(me.node)
+	}
+}
+
+// track starts tracking me for eviction, or counts it if pinned. Caller
+// must hold the write lock.
+func (m *MemoryCache) track(me *memoryEntry) {
+	m.models[me.entry.Request.Model]++
+	if me.entry.Pinned {
+		m.pinned++
+		return
+	}
+	m.evictor.add(me)
+}
+
+// untrack reverses track. Caller must hold the write lock.
+func (m *MemoryCache) untrack(me *memoryEntry) {
+	if m.models[me.entry.Request.Model]--; m.models[me.entry.Request.Model] == 0 {
+		delete(m.models, me.entry.Request.Model)
+	}
+	if me.entry.Pinned {
+		m.pinned--
+		return
+	}
+	m.evictor.remove(me)
+}
+
+// Pin exempts the entry with the given ID from eviction. It still
+// expires.
+func (m *MemoryCache) Pin(ctx context.Context, id string) error {
+	return m.setPinned(id, true)
+}
+
+// Unpin makes a pinned entry evictable again.
+func (m *MemoryCache) Unpin(ctx context.Context, id string) error {
+	return m.setPinned(id, false)
 }
 
-// Delete removes an entry by its embedding.
-func (m *MemoryCache) Delete(ctx context.Context, embedding []float64) error {
+// setPinned moves the entry with the given ID in or out of eviction
+// tracking.
+func (m *MemoryCache) setPinned(id string, pinned bool) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for i, e := range m.entries {
-		similarity := CosineSimilarity(embedding, e.Embedding)
-		if similarity > 0.99 {
-			m.entries[i] = m.entries[len(m.entries)-1]
-			m.entries = m.entries[:len(m.entries)-1]
-			return nil
-		}
+	me, ok := m.byID[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if me.entry.Pinned == pinned {
+		return nil
+	}
+	m.untrack(me)
+	me.entry.Pinned = pinned
+	m.track(me)
+	return nil
+}
+
+// unindexHash removes me from the exact-match index, unless a newer entry
+// for the same request has taken its place. Caller must hold the write lock.
+func (m *MemoryCache) unindexHash(me *memoryEntry) {
+	key := exactKeyFor(me.entry)
+	if m.byHash[key] == me {
+		delete(m.byHash, key)
+	}
+}
+
+// GetByID retrieves an entry by its ID without affecting hit statistics.
+func (m *MemoryCache) GetByID(ctx context.Context, id string) (*api.CacheEntry, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	me, ok := m.byID[id]
+	if !ok || time.Now().After(me.entry.ExpiresAt) {
+		return nil, false
+	}
+	return me.export(), true
+}
+
+// Delete removes an entry by its ID.
+func (m *MemoryCache) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if me, ok := m.byID[id]; ok {
+		m.remove(me)
+	}
+	return nil
+}
+
+// DeleteByEmbedding removes the entry nearly identical to the embedding
+// in the context's namespace.
+func (m *MemoryCache) DeleteByEmbedding(ctx context.Context, embedding []float64) error {
+	embedding = m.opts.project(embedding)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.dims != 0 && len(embedding) != m.dims {
+		return fmt.Errorf("%w: got %d, want %d", ErrDimensionMismatch, len(embedding), m.dims)
+	}
+
+	if me := m.findNearDuplicate(toFloat32(embedding), m.opts.scopeFor(ctx)); me != nil {
+		m.remove(me)
 	}
 
 	return nil
@@ -146,19 +913,121 @@ func (m *MemoryCache) Clear(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.entries = make([]*api.CacheEntry, 0, m.opts.MaxSize)
+	m.entries = make([]*memoryEntry, 0, m.opts.MaxSize)
+	m.byID = make(map[string]*memoryEntry, m.opts.MaxSize)
+	m.byHash = make(map[exactKey]*memoryEntry, m.opts.MaxSize)
+	m.evictor.reset()
+	m.pinned = 0
+	m.models = make(map[string]int)
+	if m.index != nil {
+		m.index.reset()
+	}
+	m.dims = m.opts.Dimensions
 	m.hits.Store(0)
+	m.exactHits.Store(0)
 	m.misses.Store(0)
+	m.evictions.Store(0)
+	m.merged.Store(0)
+	m.mismatches.Store(0)
+	m.savedUSD = 0
+	m.bytes = 0
+	m.byModel.reset()
+
+	return nil
+}
 
+// ClearNamespace removes all entries in a namespace.
+func (m *MemoryCache) ClearNamespace(ctx context.Context, namespace string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Iterate backwards so swap-removal doesn't skip entries
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		if me := m.entries[i]; me.entry.Namespace == namespace {
+			m.remove(me)
+		}
+	}
 	return nil
 }
 
-// Stats returns cache statistics.
+// DeleteByModel removes all entries for the request model.
+func (m *MemoryCache) DeleteByModel(ctx context.Context, model string) (int, error) {
+	return m.deleteWhere(func(e *api.CacheEntry) bool { return e.Request.Model == model }), nil
+}
+
+// DeleteOlderThan removes all entries created before t.
+func (m *MemoryCache) DeleteOlderThan(ctx context.Context, t time.Time) (int, error) {
+	return m.deleteWhere(func(e *api.CacheEntry) bool { return e.CreatedAt.Before(t) }), nil
+}
+
+// deleteWhere removes matching entries in a single pass under the write
+// lock and returns the number removed.
+func (m *MemoryCache) deleteWhere(match func(*api.CacheEntry) bool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	// Iterate backwards so swap-removal doesn't skip entries
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		if me := m.entries[i]; match(me.entry) {
+			m.remove(me)
+			removed++
+		}
+	}
+	return removed
+}
+
+// LoadFromReader stores JSONL entries written by DumpToWriter.
+func (m *MemoryCache) LoadFromReader(ctx context.Context, r io.Reader) (int, error) {
+	return loadJSONL(ctx, m, r)
+}
+
+// DumpToWriter writes all live entries as JSONL.
+func (m *MemoryCache) DumpToWriter(ctx context.Context, w io.Writer) error {
+	now := time.Now()
+	m.mu.RLock()
+	entries := make([]*api.CacheEntry, 0, len(m.entries))
+	for _, me := range m.entries {
+		if now.Before(me.entry.ExpiresAt) {
+			entries = append(entries, me.export())
+		}
+	}
+	m.mu.RUnlock()
+
+	return dumpJSONL(w, entries)
+}
+
+// Entries returns copies of a page of live entries, oldest first.
+func (m *MemoryCache) Entries(ctx context.Context, offset, limit int) ([]*api.CacheEntry, error) {
+	now := time.Now()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	live := make([]*memoryEntry, 0, len(m.entries))
+	for _, me := range m.entries {
+		if now.Before(me.entry.ExpiresAt) {
+			live = append(live, me)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool { return entryBefore(live[i].entry, live[j].entry) })
+
+	lo, hi := pageBounds(len(live), offset, limit)
+	page := make([]*api.CacheEntry, 0, hi-lo)
+	for _, me := range live[lo:hi] {
+		page = append(page, me.export())
+	}
+	return page, nil
+}
+
+// Stats returns a consistent snapshot of cache statistics, read under a
+// single lock: entry counts, hits and savings always agree, and a Clear
+// is never observed half done.
 func (m *MemoryCache) Stats(ctx context.Context) *api.CacheStats {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	hits := m.hits.Load()
+	exactHits := m.exactHits.Load()
 	misses := m.misses.Load()
 	total := hits + misses
 
@@ -167,37 +1036,72 @@ func (m *MemoryCache) Stats(ctx context.Context) *api.CacheStats {
 		hitRate = float64(hits) / float64(total)
 	}
 
-	// Estimate cost savings (rough: $0.002 per 1K tokens, assume 500 tokens per request)
-	estimatedSaved := float64(hits) * 0.001
-
 	return &api.CacheStats{
-		TotalEntries:   int64(len(m.entries)),
-		TotalHits:      hits,
-		TotalMisses:    misses,
-		HitRate:        hitRate,
-		EstimatedSaved: estimatedSaved,
+		TotalEntries:        int64(len(m.entries)),
+		TotalHits:           hits,
+		ExactHits:           exactHits,
+		SemanticHits:        hits - exactHits,
+		TotalMisses:         misses,
+		HitRate:             hitRate,
+		EstimatedSaved:      m.savedUSD,
+		TotalBytes:          m.bytes,
+		Evictions:           m.evictions.Load(),
+		Merged:              m.merged.Load(),
+		DimensionMismatches: m.mismatches.Load(),
 	}
 }
 
-// Cleanup removes expired entries.
+// CheckDimensions returns ErrDimensionMismatch if the embedding's length
+// differs from the cache's expected dimension.
+func (m *MemoryCache) CheckDimensions(embedding []float64) error {
+	embedding = m.opts.project(embedding)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.dims != 0 && len(embedding) != m.dims {
+		return fmt.Errorf("%w: got %d, want %d", ErrDimensionMismatch, len(embedding), m.dims)
+	}
+	return nil
+}
+
+// StatsByModel returns cache statistics broken down by request model.
+func (m *MemoryCache) StatsByModel(ctx context.Context) map[string]*api.CacheStats {
+	m.mu.RLock()
+	entries := make(map[string]int64, len(m.models))
+	for model, n := range m.models {
+		entries[model] = int64(n)
+	}
+	m.mu.RUnlock()
+
+	return m.byModel.snapshot(entries)
+}
+
+// Cleanup removes expired entries, keeping those still within the
+// StaleWhileRevalidate window. With Options.EvictExpired, they are passed
+// to OnEvict.
 func (m *MemoryCache) Cleanup(ctx context.Context) int {
+	var expired []*api.CacheEntry
+	defer func() { m.opts.onEvict(expired) }()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	now := time.Now()
+	now := time.Now().Add(-m.opts.StaleWhileRevalidate)
 	removed := 0
+	report := m.opts.OnEvict != nil && m.opts.EvictExpired
 
-	// Filter out expired entries
-	active := make([]*api.CacheEntry, 0, len(m.entries))
-	for _, e := range m.entries {
-		if now.Before(e.ExpiresAt) {
-			active = append(active, e)
-		} else {
+	// Iterate backwards so swap-removal doesn't skip entries
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		if me := m.entries[i]; !now.Before(me.entry.ExpiresAt) {
+			m.remove(me)
 			removed++
+			if report {
+				expired = append(expired, me.export())
+			}
 		}
 	}
 
-	m.entries = active
+	m.opts.logCleanup(ctx, removed)
 	return removed
 }
 
@@ -208,12 +1112,30 @@ func (m *MemoryCache) Size(ctx context.Context) int {
 	return len(m.entries)
 }
 
-// cleanupLoop periodically removes expired entries.
+// cleanupLoop periodically removes expired entries and, with
+// Options.Compaction, merges near-duplicates.
 func (m *MemoryCache) cleanupLoop() {
 	ticker := time.NewTicker(m.opts.CleanupInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		m.Cleanup(context.Background())
+	compactEvery := m.opts.Compaction.interval(m.opts.CleanupInterval)
+	lastCompact := time.Now()
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			m.Cleanup(context.Background())
+			if m.opts.Compaction.Threshold != 0 && now.Sub(lastCompact) >= compactEvery {
+				m.Compact(context.Background())
+				lastCompact = now
+			}
+		}
 	}
 }
+
+// Close stops the cleanup goroutine.
+func (m *MemoryCache) Close() error {
+	m.closeOnce.Do(func() { close(m.done) })
+	return nil
+}
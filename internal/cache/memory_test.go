@@ -1,7 +1,17 @@
 package cache
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -58,6 +68,34 @@ func TestNewMemoryCache(t *testing.T) {
 	})
 }
 
+func TestMemoryCacheClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 50; i++ {
+		cache := NewMemoryCache(&Options{
+			MaxSize:         10,
+			DefaultTTL:      time.Hour,
+			CleanupInterval: time.Millisecond,
+		})
+		if err := cache.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		// Close is idempotent
+		if err := cache.Close(); err != nil {
+			t.Fatalf("second Close failed: %v", err)
+		}
+	}
+
+	// Cleanup goroutines exit asynchronously after Close
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("expected cleanup goroutines to exit, got %d goroutines (was %d)", n, before)
+	}
+}
+
 func TestMemoryCacheSetAndGet(t *testing.T) {
 	cache := NewMemoryCache(&Options{
 		MaxSize:         100,
@@ -151,11 +189,11 @@ func TestMemoryCacheStats(t *testing.T) {
 	cache.Set(ctx, entry)
 
 	// Generate some hits and misses
-	cache.Get(ctx, embedding, 0.9)                  // hit
-	cache.Get(ctx, embedding, 0.9)                  // hit
-	cache.Get(ctx, []float64{0, 1, 0}, 0.9)         // miss
-	cache.Get(ctx, []float64{0, 0, 1}, 0.9)         // miss
-	cache.Get(ctx, []float64{-1, 0, 0}, 0.9)        // miss
+	cache.Get(ctx, embedding, 0.9)           // hit
+	cache.Get(ctx, embedding, 0.9)           // hit
+	cache.Get(ctx, []float64{0, 1, 0}, 0.9)  // miss
+	cache.Get(ctx, []float64{0, 0, 1}, 0.9)  // miss
+	cache.Get(ctx, []float64{-1, 0, 0}, 0.9) // miss
 
 	// Allow async hit stats update
 	time.Sleep(10 * time.Millisecond)
@@ -176,6 +214,94 @@ func TestMemoryCacheStats(t *testing.T) {
 	}
 }
 
+func TestMemoryCacheStatsConsistent(t *testing.T) {
+	cache := NewMemoryCache(&Options{
+		MaxSize:         100,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		DefaultPrice:    ModelPrice{InputPer1K: 1, OutputPer1K: 1},
+	})
+	defer cache.Close()
+	ctx := context.Background()
+
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	entry.Response.Usage = api.Usage{PromptTokens: 500, CompletionTokens: 500, TotalTokens: 1000}
+	cache.Set(ctx, entry)
+	perHit := cache.opts.hitSavings(entry)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			cache.Get(ctx, []float64{1, 0, 0}, 0.9)
+		}
+	}()
+
+	// Every snapshot must pair each hit with its savings
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		stats := cache.Stats(ctx)
+		if want := float64(stats.TotalHits) * perHit; math.Abs(stats.EstimatedSaved-want) > 1e-9 {
+			t.Fatalf("inconsistent snapshot: %d hits but $%f saved, want $%f", stats.TotalHits, stats.EstimatedSaved, want)
+		}
+	}
+}
+
+func TestMemoryCacheStatsByModel(t *testing.T) {
+	cache := NewMemoryCache(&Options{
+		MaxSize:         100,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+	})
+	ctx := context.Background()
+
+	chatEntry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	chatEntry.Request.Model = "chat-model"
+	cache.Set(ctx, chatEntry)
+
+	codeEntry := newTestEntry([]float64{0, 1, 0}, time.Hour)
+	codeEntry.Request.Model = "code-model"
+	cache.Set(ctx, codeEntry)
+
+	chatCtx := WithModel(ctx, "chat-model")
+	codeCtx := WithModel(ctx, "code-model")
+
+	cache.Get(chatCtx, []float64{1, 0, 0}, 0.9) // hit
+	cache.Get(chatCtx, []float64{1, 0, 0}, 0.9) // hit
+	cache.Get(codeCtx, []float64{0, 1, 0}, 0.9) // hit
+	cache.Get(codeCtx, []float64{0, 0, 1}, 0.9) // miss
+	cache.Get(codeCtx, []float64{0, 0, 1}, 0.9) // miss
+	cache.Get(ctx, []float64{0, 0, 1}, 0.9)     // miss, no model
+
+	stats := cache.StatsByModel(ctx)
+
+	chat := stats["chat-model"]
+	if chat == nil || chat.TotalHits != 2 || chat.TotalMisses != 0 || chat.TotalEntries != 1 {
+		t.Errorf("unexpected chat-model stats: %+v", chat)
+	}
+
+	code := stats["code-model"]
+	if code == nil || code.TotalHits != 1 || code.TotalMisses != 2 || code.TotalEntries != 1 {
+		t.Errorf("unexpected code-model stats: %+v", code)
+	}
+	if code != nil && math.Abs(code.HitRate-1.0/3) > 1e-9 {
+		t.Errorf("expected code-model HitRate=0.333, got %f", code.HitRate)
+	}
+
+	if unknown := stats[unknownModel]; unknown == nil || unknown.TotalMisses != 1 {
+		t.Errorf("expected miss without model to be attributed to %q, got %+v", unknownModel, unknown)
+	}
+
+	cache.Clear(ctx)
+	if stats := cache.StatsByModel(ctx); len(stats) != 0 {
+		t.Errorf("expected no per-model stats after clear, got %d", len(stats))
+	}
+}
+
 func TestMemoryCacheDelete(t *testing.T) {
 	cache := NewMemoryCache(&Options{
 		MaxSize:         100,
@@ -192,9 +318,9 @@ func TestMemoryCacheDelete(t *testing.T) {
 		t.Fatalf("expected size=1, got %d", cache.Size(ctx))
 	}
 
-	err := cache.Delete(ctx, embedding)
+	err := cache.DeleteByEmbedding(ctx, embedding)
 	if err != nil {
-		t.Fatalf("Delete failed: %v", err)
+		t.Fatalf("DeleteByEmbedding failed: %v", err)
 	}
 
 	if cache.Size(ctx) != 0 {
@@ -202,6 +328,165 @@ func TestMemoryCacheDelete(t *testing.T) {
 	}
 }
 
+func TestMemoryCacheTargetedDelete(t *testing.T) {
+	ctx := context.Background()
+
+	newCache := func() *MemoryCache {
+		cache := NewMemoryCache(&Options{MaxSize: 100, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+		t.Cleanup(func() { cache.Close() })
+
+		now := time.Now()
+		for i, model := range []string{"gpt-4", "gpt-4o", "gpt-4", "gpt-4o"} {
+			entry := newTestEntry([]float64{float64(i), 1, 0}, time.Hour)
+			entry.Request.Model = model
+			entry.CreatedAt = now.Add(-time.Duration(i) * time.Minute)
+			cache.Set(ctx, entry)
+		}
+		return cache
+	}
+
+	tests := []struct {
+		name    string
+		delete  func(*MemoryCache) (int, error)
+		removed int
+	}{
+		{"by model", func(c *MemoryCache) (int, error) { return c.DeleteByModel(ctx, "gpt-4") }, 2},
+		{"by unknown model", func(c *MemoryCache) (int, error) { return c.DeleteByModel(ctx, "o1") }, 0},
+		{"older than", func(c *MemoryCache) (int, error) {
+			return c.DeleteOlderThan(ctx, time.Now().Add(-90*time.Second))
+		}, 2},
+		{"older than future", func(c *MemoryCache) (int, error) {
+			return c.DeleteOlderThan(ctx, time.Now().Add(time.Hour))
+		}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newCache()
+			removed, err := tt.delete(cache)
+			if err != nil {
+				t.Fatalf("delete failed: %v", err)
+			}
+			if removed != tt.removed {
+				t.Errorf("expected %d removed, got %d", tt.removed, removed)
+			}
+			if cache.Size(ctx) != 4-tt.removed {
+				t.Errorf("expected size=%d, got %d", 4-tt.removed, cache.Size(ctx))
+			}
+		})
+	}
+}
+
+func TestMemoryCacheEntryID(t *testing.T) {
+	cache := NewMemoryCache(&Options{
+		MaxSize:         100,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+	})
+	ctx := context.Background()
+
+	t.Run("set assigns an ID", func(t *testing.T) {
+		entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+		cache.Set(ctx, entry)
+
+		if entry.ID == "" {
+			t.Fatal("expected Set to assign an ID")
+		}
+
+		result, found := cache.GetByID(ctx, entry.ID)
+		if !found {
+			t.Fatal("expected to find entry by ID")
+		}
+		if result.ID != entry.ID || result.Response.ID != entry.Response.ID {
+			t.Error("GetByID returned a different entry")
+		}
+
+		stats := cache.Stats(ctx)
+		if stats.TotalHits != 0 || stats.TotalMisses != 0 {
+			t.Error("expected GetByID not to affect hit statistics")
+		}
+	})
+
+	t.Run("same ID updates in place", func(t *testing.T) {
+		cache.Clear(ctx)
+
+		first := newTestEntry([]float64{1, 0, 0}, time.Hour)
+		first.ID = "fixed"
+		cache.Set(ctx, first)
+
+		second := newTestEntry([]float64{0, 1, 0}, time.Hour)
+		second.ID = "fixed"
+		cache.Set(ctx, second)
+
+		if cache.Size(ctx) != 1 {
+			t.Errorf("expected size=1, got %d", cache.Size(ctx))
+		}
+		if _, _, found := cache.Get(ctx, []float64{0, 1, 0}, 0.99); !found {
+			t.Error("expected updated embedding to be searchable")
+		}
+	})
+
+	t.Run("delete by ID", func(t *testing.T) {
+		cache.Clear(ctx)
+
+		keep := newTestEntry([]float64{1, 0, 0}, time.Hour)
+		drop := newTestEntry([]float64{0, 1, 0}, time.Hour)
+		cache.Set(ctx, keep)
+		cache.Set(ctx, drop)
+
+		if err := cache.Delete(ctx, drop.ID); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if _, found := cache.GetByID(ctx, drop.ID); found {
+			t.Error("expected deleted entry to be gone")
+		}
+		if _, found := cache.GetByID(ctx, keep.ID); !found {
+			t.Error("expected other entry to remain")
+		}
+	})
+
+	t.Run("unknown ID", func(t *testing.T) {
+		if _, found := cache.GetByID(ctx, "missing"); found {
+			t.Error("expected miss for unknown ID")
+		}
+		if err := cache.Delete(ctx, "missing"); err != nil {
+			t.Errorf("expected no error deleting unknown ID, got %v", err)
+		}
+	})
+}
+
+func TestMemoryCacheReturnsCopies(t *testing.T) {
+	cache := NewMemoryCache(&Options{
+		MaxSize:         100,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+	})
+	ctx := context.Background()
+
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	cache.Set(ctx, entry)
+
+	got, _, found := cache.Get(ctx, []float64{1, 0, 0}, 0.9)
+	if !found {
+		t.Fatal("expected hit")
+	}
+	got.Response.ID = "changed"
+	got.Response.Choices[0].Message.Content = "changed"
+	got.Request.Messages[0].Content = "changed"
+	got.Embedding[0] = 0
+
+	again, _, found := cache.Get(ctx, []float64{1, 0, 0}, 0.9)
+	if !found {
+		t.Fatal("expected hit after mutating a returned entry")
+	}
+	if again.Response.ID != "test-id" || again.Response.Choices[0].Message.Content != "test response" {
+		t.Errorf("mutating a returned entry changed the cached response: %+v", again.Response)
+	}
+	if again.Request.Messages[0].Content != "test" || again.Embedding[0] != 1 {
+		t.Error("mutating a returned entry changed the cached request or embedding")
+	}
+}
+
 func TestMemoryCacheClear(t *testing.T) {
 	cache := NewMemoryCache(&Options{
 		MaxSize:         100,
@@ -237,6 +522,84 @@ func TestMemoryCacheClear(t *testing.T) {
 	}
 }
 
+func TestMemoryCacheClearDuringGet(t *testing.T) {
+	policies := []EvictionPolicy{EvictLRU, EvictFIFO, EvictLFU, EvictTinyLFU}
+
+	for _, policy := range policies {
+		t.Run(policy.String(), func(t *testing.T) {
+			ctx := context.Background()
+			cache := NewMemoryCache(&Options{
+				MaxSize:         2,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+				EvictionPolicy:  policy,
+			})
+			defer cache.Close()
+
+			// A hit recorded after Clear, as by a Get whose scan finished
+			// just before it, must not bring the entry back into tracking
+			cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour))
+			cache.mu.RLock()
+			stale := cache.entries[0]
+			cache.mu.RUnlock()
+			cache.Clear(ctx)
+			cache.updateHitStats(stale, time.Now(), false)
+
+			for i, emb := range [][]float64{{0, 1, 0}, {0, 0, 1}, {1, 1, 0}} {
+				if err := cache.Set(ctx, newTestEntry(emb, time.Hour)); err != nil {
+					t.Fatalf("Set %d failed: %v", i, err)
+				}
+			}
+			if size := cache.Size(ctx); size != 2 {
+				t.Errorf("expected 2 entries after eviction, got %d", size)
+			}
+			checkMemoryCacheIndexes(t, cache)
+
+			// The same under concurrency, for the race detector
+			var wg sync.WaitGroup
+			for g := 0; g < 4; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 200; i++ {
+						emb := []float64{float64(g), float64(i % 3), 1}
+						switch i % 4 {
+						case 0:
+							cache.Clear(ctx)
+						case 1:
+							cache.Set(ctx, newTestEntry(emb, time.Hour))
+						default:
+							cache.Get(ctx, emb, 0.9)
+							cache.GetExact(ctx, &newTestEntry(emb, time.Hour).Request)
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+			if size := cache.Size(ctx); size > 2 {
+				t.Errorf("expected at most 2 entries, got %d", size)
+			}
+			checkMemoryCacheIndexes(t, cache)
+		})
+	}
+}
+
+// checkMemoryCacheIndexes fails the test unless the entry slice and ID
+// index of the cache agree.
+func checkMemoryCacheIndexes(t *testing.T, cache *MemoryCache) {
+	t.Helper()
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	if len(cache.byID) != len(cache.entries) {
+		t.Fatalf("expected %d entries indexed by ID, got %d", len(cache.entries), len(cache.byID))
+	}
+	for id, me := range cache.byID {
+		if me.idx >= len(cache.entries) || cache.entries[me.idx] != me {
+			t.Fatalf("entry %s is not at its index %d", id, me.idx)
+		}
+	}
+}
+
 func TestMemoryCacheEviction(t *testing.T) {
 	cache := NewMemoryCache(&Options{
 		MaxSize:         3,
@@ -274,6 +637,297 @@ func TestMemoryCacheEviction(t *testing.T) {
 	}
 }
 
+func TestMemoryCacheMaxBytes(t *testing.T) {
+	// Measure one stored entry to size the budget
+	probe := NewMemoryCache(&Options{MaxSize: 100, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	probe.Set(context.Background(), newTestEntry([]float64{1, 0, 0}, time.Hour))
+	size := probe.Stats(context.Background()).TotalBytes
+	probe.Close()
+
+	cache := NewMemoryCache(&Options{
+		MaxSize:         100,
+		MaxBytes:        3*size + size/2,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+	})
+	ctx := context.Background()
+
+	embeddings := [][]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {1, 1, 0}}
+	var last *api.CacheEntry
+	for i, emb := range embeddings {
+		entry := newTestEntry(emb, time.Hour)
+		entry.Request.Messages[0].Content = string(rune('A' + i))
+		if err := cache.Set(ctx, entry); err != nil {
+			t.Fatalf("Set %d: %v", i, err)
+		}
+		last = entry
+	}
+
+	stats := cache.Stats(ctx)
+	if stats.TotalEntries != 3 {
+		t.Errorf("expected 3 entries within the byte budget, got %d", stats.TotalEntries)
+	}
+	if stats.TotalBytes <= 0 || stats.TotalBytes > cache.opts.MaxBytes {
+		t.Errorf("expected 0 < total_bytes <= %d, got %d", cache.opts.MaxBytes, stats.TotalBytes)
+	}
+	if stats.Evictions != 1 {
+		t.Errorf("expected 1 eviction, got %d", stats.Evictions)
+	}
+
+	t.Run("oversized entry rejected", func(t *testing.T) {
+		big := newTestEntry([]float64{1, 0, 1}, time.Hour)
+		big.Response.Choices[0].Message.Content = strings.Repeat("x", int(cache.opts.MaxBytes))
+		if err := cache.Set(ctx, big); err != ErrCacheFull {
+			t.Fatalf("expected ErrCacheFull, got %v", err)
+		}
+		if got := cache.Size(ctx); got != 3 {
+			t.Errorf("oversized entry should not evict, size=%d", got)
+		}
+	})
+
+	t.Run("delete and clear release bytes", func(t *testing.T) {
+		before := cache.Stats(ctx).TotalBytes
+		if err := cache.Delete(ctx, last.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if after := cache.Stats(ctx).TotalBytes; after >= before {
+			t.Errorf("expected bytes to drop after delete, %d -> %d", before, after)
+		}
+		cache.Clear(ctx)
+		if got := cache.Stats(ctx).TotalBytes; got != 0 {
+			t.Errorf("expected 0 bytes after clear, got %d", got)
+		}
+	})
+}
+
+func TestMemoryCacheLRUEviction(t *testing.T) {
+	cache := NewMemoryCache(&Options{
+		MaxSize:         3,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+	})
+	ctx := context.Background()
+
+	embeddings := [][]float64{
+		{1, 0, 0},
+		{0, 1, 0},
+		{0, 0, 1},
+	}
+	for _, emb := range embeddings {
+		cache.Set(ctx, newTestEntry(emb, time.Hour))
+	}
+
+	// Touch the first entry so the second becomes least recently used
+	if _, _, found := cache.Get(ctx, embeddings[0], 0.99); !found {
+		t.Fatal("expected hit on first entry")
+	}
+
+	newEmb := []float64{1, 1, 0}
+	cache.Set(ctx, newTestEntry(newEmb, time.Hour))
+
+	if _, _, found := cache.Get(ctx, embeddings[1], 0.99); found {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	for _, emb := range [][]float64{embeddings[0], embeddings[2], newEmb} {
+		if _, _, found := cache.Get(ctx, emb, 0.99); !found {
+			t.Errorf("expected entry %v to survive eviction", emb)
+		}
+	}
+}
+
+func TestMemoryCacheEvictionPolicy(t *testing.T) {
+	embeddings := [][]float64{
+		{1, 0, 0},
+		{0, 1, 0},
+		{0, 0, 1},
+	}
+
+	tests := []struct {
+		name    string
+		policy  EvictionPolicy
+		evicted int // index into embeddings, -1 if Set must fail
+	}{
+		// Entry 0 is oldest, entry 1 is hit most but least recently,
+		// entry 2 is hit least
+		{"LRU evicts least recently used", EvictLRU, 1},
+		{"LFU evicts least frequently used", EvictLFU, 2},
+		{"FIFO evicts oldest insert", EvictFIFO, 0},
+		{"TTL refuses to evict live entries", EvictTTL, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewMemoryCache(&Options{
+				MaxSize:         3,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+				EvictionPolicy:  tt.policy,
+			})
+			ctx := context.Background()
+
+			for _, emb := range embeddings {
+				cache.Set(ctx, newTestEntry(emb, time.Hour))
+			}
+			for _, i := range []int{1, 1, 1, 2, 0, 0} {
+				cache.Get(ctx, embeddings[i], 0.99)
+			}
+
+			err := cache.Set(ctx, newTestEntry([]float64{1, 1, 0}, time.Hour))
+			if tt.evicted < 0 {
+				if err != ErrCacheFull {
+					t.Fatalf("expected ErrCacheFull, got %v", err)
+				}
+				if cache.Size(ctx) != 3 {
+					t.Errorf("expected size=3, got %d", cache.Size(ctx))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+
+			for i, emb := range embeddings {
+				_, _, found := cache.Get(ctx, emb, 0.99)
+				if i == tt.evicted && found {
+					t.Errorf("expected entry %d to be evicted", i)
+				}
+				if i != tt.evicted && !found {
+					t.Errorf("expected entry %d to survive", i)
+				}
+			}
+		})
+	}
+
+	t.Run("TTL evicts expired entries", func(t *testing.T) {
+		cache := NewMemoryCache(&Options{
+			MaxSize:         2,
+			DefaultTTL:      time.Hour,
+			CleanupInterval: time.Hour,
+			EvictionPolicy:  EvictTTL,
+		})
+		ctx := context.Background()
+
+		expired := newTestEntry([]float64{1, 0, 0}, time.Hour)
+		expired.ExpiresAt = time.Now().Add(-time.Second)
+		cache.Set(ctx, expired)
+		cache.Set(ctx, newTestEntry([]float64{0, 1, 0}, time.Hour))
+
+		if err := cache.Set(ctx, newTestEntry([]float64{0, 0, 1}, time.Hour)); err != nil {
+			t.Fatalf("expected expired entry to make room, got %v", err)
+		}
+		if stats := cache.Stats(ctx); stats.Evictions != 1 {
+			t.Errorf("expected 1 eviction, got %d", stats.Evictions)
+		}
+	})
+}
+
+func TestMemoryCacheModelQuotas(t *testing.T) {
+	ctx := context.Background()
+	vec := func(i int) []float64 {
+		v := make([]float64, 6)
+		v[i] = 1
+		return v
+	}
+	entry := func(i int, model string) *api.CacheEntry {
+		e := newTestEntry(vec(i), time.Hour)
+		e.Request.Model = model
+		e.Request.Messages[0].Content = fmt.Sprintf("prompt %d", i)
+		return e
+	}
+
+	tests := []struct {
+		name   string
+		policy EvictionPolicy
+		quota  ModelQuota
+	}{
+		{"LRU with max entries", EvictLRU, ModelQuota{MaxEntries: 2}},
+		{"LFU with max entries", EvictLFU, ModelQuota{MaxEntries: 2}},
+		{"FIFO with fraction", EvictFIFO, ModelQuota{Fraction: 0.5}},
+		{"TinyLFU with fraction", EvictTinyLFU, ModelQuota{Fraction: 0.5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewMemoryCache(&Options{
+				MaxSize:         4,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+				EvictionPolicy:  tt.policy,
+				ModelQuotas:     map[string]ModelQuota{"chatty": tt.quota},
+			})
+
+			// The quiet model's entry is the oldest and least hit, but
+			// chatty holds more than its share while there is room
+			cache.Set(ctx, entry(0, "quiet"))
+			for i := 1; i <= 3; i++ {
+				cache.Set(ctx, entry(i, "chatty"))
+			}
+			for _, i := range []int{1, 2, 3, 1, 2, 3} {
+				cache.Get(ctx, vec(i), 0.99)
+			}
+
+			if err := cache.Set(ctx, entry(4, "other")); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			if _, _, found := cache.Get(ctx, vec(0), 0.99); !found {
+				t.Error("expected the unlisted model's entry to survive")
+			}
+			stats := cache.StatsByModel(ctx)
+			if got := stats["chatty"].TotalEntries; got != 2 {
+				t.Errorf("expected chatty to be evicted down to its quota of 2, got %d", got)
+			}
+			if got := stats["other"].TotalEntries; got != 1 {
+				t.Errorf("expected the new entry to be stored, got %d", got)
+			}
+		})
+	}
+
+	t.Run("unlisted models share the remainder", func(t *testing.T) {
+		cache := NewMemoryCache(&Options{
+			MaxSize:         4,
+			DefaultTTL:      time.Hour,
+			CleanupInterval: time.Hour,
+			ModelQuotas:     map[string]ModelQuota{"chatty": {MaxEntries: 2}},
+		})
+
+		// Chatty stays within its quota; the unlisted models fill the
+		// remaining two slots, so the oldest of them goes
+		cache.Set(ctx, entry(0, "chatty"))
+		cache.Set(ctx, entry(1, "quiet"))
+		cache.Set(ctx, entry(2, "other"))
+		cache.Set(ctx, entry(3, "chatty"))
+		if err := cache.Set(ctx, entry(4, "quiet")); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+
+		for i, want := range []bool{true, false, true, true, true} {
+			if _, _, found := cache.Get(ctx, vec(i), 0.99); found != want {
+				t.Errorf("entry %d: expected found=%v", i, want)
+			}
+		}
+	})
+}
+
+func TestMemoryCacheNewEntrySurvivesEviction(t *testing.T) {
+	cache := NewMemoryCache(&Options{
+		MaxSize:         2,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+	})
+	ctx := context.Background()
+
+	cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour))
+	cache.Get(ctx, []float64{1, 0, 0}, 0.99) // hit, LastHitAt is now set
+
+	// Never-hit entries must not be treated as oldest
+	cache.Set(ctx, newTestEntry([]float64{0, 1, 0}, time.Hour))
+	cache.Set(ctx, newTestEntry([]float64{0, 0, 1}, time.Hour))
+
+	if _, _, found := cache.Get(ctx, []float64{0, 0, 1}, 0.99); !found {
+		t.Error("expected just-inserted entry to survive")
+	}
+}
+
 func TestMemoryCacheCleanup(t *testing.T) {
 	cache := NewMemoryCache(&Options{
 		MaxSize:         100,
@@ -305,6 +959,61 @@ func TestMemoryCacheCleanup(t *testing.T) {
 	}
 }
 
+func TestMemoryCacheStaleWhileRevalidate(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		window    time.Duration
+		expiredBy time.Duration
+		wantHit   bool
+		wantKept  bool
+	}{
+		{"live entry", time.Hour, -time.Minute, true, true},
+		{"within window", time.Hour, time.Minute, true, true},
+		{"past window", time.Hour, 2 * time.Hour, false, false},
+		{"disabled", 0, time.Minute, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemoryCache(&Options{
+				MaxSize:              100,
+				DefaultTTL:           time.Hour,
+				CleanupInterval:      time.Hour,
+				StaleWhileRevalidate: tt.window,
+			})
+			defer c.Close()
+
+			entry := newTestEntry([]float64{1, 0, 0}, -tt.expiredBy)
+			if err := c.Set(ctx, entry); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			wantStale := tt.expiredBy > 0
+
+			got, _, found := c.Get(ctx, []float64{1, 0, 0}, 0.9)
+			if found != tt.wantHit {
+				t.Fatalf("Get: expected found=%v, got %v", tt.wantHit, found)
+			}
+			if found && got.Stale != wantStale {
+				t.Errorf("Get: expected stale=%v, got %v", wantStale, got.Stale)
+			}
+
+			got, found = c.GetExact(ctx, &entry.Request)
+			if found != tt.wantHit {
+				t.Fatalf("GetExact: expected found=%v, got %v", tt.wantHit, found)
+			}
+			if found && got.Stale != wantStale {
+				t.Errorf("GetExact: expected stale=%v, got %v", wantStale, got.Stale)
+			}
+
+			c.Cleanup(ctx)
+			if kept := c.Size(ctx) == 1; kept != tt.wantKept {
+				t.Errorf("expected kept=%v after cleanup, got %v", tt.wantKept, kept)
+			}
+		})
+	}
+}
+
 func TestMemoryCacheUpdateExisting(t *testing.T) {
 	cache := NewMemoryCache(&Options{
 		MaxSize:         100,
@@ -338,27 +1047,157 @@ func TestMemoryCacheUpdateExisting(t *testing.T) {
 	}
 }
 
-func BenchmarkMemoryCacheGet(b *testing.B) {
-	cache := NewMemoryCache(&Options{
-		MaxSize:         10000,
-		DefaultTTL:      time.Hour,
-		CleanupInterval: time.Hour,
-	})
+func TestMemoryCacheMetric(t *testing.T) {
 	ctx := context.Background()
 
-	// Pre-populate cache with 1000 entries
-	for i := 0; i < 1000; i++ {
-		embedding := make([]float64, 768)
-		for j := range embedding {
-			embedding[j] = float64(i*768+j) / 768000.0
-		}
-		entry := newTestEntry(embedding, time.Hour)
-		cache.Set(ctx, entry)
-	}
+	t.Run("dot product with normalize on set", func(t *testing.T) {
+		cache := NewMemoryCache(&Options{
+			MaxSize:         100,
+			DefaultTTL:      time.Hour,
+			CleanupInterval: time.Hour,
+			Metric:          MetricDotProduct,
+			NormalizeOnSet:  true,
+		})
 
-	queryEmb := make([]float64, 768)
-	for i := range queryEmb {
-		queryEmb[i] = float64(i) / 768.0
+		cache.Set(ctx, newTestEntry([]float64{3, 4, 0}, time.Hour))
+
+		// Query must be normalized by the caller
+		result, similarity, found := cache.Get(ctx, []float64{0.6, 0.8, 0}, 0.99)
+		if !found {
+			t.Fatal("expected to find normalized entry")
+		}
+		if similarity < 0.99 {
+			t.Errorf("expected similarity >= 0.99, got %f", similarity)
+		}
+		// Embeddings are stored at float32 precision
+		if math.Abs(result.Embedding[0]-0.6) > 1e-6 {
+			t.Errorf("expected stored embedding to be normalized, got %v", result.Embedding)
+		}
+	})
+
+	t.Run("cosine with normalize on set", func(t *testing.T) {
+		cache := NewMemoryCache(&Options{
+			MaxSize:         100,
+			DefaultTTL:      time.Hour,
+			CleanupInterval: time.Hour,
+			NormalizeOnSet:  true,
+		})
+
+		cache.Set(ctx, newTestEntry([]float64{3, 4, 0}, time.Hour))
+
+		// Queries need not be normalized; scores are still cosine
+		query := []float64{0, 8, 6}
+		want := CosineSimilarity([]float64{3, 4, 0}, query)
+		if _, similarity, found := cache.Get(ctx, query, 0.5); !found || math.Abs(similarity-want) > 1e-6 {
+			t.Errorf("expected Get similarity %f, got %f (found %v)", want, similarity, found)
+		}
+		if results := cache.Search(ctx, query, 0.5, 1); len(results) != 1 || math.Abs(results[0].Similarity-want) > 1e-6 {
+			t.Errorf("expected Search similarity %f, got %+v", want, results)
+		}
+		if results := cache.GetBatch(ctx, [][]float64{query}, 0.5); results[0] == nil || math.Abs(results[0].Similarity-want) > 1e-6 {
+			t.Errorf("expected GetBatch similarity %f, got %+v", want, results[0])
+		}
+	})
+
+	t.Run("euclidean", func(t *testing.T) {
+		cache := NewMemoryCache(&Options{
+			MaxSize:         100,
+			DefaultTTL:      time.Hour,
+			CleanupInterval: time.Hour,
+			Metric:          MetricEuclidean,
+		})
+
+		cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour))
+
+		if _, _, found := cache.Get(ctx, []float64{1, 0.01, 0}, 0.95); !found {
+			t.Error("expected hit for nearby vector")
+		}
+		if _, _, found := cache.Get(ctx, []float64{0, 1, 0}, 0.95); found {
+			t.Error("expected miss for distant vector")
+		}
+	})
+	t.Run("per-query euclidean distance", func(t *testing.T) {
+		cache := NewMemoryCache(&Options{
+			MaxSize:         100,
+			DefaultTTL:      time.Hour,
+			CleanupInterval: time.Hour,
+		})
+
+		near := newTestEntry([]float64{1, 0.1, 0}, time.Hour)
+		near.Response.ID = "near"
+		cache.Set(ctx, near)
+		far := newTestEntry([]float64{1, 0.3, 0}, time.Hour)
+		far.Response.ID = "far"
+		cache.Set(ctx, far)
+
+		// Threshold is a maximum distance; the smallest distance wins
+		distCtx := WithMetric(ctx, MetricEuclideanDistance)
+		got, distance, found := cache.Get(distCtx, []float64{1, 0, 0}, 0.2)
+		if !found || got.Response.ID != "near" {
+			t.Fatalf("expected nearest entry, got %v", got)
+		}
+		if math.Abs(distance-0.1) > 1e-6 {
+			t.Errorf("expected distance 0.1, got %f", distance)
+		}
+		if _, _, found := cache.Get(distCtx, []float64{1, 0, 0}, 0.05); found {
+			t.Error("expected miss beyond the maximum distance")
+		}
+
+		results := cache.Search(distCtx, []float64{1, 0, 0}, 0.5, 5)
+		if len(results) != 2 || results[0].Entry.Response.ID != "near" || results[0].Similarity > results[1].Similarity {
+			t.Errorf("expected results by ascending distance, got %+v", results)
+		}
+	})
+	t.Run("manhattan distance", func(t *testing.T) {
+		cache := NewMemoryCache(&Options{
+			MaxSize:         100,
+			DefaultTTL:      time.Hour,
+			CleanupInterval: time.Hour,
+			Metric:          MetricManhattanDistance,
+		})
+
+		// L1 ranks these the other way round from L2
+		diagonal := newTestEntry([]float64{1, 0.3, 0.3}, time.Hour)
+		diagonal.Response.ID = "diagonal"
+		cache.Set(ctx, diagonal)
+		axis := newTestEntry([]float64{1, 0.5, 0}, time.Hour)
+		axis.Response.ID = "axis"
+		cache.Set(ctx, axis)
+
+		got, distance, found := cache.Get(ctx, []float64{1, 0, 0}, 0.55)
+		if !found || got.Response.ID != "axis" {
+			t.Fatalf("expected nearest entry by L1, got %v", got)
+		}
+		if math.Abs(distance-0.5) > 1e-6 {
+			t.Errorf("expected distance 0.5, got %f", distance)
+		}
+		if _, _, found := cache.Get(ctx, []float64{1, 0, 0}, 0.4); found {
+			t.Error("expected miss beyond the maximum distance")
+		}
+	})
+}
+
+func BenchmarkMemoryCacheGet(b *testing.B) {
+	cache := NewMemoryCache(&Options{
+		MaxSize:         10000,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+	})
+	ctx := context.Background()
+
+	// Pre-populate cache with 1000 entries
+	for i := 0; i < 1000; i++ {
+		embedding := make([]float64, 768)
+		for j := range embedding {
+			embedding[j] = float64(i*768+j) / 768000.0
+		}
+		entry := newTestEntry(embedding, time.Hour)
+		cache.Set(ctx, entry)
+	}
+
+	queryEmb := make([]float64, 768)
+	for i := range queryEmb {
+		queryEmb[i] = float64(i) / 768.0
 	}
 
 	b.ResetTimer()
@@ -366,3 +1205,1350 @@ func BenchmarkMemoryCacheGet(b *testing.B) {
 		cache.Get(ctx, queryEmb, 0.95)
 	}
 }
+
+func BenchmarkMemoryCacheSetAtCapacity(b *testing.B) {
+	const maxSize = 10000
+	cache := NewMemoryCache(&Options{
+		MaxSize:         maxSize,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+	})
+	ctx := context.Background()
+
+	// Random 16-dim vectors are practically never near-duplicates, so every
+	// Set past capacity triggers an eviction.
+	rng := rand.New(rand.NewSource(1))
+	randomEmbedding := func() []float64 {
+		v := make([]float64, 16)
+		for i := range v {
+			v[i] = rng.NormFloat64()
+		}
+		return v
+	}
+
+	for i := 0; i < maxSize; i++ {
+		cache.Set(ctx, newTestEntry(randomEmbedding(), time.Hour))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Set(ctx, newTestEntry(randomEmbedding(), time.Hour))
+	}
+}
+
+func TestMemoryCacheNonFiniteEmbedding(t *testing.T) {
+	for _, hnsw := range []bool{false, true} {
+		t.Run(fmt.Sprintf("hnsw=%v", hnsw), func(t *testing.T) {
+			ctx := context.Background()
+			opts := &Options{MaxSize: 10, DefaultTTL: time.Hour, CleanupInterval: time.Hour}
+			opts.HNSW.Enabled = hnsw
+			cache := NewMemoryCache(opts)
+			defer cache.Close()
+
+			cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour))
+			bad := []float64{1, math.NaN(), math.Inf(1)}
+
+			if err := cache.Set(ctx, newTestEntry(bad, time.Hour)); !errors.Is(err, ErrInvalidEmbedding) {
+				t.Errorf("expected ErrInvalidEmbedding, got %v", err)
+			}
+			if _, _, found := cache.Get(ctx, bad, 0); found {
+				t.Error("expected non-finite query to miss")
+			}
+			if results := cache.Search(ctx, bad, 0, 5); len(results) != 0 {
+				t.Errorf("expected no search results, got %d", len(results))
+			}
+			results := cache.GetBatch(ctx, [][]float64{bad, {1, 0, 0}}, 0.9)
+			if results[0] != nil || results[1] == nil {
+				t.Errorf("expected only the finite query to hit, got %v", results)
+			}
+
+			stats := cache.Stats(ctx)
+			if stats.TotalEntries != 1 || stats.TotalMisses != 2 || stats.DimensionMismatches != 0 {
+				t.Errorf("expected 1 entry and 2 plain misses, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheDisableDedupOnSet(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(&Options{
+		MaxSize:           10,
+		DefaultTTL:        time.Hour,
+		CleanupInterval:   time.Hour,
+		DisableDedupOnSet: true,
+	})
+	defer cache.Close()
+
+	// Near-duplicate embeddings for different requests are kept apart
+	first := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	first.Request.Messages[0].Content = "What is the capital of France?"
+	second := newTestEntry([]float64{1, 0.001, 0}, time.Hour)
+	second.Request.Messages[0].Content = "Capital of France?"
+	cache.Set(ctx, first)
+	cache.Set(ctx, second)
+	if size := cache.Size(ctx); size != 2 {
+		t.Fatalf("expected 2 entries, got %d", size)
+	}
+
+	// The same request still replaces its entry
+	repeat := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	repeat.Request.Messages[0].Content = "What is the capital of France?"
+	repeat.Response.ID = "repeat"
+	cache.Set(ctx, repeat)
+	if size := cache.Size(ctx); size != 2 {
+		t.Fatalf("expected repeat to replace its entry, got %d entries", size)
+	}
+	if _, ok := cache.GetByID(ctx, first.ID); ok {
+		t.Error("expected replaced entry to be gone")
+	}
+	got, found := cache.GetExact(ctx, &repeat.Request)
+	if !found || got.Response.ID != "repeat" {
+		t.Errorf("expected exact hit on the repeat, got %v", got)
+	}
+}
+
+func BenchmarkMemoryCacheSetDedup(b *testing.B) {
+	const entries, dim = 10000, 128
+	rng := rand.New(rand.NewSource(1))
+	randomEmbedding := func() []float64 {
+		v := make([]float64, dim)
+		for i := range v {
+			v[i] = rng.NormFloat64()
+		}
+		return v
+	}
+
+	for _, dedup := range []bool{true, false} {
+		b.Run(fmt.Sprintf("dedup=%v", dedup), func(b *testing.B) {
+			cache := NewMemoryCache(&Options{
+				MaxSize:           entries,
+				DefaultTTL:        time.Hour,
+				CleanupInterval:   time.Hour,
+				DisableDedupOnSet: !dedup,
+			})
+			defer cache.Close()
+			// Fill directly: Set's duplicate check would make setup quadratic
+			for i := 0; i < entries; i++ {
+				me := &memoryEntry{entry: newTestEntry(nil, time.Hour), idx: i}
+				me.setVector(toFloat32(randomEmbedding()), QuantizationNone)
+				cache.evictor.add(me)
+				cache.entries = append(cache.entries, me)
+			}
+
+			pending := make([]*api.CacheEntry, b.N)
+			for i := range pending {
+				pending[i] = newTestEntry(randomEmbedding(), time.Hour)
+				pending[i].Request.Messages[0].Content = fmt.Sprintf("prompt %d", i)
+			}
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cache.Set(ctx, pending[i])
+			}
+		})
+	}
+}
+
+func TestMemoryCacheParallelScan(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(1))
+
+	sequential := NewMemoryCache(&Options{MaxSize: 1000, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	parallel := NewMemoryCache(&Options{
+		MaxSize:               1000,
+		DefaultTTL:            time.Hour,
+		CleanupInterval:       time.Hour,
+		ParallelScanThreshold: 10,
+		ParallelScanWorkers:   4,
+	})
+
+	for i := 0; i < 500; i++ {
+		emb := make([]float64, 16)
+		for j := range emb {
+			emb[j] = rng.NormFloat64()
+		}
+		sequential.Set(ctx, newTestEntry(emb, time.Hour))
+		parallel.Set(ctx, newTestEntry(emb, time.Hour))
+	}
+
+	for i := 0; i < 50; i++ {
+		query := make([]float64, 16)
+		for j := range query {
+			query[j] = rng.NormFloat64()
+		}
+
+		want, wantSim, wantFound := sequential.Get(ctx, query, 0.3)
+		got, gotSim, gotFound := parallel.Get(ctx, query, 0.3)
+		if gotFound != wantFound || gotSim != wantSim {
+			t.Fatalf("query %d: expected found=%v sim=%f, got found=%v sim=%f", i, wantFound, wantSim, gotFound, gotSim)
+		}
+		if wantFound && got.Embedding[0] != want.Embedding[0] {
+			t.Fatalf("query %d: parallel scan returned a different entry", i)
+		}
+	}
+}
+
+func TestMemoryCacheGetCancelled(t *testing.T) {
+	const n, dims = 50000, 64
+	rng := rand.New(rand.NewSource(1))
+	embeddings := make([][]float64, n)
+	for i := range embeddings {
+		embeddings[i] = make([]float64, dims)
+		for j := range embeddings[i] {
+			embeddings[i][j] = rng.NormFloat64()
+		}
+	}
+
+	tests := []struct {
+		name     string
+		parallel int
+	}{
+		{"sequential", 0},
+		{"parallel", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemoryCache(&Options{
+				MaxSize:               n,
+				DefaultTTL:            time.Hour,
+				CleanupInterval:       time.Hour,
+				ParallelScanThreshold: tt.parallel,
+				ParallelScanWorkers:   tt.parallel,
+			})
+			defer c.Close()
+			// Fill directly: Set's duplicate check would make setup quadratic
+			for i, emb := range embeddings {
+				me := &memoryEntry{entry: newTestEntry(nil, time.Hour), idx: i}
+				me.setVector(toFloat32(emb), QuantizationNone)
+				c.evictor.add(me)
+				c.entries = append(c.entries, me)
+			}
+			query := embeddings[n-1]
+
+			start := time.Now()
+			if _, _, found := c.Get(context.Background(), query, 0.99); !found {
+				t.Fatal("expected a hit without a deadline")
+			}
+			full := time.Since(start)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Microsecond)
+			defer cancel()
+			<-ctx.Done()
+
+			start = time.Now()
+			_, _, found := c.Get(ctx, query, 0.99)
+			elapsed := time.Since(start)
+			if found {
+				t.Error("expected a miss once the deadline passed")
+			}
+			if elapsed >= full {
+				t.Errorf("expected cancelled Get to return before a full scan (%v), took %v", full, elapsed)
+			}
+			if got := c.Stats(context.Background()).TotalMisses; got != 1 {
+				t.Errorf("expected the cancelled Get to count as a miss, got %d misses", got)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheGetBatch(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(1))
+	randomEmbedding := func() []float64 {
+		v := make([]float64, 16)
+		for i := range v {
+			v[i] = rng.NormFloat64()
+		}
+		return v
+	}
+
+	single := NewMemoryCache(&Options{MaxSize: 1000, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	batch := NewMemoryCache(&Options{MaxSize: 1000, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	for i := 0; i < 300; i++ {
+		emb := randomEmbedding()
+		single.Set(ctx, newTestEntry(emb, time.Hour))
+		batch.Set(ctx, newTestEntry(emb, time.Hour))
+	}
+
+	queries := make([][]float64, 40)
+	for i := range queries {
+		queries[i] = randomEmbedding()
+	}
+	queries[7] = []float64{1, 0} // dimension mismatch
+
+	results := batch.GetBatch(ctx, queries, 0.3)
+	if len(results) != len(queries) {
+		t.Fatalf("expected %d results, got %d", len(queries), len(results))
+	}
+	for i, query := range queries {
+		want, wantSim, wantFound := single.Get(ctx, query, 0.3)
+		got := results[i]
+		if (got != nil) != wantFound {
+			t.Fatalf("query %d: expected found=%v, got %v", i, wantFound, got != nil)
+		}
+		if wantFound && (got.Similarity != wantSim || got.Entry.ID == "" || got.Entry.Embedding[0] != want.Embedding[0]) {
+			t.Fatalf("query %d: batch result differs from Get", i)
+		}
+	}
+
+	want, got := single.Stats(ctx), batch.Stats(ctx)
+	if got.TotalHits != want.TotalHits || got.TotalMisses != want.TotalMisses || got.DimensionMismatches != 1 {
+		t.Errorf("expected stats to match Get: want %+v, got %+v", want, got)
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		for i, r := range batch.GetBatch(cancelled, queries, 0.3) {
+			if r != nil {
+				t.Fatalf("query %d: expected miss after cancellation", i)
+			}
+		}
+	})
+}
+
+// BenchmarkMemoryCacheGetBatch compares one GetBatch call against the
+// same lookups made with Get.
+func BenchmarkMemoryCacheGetBatch(b *testing.B) {
+	const entries, dim, queries = 20000, 128, 64
+	rng := rand.New(rand.NewSource(1))
+	randomEmbedding := func() []float64 {
+		v := make([]float64, dim)
+		for i := range v {
+			v[i] = rng.NormFloat64()
+		}
+		return v
+	}
+
+	cache := NewMemoryCache(&Options{MaxSize: entries, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	// Fill directly: Set's duplicate check would make setup quadratic
+	for i := 0; i < entries; i++ {
+		me := &memoryEntry{entry: newTestEntry(nil, time.Hour), idx: i}
+		me.setVector(toFloat32(randomEmbedding()), QuantizationNone)
+		cache.evictor.add(me)
+		cache.entries = append(cache.entries, me)
+	}
+	batch := make([][]float64, queries)
+	for i := range batch {
+		batch[i] = randomEmbedding()
+	}
+	ctx := context.Background()
+
+	b.Run("Get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, q := range batch {
+				cache.Get(ctx, q, 0.99)
+			}
+		}
+	})
+	b.Run("GetBatch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			cache.GetBatch(ctx, batch, 0.99)
+		}
+	})
+}
+
+// BenchmarkMemoryCacheGetParallel scans 200k entries with increasing
+// worker counts; speedup is bounded by the cores available.
+func BenchmarkMemoryCacheGetParallel(b *testing.B) {
+	const entries, dim = 200000, 128
+	rng := rand.New(rand.NewSource(1))
+	randomEmbedding := func() []float64 {
+		v := make([]float64, dim)
+		for i := range v {
+			v[i] = rng.NormFloat64()
+		}
+		return v
+	}
+
+	cache := NewMemoryCache(&Options{
+		MaxSize:               entries,
+		DefaultTTL:            time.Hour,
+		CleanupInterval:       time.Hour,
+		ParallelScanThreshold: 1,
+	})
+	// Fill directly: Set's duplicate check would make setup quadratic
+	for i := 0; i < entries; i++ {
+		me := &memoryEntry{entry: newTestEntry(randomEmbedding(), time.Hour), idx: i}
+		cache.evictor.add(me)
+		cache.entries = append(cache.entries, me)
+	}
+	query := randomEmbedding()
+	ctx := context.Background()
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cache.opts.ParallelScanWorkers = workers
+			for i := 0; i < b.N; i++ {
+				cache.Get(ctx, query, 0.99)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheDimensions(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		dims int
+	}{
+		{"from first entry", 0},
+		{"from options", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewMemoryCache(&Options{
+				MaxSize:         10,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+				Dimensions:      tt.dims,
+			})
+
+			if err := cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour)); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			err := cache.Set(ctx, newTestEntry([]float64{1, 0, 0, 0}, time.Hour))
+			if !errors.Is(err, ErrDimensionMismatch) {
+				t.Errorf("expected ErrDimensionMismatch on Set, got %v", err)
+			}
+
+			if _, _, found := cache.Get(ctx, []float64{1, 0, 0, 0}, 0.5); found {
+				t.Error("expected miss for mismatched query")
+			}
+			if err := cache.CheckDimensions([]float64{1, 0, 0, 0}); !errors.Is(err, ErrDimensionMismatch) {
+				t.Errorf("expected ErrDimensionMismatch from CheckDimensions, got %v", err)
+			}
+			stats := cache.Stats(ctx)
+			if stats.DimensionMismatches != 1 || stats.TotalMisses != 1 {
+				t.Errorf("expected 1 mismatch counted as a miss, got mismatches=%d misses=%d", stats.DimensionMismatches, stats.TotalMisses)
+			}
+
+			// Clearing allows switching models when not pinned by Options
+			cache.Clear(ctx)
+			err = cache.Set(ctx, newTestEntry([]float64{1, 0, 0, 0}, time.Hour))
+			if wantErr := tt.dims != 0; (err != nil) != wantErr {
+				t.Errorf("expected error=%v after Clear, got %v", wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheHooks(t *testing.T) {
+	ctx := context.Background()
+
+	var hits, misses, sets int
+	var cache *MemoryCache
+	cache = NewMemoryCache(&Options{
+		MaxSize:         10,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		OnHit: func(entry *api.CacheEntry, similarity float64) {
+			hits++
+			// Hooks run without the lock, so calling back in must not deadlock
+			cache.Size(ctx)
+		},
+		OnMiss: func(embedding []float64) {
+			misses++
+			cache.Size(ctx)
+		},
+		OnSet: func(entry *api.CacheEntry) {
+			sets++
+			entry.Request.Messages = []api.Message{{Role: "user", Content: "[redacted]"}}
+		},
+	})
+
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	if err := cache.Set(ctx, entry); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	got, _, found := cache.Get(ctx, []float64{1, 0, 0}, 0.9)
+	if !found {
+		t.Fatal("expected hit")
+	}
+	if content := got.Request.Messages[0].Content; content != "[redacted]" {
+		t.Errorf("expected OnSet to redact stored content, got %v", content)
+	}
+	cache.Get(ctx, []float64{0, 1, 0}, 0.9)
+
+	if hits != 1 || misses != 1 || sets != 1 {
+		t.Errorf("expected 1 hit, 1 miss and 1 set, got %d, %d and %d", hits, misses, sets)
+	}
+}
+
+func TestMemoryCacheOnEvict(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name         string
+		evictExpired bool
+		wantEvicted  []string
+	}{
+		{"evictions only", false, []string{"first"}},
+		{"with expirations", true, []string{"first", "expired"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var evicted []string
+			var c *MemoryCache
+			c = NewMemoryCache(&Options{
+				MaxSize:         2,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+				OnEvict: func(entry *api.CacheEntry) {
+					if len(entry.Embedding) != 3 {
+						t.Errorf("expected the evicted entry's embedding, got %v", entry.Embedding)
+					}
+					evicted = append(evicted, entry.ID)
+					// The hook runs without the lock, so calling back in must not deadlock
+					c.Size(ctx)
+				},
+				EvictExpired: tt.evictExpired,
+			})
+			defer c.Close()
+
+			for _, e := range []struct {
+				id  string
+				emb []float64
+				ttl time.Duration
+			}{
+				{"first", []float64{1, 0, 0}, time.Hour},
+				{"second", []float64{0, 1, 0}, time.Hour},
+				{"expired", []float64{0, 0, 1}, -time.Minute},
+			} {
+				entry := newTestEntry(e.emb, e.ttl)
+				entry.ID = e.id
+				if err := c.Set(ctx, entry); err != nil {
+					t.Fatalf("Set(%s) failed: %v", e.id, err)
+				}
+			}
+			c.Cleanup(ctx)
+
+			if !reflect.DeepEqual(evicted, tt.wantEvicted) {
+				t.Errorf("expected OnEvict for %v, got %v", tt.wantEvicted, evicted)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheEntryTTL(t *testing.T) {
+	ctx := context.Background()
+	opts := &Options{
+		MaxSize:         10,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		TTLFunc: func(e *api.CacheEntry) time.Duration {
+			if len(e.Response.Choices) > 0 && len(e.Response.Choices[0].Message.ToolCalls) > 0 {
+				return time.Minute
+			}
+			return 0
+		},
+	}
+
+	tests := []struct {
+		name    string
+		prepare func(e *api.CacheEntry)
+		want    time.Duration
+	}{
+		{"default", func(e *api.CacheEntry) {}, time.Hour},
+		{"classifier", func(e *api.CacheEntry) {
+			e.Response.Choices[0].Message.ToolCalls = []api.ToolCall{{ID: "call_1", Type: "function"}}
+		}, time.Minute},
+		{"per-entry", func(e *api.CacheEntry) {
+			e.TTL = 10 * time.Second
+			e.Response.Choices[0].Message.ToolCalls = []api.ToolCall{{ID: "call_1", Type: "function"}}
+		}, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewMemoryCache(opts)
+
+			entry := newTestEntry([]float64{1, 0, 0}, 0)
+			entry.ExpiresAt = time.Time{}
+			tt.prepare(entry)
+			if err := cache.Set(ctx, entry); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+
+			got, _, found := cache.Get(ctx, []float64{1, 0, 0}, 0.9)
+			if !found {
+				t.Fatal("expected entry to be found")
+			}
+			if ttl := got.ExpiresAt.Sub(got.CreatedAt); ttl != tt.want {
+				t.Errorf("expected TTL %v, got %v", tt.want, ttl)
+			}
+		})
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	opts := &Options{DefaultTTL: time.Hour, TTLJitter: 0.2}
+	lo, hi := 48*time.Minute, 72*time.Minute
+
+	var minTTL, maxTTL, total time.Duration
+	const n = 1000
+	for i := 0; i < n; i++ {
+		entry := &api.CacheEntry{CreatedAt: time.Now()}
+		opts.resolveExpiry(entry)
+		ttl := entry.ExpiresAt.Sub(entry.CreatedAt)
+		if ttl < lo || ttl > hi {
+			t.Fatalf("TTL %v outside the ±20%% band [%v, %v]", ttl, lo, hi)
+		}
+		if i == 0 || ttl < minTTL {
+			minTTL = ttl
+		}
+		if ttl > maxTTL {
+			maxTTL = ttl
+		}
+		total += ttl
+	}
+
+	// Uniform over the band: wide spread, centered on the TTL
+	if spread := maxTTL - minTTL; spread < 20*time.Minute {
+		t.Errorf("expected expiries spread across most of the band, got %v", spread)
+	}
+	if mean := total / n; mean < 58*time.Minute || mean > 62*time.Minute {
+		t.Errorf("expected mean TTL near 1h, got %v", mean)
+	}
+
+	t.Run("explicit expiry untouched", func(t *testing.T) {
+		expires := time.Now().Add(time.Minute)
+		entry := &api.CacheEntry{ExpiresAt: expires}
+		opts.resolveExpiry(entry)
+		if !entry.ExpiresAt.Equal(expires) {
+			t.Errorf("expected explicit ExpiresAt to be kept, got %v", entry.ExpiresAt)
+		}
+	})
+}
+
+func TestMemoryCacheNegativeEntry(t *testing.T) {
+	cache := NewMemoryCache(&Options{
+		MaxSize:         10,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		NegativeTTL:     time.Minute,
+	})
+	ctx := context.Background()
+
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	entry.Negative = true
+	entry.StatusCode = 400
+	entry.Error = &api.APIError{Message: "invalid prompt", Type: "invalid_request_error"}
+	if err := cache.Set(ctx, entry); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if ttl := time.Until(entry.ExpiresAt); ttl > time.Minute {
+		t.Errorf("expected NegativeTTL to cap expiry, got %v", ttl)
+	}
+
+	// Negative entries match the exact request only
+	if _, _, found := cache.Get(ctx, []float64{1, 0, 0}, 0.99); found {
+		t.Error("expected semantic lookup to skip negative entry")
+	}
+	result, found := cache.GetExact(ctx, &entry.Request)
+	if !found {
+		t.Fatal("expected negative entry to be returned")
+	}
+	if !result.Negative || result.StatusCode != 400 || result.Error.Message != "invalid prompt" {
+		t.Errorf("expected negative entry details to be preserved, got %+v", result)
+	}
+
+	// A successful response for the same prompt replaces the negative entry
+	cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour))
+	if result, _ := cache.GetExact(ctx, &entry.Request); result.Negative {
+		t.Error("expected positive entry to replace negative entry")
+	}
+	if cache.Size(ctx) != 1 {
+		t.Errorf("expected 1 entry, got %d", cache.Size(ctx))
+	}
+}
+
+func TestMemoryCacheNegativeEntryKeepsResponses(t *testing.T) {
+	cache := NewMemoryCache(&Options{
+		MaxSize:         10,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+	})
+	ctx := context.Background()
+
+	good := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	if err := cache.Set(ctx, good); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// A failure of a similar prompt is stored next to the response
+	other := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	other.Request.Messages = []api.Message{{Role: "user", Content: "test, but longer"}}
+	other.Negative = true
+	other.StatusCode = 400
+	if err := cache.Set(ctx, other); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if cache.Size(ctx) != 2 {
+		t.Fatalf("expected 2 entries, got %d", cache.Size(ctx))
+	}
+	result, _, found := cache.Get(ctx, []float64{1, 0, 0}, 0.99)
+	if !found || result.Negative {
+		t.Fatalf("expected the response to be found, got %+v", result)
+	}
+	if result, found := cache.GetExact(ctx, &other.Request); !found || !result.Negative {
+		t.Error("expected the failure to be found for its own request")
+	}
+
+	// A failure of the same request does not displace its response
+	same := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	same.Negative = true
+	same.StatusCode = 429
+	if err := cache.Set(ctx, same); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if result, found := cache.GetExact(ctx, &good.Request); !found || result.Negative {
+		t.Errorf("expected the response to be kept, got %+v", result)
+	}
+	if cache.Size(ctx) != 2 {
+		t.Errorf("expected 2 entries, got %d", cache.Size(ctx))
+	}
+}
+
+func TestMemoryCacheSearch(t *testing.T) {
+	for _, hnsw := range []bool{false, true} {
+		t.Run(fmt.Sprintf("hnsw=%v", hnsw), func(t *testing.T) {
+			cache := NewMemoryCache(&Options{
+				MaxSize:         10,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+				HNSW:            HNSWOptions{Enabled: hnsw, MinEntries: -1},
+			})
+			ctx := context.Background()
+
+			for _, emb := range [][]float64{{1, 0.3, 0}, {1, 0, 0}, {1, 0.6, 0}, {0, 1, 0}} {
+				cache.Set(ctx, newTestEntry(emb, time.Hour))
+			}
+			expired := newTestEntry([]float64{1, -0.2, 0}, time.Hour)
+			expired.ExpiresAt = time.Now().Add(-time.Second)
+			cache.Set(ctx, expired)
+
+			results := cache.Search(ctx, []float64{1, 0, 0}, 0.8, 2)
+			if len(results) != 2 {
+				t.Fatalf("expected 2 results, got %d", len(results))
+			}
+			if results[0].Similarity < 0.999 || results[0].Similarity < results[1].Similarity {
+				t.Errorf("expected results sorted by similarity, got %f then %f", results[0].Similarity, results[1].Similarity)
+			}
+			if results[1].Entry.Embedding[1] < 0.29 || results[1].Entry.Embedding[1] > 0.31 {
+				t.Errorf("expected second result to be the next closest entry, got %v", results[1].Entry.Embedding)
+			}
+
+			if all := cache.Search(ctx, []float64{1, 0, 0}, 0.8, 10); len(all) != 3 {
+				t.Errorf("expected 3 live entries above threshold, got %d", len(all))
+			}
+
+			if stats := cache.Stats(ctx); stats.TotalHits != 0 || stats.TotalMisses != 0 {
+				t.Error("expected Search not to affect hit statistics")
+			}
+		})
+	}
+}
+
+func TestMemoryCacheNamespaces(t *testing.T) {
+	for _, hnsw := range []bool{false, true} {
+		t.Run(fmt.Sprintf("hnsw=%v", hnsw), func(t *testing.T) {
+			opts := &Options{
+				MaxSize:         10,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+			}
+			opts.HNSW.Enabled = hnsw
+			cache := NewMemoryCache(opts)
+			defer cache.Close()
+
+			tenantA := WithNamespace(context.Background(), "a")
+			tenantB := WithNamespace(context.Background(), "b")
+			emb := []float64{1, 0, 0}
+
+			entryA := newTestEntry(emb, time.Hour)
+			entryA.Response.ID = "A"
+			if err := cache.Set(tenantA, entryA); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			if entryA.Namespace != "a" {
+				t.Errorf("expected namespace from context, got %q", entryA.Namespace)
+			}
+
+			if _, _, found := cache.Get(tenantB, emb, 0.9); found {
+				t.Fatal("expected tenant b not to see tenant a's entry")
+			}
+			if _, _, found := cache.Get(context.Background(), emb, 0.9); found {
+				t.Fatal("expected default namespace not to see tenant a's entry")
+			}
+			if results := cache.Search(tenantB, emb, 0.9, 5); len(results) != 0 {
+				t.Errorf("expected no search results for tenant b, got %d", len(results))
+			}
+
+			// The same prompt in another namespace is a separate entry
+			entryB := newTestEntry(emb, time.Hour)
+			entryB.Response.ID = "B"
+			cache.Set(tenantB, entryB)
+			if size := cache.Size(tenantA); size != 2 {
+				t.Fatalf("expected 2 entries, got %d", size)
+			}
+
+			for ns, want := range map[context.Context]string{tenantA: "A", tenantB: "B"} {
+				got, _, found := cache.Get(ns, emb, 0.9)
+				if !found || got.Response.ID != want {
+					t.Errorf("expected hit on %s, got %v", want, got)
+				}
+			}
+
+			if err := cache.ClearNamespace(context.Background(), "a"); err != nil {
+				t.Fatalf("ClearNamespace failed: %v", err)
+			}
+			if _, _, found := cache.Get(tenantA, emb, 0.9); found {
+				t.Error("expected tenant a's entry to be cleared")
+			}
+			if _, _, found := cache.Get(tenantB, emb, 0.9); !found {
+				t.Error("expected tenant b's entry to survive")
+			}
+		})
+	}
+}
+
+func TestMemoryCacheEmbeddingModel(t *testing.T) {
+	for _, hnsw := range []bool{false, true} {
+		t.Run(fmt.Sprintf("hnsw=%v", hnsw), func(t *testing.T) {
+			ctx := context.Background()
+			opts := &Options{
+				MaxSize:         10,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+				EmbeddingModel:  "embed-v2",
+			}
+			opts.HNSW.Enabled = hnsw
+			cache := NewMemoryCache(opts)
+			defer cache.Close()
+
+			emb := []float64{1, 0, 0}
+
+			// An entry embedded before the embedder was swapped
+			stale := newTestEntry(emb, time.Hour)
+			stale.Request.Messages[0].Content = "stale"
+			stale.EmbeddingModel = "embed-v1"
+			if err := cache.Set(ctx, stale); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+
+			if _, _, found := cache.Get(ctx, emb, 0.9); found {
+				t.Fatal("expected entry from another embedding model not to match")
+			}
+			if results := cache.Search(ctx, emb, 0.9, 5); len(results) != 0 {
+				t.Errorf("expected no search results, got %d", len(results))
+			}
+			if _, found := cache.GetExact(ctx, &stale.Request); !found {
+				t.Error("expected exact match regardless of embedding model")
+			}
+
+			// A fresh entry is tagged and is not a near-duplicate of the
+			// stale one
+			fresh := newTestEntry(emb, time.Hour)
+			if err := cache.Set(ctx, fresh); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			if fresh.EmbeddingModel != "embed-v2" {
+				t.Errorf("expected entry tagged embed-v2, got %q", fresh.EmbeddingModel)
+			}
+			if size := cache.Size(ctx); size != 2 {
+				t.Fatalf("expected 2 entries, got %d", size)
+			}
+			got, _, found := cache.Get(ctx, emb, 0.9)
+			if !found || got.ID != fresh.ID {
+				t.Errorf("expected hit on fresh entry, got %v", got)
+			}
+		})
+	}
+
+	t.Run("untagged", func(t *testing.T) {
+		if !sameEmbeddingModel(&api.CacheEntry{}, "embed-v2") {
+			t.Error("expected untagged entry to compare with any model")
+		}
+		if !sameEmbeddingModel(&api.CacheEntry{EmbeddingModel: "embed-v1"}, "") {
+			t.Error("expected lookup without a model to compare with any entry")
+		}
+	})
+
+	t.Run("context override", func(t *testing.T) {
+		cache := NewMemoryCache(&Options{MaxSize: 10, DefaultTTL: time.Hour, CleanupInterval: time.Hour, EmbeddingModel: "primary"})
+		defer cache.Close()
+		ctx := context.Background()
+
+		emb := []float64{1, 0, 0}
+		fallbackCtx := WithEmbeddingModel(ctx, "fallback")
+		entry := newTestEntry(emb, time.Hour)
+		if err := cache.Set(fallbackCtx, entry); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		if entry.EmbeddingModel != "fallback" {
+			t.Errorf("expected entry tagged fallback, got %q", entry.EmbeddingModel)
+		}
+		if _, _, found := cache.Get(ctx, emb, 0.9); found {
+			t.Error("expected primary-model lookup to skip fallback entry")
+		}
+		if _, _, found := cache.Get(fallbackCtx, emb, 0.9); !found {
+			t.Error("expected fallback-model lookup to hit")
+		}
+	})
+}
+
+func TestMemoryCacheModelThresholds(t *testing.T) {
+	opts := &Options{
+		MaxSize:         10,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		EmbeddingModel:  "clustered",
+		ModelThresholds: map[string]float64{"clustered": 0.99, "spread": 0.5},
+	}
+	cache := NewMemoryCache(opts)
+	defer cache.Close()
+
+	// Similarity between the entry and query is 0.8
+	for _, model := range []string{"clustered", "spread", "unlisted"} {
+		entry := newTestEntry([]float64{1, 0}, time.Hour)
+		entry.Request.Messages[0].Content = model
+		entry.EmbeddingModel = model
+		if err := cache.Set(context.Background(), entry); err != nil {
+			t.Fatalf("Set(%s) failed: %v", model, err)
+		}
+	}
+	query := []float64{0.8, 0.6}
+
+	tests := []struct {
+		model string
+		want  bool
+	}{
+		{"clustered", false}, // 0.99 overrides the passed 0.7
+		{"spread", true},     // 0.5
+		{"unlisted", true},   // passed 0.7
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			ctx := WithEmbeddingModel(context.Background(), tt.model)
+			if _, _, found := cache.Get(ctx, query, 0.7); found != tt.want {
+				t.Errorf("Get found = %v, want %v", found, tt.want)
+			}
+			if got := len(cache.Search(ctx, query, 0.7, 5)) == 1; got != tt.want {
+				t.Errorf("Search found = %v, want %v", got, tt.want)
+			}
+			if got := cache.GetBatch(ctx, [][]float64{query}, 0.7); (got[0] != nil) != tt.want {
+				t.Errorf("GetBatch found = %v, want %v", got[0] != nil, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheSnapshot(t *testing.T) {
+	ctx := context.Background()
+	opts := &Options{MaxSize: 10, DefaultTTL: time.Hour, CleanupInterval: time.Hour}
+
+	src := NewMemoryCache(opts)
+	defer src.Close()
+
+	live := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	live.Response.ID = "live"
+	live.Namespace = "tenant"
+	src.Set(ctx, live)
+	src.Set(ctx, newTestEntry([]float64{0, 1, 0}, time.Hour))
+
+	var buf bytes.Buffer
+	if err := src.DumpToWriter(ctx, &buf); err != nil {
+		t.Fatalf("DumpToWriter failed: %v", err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 2 {
+		t.Fatalf("expected 2 lines, got %d", lines)
+	}
+
+	// An entry that expired after the dump is skipped on load
+	expired, _ := json.Marshal(newTestEntry([]float64{0, 0, 1}, -time.Minute))
+	buf.Write(expired)
+
+	dst := NewMemoryCache(opts)
+	defer dst.Close()
+
+	n, err := dst.LoadFromReader(ctx, &buf)
+	if err != nil {
+		t.Fatalf("LoadFromReader failed: %v", err)
+	}
+	if n != 2 || dst.Size(ctx) != 2 {
+		t.Fatalf("expected 2 entries loaded, got %d (size %d)", n, dst.Size(ctx))
+	}
+
+	got, _, found := dst.Get(WithNamespace(ctx, "tenant"), []float64{1, 0, 0}, 0.99)
+	if !found {
+		t.Fatal("expected loaded entry to be found in its namespace")
+	}
+	if got.ID != live.ID || got.Response.ID != "live" {
+		t.Errorf("expected entry %s, got %s (%s)", live.ID, got.ID, got.Response.ID)
+	}
+	if !got.ExpiresAt.Equal(live.ExpiresAt) {
+		t.Errorf("expected expiry %v to be preserved, got %v", live.ExpiresAt, got.ExpiresAt)
+	}
+
+	if _, err := dst.LoadFromReader(ctx, strings.NewReader("{not json")); err == nil {
+		t.Error("expected error for malformed input")
+	}
+}
+
+func TestMemoryCacheEntries(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(&Options{MaxSize: 10, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	defer cache.Close()
+
+	base := time.Now().Add(-time.Hour)
+	for i, emb := range [][]float64{{0, 0, 1}, {0, 1, 0}, {1, 0, 0}} {
+		entry := newTestEntry(emb, time.Hour)
+		entry.ID = fmt.Sprintf("entry-%d", i)
+		entry.Request.Messages[0].Content = entry.ID
+		entry.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		entry.Namespace = fmt.Sprintf("ns-%d", i)
+		if err := cache.Set(ctx, entry); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	expired := newTestEntry([]float64{1, 1, 0}, -time.Minute)
+	expired.Request.Messages[0].Content = "expired"
+	cache.Set(ctx, expired)
+
+	tests := []struct {
+		name   string
+		offset int
+		limit  int
+		want   []string
+	}{
+		{name: "all", want: []string{"entry-0", "entry-1", "entry-2"}},
+		{name: "first page", limit: 2, want: []string{"entry-0", "entry-1"}},
+		{name: "second page", offset: 2, limit: 2, want: []string{"entry-2"}},
+		{name: "past the end", offset: 5, limit: 2, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := cache.Entries(ctx, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatalf("Entries failed: %v", err)
+			}
+			got := make([]string, len(entries))
+			for i, e := range entries {
+				got[i] = e.ID
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	// Returned entries are copies
+	entries, _ := cache.Entries(ctx, 0, 1)
+	entries[0].HitCount = 99
+	entries[0].Embedding[0] = 5
+	stored, _ := cache.GetByID(ctx, "entry-0")
+	if stored.HitCount == 99 || stored.Embedding[2] != 1 || stored.Embedding[0] != 0 {
+		t.Error("expected modifying an exported entry not to affect the cache")
+	}
+}
+
+func TestMemoryCacheHardThreshold(t *testing.T) {
+	ctx := context.Background()
+	query := []float64{1, 0, 0}
+	near := []float64{0.95, math.Sqrt(1 - 0.95*0.95), 0}
+
+	tests := []struct {
+		name          string
+		hardThreshold float64
+		wantID        string
+	}{
+		{"disabled finds best match", 0, "exact"},
+		{"stops at first match above hard threshold", 0.9, "close"},
+		{"hard threshold above first match", 0.99, "exact"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewMemoryCache(&Options{
+				MaxSize:         10,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+				HardThreshold:   tt.hardThreshold,
+			})
+			defer cache.Close()
+
+			first := newTestEntry(near, time.Hour)
+			first.Response.ID = "close"
+			cache.Set(ctx, first)
+			second := newTestEntry(query, time.Hour)
+			second.Response.ID = "exact"
+			cache.Set(ctx, second)
+
+			got, _, found := cache.Get(ctx, query, 0.9)
+			if !found {
+				t.Fatal("expected hit")
+			}
+			if got.Response.ID != tt.wantID {
+				t.Errorf("expected %s, got %s", tt.wantID, got.Response.ID)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheGetExact(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(&Options{MaxSize: 100, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	defer cache.Close()
+
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	cache.Set(ctx, entry)
+	if entry.RequestHash == "" {
+		t.Fatal("expected Set to record the request hash")
+	}
+
+	// Whitespace differences canonicalize away
+	req := entry.Request
+	req.Messages = []api.Message{{Role: "user", Content: "  test\n"}}
+	got, found := cache.GetExact(ctx, &req)
+	if !found {
+		t.Fatal("expected exact hit")
+	}
+	if got.ID != entry.ID {
+		t.Errorf("expected entry %s, got %s", entry.ID, got.ID)
+	}
+
+	t.Run("different prompt", func(t *testing.T) {
+		other := entry.Request
+		other.Messages = []api.Message{{Role: "user", Content: "something else"}}
+		if _, found := cache.GetExact(ctx, &other); found {
+			t.Error("expected exact miss")
+		}
+	})
+
+	t.Run("other namespace", func(t *testing.T) {
+		if _, found := cache.GetExact(WithNamespace(ctx, "tenant-a"), &req); found {
+			t.Error("expected exact miss in another namespace")
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		cache.Get(ctx, []float64{1, 0, 0}, 0.9)
+		stats := cache.Stats(ctx)
+		if stats.ExactHits != 1 || stats.SemanticHits != 1 || stats.TotalHits != 2 {
+			t.Errorf("expected 1 exact and 1 semantic hit, got %+v", stats)
+		}
+		// Exact misses are not counted; Get follows them
+		if stats.TotalMisses != 0 {
+			t.Errorf("expected no misses, got %d", stats.TotalMisses)
+		}
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		cache.Delete(ctx, entry.ID)
+		if _, found := cache.GetExact(ctx, &req); found {
+			t.Error("expected exact miss after delete")
+		}
+	})
+}
+
+func TestMemoryCacheRejectsFormatMismatch(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(&Options{MaxSize: 100, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	defer cache.Close()
+
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	entry.Request.ResponseFormat = &api.ResponseFormat{Type: "json_object"}
+	if err := cache.Set(ctx, entry); !errors.Is(err, ErrFormatMismatch) {
+		t.Fatalf("expected ErrFormatMismatch, got %v", err)
+	}
+	if cache.Size(ctx) != 0 {
+		t.Errorf("expected nothing stored, got %d entries", cache.Size(ctx))
+	}
+
+	entry.Response.Choices[0].Message.Content = `{"answer": "test"}`
+	if err := cache.Set(ctx, entry); err != nil {
+		t.Errorf("expected JSON response to be stored, got %v", err)
+	}
+}
+
+func TestMemoryCachePinning(t *testing.T) {
+	embeddings := [][]float64{
+		{1, 0, 0},
+		{0, 1, 0},
+	}
+
+	for _, policy := range []EvictionPolicy{EvictLRU, EvictLFU, EvictFIFO, EvictTinyLFU} {
+		t.Run(policy.String(), func(t *testing.T) {
+			ctx := context.Background()
+			cache := NewMemoryCache(&Options{
+				MaxSize:         2,
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+				EvictionPolicy:  policy,
+			})
+			defer cache.Close()
+
+			// Entry 0 would be evicted first under every policy
+			ids := make([]string, len(embeddings))
+			for i, emb := range embeddings {
+				entry := newTestEntry(emb, time.Hour)
+				if err := cache.Set(ctx, entry); err != nil {
+					t.Fatalf("Set failed: %v", err)
+				}
+				ids[i] = entry.ID
+			}
+			cache.Get(ctx, embeddings[1], 0.99)
+
+			if err := cache.Pin(ctx, ids[0]); err != nil {
+				t.Fatalf("Pin failed: %v", err)
+			}
+			if err := cache.Set(ctx, newTestEntry([]float64{0, 0, 1}, time.Hour)); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			if _, ok := cache.GetByID(ctx, ids[0]); !ok {
+				t.Error("expected pinned entry to survive eviction")
+			}
+
+			// Only pinned entries left: refuse rather than evict
+			pinned := newTestEntry([]float64{1, 1, 0}, time.Hour)
+			pinned.Pinned = true
+			if err := cache.Set(ctx, pinned); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			err := cache.Set(ctx, newTestEntry([]float64{0, 1, 1}, time.Hour))
+			if !errors.Is(err, ErrAllPinned) || !errors.Is(err, ErrCacheFull) {
+				t.Fatalf("expected ErrAllPinned, got %v", err)
+			}
+
+			// Unpinned entries are evictable again
+			if err := cache.Unpin(ctx, ids[0]); err != nil {
+				t.Fatalf("Unpin failed: %v", err)
+			}
+			if err := cache.Set(ctx, newTestEntry([]float64{0, 1, 1}, time.Hour)); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			if _, ok := cache.GetByID(ctx, ids[0]); ok {
+				t.Error("expected unpinned entry to be evicted")
+			}
+			if _, ok := cache.GetByID(ctx, pinned.ID); !ok {
+				t.Error("expected pinned entry to survive eviction")
+			}
+		})
+	}
+
+	t.Run("replacement stays pinned", func(t *testing.T) {
+		ctx := context.Background()
+		cache := NewMemoryCache(&Options{MaxSize: 2, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+		defer cache.Close()
+
+		entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+		entry.Pinned = true
+		if err := cache.Set(ctx, entry); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		if err := cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		got, _, found := cache.Get(ctx, []float64{1, 0, 0}, 0.99)
+		if !found || !got.Pinned {
+			t.Errorf("expected pinned replacement, got %+v", got)
+		}
+	})
+
+	t.Run("unknown ID", func(t *testing.T) {
+		cache := NewMemoryCache(DefaultOptions())
+		defer cache.Close()
+		if err := cache.Pin(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Pin: expected ErrNotFound, got %v", err)
+		}
+		if err := cache.Unpin(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Unpin: expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestMemoryCacheScoring(t *testing.T) {
+	// The stale entry is closer to the query than the fresh one
+	query := []float64{1, 0}
+	staleEmb := []float64{0.99, 0.14}
+	freshEmb := []float64{0.95, 0.31}
+
+	tests := []struct {
+		name      string
+		scoring   ScoringOptions
+		wantFresh bool
+	}{
+		{"default ranks by similarity", ScoringOptions{}, false},
+		{"age weight prefers fresh entries", ScoringOptions{AgeWeight: 0.01}, true},
+		{"hit weight prefers popular entries", ScoringOptions{HitWeight: 0.1}, true},
+	}
+
+	for _, tt := range tests {
+		for _, hnsw := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/hnsw=%v", tt.name, hnsw), func(t *testing.T) {
+				ctx := context.Background()
+				opts := &Options{
+					MaxSize:         10,
+					DefaultTTL:      48 * time.Hour,
+					CleanupInterval: time.Hour,
+					Scoring:         tt.scoring,
+				}
+				opts.HNSW.Enabled = hnsw
+				cache := NewMemoryCache(opts)
+				defer cache.Close()
+
+				stale := newTestEntry(staleEmb, 48*time.Hour)
+				stale.CreatedAt = time.Now().Add(-24 * time.Hour)
+				fresh := newTestEntry(freshEmb, 48*time.Hour)
+				fresh.Request.Messages[0].Content = "fresh"
+				fresh.HitCount = 10
+				if tt.scoring.AgeWeight != 0 {
+					fresh.HitCount = 0
+				}
+				for _, e := range []*api.CacheEntry{stale, fresh} {
+					if err := cache.Set(ctx, e); err != nil {
+						t.Fatalf("Set failed: %v", err)
+					}
+				}
+
+				want := stale.ID
+				if tt.wantFresh {
+					want = fresh.ID
+				}
+				results := cache.Search(ctx, query, 0.9, 2)
+				if len(results) != 2 || results[0].Entry.ID != want {
+					t.Fatalf("expected %s ranked first, got %+v", want, results)
+				}
+				if results[0].Confidence < results[1].Confidence {
+					t.Errorf("expected results ordered by confidence, got %v then %v", results[0].Confidence, results[1].Confidence)
+				}
+				if tt.scoring == (ScoringOptions{}) && results[0].Confidence != results[0].Similarity {
+					t.Errorf("expected confidence %v to equal similarity %v", results[0].Confidence, results[0].Similarity)
+				}
+
+				got, similarity, found := cache.Get(ctx, query, 0.9)
+				if !found || got.ID != want {
+					t.Fatalf("expected Get to choose %s, got %v", want, got)
+				}
+				if want == fresh.ID && similarity >= results[1].Similarity {
+					t.Errorf("expected Get to report raw similarity, got %v", similarity)
+				}
+
+				batch := cache.GetBatch(ctx, [][]float64{query}, 0.9)
+				if batch[0] == nil || batch[0].Entry.ID != want {
+					t.Errorf("expected GetBatch to choose %s, got %+v", want, batch[0])
+				}
+			})
+		}
+	}
+}
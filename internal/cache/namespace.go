@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+type namespaceContextKey struct{}
+
+// WithNamespace returns a context scoping cache operations to a namespace,
+// e.g. a tenant or user. Get, Search, DeleteByEmbedding and near-duplicate
+// detection in Set only consider entries in the same namespace, and Set
+// stores entries without an explicit Namespace in it. The empty namespace
+// is the default and is itself a separate partition.
+func WithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, namespaceContextKey{}, namespace)
+}
+
+// NamespaceFromContext returns the namespace set by WithNamespace, or "".
+func NamespaceFromContext(ctx context.Context) string {
+	return namespaceFromContext(ctx)
+}
+
+// namespaceFromContext returns the namespace set by WithNamespace, or "".
+func namespaceFromContext(ctx context.Context) string {
+	ns, _ := ctx.Value(namespaceContextKey{}).(string)
+	return ns
+}
+
+// applyNamespace assigns the context's namespace to an entry without one.
+func applyNamespace(ctx context.Context, entry *api.CacheEntry) {
+	if entry.Namespace == "" {
+		entry.Namespace = namespaceFromContext(ctx)
+	}
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// defaultFlushInterval is used when Options.FlushInterval is unset.
+const defaultFlushInterval = time.Second
+
+// pendingWrites accumulates the counter increments and hit entries a
+// persistent cache has yet to write, so lookups return without waiting
+// on the disk. The zero value is ready to use.
+type pendingWrites struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	hits     map[string]struct{} // IDs of entries hit since the last flush
+}
+
+// addCounters records counter increments.
+func (p *pendingWrites) addCounters(deltas map[string]int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.counters == nil {
+		p.counters = make(map[string]int64, len(deltas))
+	}
+	for name, delta := range deltas {
+		p.counters[name] += delta
+	}
+}
+
+// addHit records that the entry with the given ID was hit.
+func (p *pendingWrites) addHit(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.hits == nil {
+		p.hits = make(map[string]struct{})
+	}
+	p.hits[id] = struct{}{}
+}
+
+// take returns and clears the pending writes.
+func (p *pendingWrites) take() (counters map[string]int64, hits map[string]struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	counters, hits = p.counters, p.hits
+	p.counters, p.hits = nil, nil
+	return counters, hits
+}
+
+// restore puts back writes returned by take that failed to persist, so the
+// next flush retries them.
+func (p *pendingWrites) restore(counters map[string]int64, hits map[string]struct{}) {
+	p.addCounters(counters)
+	for id := range hits {
+		p.addHit(id)
+	}
+}
+
+// flushInterval returns FlushInterval, or its default if unset.
+func (o *Options) flushInterval() time.Duration {
+	if o.FlushInterval > 0 {
+		return o.FlushInterval
+	}
+	return defaultFlushInterval
+}
+
+// flushLoop calls flush every FlushInterval until done is closed, logging
+// failures.
+func (o *Options) flushLoop(done <-chan struct{}, flush func(context.Context) error) {
+	ticker := time.NewTicker(o.flushInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ctx := context.Background()
+			if err := flush(ctx); err != nil {
+				o.logFlushError(ctx, err)
+			}
+		}
+	}
+}
+
+// logFlushError logs a failure to persist hit statistics at error level,
+// since they are kept only in memory until a later flush succeeds.
+func (o *Options) logFlushError(ctx context.Context, err error) {
+	if o.logEnabled(ctx, slog.LevelError) {
+		o.Logger.LogAttrs(ctx, slog.LevelError, "failed to persist cache statistics", slog.String("error", err.Error()))
+	}
+}
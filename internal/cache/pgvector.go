@@ -0,0 +1,872 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// pgvectorSchema creates the tables; the embedding column and its index
+// depend on Options.Dimensions and Options.Metric.
+const pgvectorSchema = `
+CREATE EXTENSION IF NOT EXISTS vector;
+CREATE TABLE IF NOT EXISTS mimir_cache_entries (
+	id              TEXT        PRIMARY KEY,
+	request         BYTEA       NOT NULL,
+	response        BYTEA       NOT NULL,
+	embedding       vector(%d)  NOT NULL,
+	model           TEXT        NOT NULL DEFAULT '',
+	created_at      TIMESTAMPTZ NOT NULL,
+	expires_at      TIMESTAMPTZ NOT NULL,
+	hit_count       BIGINT      NOT NULL DEFAULT 0,
+	last_hit_at     TIMESTAMPTZ NOT NULL,
+	namespace       TEXT        NOT NULL DEFAULT '',
+	request_hash    TEXT        NOT NULL DEFAULT '',
+	embedding_model TEXT        NOT NULL DEFAULT '',
+	negative        BOOLEAN     NOT NULL DEFAULT FALSE,
+	status_code     INTEGER     NOT NULL DEFAULT 0,
+	error           BYTEA,
+	pinned          BOOLEAN     NOT NULL DEFAULT FALSE,
+	checksum        TEXT        NOT NULL DEFAULT '',
+	schema_version  INTEGER     NOT NULL DEFAULT 0
+);
+ALTER TABLE mimir_cache_entries ADD COLUMN IF NOT EXISTS pinned BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE mimir_cache_entries ADD COLUMN IF NOT EXISTS checksum TEXT NOT NULL DEFAULT '';
+ALTER TABLE mimir_cache_entries ADD COLUMN IF NOT EXISTS schema_version INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_mimir_cache_entries_expires_at ON mimir_cache_entries (expires_at);
+CREATE INDEX IF NOT EXISTS idx_mimir_cache_entries_request_hash ON mimir_cache_entries (request_hash);
+CREATE INDEX IF NOT EXISTS idx_mimir_cache_entries_embedding ON mimir_cache_entries USING hnsw (embedding %s);
+CREATE TABLE IF NOT EXISTS mimir_cache_counters (
+	name  TEXT   PRIMARY KEY,
+	value BIGINT NOT NULL
+);
+`
+
+// pgvectorColumns are the entry columns read by every query, in scan order.
+const pgvectorColumns = `id, request, response, embedding::text, created_at, expires_at, hit_count, last_hit_at,
+	namespace, request_hash, embedding_model, negative, status_code, error, pinned, checksum, schema_version`
+
+// Ensure PgVectorCache implements Cache.
+var _ Cache = (*PgVectorCache)(nil)
+
+// PgVectorCache implements a semantic cache in Postgres using the pgvector
+// extension. Unlike SQLiteCache and BoltCache nothing is mirrored in
+// memory: similarity search runs in the database against an HNSW index,
+// so the cache scales past available memory and can be shared by several
+// proxies. The index is approximate; filtering by namespace, expiry and
+// embedding model happens after it, so a lookup may miss an entry that an
+// exhaustive scan would find when many candidates are filtered out.
+// Raise hnsw.ef_search on the connection to trade speed for recall.
+//
+// Hit and miss counters are kept in the database and shared too.
+// Options.MaxSize of zero or less leaves the table unbounded; otherwise Set
+// evicts the least recently hit entry when it is full.
+type PgVectorCache struct {
+	mu   sync.Mutex // serializes Set's replace, evict and insert
+	db   *sql.DB
+	opts *Options
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPgVectorCache creates a cache in the database behind db, creating the
+// extension, tables and indexes if needed. mimir does not link a Postgres
+// driver; open db with one, e.g. github.com/jackc/pgx/v5/stdlib.
+// Options.Dimensions is required, since the embedding column and its index
+// have a fixed length. Close does not close db.
+func NewPgVectorCache(db *sql.DB, opts *Options) (*PgVectorCache, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if opts.Dimensions <= 0 {
+		return nil, errors.New("pgvector cache requires Options.Dimensions")
+	}
+	op, ok := pgvectorOperators[opts.Metric]
+	if !ok {
+		return nil, fmt.Errorf("pgvector cache does not support metric %s", opts.Metric)
+	}
+
+	if _, err := db.Exec(fmt.Sprintf(pgvectorSchema, opts.Dimensions, op.opclass)); err != nil {
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	pc := &PgVectorCache{
+		db:   db,
+		opts: opts,
+		done: make(chan struct{}),
+	}
+	go pc.cleanupLoop()
+
+	return pc, nil
+}
+
+// pgvectorOperator is how a metric is computed by pgvector.
+type pgvectorOperator struct {
+	op      string // distance operator
+	opclass string // index operator class
+	// similarity converts the operator's distance into the value
+	// Metric.Similarity returns.
+	similarity func(d float64) float64
+}
+
+var pgvectorOperators = map[Metric]pgvectorOperator{
+	MetricCosine:            {"<=>", "vector_cosine_ops", func(d float64) float64 { return 1 - d }},
+	MetricDotProduct:        {"<#>", "vector_ip_ops", func(d float64) float64 { return -d }},
+	MetricEuclidean:         {"<->", "vector_l2_ops", func(d float64) float64 { return 1 / (1 + d) }},
+	MetricEuclideanDistance: {"<->", "vector_l2_ops", func(d float64) float64 { return -d }},
+	MetricManhattanDistance: {"<+>", "vector_l1_ops", func(d float64) float64 { return -d }},
+}
+
+// formatVector renders an embedding in pgvector's text format.
+func formatVector(v []float64) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, f := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(f, 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// parseVector parses an embedding in pgvector's text format.
+func parseVector(s string) ([]float64, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+		return nil, fmt.Errorf("invalid vector %q", s)
+	}
+	if s = s[1 : len(s)-1]; s == "" {
+		return []float64{}, nil
+	}
+	parts := strings.Split(s, ",")
+	v := make([]float64, len(parts))
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vector element %q: %w", p, err)
+		}
+		v[i] = f
+	}
+	return v, nil
+}
+
+// scanEntry reads a row selected with pgvectorColumns, plus any extra
+// destinations for trailing columns.
+func (p *PgVectorCache) scanEntry(row interface{ Scan(...any) error }, extra ...any) (*api.CacheEntry, error) {
+	var (
+		e                 api.CacheEntry
+		reqJSON, respJSON []byte
+		errJSON           []byte
+		embedding         string
+		statusCode        int64
+		schemaVersion     int64
+	)
+	dest := append([]any{&e.ID, &reqJSON, &respJSON, &embedding, &e.CreatedAt, &e.ExpiresAt, &e.HitCount, &e.LastHitAt,
+		&e.Namespace, &e.RequestHash, &e.EmbeddingModel, &e.Negative, &statusCode, &errJSON, &e.Pinned, &e.Checksum, &schemaVersion}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	e.StatusCode = int(statusCode)
+	e.SchemaVersion = int(schemaVersion)
+
+	var err error
+	if reqJSON, err = decompress(reqJSON); err != nil {
+		return nil, fmt.Errorf("failed to decode request for entry %s: %w", e.ID, err)
+	}
+	if respJSON, err = decompress(respJSON); err != nil {
+		return nil, fmt.Errorf("failed to decode response for entry %s: %w", e.ID, err)
+	}
+	if err := json.Unmarshal(reqJSON, &e.Request); err != nil {
+		return nil, fmt.Errorf("failed to decode request for entry %s: %w", e.ID, err)
+	}
+	if err := json.Unmarshal(respJSON, &e.Response); err != nil {
+		return nil, fmt.Errorf("failed to decode response for entry %s: %w", e.ID, err)
+	}
+	if errJSON != nil {
+		e.Error = &api.APIError{}
+		if err := json.Unmarshal(errJSON, e.Error); err != nil {
+			return nil, fmt.Errorf("failed to decode error for entry %s: %w", e.ID, err)
+		}
+	}
+	if e.Embedding, err = parseVector(embedding); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding for entry %s: %w", e.ID, err)
+	}
+	return &e, nil
+}
+
+// nearest returns up to k live entries in the context's namespace closest
+// to embedding, with their similarity as returned by metric.Similarity,
+// closest first.
+func (p *PgVectorCache) nearest(ctx context.Context, embedding []float64, metric Metric, k int) ([]SearchResult, error) {
+	op, ok := pgvectorOperators[metric]
+	if !ok {
+		return nil, fmt.Errorf("pgvector cache does not support metric %s", metric)
+	}
+	now := time.Now()
+
+	rows, err := p.db.QueryContext(ctx, `SELECT `+pgvectorColumns+`, embedding `+op.op+` $1::vector AS distance
+		FROM mimir_cache_entries
+		WHERE NOT negative AND namespace = $2 AND expires_at > $3 AND ($4 = '' OR embedding_model IN ('', $4))
+		ORDER BY embedding `+op.op+` $1::vector
+		LIMIT $5`,
+		formatVector(embedding), namespaceFromContext(ctx), now, p.opts.embeddingModel(ctx), k)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query entries: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	var corrupt, incompatible []string
+	for rows.Next() {
+		var distance float64
+		e, err := p.scanEntry(rows, &distance)
+		if err != nil {
+			return nil, err
+		}
+		if !p.opts.intact(e) {
+			corrupt = append(corrupt, e.ID)
+			continue
+		}
+		if err := migrateEntry(e); err != nil {
+			p.opts.logIncompatible(ctx, e.ID, err)
+			incompatible = append(incompatible, e.ID)
+			continue
+		}
+		similarity := op.similarity(distance)
+		results = append(results, SearchResult{Entry: e, Similarity: similarity, Confidence: p.opts.confidence(e, similarity, now)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	p.deleteCorrupt(ctx, corrupt...)
+	p.deleteIncompatible(ctx, incompatible...)
+	return results, nil
+}
+
+// deleteCorrupt removes entries that failed integrity verification.
+func (p *PgVectorCache) deleteCorrupt(ctx context.Context, ids ...string) {
+	for _, id := range ids {
+		if _, err := p.db.ExecContext(ctx, `DELETE FROM mimir_cache_entries WHERE id = $1`, id); err == nil {
+			p.opts.logCorrupt(ctx, id)
+		}
+	}
+}
+
+// deleteIncompatible removes entries that could not be upgraded to the
+// current schema version.
+func (p *PgVectorCache) deleteIncompatible(ctx context.Context, ids ...string) {
+	for _, id := range ids {
+		p.db.ExecContext(ctx, `DELETE FROM mimir_cache_entries WHERE id = $1`, id)
+	}
+}
+
+// pgvectorScoringCandidates is how many nearest entries Get ranks by
+// confidence under Options.Scoring.
+const pgvectorScoringCandidates = 10
+
+// Get retrieves a cached response based on semantic similarity. The
+// nearest entry is found through the index and then held to threshold.
+func (p *PgVectorCache) Get(ctx context.Context, embedding []float64, threshold float64) (*api.CacheEntry, float64, bool) {
+	result, ok := p.best(ctx, embedding, p.opts.lookupThreshold(ctx, threshold))
+	if !ok {
+		p.recordMiss(ctx, embedding)
+		return nil, 0, false
+	}
+	hit := p.recordHit(ctx, result.Entry, time.Now(), false)
+	p.opts.onHit(hit, result.Similarity)
+	return hit, result.Similarity, true
+}
+
+// best returns the nearest entry at or above threshold or, under
+// Options.Scoring, the one of highest confidence among the nearest few.
+func (p *PgVectorCache) best(ctx context.Context, embedding []float64, threshold float64) (SearchResult, bool) {
+	metric := p.opts.queryMetric(ctx)
+	k := 1
+	if p.opts.Scoring.enabled() {
+		k = pgvectorScoringCandidates
+	}
+	results, err := p.nearest(ctx, embedding, metric, k)
+	if err != nil || ctx.Err() != nil {
+		return SearchResult{}, false
+	}
+
+	var best *SearchResult
+	for i, r := range results {
+		if r.Similarity < metric.ordered(threshold) {
+			break
+		}
+		if best == nil || r.Confidence > best.Confidence {
+			best = &results[i]
+		}
+	}
+	if best == nil {
+		return SearchResult{}, false
+	}
+	best.Similarity = metric.ordered(best.Similarity)
+	return *best, true
+}
+
+// GetBatch looks up several embeddings, one index query each.
+func (p *PgVectorCache) GetBatch(ctx context.Context, embeddings [][]float64, threshold float64) []*SearchResult {
+	threshold = p.opts.modelThreshold(ctx, threshold)
+	results := make([]*SearchResult, len(embeddings))
+	for i, embedding := range embeddings {
+		result, ok := p.best(ctx, embedding, threshold)
+		if !ok {
+			p.recordMiss(ctx, embedding)
+			continue
+		}
+		result.Entry = p.recordHit(ctx, result.Entry, time.Now(), false)
+		p.opts.onHit(result.Entry, result.Similarity)
+		results[i] = &result
+	}
+	return results
+}
+
+// GetExact retrieves the entry whose request canonicalizes identically to
+// req. OnHit receives a similarity of 1.
+func (p *PgVectorCache) GetExact(ctx context.Context, req *api.ChatCompletionRequest) (*api.CacheEntry, bool) {
+	row := p.db.QueryRowContext(ctx, `SELECT `+pgvectorColumns+` FROM mimir_cache_entries
+		WHERE request_hash = $1 AND namespace = $2 AND expires_at > $3
+		LIMIT 1`,
+		api.RequestHash(req), namespaceFromContext(ctx), time.Now())
+	match, err := p.scanEntry(row)
+	if err != nil {
+		return nil, false
+	}
+	if !p.opts.intact(match) {
+		p.deleteCorrupt(ctx, match.ID)
+		return nil, false
+	}
+	if err := migrateEntry(match); err != nil {
+		p.opts.logIncompatible(ctx, match.ID, err)
+		p.deleteIncompatible(ctx, match.ID)
+		return nil, false
+	}
+
+	hit := p.recordHit(ctx, match, time.Now(), true)
+	p.opts.onHit(hit, 1)
+	return hit, true
+}
+
+// recordMiss persists miss statistics.
+func (p *PgVectorCache) recordMiss(ctx context.Context, embedding []float64) {
+	model := modelFromContext(ctx)
+	p.incrementCounters(ctx, map[string]int64{"misses": 1, "misses:" + model: 1})
+	p.opts.onMiss(embedding)
+}
+
+// recordHit persists hit statistics for an entry and returns it updated.
+func (p *PgVectorCache) recordHit(ctx context.Context, hit *api.CacheEntry, now time.Time, exact bool) *api.CacheEntry {
+	model := hit.Request.Model
+	if model == "" {
+		model = unknownModel
+	}
+	saved := int64(p.opts.hitSavings(hit) * 1e6)
+	counters := map[string]int64{
+		"hits":                     1,
+		"saved_micro_usd":          saved,
+		"hits:" + model:            1,
+		"saved_micro_usd:" + model: saved,
+	}
+	if exact {
+		counters["exact_hits"] = 1
+	}
+	p.incrementCounters(ctx, counters)
+
+	hit.HitCount++
+	hit.LastHitAt = now
+	p.db.ExecContext(ctx, `UPDATE mimir_cache_entries SET hit_count = hit_count + 1, last_hit_at = $1 WHERE id = $2`,
+		now, hit.ID)
+	return hit
+}
+
+// incrementCounters persists counter increments in one statement.
+func (p *PgVectorCache) incrementCounters(ctx context.Context, deltas map[string]int64) {
+	var values []string
+	var args []any
+	for name, delta := range deltas {
+		values = append(values, fmt.Sprintf("($%d, $%d)", len(args)+1, len(args)+2))
+		args = append(args, name, delta)
+	}
+	p.db.ExecContext(ctx, `INSERT INTO mimir_cache_counters (name, value) VALUES `+strings.Join(values, ", ")+`
+		ON CONFLICT (name) DO UPDATE SET value = mimir_cache_counters.value + EXCLUDED.value`, args...)
+}
+
+// Search returns up to k live entries with similarity at or above
+// threshold, most similar first.
+func (p *PgVectorCache) Search(ctx context.Context, embedding []float64, threshold float64, k int) []SearchResult {
+	threshold = p.opts.lookupThreshold(ctx, threshold)
+	if k <= 0 {
+		return nil
+	}
+
+	metric := p.opts.queryMetric(ctx)
+	results, err := p.nearest(ctx, embedding, metric, k)
+	if err != nil {
+		return nil
+	}
+	threshold = metric.ordered(threshold)
+	for i, r := range results {
+		if r.Similarity < threshold {
+			results = results[:i]
+			break
+		}
+	}
+	return metricResults(metric, topResults(results, k))
+}
+
+// GetByID retrieves an entry by its ID without affecting hit statistics.
+func (p *PgVectorCache) GetByID(ctx context.Context, id string) (*api.CacheEntry, bool) {
+	row := p.db.QueryRowContext(ctx, `SELECT `+pgvectorColumns+` FROM mimir_cache_entries
+		WHERE id = $1 AND expires_at > $2`, id, time.Now())
+	e, err := p.scanEntry(row)
+	if err != nil {
+		return nil, false
+	}
+	if !p.opts.intact(e) {
+		p.deleteCorrupt(ctx, e.ID)
+		return nil, false
+	}
+	if err := migrateEntry(e); err != nil {
+		p.opts.logIncompatible(ctx, e.ID, err)
+		p.deleteIncompatible(ctx, e.ID)
+		return nil, false
+	}
+	return e, true
+}
+
+// Set stores a response with its embedding, replacing an entry with the
+// same ID or a near-duplicate embedding.
+func (p *PgVectorCache) Set(ctx context.Context, entry *api.CacheEntry) error {
+	p.opts.onSet(entry)
+	if err := checkResponseFormat(entry); err != nil {
+		return err
+	}
+	if err := p.opts.checkToolCalls(entry); err != nil {
+		return err
+	}
+	if err := CheckFinite(entry.Embedding); err != nil {
+		return err
+	}
+	applyNamespace(ctx, entry)
+	p.opts.applyEmbeddingModel(ctx, entry)
+	applyRequestHash(entry)
+	p.opts.sanitize(entry)
+	if p.opts.NormalizeOnSet {
+		entry.Embedding = NormalizeVector(entry.Embedding)
+	}
+	p.opts.resolveExpiry(entry)
+	p.opts.applyNegativeTTL(entry)
+	if err := p.opts.applyConfidence(entry); err != nil {
+		return err
+	}
+	p.opts.applyChecksum(entry)
+	if len(entry.Embedding) != p.opts.Dimensions {
+		return fmt.Errorf("%w: got %d, want %d", ErrDimensionMismatch, len(entry.Embedding), p.opts.Dimensions)
+	}
+	if entry.ID == "" {
+		entry.ID = NewEntryID()
+	}
+	entry.SchemaVersion = api.CacheEntrySchemaVersion
+
+	reqJSON, err := json.Marshal(entry.Request)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	respJSON, err := json.Marshal(entry.Response)
+	if err != nil {
+		return fmt.Errorf("failed to encode response: %w", err)
+	}
+	if reqJSON, err = p.opts.Compression.compress(reqJSON); err != nil {
+		return err
+	}
+	if respJSON, err = p.opts.Compression.compress(respJSON); err != nil {
+		return err
+	}
+	var errJSON []byte
+	if entry.Error != nil {
+		if errJSON, err = json.Marshal(entry.Error); err != nil {
+			return fmt.Errorf("failed to encode error: %w", err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// A negative entry replaces the failure remembered for the same
+	// request, and is dropped if a response to the request is stored
+	if entry.Negative {
+		var shadowed bool
+		err := p.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM mimir_cache_entries
+			WHERE request_hash = $1 AND namespace = $2 AND NOT negative AND id <> $3)`,
+			entry.RequestHash, entry.Namespace, entry.ID).Scan(&shadowed)
+		if err != nil {
+			return fmt.Errorf("failed to query entries: %w", err)
+		}
+		if shadowed {
+			return nil
+		}
+	}
+	if _, err := p.db.ExecContext(ctx, `DELETE FROM mimir_cache_entries
+		WHERE request_hash = $1 AND namespace = $2 AND negative AND id <> $3`,
+		entry.RequestHash, entry.Namespace, entry.ID); err != nil {
+		return fmt.Errorf("failed to delete entry: %w", err)
+	}
+
+	if !p.opts.DisableDedupOnSet && !entry.Negative {
+		dup, err := p.nearest(WithEmbeddingModel(WithNamespace(ctx, entry.Namespace), entry.EmbeddingModel), entry.Embedding, p.opts.Metric, 1)
+		if err != nil {
+			return err
+		}
+		if len(dup) > 0 && dup[0].Entry.ID != entry.ID && p.opts.Metric.isNearDuplicate(dup[0].Similarity) {
+			// Replacements of pinned entries stay pinned
+			entry.Pinned = entry.Pinned || dup[0].Entry.Pinned
+			if err := p.Delete(ctx, dup[0].Entry.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.opts.MaxSize > 0 {
+		if err := p.evict(ctx, entry.ID); err != nil {
+			return err
+		}
+	}
+
+	_, err = p.db.ExecContext(ctx, `INSERT INTO mimir_cache_entries
+		(id, request, response, embedding, model, created_at, expires_at, hit_count, last_hit_at,
+			namespace, request_hash, embedding_model, negative, status_code, error, pinned, checksum, schema_version)
+		VALUES ($1, $2, $3, $4::vector, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		ON CONFLICT (id) DO UPDATE SET
+			request = EXCLUDED.request, response = EXCLUDED.response, embedding = EXCLUDED.embedding,
+			model = EXCLUDED.model, created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at,
+			hit_count = EXCLUDED.hit_count, last_hit_at = EXCLUDED.last_hit_at, namespace = EXCLUDED.namespace,
+			request_hash = EXCLUDED.request_hash, embedding_model = EXCLUDED.embedding_model,
+			negative = EXCLUDED.negative, status_code = EXCLUDED.status_code, error = EXCLUDED.error,
+			checksum = EXCLUDED.checksum, schema_version = EXCLUDED.schema_version, pinned = mimir_cache_entries.pinned OR EXCLUDED.pinned`,
+		entry.ID, reqJSON, respJSON, formatVector(entry.Embedding), entry.Request.Model,
+		entry.CreatedAt, entry.ExpiresAt, entry.HitCount, entry.LastHitAt,
+		entry.Namespace, entry.RequestHash, entry.EmbeddingModel, entry.Negative, entry.StatusCode, errJSON, entry.Pinned, entry.Checksum, entry.SchemaVersion)
+	if err != nil {
+		return fmt.Errorf("failed to insert entry: %w", err)
+	}
+	return nil
+}
+
+// evict removes least recently hit unpinned entries until there is room
+// for one more, unless id is already stored and will be replaced. It
+// returns ErrAllPinned if every entry is pinned. Caller must hold the
+// lock.
+func (p *PgVectorCache) evict(ctx context.Context, id string) error {
+	var size int
+	var exists bool
+	err := p.db.QueryRowContext(ctx, `SELECT count(*), coalesce(bool_or(id = $1), false) FROM mimir_cache_entries`, id).Scan(&size, &exists)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to count entries: %w", err)
+	}
+	if exists || size < p.opts.MaxSize {
+		return nil
+	}
+
+	rows, err := p.db.QueryContext(ctx, `DELETE FROM mimir_cache_entries WHERE id IN (
+		SELECT id FROM mimir_cache_entries WHERE NOT pinned ORDER BY last_hit_at LIMIT $1) RETURNING id`, size-p.opts.MaxSize+1)
+	if err != nil {
+		return fmt.Errorf("failed to evict entries: %w", err)
+	}
+	defer rows.Close()
+
+	var n int64
+	for rows.Next() {
+		var evicted string
+		if err := rows.Scan(&evicted); err != nil {
+			return fmt.Errorf("failed to evict entries: %w", err)
+		}
+		p.opts.logEviction(ctx, evicted)
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to evict entries: %w", err)
+	}
+	if n == 0 {
+		return ErrAllPinned
+	}
+	p.incrementCounters(ctx, map[string]int64{"evictions": n})
+	return nil
+}
+
+// Delete removes an entry by its ID.
+func (p *PgVectorCache) Delete(ctx context.Context, id string) error {
+	if _, err := p.db.ExecContext(ctx, `DELETE FROM mimir_cache_entries WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete entry: %w", err)
+	}
+	return nil
+}
+
+// Pin exempts the entry with the given ID from eviction.
+func (p *PgVectorCache) Pin(ctx context.Context, id string) error {
+	return p.setPinned(ctx, id, true)
+}
+
+// Unpin makes a pinned entry evictable again.
+func (p *PgVectorCache) Unpin(ctx context.Context, id string) error {
+	return p.setPinned(ctx, id, false)
+}
+
+// setPinned updates the pinned flag of the entry with the given ID.
+func (p *PgVectorCache) setPinned(ctx context.Context, id string, pinned bool) error {
+	res, err := p.db.ExecContext(ctx, `UPDATE mimir_cache_entries SET pinned = $1 WHERE id = $2`, pinned, id)
+	if err != nil {
+		return fmt.Errorf("failed to update entry: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteByEmbedding removes the entry nearly identical to the embedding
+// in the context's namespace.
+func (p *PgVectorCache) DeleteByEmbedding(ctx context.Context, embedding []float64) error {
+	results, err := p.nearest(ctx, embedding, p.opts.Metric, 1)
+	if err != nil {
+		return err
+	}
+	if len(results) > 0 && p.opts.Metric.isNearDuplicate(results[0].Similarity) {
+		return p.Delete(ctx, results[0].Entry.ID)
+	}
+	return nil
+}
+
+// Clear removes all entries and resets statistics.
+func (p *PgVectorCache) Clear(ctx context.Context) error {
+	if _, err := p.db.ExecContext(ctx, `DELETE FROM mimir_cache_entries`); err != nil {
+		return fmt.Errorf("failed to clear entries: %w", err)
+	}
+	if _, err := p.db.ExecContext(ctx, `DELETE FROM mimir_cache_counters`); err != nil {
+		return fmt.Errorf("failed to reset counters: %w", err)
+	}
+	return nil
+}
+
+// ClearNamespace removes all entries in a namespace.
+func (p *PgVectorCache) ClearNamespace(ctx context.Context, namespace string) error {
+	if _, err := p.db.ExecContext(ctx, `DELETE FROM mimir_cache_entries WHERE namespace = $1`, namespace); err != nil {
+		return fmt.Errorf("failed to clear namespace: %w", err)
+	}
+	return nil
+}
+
+// DeleteByModel removes all entries for the request model.
+func (p *PgVectorCache) DeleteByModel(ctx context.Context, model string) (int, error) {
+	return p.deleteWhere(ctx, `model = $1`, model)
+}
+
+// DeleteOlderThan removes all entries created before t.
+func (p *PgVectorCache) DeleteOlderThan(ctx context.Context, t time.Time) (int, error) {
+	return p.deleteWhere(ctx, `created_at < $1`, t)
+}
+
+// deleteWhere removes entries matching a condition and returns the number
+// removed.
+func (p *PgVectorCache) deleteWhere(ctx context.Context, cond string, args ...any) (int, error) {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM mimir_cache_entries WHERE `+cond, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete entries: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted entries: %w", err)
+	}
+	return int(n), nil
+}
+
+// LoadFromReader stores JSONL entries written by DumpToWriter.
+func (p *PgVectorCache) LoadFromReader(ctx context.Context, r io.Reader) (int, error) {
+	return loadJSONL(ctx, p, r)
+}
+
+// DumpToWriter writes all live entries as JSONL.
+func (p *PgVectorCache) DumpToWriter(ctx context.Context, w io.Writer) error {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+pgvectorColumns+` FROM mimir_cache_entries WHERE expires_at > $1`, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to query entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*api.CacheEntry
+	for rows.Next() {
+		e, err := p.scanEntry(rows)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read entries: %w", err)
+	}
+	return dumpJSONL(w, entries)
+}
+
+// Entries returns a page of live entries, oldest first.
+func (p *PgVectorCache) Entries(ctx context.Context, offset, limit int) ([]*api.CacheEntry, error) {
+	query := `SELECT ` + pgvectorColumns + ` FROM mimir_cache_entries WHERE expires_at > $1 ORDER BY created_at, id OFFSET $2`
+	args := []interface{}{time.Now(), max(offset, 0)}
+	if limit > 0 {
+		query += ` LIMIT $3`
+		args = append(args, limit)
+	}
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*api.CacheEntry
+	for rows.Next() {
+		e, err := p.scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read entries: %w", err)
+	}
+	return entries, nil
+}
+
+// counters reads the persisted counters.
+func (p *PgVectorCache) counters(ctx context.Context) (map[string]int64, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT name, value FROM mimir_cache_counters`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load counters: %w", err)
+	}
+	defer rows.Close()
+
+	counters := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var value int64
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan counter: %w", err)
+		}
+		counters[name] = value
+	}
+	return counters, rows.Err()
+}
+
+// Stats returns cache statistics, shared by every cache on the database.
+func (p *PgVectorCache) Stats(ctx context.Context) *api.CacheStats {
+	counters, _ := p.counters(ctx)
+	hits := counters["hits"]
+	exactHits := counters["exact_hits"]
+	misses := counters["misses"]
+
+	var hitRate float64
+	if total := hits + misses; total > 0 {
+		hitRate = float64(hits) / float64(total)
+	}
+
+	return &api.CacheStats{
+		TotalEntries:   int64(p.Size(ctx)),
+		TotalHits:      hits,
+		ExactHits:      exactHits,
+		SemanticHits:   hits - exactHits,
+		TotalMisses:    misses,
+		HitRate:        hitRate,
+		EstimatedSaved: float64(counters["saved_micro_usd"]) / 1e6,
+		Evictions:      counters["evictions"],
+	}
+}
+
+// StatsByModel returns cache statistics broken down by request model.
+func (p *PgVectorCache) StatsByModel(ctx context.Context) map[string]*api.CacheStats {
+	var byModel modelStats
+	counters, _ := p.counters(ctx)
+	for name, value := range counters {
+		kind, model, ok := strings.Cut(name, ":")
+		if !ok {
+			continue
+		}
+		c := byModel.get(model)
+		switch kind {
+		case "hits":
+			c.hits = value
+		case "misses":
+			c.misses = value
+		case "saved_micro_usd":
+			c.savedUSD = float64(value) / 1e6
+		}
+	}
+
+	entries := make(map[string]int64)
+	if rows, err := p.db.QueryContext(ctx, `SELECT model, count(*) FROM mimir_cache_entries GROUP BY model`); err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var model string
+			var n int64
+			if rows.Scan(&model, &n) == nil {
+				entries[model] = n
+			}
+		}
+	}
+
+	return byModel.snapshot(entries)
+}
+
+// Cleanup removes expired entries.
+func (p *PgVectorCache) Cleanup(ctx context.Context) int {
+	n, err := p.deleteWhere(ctx, `expires_at <= $1`, time.Now())
+	if err != nil {
+		return 0
+	}
+	p.opts.logCleanup(ctx, n)
+	return n
+}
+
+// Size returns the number of entries in the cache.
+func (p *PgVectorCache) Size(ctx context.Context) int {
+	var n int
+	if err := p.db.QueryRowContext(ctx, `SELECT count(*) FROM mimir_cache_entries`).Scan(&n); err != nil {
+		return 0
+	}
+	return n
+}
+
+// cleanupLoop periodically removes expired entries.
+func (p *PgVectorCache) cleanupLoop() {
+	ticker := time.NewTicker(p.opts.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.Cleanup(context.Background())
+		}
+	}
+}
+
+// Close stops the cleanup goroutine. The database is left open for its
+// owner to close.
+func (p *PgVectorCache) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+	return nil
+}
@@ -0,0 +1,385 @@
+package cache
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakePostgres is an in-memory stand-in for a Postgres database with the
+// pgvector extension, understanding exactly the statements PgVectorCache
+// issues, so the cache can be tested without a server. Any other
+// statement fails, so a query added to PgVectorCache without a case here
+// shows up as a test failure rather than going unnoticed. Use it with
+// sql.OpenDB.
+type fakePostgres struct {
+	mu       sync.Mutex
+	entries  map[string]*fakePgEntry
+	counters map[string]int64
+}
+
+// fakePgEntry is a row of mimir_cache_entries.
+type fakePgEntry struct {
+	id             string
+	request        []byte
+	response       []byte
+	embedding      []float64
+	model          string
+	createdAt      time.Time
+	expiresAt      time.Time
+	hitCount       int64
+	lastHitAt      time.Time
+	namespace      string
+	requestHash    string
+	embeddingModel string
+	negative       bool
+	statusCode     int64
+	errJSON        []byte
+	pinned         bool
+	checksum       string
+	schemaVersion  int64
+}
+
+// fakePgColumns are the column names of pgvectorColumns.
+var fakePgColumns = []string{"id", "request", "response", "embedding", "created_at", "expires_at", "hit_count", "last_hit_at",
+	"namespace", "request_hash", "embedding_model", "negative", "status_code", "error", "pinned", "checksum", "schema_version"}
+
+// values returns the row as selected by pgvectorColumns.
+func (e *fakePgEntry) values() []driver.Value {
+	var errJSON driver.Value
+	if e.errJSON != nil {
+		errJSON = e.errJSON
+	}
+	return []driver.Value{e.id, e.request, e.response, formatVector(e.embedding), e.createdAt, e.expiresAt, e.hitCount, e.lastHitAt,
+		e.namespace, e.requestHash, e.embeddingModel, e.negative, e.statusCode, errJSON, e.pinned, e.checksum, e.schemaVersion}
+}
+
+// fakePgDistances are the distance operators of pgvector.
+var fakePgDistances = map[string]func(a, b []float64) float64{
+	"<=>": func(a, b []float64) float64 { return 1 - CosineSimilarity(a, b) },
+	"<#>": func(a, b []float64) float64 { return -DotProduct(a, b) },
+	"<->": EuclideanDistance,
+	"<+>": ManhattanDistance,
+}
+
+func newFakePostgres() *fakePostgres {
+	return &fakePostgres{
+		entries:  make(map[string]*fakePgEntry),
+		counters: make(map[string]int64),
+	}
+}
+
+// Connect implements driver.Connector.
+func (f *fakePostgres) Connect(context.Context) (driver.Conn, error) {
+	return fakePgConn{f}, nil
+}
+
+// Driver implements driver.Connector.
+func (f *fakePostgres) Driver() driver.Driver {
+	return fakePgDriver{f}
+}
+
+type fakePgDriver struct{ db *fakePostgres }
+
+func (d fakePgDriver) Open(string) (driver.Conn, error) {
+	return fakePgConn{d.db}, nil
+}
+
+// fakePgConn runs statements directly through ExecContext and
+// QueryContext; it supports neither prepared statements nor transactions.
+type fakePgConn struct{ db *fakePostgres }
+
+func (c fakePgConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fake postgres: prepared statements are not supported")
+}
+
+func (c fakePgConn) Close() error { return nil }
+
+func (c fakePgConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fake postgres: transactions are not supported")
+}
+
+func (c fakePgConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	n, err := c.db.exec(normalizeFakePgQuery(query), fakePgArgs(args))
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
+
+func (c fakePgConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	return c.db.query(normalizeFakePgQuery(query), fakePgArgs(args))
+}
+
+// normalizeFakePgQuery collapses whitespace and abbreviates the entry
+// column list to "<cols>".
+func normalizeFakePgQuery(query string) string {
+	normalize := func(s string) string { return strings.Join(strings.Fields(s), " ") }
+	return strings.ReplaceAll(normalize(query), normalize(pgvectorColumns), "<cols>")
+}
+
+func fakePgArgs(named []driver.NamedValue) []driver.Value {
+	args := make([]driver.Value, len(named))
+	for i, nv := range named {
+		args[i] = nv.Value
+	}
+	return args
+}
+
+// exec runs a statement returning no rows and returns the number of rows
+// it affected.
+func (f *fakePostgres) exec(query string, args []driver.Value) (int64, error) {
+	switch {
+	case strings.HasPrefix(query, "CREATE EXTENSION IF NOT EXISTS vector;"):
+		return 0, nil
+	case strings.HasPrefix(query, "INSERT INTO mimir_cache_counters (name, value) VALUES "):
+		for i := 0; i+1 < len(args); i += 2 {
+			f.counters[args[i].(string)] += args[i+1].(int64)
+		}
+		return int64(len(args) / 2), nil
+	case strings.HasPrefix(query, "INSERT INTO mimir_cache_entries "):
+		return 1, f.insert(args)
+	}
+
+	switch query {
+	case "UPDATE mimir_cache_entries SET hit_count = hit_count + 1, last_hit_at = $1 WHERE id = $2":
+		e, ok := f.entries[args[1].(string)]
+		if !ok {
+			return 0, nil
+		}
+		e.hitCount++
+		e.lastHitAt = args[0].(time.Time)
+		return 1, nil
+	case "UPDATE mimir_cache_entries SET pinned = $1 WHERE id = $2":
+		e, ok := f.entries[args[1].(string)]
+		if !ok {
+			return 0, nil
+		}
+		e.pinned = args[0].(bool)
+		return 1, nil
+	case "DELETE FROM mimir_cache_counters":
+		n := int64(len(f.counters))
+		f.counters = make(map[string]int64)
+		return n, nil
+	case "DELETE FROM mimir_cache_entries":
+		return f.delete(func(*fakePgEntry) bool { return true }), nil
+	case "DELETE FROM mimir_cache_entries WHERE id = $1":
+		return f.delete(func(e *fakePgEntry) bool { return e.id == args[0] }), nil
+	case "DELETE FROM mimir_cache_entries WHERE namespace = $1":
+		return f.delete(func(e *fakePgEntry) bool { return e.namespace == args[0] }), nil
+	case "DELETE FROM mimir_cache_entries WHERE model = $1":
+		return f.delete(func(e *fakePgEntry) bool { return e.model == args[0] }), nil
+	case "DELETE FROM mimir_cache_entries WHERE created_at < $1":
+		return f.delete(func(e *fakePgEntry) bool { return e.createdAt.Before(args[0].(time.Time)) }), nil
+	case "DELETE FROM mimir_cache_entries WHERE expires_at <= $1":
+		return f.delete(func(e *fakePgEntry) bool { return !e.expiresAt.After(args[0].(time.Time)) }), nil
+	case "DELETE FROM mimir_cache_entries WHERE request_hash = $1 AND namespace = $2 AND negative AND id <> $3":
+		return f.delete(func(e *fakePgEntry) bool {
+			return e.requestHash == args[0] && e.namespace == args[1] && e.negative && e.id != args[2]
+		}), nil
+	}
+	return 0, fmt.Errorf("fake postgres: unsupported statement %q", query)
+}
+
+// insert upserts an entry by ID, keeping it pinned if it was.
+func (f *fakePostgres) insert(args []driver.Value) error {
+	if len(args) != 18 {
+		return fmt.Errorf("fake postgres: expected 18 entry values, got %d", len(args))
+	}
+	embedding, err := parseVector(args[3].(string))
+	if err != nil {
+		return err
+	}
+	e := &fakePgEntry{
+		id:             args[0].(string),
+		request:        args[1].([]byte),
+		response:       args[2].([]byte),
+		embedding:      embedding,
+		model:          args[4].(string),
+		createdAt:      args[5].(time.Time),
+		expiresAt:      args[6].(time.Time),
+		hitCount:       args[7].(int64),
+		lastHitAt:      args[8].(time.Time),
+		namespace:      args[9].(string),
+		requestHash:    args[10].(string),
+		embeddingModel: args[11].(string),
+		negative:       args[12].(bool),
+		statusCode:     args[13].(int64),
+		pinned:         args[15].(bool),
+		checksum:       args[16].(string),
+		schemaVersion:  args[17].(int64),
+	}
+	if errJSON, ok := args[14].([]byte); ok {
+		e.errJSON = errJSON
+	}
+	if old, ok := f.entries[e.id]; ok {
+		e.pinned = e.pinned || old.pinned
+	}
+	f.entries[e.id] = e
+	return nil
+}
+
+// delete removes the entries matching and returns how many it removed.
+func (f *fakePostgres) delete(match func(*fakePgEntry) bool) int64 {
+	var n int64
+	for id, e := range f.entries {
+		if match(e) {
+			delete(f.entries, id)
+			n++
+		}
+	}
+	return n
+}
+
+// sorted returns the entries matching, ordered by less.
+func (f *fakePostgres) sorted(match func(*fakePgEntry) bool, less func(a, b *fakePgEntry) bool) []*fakePgEntry {
+	var entries []*fakePgEntry
+	for _, e := range f.entries {
+		if match(e) {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if less != nil && less(entries[i], entries[j]) != less(entries[j], entries[i]) {
+			return less(entries[i], entries[j])
+		}
+		return entries[i].id < entries[j].id
+	})
+	return entries
+}
+
+// query runs a statement returning rows.
+func (f *fakePostgres) query(query string, args []driver.Value) (driver.Rows, error) {
+	if op, ok := strings.CutPrefix(query, "SELECT <cols>, embedding "); ok {
+		return f.nearest(query, op[:3], args)
+	}
+
+	switch query {
+	case "SELECT <cols> FROM mimir_cache_entries WHERE request_hash = $1 AND namespace = $2 AND expires_at > $3 LIMIT 1":
+		entries := f.sorted(func(e *fakePgEntry) bool {
+			return e.requestHash == args[0] && e.namespace == args[1] && e.expiresAt.After(args[2].(time.Time))
+		}, nil)
+		return entryRows(limitFakePg(entries, 1)), nil
+	case "SELECT <cols> FROM mimir_cache_entries WHERE id = $1 AND expires_at > $2":
+		return entryRows(f.sorted(func(e *fakePgEntry) bool {
+			return e.id == args[0] && e.expiresAt.After(args[1].(time.Time))
+		}, nil)), nil
+	case "SELECT <cols> FROM mimir_cache_entries WHERE expires_at > $1":
+		return entryRows(f.sorted(func(e *fakePgEntry) bool { return e.expiresAt.After(args[0].(time.Time)) }, nil)), nil
+	case "SELECT <cols> FROM mimir_cache_entries WHERE expires_at > $1 ORDER BY created_at, id OFFSET $2",
+		"SELECT <cols> FROM mimir_cache_entries WHERE expires_at > $1 ORDER BY created_at, id OFFSET $2 LIMIT $3":
+		entries := f.sorted(func(e *fakePgEntry) bool { return e.expiresAt.After(args[0].(time.Time)) },
+			func(a, b *fakePgEntry) bool { return a.createdAt.Before(b.createdAt) })
+		entries = entries[min(int(args[1].(int64)), len(entries)):]
+		if len(args) > 2 {
+			entries = limitFakePg(entries, int(args[2].(int64)))
+		}
+		return entryRows(entries), nil
+	case "SELECT EXISTS (SELECT 1 FROM mimir_cache_entries WHERE request_hash = $1 AND namespace = $2 AND NOT negative AND id <> $3)":
+		exists := len(f.sorted(func(e *fakePgEntry) bool {
+			return e.requestHash == args[0] && e.namespace == args[1] && !e.negative && e.id != args[2]
+		}, nil)) > 0
+		return &fakePgRows{columns: []string{"exists"}, rows: [][]driver.Value{{exists}}}, nil
+	case "SELECT count(*), coalesce(bool_or(id = $1), false) FROM mimir_cache_entries":
+		_, exists := f.entries[args[0].(string)]
+		return &fakePgRows{columns: []string{"count", "coalesce"}, rows: [][]driver.Value{{int64(len(f.entries)), exists}}}, nil
+	case "SELECT count(*) FROM mimir_cache_entries":
+		return &fakePgRows{columns: []string{"count"}, rows: [][]driver.Value{{int64(len(f.entries))}}}, nil
+	case "SELECT model, count(*) FROM mimir_cache_entries GROUP BY model":
+		counts := make(map[string]int64)
+		for _, e := range f.entries {
+			counts[e.model]++
+		}
+		rows := &fakePgRows{columns: []string{"model", "count"}}
+		for model, n := range counts {
+			rows.rows = append(rows.rows, []driver.Value{model, n})
+		}
+		return rows, nil
+	case "SELECT name, value FROM mimir_cache_counters":
+		rows := &fakePgRows{columns: []string{"name", "value"}}
+		for name, value := range f.counters {
+			rows.rows = append(rows.rows, []driver.Value{name, value})
+		}
+		return rows, nil
+	case "DELETE FROM mimir_cache_entries WHERE id IN ( SELECT id FROM mimir_cache_entries WHERE NOT pinned ORDER BY last_hit_at LIMIT $1) RETURNING id":
+		victims := f.sorted(func(e *fakePgEntry) bool { return !e.pinned },
+			func(a, b *fakePgEntry) bool { return a.lastHitAt.Before(b.lastHitAt) })
+		rows := &fakePgRows{columns: []string{"id"}}
+		for _, e := range limitFakePg(victims, int(args[0].(int64))) {
+			delete(f.entries, e.id)
+			rows.rows = append(rows.rows, []driver.Value{e.id})
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("fake postgres: unsupported query %q", query)
+}
+
+// nearest answers PgVectorCache.nearest's query with distance operator op.
+func (f *fakePostgres) nearest(query, op string, args []driver.Value) (driver.Rows, error) {
+	want := "SELECT <cols>, embedding " + op + " $1::vector AS distance FROM mimir_cache_entries" +
+		" WHERE NOT negative AND namespace = $2 AND expires_at > $3 AND ($4 = '' OR embedding_model IN ('', $4))" +
+		" ORDER BY embedding " + op + " $1::vector LIMIT $5"
+	distance, ok := fakePgDistances[op]
+	if !ok || query != want {
+		return nil, fmt.Errorf("fake postgres: unsupported query %q", query)
+	}
+	embedding, err := parseVector(args[0].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	model := args[3].(string)
+	entries := f.sorted(func(e *fakePgEntry) bool {
+		return !e.negative && e.namespace == args[1] && e.expiresAt.After(args[2].(time.Time)) &&
+			(model == "" || e.embeddingModel == "" || e.embeddingModel == model)
+	}, func(a, b *fakePgEntry) bool {
+		return distance(a.embedding, embedding) < distance(b.embedding, embedding)
+	})
+
+	rows := &fakePgRows{columns: append(append([]string(nil), fakePgColumns...), "distance")}
+	for _, e := range limitFakePg(entries, int(args[4].(int64))) {
+		rows.rows = append(rows.rows, append(e.values(), distance(e.embedding, embedding)))
+	}
+	return rows, nil
+}
+
+func limitFakePg(entries []*fakePgEntry, n int) []*fakePgEntry {
+	return entries[:min(n, len(entries))]
+}
+
+func entryRows(entries []*fakePgEntry) *fakePgRows {
+	rows := &fakePgRows{columns: fakePgColumns}
+	for _, e := range entries {
+		rows.rows = append(rows.rows, e.values())
+	}
+	return rows
+}
+
+// fakePgRows is a result set held in memory.
+type fakePgRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakePgRows) Columns() []string { return r.columns }
+
+func (r *fakePgRows) Close() error { return nil }
+
+func (r *fakePgRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,385 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// newTestPgVectorCache connects to the database in MIMIR_TEST_POSTGRES_DSN,
+// skipping the test when no pgx driver is linked into the test binary.
+// Without a DSN it runs against fakePostgres.
+func newTestPgVectorCache(t *testing.T, maxSize int) *PgVectorCache {
+	t.Helper()
+
+	db := sql.OpenDB(newFakePostgres())
+	if dsn := os.Getenv("MIMIR_TEST_POSTGRES_DSN"); dsn != "" {
+		registered := false
+		for _, d := range sql.Drivers() {
+			if d == "pgx" {
+				registered = true
+			}
+		}
+		if !registered {
+			t.Skip(`postgres driver "pgx" not registered`)
+		}
+
+		var err error
+		if db, err = sql.Open("pgx", dsn); err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cache, err := NewPgVectorCache(db, &Options{
+		MaxSize:         maxSize,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		Dimensions:      3,
+	})
+	if err != nil {
+		t.Fatalf("NewPgVectorCache failed: %v", err)
+	}
+	cache.Clear(context.Background())
+	t.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+func TestVectorText(t *testing.T) {
+	original := []float64{0.25, -2.5, 1e-3, 0}
+	text := formatVector(original)
+	if text != "[0.25,-2.5,0.001,0]" {
+		t.Errorf("unexpected text %q", text)
+	}
+	decoded, err := parseVector(text)
+	if err != nil {
+		t.Fatalf("parseVector failed: %v", err)
+	}
+	for i := range original {
+		if decoded[i] != original[i] {
+			t.Errorf("element %d: expected %v, got %v", i, original[i], decoded[i])
+		}
+	}
+
+	for _, bad := range []string{"", "1,2", "[1,x]"} {
+		if _, err := parseVector(bad); err == nil {
+			t.Errorf("expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestPgVectorOperators(t *testing.T) {
+	a := []float64{1, 2, 3}
+	b := []float64{2, 0, 1}
+
+	// The distances pgvector's operators return for a and b
+	cosine := 1 - CosineSimilarity(a, b)
+	l2 := EuclideanDistance(a, b)
+	l1 := ManhattanDistance(a, b)
+	ip := -DotProduct(a, b)
+
+	tests := []struct {
+		metric   Metric
+		distance float64
+	}{
+		{MetricCosine, cosine},
+		{MetricDotProduct, ip},
+		{MetricEuclidean, l2},
+		{MetricEuclideanDistance, l2},
+		{MetricManhattanDistance, l1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.metric.String(), func(t *testing.T) {
+			op, ok := pgvectorOperators[tt.metric]
+			if !ok {
+				t.Fatal("expected metric to be supported")
+			}
+			want := tt.metric.Similarity(a, b)
+			if got := op.similarity(tt.distance); math.Abs(got-want) > 1e-9 {
+				t.Errorf("expected similarity %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestNewPgVectorCacheRequiresDimensions(t *testing.T) {
+	if _, err := NewPgVectorCache(nil, &Options{Metric: MetricCosine}); err == nil {
+		t.Error("expected error without Dimensions")
+	}
+}
+
+func TestPgVectorCache(t *testing.T) {
+	cache := newTestPgVectorCache(t, 100)
+	ctx := context.Background()
+
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	if err := cache.Set(ctx, entry); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := cache.Set(ctx, newTestEntry([]float64{1, 0}, time.Hour)); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("expected ErrDimensionMismatch, got %v", err)
+	}
+
+	got, similarity, found := cache.Get(ctx, []float64{1, 0.01, 0}, 0.9)
+	if !found || got.ID != entry.ID {
+		t.Fatalf("expected hit on stored entry, got %v", got)
+	}
+	if similarity < 0.9 || got.HitCount != 1 {
+		t.Errorf("expected similarity >= 0.9 and one hit, got %v and %d", similarity, got.HitCount)
+	}
+	if _, _, found := cache.Get(ctx, []float64{0, 1, 0}, 0.9); found {
+		t.Error("expected miss for dissimilar embedding")
+	}
+	if _, found := cache.GetExact(ctx, &entry.Request); !found {
+		t.Error("expected exact hit")
+	}
+
+	stats := cache.Stats(ctx)
+	if stats.TotalEntries != 1 || stats.TotalHits != 2 || stats.ExactHits != 1 || stats.TotalMisses != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// A near-duplicate replaces the stored entry
+	cache.Set(ctx, newTestEntry([]float64{1, 0.0001, 0}, time.Hour))
+	if size := cache.Size(ctx); size != 1 {
+		t.Errorf("expected near-duplicate to replace, got %d entries", size)
+	}
+
+	if n, err := cache.DeleteByModel(ctx, "test-model"); err != nil || n != 1 {
+		t.Errorf("expected 1 entry deleted, got %d (%v)", n, err)
+	}
+}
+
+func TestPgVectorCacheEviction(t *testing.T) {
+	cache := newTestPgVectorCache(t, 2)
+	ctx := context.Background()
+
+	first := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	first.LastHitAt = time.Now().Add(-time.Minute)
+	second := newTestEntry([]float64{0, 1, 0}, time.Hour)
+	second.Request.Messages[0].Content = "second"
+	for _, entry := range []*api.CacheEntry{first, second} {
+		if err := cache.Set(ctx, entry); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	// The least recently hit entry makes room
+	third := newTestEntry([]float64{0, 0, 1}, time.Hour)
+	third.Request.Messages[0].Content = "third"
+	if err := cache.Set(ctx, third); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, found := cache.GetByID(ctx, first.ID); found {
+		t.Error("expected the least recently hit entry to be evicted")
+	}
+	if stats := cache.Stats(ctx); stats.TotalEntries != 2 || stats.Evictions != 1 {
+		t.Errorf("expected 2 entries and 1 eviction, got %+v", stats)
+	}
+
+	// Pinned entries are never evicted
+	for _, id := range []string{second.ID, third.ID} {
+		if err := cache.Pin(ctx, id); err != nil {
+			t.Fatalf("Pin failed: %v", err)
+		}
+	}
+	if err := cache.Pin(ctx, first.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound pinning an evicted entry, got %v", err)
+	}
+	if err := cache.Set(ctx, first); !errors.Is(err, ErrAllPinned) {
+		t.Errorf("expected ErrAllPinned, got %v", err)
+	}
+	if err := cache.Unpin(ctx, second.ID); err != nil {
+		t.Fatalf("Unpin failed: %v", err)
+	}
+	if err := cache.Set(ctx, first); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, found := cache.GetByID(ctx, third.ID); !found {
+		t.Error("expected the pinned entry to remain")
+	}
+}
+
+func TestPgVectorCacheNegativeEntry(t *testing.T) {
+	cache := newTestPgVectorCache(t, 100)
+	ctx := context.Background()
+
+	good := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	if err := cache.Set(ctx, good); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// A failure of a similar prompt neither replaces nor answers for it
+	other := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	other.Request.Messages = []api.Message{{Role: "user", Content: "test, but longer"}}
+	other.Negative = true
+	other.StatusCode = 400
+	other.Error = &api.APIError{Message: "invalid prompt", Type: "invalid_request_error"}
+	if err := cache.Set(ctx, other); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if result, _, found := cache.Get(ctx, []float64{1, 0, 0}, 0.99); !found || result.Negative {
+		t.Fatalf("expected the response to be found, got %+v", result)
+	}
+	result, found := cache.GetExact(ctx, &other.Request)
+	if !found || !result.Negative || result.StatusCode != 400 || result.Error.Message != "invalid prompt" {
+		t.Fatalf("expected the failure to be found for its own request, got %+v", result)
+	}
+
+	// A failure of the same request is dropped
+	same := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	same.Negative = true
+	if err := cache.Set(ctx, same); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if result, found := cache.GetExact(ctx, &good.Request); !found || result.Negative {
+		t.Errorf("expected the response to be kept, got %+v", result)
+	}
+
+	// A response to the failed request replaces the failure
+	success := newTestEntry([]float64{0, 1, 0}, time.Hour)
+	success.Request = other.Request
+	if err := cache.Set(ctx, success); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if result, found := cache.GetExact(ctx, &other.Request); !found || result.Negative {
+		t.Errorf("expected the response to replace the failure, got %+v", result)
+	}
+	if size := cache.Size(ctx); size != 2 {
+		t.Errorf("expected 2 entries, got %d", size)
+	}
+}
+
+func TestPgVectorCacheEntriesAndSnapshot(t *testing.T) {
+	cache := newTestPgVectorCache(t, 100)
+	ctx := context.Background()
+
+	base := time.Now().Add(-time.Hour)
+	for i, embedding := range [][]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}} {
+		entry := newTestEntry(embedding, time.Hour)
+		entry.Request.Messages[0].Content = string(rune('a' + i))
+		entry.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		if i == 2 {
+			entry.Request.Model = "other-model"
+		}
+		if err := cache.Set(ctx, entry); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	page, err := cache.Entries(ctx, 1, 1)
+	if err != nil {
+		t.Fatalf("Entries failed: %v", err)
+	}
+	if len(page) != 1 || page[0].Request.Messages[0].Content != "b" {
+		t.Errorf("expected the second oldest entry, got %+v", page)
+	}
+	if all, _ := cache.Entries(ctx, 0, 0); len(all) != 3 {
+		t.Errorf("expected 3 entries without a limit, got %d", len(all))
+	}
+
+	cache.Get(ctx, []float64{0, 0, 1}, 0.99)
+	byModel := cache.StatsByModel(ctx)
+	if s := byModel["other-model"]; s == nil || s.TotalEntries != 1 || s.TotalHits != 1 {
+		t.Errorf("unexpected stats for other-model: %+v", s)
+	}
+	if s := byModel["test-model"]; s == nil || s.TotalEntries != 2 {
+		t.Errorf("unexpected stats for test-model: %+v", s)
+	}
+
+	var buf bytes.Buffer
+	if err := cache.DumpToWriter(ctx, &buf); err != nil {
+		t.Fatalf("DumpToWriter failed: %v", err)
+	}
+	if err := cache.Clear(ctx); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if stats := cache.Stats(ctx); stats.TotalEntries != 0 || stats.TotalHits != 0 {
+		t.Errorf("expected Clear to reset the cache, got %+v", stats)
+	}
+	if n, err := cache.LoadFromReader(ctx, &buf); err != nil || n != 3 {
+		t.Fatalf("expected 3 entries loaded, got %d (%v)", n, err)
+	}
+	if _, _, found := cache.Get(ctx, []float64{0, 1, 0}, 0.99); !found {
+		t.Error("expected a loaded entry to be found")
+	}
+}
+
+func TestPgVectorCacheDeletes(t *testing.T) {
+	cache := newTestPgVectorCache(t, 100)
+	ctx := context.Background()
+
+	old := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	old.CreatedAt = time.Now().Add(-2 * time.Hour)
+	expired := newTestEntry([]float64{0, 1, 0}, -time.Hour)
+	expired.Request.Messages[0].Content = "expired"
+	other := newTestEntry([]float64{0, 0, 1}, time.Hour)
+	other.Namespace = "other"
+	for _, entry := range []*api.CacheEntry{old, expired, other} {
+		if err := cache.Set(ctx, entry); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	// Lookups stay within their namespace
+	if _, _, found := cache.Get(ctx, []float64{0, 0, 1}, 0.99); found {
+		t.Error("expected no hit outside the entry's namespace")
+	}
+	if _, _, found := cache.Get(WithNamespace(ctx, "other"), []float64{0, 0, 1}, 0.99); !found {
+		t.Error("expected a hit in the entry's namespace")
+	}
+
+	if n := cache.Cleanup(ctx); n != 1 {
+		t.Errorf("expected 1 expired entry removed, got %d", n)
+	}
+	if n, err := cache.DeleteOlderThan(ctx, time.Now().Add(-time.Hour)); err != nil || n != 1 {
+		t.Errorf("expected 1 old entry deleted, got %d (%v)", n, err)
+	}
+	if err := cache.ClearNamespace(ctx, "other"); err != nil {
+		t.Fatalf("ClearNamespace failed: %v", err)
+	}
+	if size := cache.Size(ctx); size != 0 {
+		t.Errorf("expected no entries left, got %d", size)
+	}
+}
+
+func TestPgVectorCacheSearch(t *testing.T) {
+	cache := newTestPgVectorCache(t, 100)
+	ctx := context.Background()
+
+	for i, embedding := range [][]float64{{1, 0, 0}, {1, 0.3, 0}, {0, 1, 0}} {
+		entry := newTestEntry(embedding, time.Hour)
+		entry.Request.Messages[0].Content = string(rune('a' + i))
+		if err := cache.Set(ctx, entry); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	results := cache.Search(ctx, []float64{1, 0, 0}, 0.9, 5)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results above threshold, got %d", len(results))
+	}
+	if results[0].Similarity < results[1].Similarity || results[0].Entry.Request.Messages[0].Content != "a" {
+		t.Errorf("expected the closest entry first, got %+v", results)
+	}
+
+	batch := cache.GetBatch(ctx, [][]float64{{0, 1, 0}, {0, 0, 1}}, 0.99)
+	if batch[0] == nil || batch[0].Entry.Request.Messages[0].Content != "c" || batch[1] != nil {
+		t.Errorf("expected a hit then a miss, got %+v", batch)
+	}
+
+	if err := cache.DeleteByEmbedding(ctx, []float64{0, 1, 0}); err != nil {
+		t.Fatalf("DeleteByEmbedding failed: %v", err)
+	}
+	if size := cache.Size(ctx); size != 2 {
+		t.Errorf("expected 2 entries after DeleteByEmbedding, got %d", size)
+	}
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// ModelPrice is the per-1K-token price of a model in USD.
+type ModelPrice struct {
+	InputPer1K  float64 `json:"input_per_1k"`
+	OutputPer1K float64 `json:"output_per_1k"`
+}
+
+// Cost returns the USD cost of the given token usage.
+func (p ModelPrice) Cost(usage api.Usage) float64 {
+	return float64(usage.PromptTokens)/1000*p.InputPer1K +
+		float64(usage.CompletionTokens)/1000*p.OutputPer1K
+}
+
+// Pricing maps model names to prices. Lookups fall back to DefaultPricing,
+// so a Pricing only needs the models whose rates differ.
+type Pricing map[string]ModelPrice
+
+// LoadPricing reads a pricing file; see Pricing.Load.
+func LoadPricing(path string) (Pricing, error) {
+	p := Pricing{}
+	if err := p.Load(path); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Load merges prices from a JSON file into p, replacing existing models.
+// The file maps model names to prices:
+//
+//	{"gpt-4o": {"input_per_1k": 0.0025, "output_per_1k": 0.01}}
+func (p *Pricing) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read pricing file: %w", err)
+	}
+
+	var prices map[string]ModelPrice
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return fmt.Errorf("failed to parse pricing file: %w", err)
+	}
+
+	if *p == nil {
+		*p = Pricing{}
+	}
+	for model, price := range prices {
+		(*p)[model] = price
+	}
+	return nil
+}
+
+// Price resolves the price of a model: p first, then DefaultPricing, each
+// by exact name and then by longest prefix. It reports false for unknown
+// models.
+func (p Pricing) Price(model string) (ModelPrice, bool) {
+	for _, table := range []Pricing{p, DefaultPricing} {
+		if price, ok := table[model]; ok {
+			return price, true
+		}
+	}
+
+	var best string
+	var bestPrice ModelPrice
+	for _, table := range []Pricing{p, DefaultPricing} {
+		for name, price := range table {
+			if len(name) > len(best) && strings.HasPrefix(model, name) {
+				best, bestPrice = name, price
+			}
+		}
+	}
+	return bestPrice, best != ""
+}
+
+// DefaultPricing holds list prices for common models.
+// Dated variants (e.g. "gpt-4o-2024-08-06") match by longest prefix.
+var DefaultPricing = Pricing{
+	"gpt-4o":        {InputPer1K: 0.0025, OutputPer1K: 0.01},
+	"gpt-4o-mini":   {InputPer1K: 0.00015, OutputPer1K: 0.0006},
+	"gpt-4-turbo":   {InputPer1K: 0.01, OutputPer1K: 0.03},
+	"gpt-4":         {InputPer1K: 0.03, OutputPer1K: 0.06},
+	"gpt-3.5-turbo": {InputPer1K: 0.0005, OutputPer1K: 0.0015},
+	"o1":            {InputPer1K: 0.015, OutputPer1K: 0.06},
+	"o1-mini":       {InputPer1K: 0.003, OutputPer1K: 0.012},
+
+	"claude-3-5-sonnet": {InputPer1K: 0.003, OutputPer1K: 0.015},
+	"claude-3-5-haiku":  {InputPer1K: 0.0008, OutputPer1K: 0.004},
+	"claude-3-opus":     {InputPer1K: 0.015, OutputPer1K: 0.075},
+	"claude-3-sonnet":   {InputPer1K: 0.003, OutputPer1K: 0.015},
+	"claude-3-haiku":    {InputPer1K: 0.00025, OutputPer1K: 0.00125},
+}
+
+// fallbackPrice is used for unknown models when Options.DefaultPrice is unset.
+var fallbackPrice = ModelPrice{InputPer1K: 0.002, OutputPer1K: 0.002}
+
+// priceFor resolves the price of a model: Options.Pricing first, then
+// DefaultPricing (exact, then longest prefix), then the default price.
+func (o *Options) priceFor(model string) ModelPrice {
+	if p, ok := o.Pricing.Price(model); ok {
+		return p
+	}
+	if o.DefaultPrice != (ModelPrice{}) {
+		return o.DefaultPrice
+	}
+	return fallbackPrice
+}
+
+// Cost returns the USD cost of usage on model at the price priceFor
+// resolves.
+func (o *Options) Cost(model string, usage api.Usage) float64 {
+	return o.priceFor(model).Cost(usage)
+}
+
+// hitSavings estimates the USD saved by serving entry from cache.
+func (o *Options) hitSavings(entry *api.CacheEntry) float64 {
+	model := entry.Response.Model
+	if model == "" {
+		model = entry.Request.Model
+	}
+	return o.Cost(model, entry.Response.Usage)
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+func TestModelPriceCost(t *testing.T) {
+	price := ModelPrice{InputPer1K: 0.01, OutputPer1K: 0.03}
+	cost := price.Cost(api.Usage{PromptTokens: 1000, CompletionTokens: 500})
+	if math.Abs(cost-0.025) > 1e-9 {
+		t.Errorf("expected cost=0.025, got %f", cost)
+	}
+}
+
+func TestPriceFor(t *testing.T) {
+	opts := &Options{
+		Pricing: map[string]ModelPrice{
+			"gpt-4":       {InputPer1K: 0.02, OutputPer1K: 0.04}, // negotiated rate
+			"my-finetune": {InputPer1K: 0.1, OutputPer1K: 0.1},
+		},
+		DefaultPrice: ModelPrice{InputPer1K: 0.5, OutputPer1K: 0.5},
+	}
+
+	tests := []struct {
+		model    string
+		expected ModelPrice
+	}{
+		{"gpt-4", opts.Pricing["gpt-4"]},
+		{"my-finetune", opts.Pricing["my-finetune"]},
+		{"gpt-4o", DefaultPricing["gpt-4o"]},
+		{"gpt-4o-2024-08-06", DefaultPricing["gpt-4o"]},
+		{"gpt-4o-mini-2024-07-18", DefaultPricing["gpt-4o-mini"]},
+		{"unknown-model", opts.DefaultPrice},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := opts.priceFor(tt.model); got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("fallback when default unset", func(t *testing.T) {
+		if got := (&Options{}).priceFor("unknown-model"); got != fallbackPrice {
+			t.Errorf("expected fallback price, got %+v", got)
+		}
+	})
+}
+
+func TestPricingLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.json")
+	data := `{"gpt-4o": {"input_per_1k": 0.001, "output_per_1k": 0.002}, "my-finetune": {"input_per_1k": 0.1, "output_per_1k": 0.2}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pricing, err := LoadPricing(path)
+	if err != nil {
+		t.Fatalf("LoadPricing failed: %v", err)
+	}
+
+	usage := api.Usage{PromptTokens: 1000, CompletionTokens: 1000}
+	opts := &Options{Pricing: pricing}
+	tests := []struct {
+		model    string
+		expected float64
+	}{
+		{"gpt-4o", 0.003},                     // file overrides built-in
+		{"gpt-4o-2024-08-06", 0.003},          // by prefix
+		{"my-finetune", 0.3},                  // file-only model
+		{"claude-3-5-sonnet-20241022", 0.018}, // built-in
+		{"unknown-model", 0.004},              // fallback
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := opts.Cost(tt.model, usage); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("expected cost=%f, got %f", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("default price", func(t *testing.T) {
+		opts := &Options{Pricing: pricing, DefaultPrice: ModelPrice{InputPer1K: 1, OutputPer1K: 1}}
+		if got := opts.Cost("unknown-model", usage); math.Abs(got-2) > 1e-9 {
+			t.Errorf("expected DefaultPrice cost=2, got %f", got)
+		}
+		if got := opts.Cost("my-finetune", usage); math.Abs(got-0.3) > 1e-9 {
+			t.Errorf("expected file price cost=0.3, got %f", got)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := LoadPricing(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+			t.Error("expected error for missing file")
+		}
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		bad := filepath.Join(t.TempDir(), "bad.json")
+		os.WriteFile(bad, []byte("not json"), 0o644)
+		if _, err := LoadPricing(bad); err == nil {
+			t.Error("expected error for invalid file")
+		}
+	})
+}
+
+func TestMemoryCacheEstimatedSaved(t *testing.T) {
+	cache := NewMemoryCache(&Options{
+		MaxSize:         100,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		Pricing: map[string]ModelPrice{
+			"test-model": {InputPer1K: 0.01, OutputPer1K: 0.02},
+		},
+	})
+	ctx := context.Background()
+
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	entry.Response.Usage = api.Usage{PromptTokens: 1000, CompletionTokens: 1000, TotalTokens: 2000}
+	cache.Set(ctx, entry)
+
+	cache.Get(ctx, []float64{1, 0, 0}, 0.9) // hit
+	cache.Get(ctx, []float64{1, 0, 0}, 0.9) // hit
+	cache.Get(ctx, []float64{0, 1, 0}, 0.9) // miss
+
+	stats := cache.Stats(ctx)
+	if math.Abs(stats.EstimatedSaved-0.06) > 1e-9 {
+		t.Errorf("expected EstimatedSaved=0.06, got %f", stats.EstimatedSaved)
+	}
+}
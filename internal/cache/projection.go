@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// ProjectionMethod selects how a Projection maps embeddings to its
+// target dimension.
+type ProjectionMethod int
+
+const (
+	// ProjectionRandom multiplies embeddings by a random ±1 matrix drawn
+	// from the seed, which approximately preserves the similarities
+	// between embeddings of the same model.
+	ProjectionRandom ProjectionMethod = iota
+	// ProjectionTruncate keeps the first components, zero-padding shorter
+	// embeddings. It suits models trained to front-load information
+	// (Matryoshka embeddings), where a prefix is a usable embedding.
+	ProjectionTruncate
+)
+
+// String returns the method name.
+func (p ProjectionMethod) String() string {
+	switch p {
+	case ProjectionRandom:
+		return "random"
+	case ProjectionTruncate:
+		return "truncate"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseProjectionMethod returns the method with the given name. The empty
+// string is ProjectionRandom.
+func ParseProjectionMethod(name string) (ProjectionMethod, error) {
+	switch name {
+	case "", "random":
+		return ProjectionRandom, nil
+	case "truncate":
+		return ProjectionTruncate, nil
+	default:
+		return 0, fmt.Errorf("unknown projection method %q", name)
+	}
+}
+
+// Projection maps embeddings of any dimension to a common one, so a cache
+// holding entries from embedding models of different dimensions can
+// still match them approximately while migrating between the models.
+// Embeddings already of the target dimension are left as they are, so
+// targeting the new model's dimension keeps its entries exact.
+//
+// Different models embed into different spaces, and no projection aligns
+// them: matches across models are rough, which is the price of keeping
+// the old entries useful until they age out. It is a bridge, not a mode
+// to run in permanently.
+type Projection struct {
+	method ProjectionMethod
+	dims   int
+	seed   int64
+
+	mu   sync.Mutex
+	sign map[int][]uint64 // random matrix bits by input dimension
+}
+
+// NewProjection returns a projection to dims dimensions. Random
+// projections drawn from the same seed are identical, so the seed must be
+// kept to reproduce them, e.g. when reloading projected entries; each
+// projected entry records it (see api.CacheEntry.Projection).
+func NewProjection(method ProjectionMethod, dims int, seed int64) *Projection {
+	return &Projection{method: method, dims: dims, seed: seed, sign: make(map[int][]uint64)}
+}
+
+// Dims returns the target dimension.
+func (p *Projection) Dims() int {
+	return p.dims
+}
+
+// String describes the projection as method:dims:seed, e.g.
+// "random:384:42"; projections with the same description are identical.
+func (p *Projection) String() string {
+	if p.method == ProjectionTruncate {
+		return fmt.Sprintf("%s:%d", p.method, p.dims)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.method, p.dims, p.seed)
+}
+
+// Project returns vec mapped to the target dimension, or vec itself if it
+// already has it.
+func (p *Projection) Project(vec []float64) []float64 {
+	if len(vec) == p.dims || len(vec) == 0 {
+		return vec
+	}
+	out := make([]float64, p.dims)
+	if p.method == ProjectionTruncate {
+		copy(out, vec)
+		return out
+	}
+
+	// Scaled so norms are preserved in expectation
+	bits := p.matrix(len(vec))
+	scale := 1 / math.Sqrt(float64(p.dims))
+	for i := range out {
+		var sum float64
+		for j, x := range vec {
+			if k := i*len(vec) + j; bits[k/64]&(1<<(k%64)) != 0 {
+				sum += x
+			} else {
+				sum -= x
+			}
+		}
+		out[i] = sum * scale
+	}
+	return out
+}
+
+// matrix returns the signs of the random matrix projecting from n
+// dimensions, one bit per entry in row-major order, drawing it from the
+// seed on first use.
+func (p *Projection) matrix(n int) []uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if bits, ok := p.sign[n]; ok {
+		return bits
+	}
+	// Seeded per input dimension, so each matrix is reproducible on its own
+	rng := rand.New(rand.NewSource(p.seed ^ int64(n)))
+	bits := make([]uint64, (n*p.dims+63)/64)
+	for i := range bits {
+		bits[i] = rng.Uint64()
+	}
+	p.sign[n] = bits
+	return bits
+}
+
+// applyProjection projects an entry's embedding to Options.Projection's
+// dimension, recording the projection on the entry. An entry projected
+// before by another projection cannot be mapped back, and is rejected
+// with ErrDimensionMismatch.
+func (o *Options) applyProjection(entry *api.CacheEntry) error {
+	p := o.Projection
+	if p == nil {
+		return nil
+	}
+	if entry.Projection != "" && entry.Projection != p.String() {
+		return fmt.Errorf("%w: entry projected with %s, cache uses %s", ErrDimensionMismatch, entry.Projection, p)
+	}
+	if len(entry.Embedding) != p.dims {
+		entry.Embedding = p.Project(entry.Embedding)
+		entry.Projection = p.String()
+	}
+	return nil
+}
+
+// project maps a lookup's embedding to Options.Projection's dimension.
+func (o *Options) project(embedding []float64) []float64 {
+	if o.Projection == nil {
+		return embedding
+	}
+	return o.Projection.Project(embedding)
+}
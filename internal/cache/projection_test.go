@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProjection(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	t.Run("target dimension unchanged", func(t *testing.T) {
+		vec := []float64{1, 2, 3}
+		if got := NewProjection(ProjectionRandom, 3, 1).Project(vec); !reflect.DeepEqual(got, vec) {
+			t.Errorf("expected %v unchanged, got %v", vec, got)
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		p := NewProjection(ProjectionTruncate, 3, 0)
+		tests := []struct {
+			vec, want []float64
+		}{
+			{[]float64{1, 2, 3, 4, 5}, []float64{1, 2, 3}},
+			{[]float64{1, 2}, []float64{1, 2, 0}},
+		}
+		for _, tt := range tests {
+			if got := p.Project(tt.vec); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Project(%v) = %v, want %v", tt.vec, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("random is reproducible from the seed", func(t *testing.T) {
+		vec := randomVectors(rng, 1, 256)[0]
+		a := NewProjection(ProjectionRandom, 64, 42).Project(vec)
+		b := NewProjection(ProjectionRandom, 64, 42).Project(vec)
+		c := NewProjection(ProjectionRandom, 64, 43).Project(vec)
+		if !reflect.DeepEqual(a, b) {
+			t.Error("expected projections with the same seed to agree")
+		}
+		if reflect.DeepEqual(a, c) {
+			t.Error("expected projections with other seeds to differ")
+		}
+	})
+
+	t.Run("random preserves similarity", func(t *testing.T) {
+		p := NewProjection(ProjectionRandom, 256, 7)
+		var worst float64
+		for _, v := range randomVectors(rng, 20, 768) {
+			near := make([]float64, len(v))
+			for i := range v {
+				near[i] = v[i] + 0.5*rng.NormFloat64()
+			}
+			before := CosineSimilarity(v, near)
+			after := CosineSimilarity(p.Project(v), p.Project(near))
+			worst = math.Max(worst, math.Abs(before-after))
+		}
+		if worst > 0.1 {
+			t.Errorf("expected projected similarities within 0.1 of the originals, worst off by %.3f", worst)
+		}
+	})
+
+	t.Run("describes itself", func(t *testing.T) {
+		if got := NewProjection(ProjectionRandom, 384, 42).String(); got != "random:384:42" {
+			t.Errorf("expected random:384:42, got %q", got)
+		}
+		if got := NewProjection(ProjectionTruncate, 384, 42).String(); got != "truncate:384" {
+			t.Errorf("expected truncate:384, got %q", got)
+		}
+	})
+}
+
+func TestMemoryCacheProjection(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(&Options{
+		MaxSize:         100,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		Metric:          MetricCosine,
+		EmbeddingModel:  "new-model",
+		Projection:      NewProjection(ProjectionTruncate, 4, 0),
+	})
+	defer c.Close()
+
+	// An entry from the old, wider model is projected on the way in
+	old := newTestEntry([]float64{1, 0, 0, 0, 0.2, 0.3, 0, 0}, time.Hour)
+	old.EmbeddingModel = "old-model"
+	if err := c.Set(ctx, old); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	entry, _, found := c.Get(WithEmbeddingModel(ctx, "new-model"), []float64{1, 0.05, 0, 0}, 0.9)
+	if !found {
+		t.Fatal("expected the new model's query to match the projected entry")
+	}
+	if entry.Projection != "truncate:4" || len(entry.Embedding) != 4 {
+		t.Errorf("expected a 4-dimensional entry recording truncate:4, got %d dimensions, %q", len(entry.Embedding), entry.Projection)
+	}
+
+	// Queries of the old model are projected too
+	if _, _, found := c.Get(WithEmbeddingModel(ctx, "old-model"), []float64{1, 0, 0, 0, 0.1, 0.1, 0, 0}, 0.9); !found {
+		t.Error("expected the old model's query to be projected and match")
+	}
+
+	// Vectors projected otherwise can't be mapped back
+	other := newTestEntry([]float64{0, 1, 0, 0}, time.Hour)
+	other.Projection = "random:4:1"
+	if err := c.Set(ctx, other); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("expected ErrDimensionMismatch for another projection, got %v", err)
+	}
+}
+
+func TestMemoryCacheProjectionGetBatch(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(&Options{
+		MaxSize:         100,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		Metric:          MetricCosine,
+		NormalizeOnSet:  true,
+		Projection:      NewProjection(ProjectionTruncate, 4, 0),
+	})
+	defer c.Close()
+
+	if err := c.Set(ctx, newTestEntry([]float64{1, 0, 0, 0, 0.2, 0.3, 0, 0}, time.Hour)); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	queries := [][]float64{
+		{1, 0.05, 0, 0, 0.4, 0, 0, 0},
+		{0, 1, 0, 0, 0, 0, 0, 0},
+	}
+	results := c.GetBatch(ctx, queries, 0.9)
+	for i, query := range queries {
+		entry, similarity, found := c.Get(ctx, query, 0.9)
+		if got := results[i]; (got != nil) != found {
+			t.Fatalf("query %d: GetBatch found %v, Get found %v", i, got != nil, found)
+		} else if found && (got.Entry.ID != entry.ID || math.Abs(got.Similarity-similarity) > 1e-6) {
+			t.Errorf("query %d: GetBatch returned %s (%f), Get returned %s (%f)", i, got.Entry.ID, got.Similarity, entry.ID, similarity)
+		}
+	}
+	if results[0] == nil {
+		t.Error("expected the projected query to hit")
+	}
+}
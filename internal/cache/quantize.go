@@ -0,0 +1,123 @@
+package cache
+
+import "math"
+
+// Quantization selects how MemoryCache stores embeddings.
+type Quantization int
+
+const (
+	// QuantizationNone stores embeddings as float32.
+	QuantizationNone Quantization = iota
+	// QuantizationInt8 stores embeddings as int8 with a per-vector scale,
+	// a quarter of the float32 size. Similarities are computed against
+	// the full-precision query and typically differ by well under 0.01.
+	QuantizationInt8
+)
+
+// String returns the quantization name.
+func (q Quantization) String() string {
+	switch q {
+	case QuantizationNone:
+		return "none"
+	case QuantizationInt8:
+		return "int8"
+	default:
+		return "unknown"
+	}
+}
+
+// int8Vector is an embedding quantized symmetrically to int8:
+// v[i] ≈ float32(q[i]) * scale.
+type int8Vector struct {
+	q     []int8
+	scale float32
+	norm  float32 // Euclidean norm of q, for cosine similarity
+}
+
+// quantizeInt8 maps the largest absolute component of v to ±127.
+func quantizeInt8(v []float32) int8Vector {
+	var maxAbs float32
+	for _, x := range v {
+		if x < 0 {
+			x = -x
+		}
+		if x > maxAbs {
+			maxAbs = x
+		}
+	}
+
+	out := int8Vector{q: make([]int8, len(v))}
+	if maxAbs == 0 {
+		return out
+	}
+	out.scale = maxAbs / 127
+
+	var norm float32
+	for i, x := range v {
+		q := int8(math.Round(float64(x / out.scale)))
+		out.q[i] = q
+		norm += float32(q) * float32(q)
+	}
+	out.norm = float32(math.Sqrt(float64(norm)))
+	return out
+}
+
+// dequantize returns the float32 approximation of the vector.
+func (v int8Vector) dequantize() []float32 {
+	out := make([]float32, len(v.q))
+	for i, q := range v.q {
+		out[i] = float32(q) * v.scale
+	}
+	return out
+}
+
+// similarityInt8 is Similarity32 between a float32 query and a quantized
+// vector, dequantizing on the fly.
+func (m Metric) similarityInt8(a []float32, b int8Vector) float64 {
+	if len(a) != len(b.q) || len(a) == 0 {
+		// Whatever the metric reports for mismatched lengths
+		return m.Similarity32(a, nil)
+	}
+	q := b.q[:len(a)]
+
+	switch m {
+	case MetricEuclidean, MetricEuclideanDistance:
+		var sum float32
+		for i, x := range a {
+			diff := x - float32(q[i])*b.scale
+			sum += diff * diff
+		}
+		d := math.Sqrt(float64(sum))
+		if m == MetricEuclideanDistance {
+			return -d
+		}
+		return 1 / (1 + d)
+	case MetricManhattanDistance:
+		var sum float32
+		for i, x := range a {
+			if diff := x - float32(q[i])*b.scale; diff < 0 {
+				sum -= diff
+			} else {
+				sum += diff
+			}
+		}
+		return -float64(sum)
+	case MetricDotProduct:
+		var dot float32
+		for i, x := range a {
+			dot += x * float32(q[i])
+		}
+		return float64(dot * b.scale)
+	default:
+		// The scale cancels out of cosine similarity
+		var dot, normA float32
+		for i, x := range a {
+			dot += x * float32(q[i])
+			normA += x * x
+		}
+		if normA == 0 || b.norm == 0 {
+			return 0
+		}
+		return float64(dot) / (math.Sqrt(float64(normA)) * float64(b.norm))
+	}
+}
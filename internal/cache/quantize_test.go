@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestQuantizeInt8(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	t.Run("round trip", func(t *testing.T) {
+		for _, v := range randomVectors(rng, 50, 384) {
+			orig := toFloat32(v)
+			if sim := CosineSimilarity32(orig, quantizeInt8(orig).dequantize()); sim < 0.999 {
+				t.Fatalf("expected dequantized vector to keep cosine >= 0.999, got %f", sim)
+			}
+		}
+	})
+
+	t.Run("zero vector", func(t *testing.T) {
+		q := quantizeInt8(make([]float32, 4))
+		if got := MetricCosine.similarityInt8([]float32{1, 0, 0, 0}, q); got != 0 {
+			t.Errorf("expected 0 similarity to zero vector, got %f", got)
+		}
+	})
+
+	t.Run("length mismatch", func(t *testing.T) {
+		q := quantizeInt8([]float32{1, 2})
+		if got := MetricCosine.similarityInt8([]float32{1, 2, 3}, q); got != 0 {
+			t.Errorf("expected 0, got %f", got)
+		}
+		if got := MetricEuclideanDistance.similarityInt8([]float32{1, 2, 3}, q); !math.IsInf(got, -1) {
+			t.Errorf("expected -Inf, got %f", got)
+		}
+	})
+}
+
+func TestSimilarityInt8MatchesDequantized(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	vecs := randomVectors(rng, 20, 64)
+
+	for _, metric := range []Metric{MetricCosine, MetricDotProduct, MetricEuclidean, MetricEuclideanDistance, MetricManhattanDistance} {
+		t.Run(metric.String(), func(t *testing.T) {
+			for i := 1; i < len(vecs); i++ {
+				query := toFloat32(vecs[0])
+				q := quantizeInt8(toFloat32(vecs[i]))
+
+				want := metric.Similarity32(query, q.dequantize())
+				if got := metric.similarityInt8(query, q); math.Abs(got-want) > 1e-4*math.Max(1, math.Abs(want)) {
+					t.Fatalf("expected %f, got %f", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryCacheInt8Recall(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(3))
+	vecs := randomVectors(rng, 1000, 128)
+
+	newCache := func(q Quantization) *MemoryCache {
+		c := NewMemoryCache(&Options{
+			MaxSize:         len(vecs),
+			DefaultTTL:      time.Hour,
+			CleanupInterval: time.Hour,
+			Quantization:    q,
+		})
+		for i, v := range vecs {
+			e := newTestEntry(v, time.Hour)
+			e.Response.ID = fmt.Sprint(i)
+			c.Set(ctx, e)
+		}
+		return c
+	}
+	exact := newCache(QuantizationNone)
+	defer exact.Close()
+	quantized := newCache(QuantizationInt8)
+	defer quantized.Close()
+
+	// Paraphrase-like queries: small perturbations of stored vectors
+	const queries = 200
+	agree := 0
+	for i := 0; i < queries; i++ {
+		query := make([]float64, 128)
+		for j, x := range vecs[rng.Intn(len(vecs))] {
+			query[j] = x + rng.NormFloat64()*0.3
+		}
+
+		want, wantSim, found := exact.Get(ctx, query, 0.9)
+		got, gotSim, qfound := quantized.Get(ctx, query, 0.9)
+		if found != qfound {
+			// Only acceptable right at the threshold
+			if math.Abs(wantSim-0.9) > 0.01 && math.Abs(gotSim-0.9) > 0.01 {
+				t.Errorf("query %d: exact found=%v, quantized found=%v", i, found, qfound)
+			}
+			continue
+		}
+		if !found || want.Response.ID == got.Response.ID {
+			agree++
+		}
+		if found && math.Abs(wantSim-gotSim) > 0.01 {
+			t.Errorf("query %d: similarity drifted from %f to %f", i, wantSim, gotSim)
+		}
+	}
+
+	if recall := float64(agree) / queries; recall < 0.99 {
+		t.Errorf("expected quantized results to match exact ones for >= 99%% of queries, got %.2f", recall)
+	}
+}
+
+func BenchmarkMemoryCacheGetQuantization(b *testing.B) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(1))
+	vecs := randomVectors(rng, 10000, 768)
+	query := vecs[0]
+
+	for _, q := range []Quantization{QuantizationNone, QuantizationInt8} {
+		b.Run(q.String(), func(b *testing.B) {
+			cache := NewMemoryCache(&Options{
+				MaxSize:         len(vecs),
+				DefaultTTL:      time.Hour,
+				CleanupInterval: time.Hour,
+				Quantization:    q,
+			})
+			defer cache.Close()
+			for _, v := range vecs {
+				cache.Set(ctx, newTestEntry(v, time.Hour))
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cache.Get(ctx, query, 0.95)
+			}
+
+			bytesPerDim := 4.0
+			if q == QuantizationInt8 {
+				bytesPerDim = 1
+			}
+			b.ReportMetric(bytesPerDim*float64(len(vecs)*len(query))/(1<<20), "vector-MiB")
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package cache
+
+import "time"
+
+// ModelQuota caps the share of MemoryCache's MaxSize held by one request
+// model, so a chatty model cannot starve the others. Quotas only steer
+// eviction: a model may exceed its share while the cache has room, and
+// once the cache is full entries of models over their share are evicted
+// first.
+type ModelQuota struct {
+	// MaxEntries is the model's share in entries.
+	MaxEntries int
+	// Fraction is the model's share as a fraction of MaxSize, used when
+	// MaxEntries is zero.
+	Fraction float64
+}
+
+// limit returns the quota in entries for a cache holding up to maxSize.
+func (q ModelQuota) limit(maxSize int) int {
+	if q.MaxEntries > 0 {
+		return q.MaxEntries
+	}
+	return int(q.Fraction * float64(maxSize))
+}
+
+// quotaGroup returns the key an entry for model counts against: the model
+// itself if it has a quota, or "" for the unlisted models sharing the
+// remainder.
+func (o *Options) quotaGroup(model string) string {
+	if _, ok := o.ModelQuotas[model]; ok {
+		return model
+	}
+	return ""
+}
+
+// quotaVictim returns the entry to evict to make room for an entry for
+// model when some quota group would hold more than its share, or nil to
+// leave the choice to the eviction policy alone. Caller must hold the
+// write lock.
+func (m *MemoryCache) quotaVictim(now time.Time, model string) *memoryEntry {
+	if len(m.opts.ModelQuotas) == 0 {
+		return nil
+	}
+
+	counts := make(map[string]int, len(m.opts.ModelQuotas)+1)
+	for model, n := range m.models {
+		counts[m.opts.quotaGroup(model)] += n
+	}
+	counts[m.opts.quotaGroup(model)]++
+
+	over := make(map[string]bool)
+	remainder := m.opts.MaxSize
+	for model, q := range m.opts.ModelQuotas {
+		limit := q.limit(m.opts.MaxSize)
+		remainder -= limit
+		if counts[model] > limit {
+			over[model] = true
+		}
+	}
+	if counts[""] > max(remainder, 0) {
+		over[""] = true
+	}
+	if len(over) == 0 {
+		return nil
+	}
+	return m.evictor.victimAmong(now, func(me *memoryEntry) bool {
+		return over[m.opts.quotaGroup(me.entry.Request.Model)]
+	})
+}
@@ -0,0 +1,323 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// Ensure RoutingCache implements Cache.
+var _ Cache = (*RoutingCache)(nil)
+
+// RoutingOptions configures a RoutingCache.
+type RoutingOptions struct {
+	// Backends are the caches to route to, by name.
+	Backends map[string]Cache
+	// Route returns the name of the backend for a request model. Models it
+	// returns an empty or unknown name for go to Default. If nil, every
+	// model goes to Default.
+	Route func(model string) string
+	// Default names the backend for models Route doesn't place. Required.
+	Default string
+}
+
+// RoutingCache federates several caches, keeping each request model's
+// entries in the backend chosen for it, e.g. one model's completions in a
+// shared persistent cache and a sensitive model's only in memory. It adds
+// no storage of its own.
+//
+// Writes route by the entry's request model and exact lookups by the
+// request's. Semantic lookups carry no request, so they route by the model
+// set on the context with WithModel, as the proxy does; without one they
+// go to Default. Operations by ID, which doesn't reveal the model, and
+// those spanning every model go to all backends.
+//
+// Stats sums the backends' statistics, so a backend shared with other
+// users is counted as a whole.
+type RoutingCache struct {
+	backends map[string]Cache
+	all      []Cache // distinct backends, by name
+	route    func(model string) string
+	fallback Cache
+}
+
+// NewRoutingCache creates a cache routing between opts.Backends.
+func NewRoutingCache(opts *RoutingOptions) (*RoutingCache, error) {
+	fallback, ok := opts.Backends[opts.Default]
+	if !ok {
+		return nil, fmt.Errorf("default backend %q is not among the backends", opts.Default)
+	}
+
+	names := make([]string, 0, len(opts.Backends))
+	for name := range opts.Backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// A backend registered under several names is operated on once
+	seen := make(map[Cache]bool)
+	var all []Cache
+	for _, name := range names {
+		if c := opts.Backends[name]; !seen[c] {
+			seen[c] = true
+			all = append(all, c)
+		}
+	}
+
+	return &RoutingCache{
+		backends: opts.Backends,
+		all:      all,
+		route:    opts.Route,
+		fallback: fallback,
+	}, nil
+}
+
+// backendFor returns the backend for a request model.
+func (rc *RoutingCache) backendFor(model string) Cache {
+	if rc.route != nil {
+		if c, ok := rc.backends[rc.route(model)]; ok {
+			return c
+		}
+	}
+	return rc.fallback
+}
+
+// backendForContext returns the backend for the model set on the context
+// with WithModel.
+func (rc *RoutingCache) backendForContext(ctx context.Context) Cache {
+	model, _ := ctx.Value(modelContextKey{}).(string)
+	return rc.backendFor(model)
+}
+
+// Get looks up the backend for the context's model.
+func (rc *RoutingCache) Get(ctx context.Context, embedding []float64, threshold float64) (*api.CacheEntry, float64, bool) {
+	return rc.backendForContext(ctx).Get(ctx, embedding, threshold)
+}
+
+// GetBatch looks up the backend for the context's model.
+func (rc *RoutingCache) GetBatch(ctx context.Context, embeddings [][]float64, threshold float64) []*SearchResult {
+	return rc.backendForContext(ctx).GetBatch(ctx, embeddings, threshold)
+}
+
+// GetExact looks up the backend for the request's model.
+func (rc *RoutingCache) GetExact(ctx context.Context, req *api.ChatCompletionRequest) (*api.CacheEntry, bool) {
+	return rc.backendFor(req.Model).GetExact(ctx, req)
+}
+
+// Search searches the backend for the context's model.
+func (rc *RoutingCache) Search(ctx context.Context, embedding []float64, threshold float64, k int) []SearchResult {
+	return rc.backendForContext(ctx).Search(ctx, embedding, threshold, k)
+}
+
+// GetByID retrieves the entry from whichever backend holds it.
+func (rc *RoutingCache) GetByID(ctx context.Context, id string) (*api.CacheEntry, bool) {
+	for _, c := range rc.all {
+		if entry, ok := c.GetByID(ctx, id); ok {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// Set stores the entry in the backend for its request model.
+func (rc *RoutingCache) Set(ctx context.Context, entry *api.CacheEntry) error {
+	return rc.backendFor(entry.Request.Model).Set(ctx, entry)
+}
+
+// Delete removes the entry from whichever backend holds it.
+func (rc *RoutingCache) Delete(ctx context.Context, id string) error {
+	var err error
+	for _, c := range rc.all {
+		if cerr := c.Delete(ctx, id); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Pin pins the entry in whichever backend holds it.
+func (rc *RoutingCache) Pin(ctx context.Context, id string) error {
+	return rc.byID(func(c Cache) error { return c.Pin(ctx, id) })
+}
+
+// Unpin unpins the entry in whichever backend holds it.
+func (rc *RoutingCache) Unpin(ctx context.Context, id string) error {
+	return rc.byID(func(c Cache) error { return c.Unpin(ctx, id) })
+}
+
+// byID applies op to each backend until one doesn't return ErrNotFound.
+func (rc *RoutingCache) byID(op func(Cache) error) error {
+	for _, c := range rc.all {
+		if err := op(c); !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return ErrNotFound
+}
+
+// DeleteByEmbedding removes the entry nearly identical to the embedding
+// from the backend for the context's model.
+func (rc *RoutingCache) DeleteByEmbedding(ctx context.Context, embedding []float64) error {
+	return rc.backendForContext(ctx).DeleteByEmbedding(ctx, embedding)
+}
+
+// Clear removes all entries from every backend.
+func (rc *RoutingCache) Clear(ctx context.Context) error {
+	return rc.each(func(c Cache) error { return c.Clear(ctx) })
+}
+
+// ClearNamespace removes a namespace's entries from every backend.
+func (rc *RoutingCache) ClearNamespace(ctx context.Context, namespace string) error {
+	return rc.each(func(c Cache) error { return c.ClearNamespace(ctx, namespace) })
+}
+
+// each applies op to every backend, returning the first error.
+func (rc *RoutingCache) each(op func(Cache) error) error {
+	var err error
+	for _, c := range rc.all {
+		if cerr := op(c); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// DeleteByModel removes the model's entries from its backend.
+func (rc *RoutingCache) DeleteByModel(ctx context.Context, model string) (int, error) {
+	return rc.backendFor(model).DeleteByModel(ctx, model)
+}
+
+// DeleteOlderThan removes entries created before t from every backend,
+// returning the total removed.
+func (rc *RoutingCache) DeleteOlderThan(ctx context.Context, t time.Time) (int, error) {
+	total := 0
+	for _, c := range rc.all {
+		n, err := c.DeleteOlderThan(ctx, t)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// LoadFromReader stores each entry in the backend for its request model.
+func (rc *RoutingCache) LoadFromReader(ctx context.Context, r io.Reader) (int, error) {
+	return loadJSONL(ctx, rc, r)
+}
+
+// DumpToWriter writes the entries of every backend in turn.
+func (rc *RoutingCache) DumpToWriter(ctx context.Context, w io.Writer) error {
+	return rc.each(func(c Cache) error { return c.DumpToWriter(ctx, w) })
+}
+
+// Entries pages the entries of all backends together, oldest first.
+func (rc *RoutingCache) Entries(ctx context.Context, offset, limit int) ([]*api.CacheEntry, error) {
+	offset = max(offset, 0)
+
+	// The page can only hold entries within each backend's first
+	// offset+limit
+	backendLimit := 0
+	if limit > 0 {
+		backendLimit = offset + limit
+	}
+	var entries []*api.CacheEntry
+	for _, c := range rc.all {
+		page, err := c.Entries(ctx, 0, backendLimit)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page...)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entryBefore(entries[i], entries[j]) })
+
+	if offset >= len(entries) {
+		return nil, nil
+	}
+	entries = entries[offset:]
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// Stats returns the sum of every backend's statistics.
+func (rc *RoutingCache) Stats(ctx context.Context) *api.CacheStats {
+	stats := make([]*api.CacheStats, len(rc.all))
+	for i, c := range rc.all {
+		stats[i] = c.Stats(ctx)
+	}
+	return sumStats(stats...)
+}
+
+// StatsByModel returns per-model statistics summed across backends.
+func (rc *RoutingCache) StatsByModel(ctx context.Context) map[string]*api.CacheStats {
+	byModel := make(map[string][]*api.CacheStats)
+	for _, c := range rc.all {
+		for model, s := range c.StatsByModel(ctx) {
+			byModel[model] = append(byModel[model], s)
+		}
+	}
+
+	merged := make(map[string]*api.CacheStats, len(byModel))
+	for model, stats := range byModel {
+		merged[model] = sumStats(stats...)
+	}
+	return merged
+}
+
+// sumStats adds up the statistics of disjoint caches. The hit rate is
+// recomputed and the average similarity weighted by each cache's hits.
+func sumStats(stats ...*api.CacheStats) *api.CacheStats {
+	sum := &api.CacheStats{}
+	var similarity float64
+	for _, s := range stats {
+		sum.TotalEntries += s.TotalEntries
+		sum.TotalHits += s.TotalHits
+		sum.ExactHits += s.ExactHits
+		sum.SemanticHits += s.SemanticHits
+		sum.TotalMisses += s.TotalMisses
+		sum.EstimatedSaved += s.EstimatedSaved
+		sum.Evictions += s.Evictions
+		sum.TotalBytes += s.TotalBytes
+		sum.Merged += s.Merged
+		sum.DimensionMismatches += s.DimensionMismatches
+		similarity += s.AvgSimilarity * float64(s.TotalHits)
+	}
+	if total := sum.TotalHits + sum.TotalMisses; total > 0 {
+		sum.HitRate = float64(sum.TotalHits) / float64(total)
+	}
+	if sum.TotalHits > 0 {
+		sum.AvgSimilarity = similarity / float64(sum.TotalHits)
+	}
+	return sum
+}
+
+// Cleanup removes expired entries from every backend, returning the total
+// removed.
+func (rc *RoutingCache) Cleanup(ctx context.Context) int {
+	total := 0
+	for _, c := range rc.all {
+		total += c.Cleanup(ctx)
+	}
+	return total
+}
+
+// Size returns the number of entries across backends.
+func (rc *RoutingCache) Size(ctx context.Context) int {
+	total := 0
+	for _, c := range rc.all {
+		total += c.Size(ctx)
+	}
+	return total
+}
+
+// Close closes every backend.
+func (rc *RoutingCache) Close() error {
+	return rc.each(func(c Cache) error { return c.Close() })
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+func newTestRoutingCache(t *testing.T) (*RoutingCache, *MemoryCache, *MemoryCache) {
+	t.Helper()
+	shared := NewMemoryCache(&Options{MaxSize: 100, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	private := NewMemoryCache(&Options{MaxSize: 100, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	cache, err := NewRoutingCache(&RoutingOptions{
+		Backends: map[string]Cache{"shared": shared, "private": private},
+		Route: func(model string) string {
+			if model == "gpt-4" {
+				return "shared"
+			}
+			return ""
+		},
+		Default: "private",
+	})
+	if err != nil {
+		t.Fatalf("NewRoutingCache failed: %v", err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	return cache, shared, private
+}
+
+func TestRoutingCache(t *testing.T) {
+	ctx := context.Background()
+	cache, shared, private := newTestRoutingCache(t)
+
+	public := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	public.Request.Model = "gpt-4"
+	sensitive := newTestEntry([]float64{0, 1, 0}, time.Hour)
+	sensitive.Request.Model = "internal"
+	for _, e := range []*api.CacheEntry{public, sensitive} {
+		if err := cache.Set(ctx, e); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	// Entries land in their model's backend only
+	if _, ok := shared.GetByID(ctx, public.ID); !ok || shared.Size(ctx) != 1 {
+		t.Errorf("expected only the gpt-4 entry in the shared backend, size %d", shared.Size(ctx))
+	}
+	if _, ok := private.GetByID(ctx, sensitive.ID); !ok || private.Size(ctx) != 1 {
+		t.Errorf("expected only the internal entry in the private backend, size %d", private.Size(ctx))
+	}
+
+	t.Run("lookups route by the context's model", func(t *testing.T) {
+		if _, _, found := cache.Get(WithModel(ctx, "gpt-4"), []float64{1, 0, 0}, 0.99); !found {
+			t.Error("expected a gpt-4 lookup to hit the shared backend")
+		}
+		if _, _, found := cache.Get(WithModel(ctx, "gpt-4"), []float64{0, 1, 0}, 0.99); found {
+			t.Error("expected a gpt-4 lookup not to see the private backend")
+		}
+		if _, _, found := cache.Get(ctx, []float64{0, 1, 0}, 0.99); !found {
+			t.Error("expected a lookup without a model to hit the default backend")
+		}
+		if _, found := cache.GetExact(ctx, &public.Request); !found {
+			t.Error("expected an exact lookup to route by the request's model")
+		}
+	})
+
+	t.Run("operations by ID reach every backend", func(t *testing.T) {
+		for _, e := range []*api.CacheEntry{public, sensitive} {
+			if _, ok := cache.GetByID(ctx, e.ID); !ok {
+				t.Errorf("expected entry %s to be found by ID", e.ID)
+			}
+			if err := cache.Pin(ctx, e.ID); err != nil {
+				t.Errorf("Pin failed: %v", err)
+			}
+		}
+		if err := cache.Pin(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound for an unknown ID, got %v", err)
+		}
+	})
+
+	t.Run("stats aggregate across backends", func(t *testing.T) {
+		stats := cache.Stats(ctx)
+		if stats.TotalEntries != 2 || stats.TotalHits != 3 || stats.ExactHits != 1 || stats.TotalMisses != 1 {
+			t.Errorf("expected 2 entries, 3 hits (1 exact) and 1 miss, got %+v", stats)
+		}
+		if stats.HitRate != 0.75 {
+			t.Errorf("expected hit rate 0.75, got %f", stats.HitRate)
+		}
+		if cache.Size(ctx) != 2 {
+			t.Errorf("expected Size 2, got %d", cache.Size(ctx))
+		}
+
+		entries, err := cache.Entries(ctx, 0, 0)
+		if err != nil {
+			t.Fatalf("Entries failed: %v", err)
+		}
+		if len(entries) != 2 || entries[0].ID != public.ID {
+			t.Errorf("expected both entries, oldest first, got %d", len(entries))
+		}
+	})
+}
+
+func TestNewRoutingCacheRequiresDefault(t *testing.T) {
+	backend := NewMemoryCache(&Options{MaxSize: 10, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	defer backend.Close()
+
+	if _, err := NewRoutingCache(&RoutingOptions{Backends: map[string]Cache{"memory": backend}, Default: "redis"}); err == nil {
+		t.Error("expected an error for a default backend that doesn't exist")
+	}
+}
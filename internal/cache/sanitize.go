@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"regexp"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// Sanitizer scrubs sensitive data from message text before it is stored.
+type Sanitizer interface {
+	Sanitize(text string) string
+}
+
+// RegexSanitizer replaces every match of each pattern with its replacement.
+type RegexSanitizer struct {
+	Rules []SanitizeRule
+}
+
+// SanitizeRule is a pattern and the text substituted for its matches.
+type SanitizeRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// NewPIISanitizer returns a RegexSanitizer that redacts email addresses,
+// credit-card-like digit runs and phone numbers.
+func NewPIISanitizer() *RegexSanitizer {
+	return &RegexSanitizer{Rules: []SanitizeRule{
+		{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+		// Cards before phones so long digit runs aren't split
+		{regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), "[CARD]"},
+		{regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{3}\)|\b\d{3})[ .-]?\d{3}[ .-]?\d{4}\b`), "[PHONE]"},
+	}}
+}
+
+// Sanitize applies the rules in order.
+func (s *RegexSanitizer) Sanitize(text string) string {
+	for _, r := range s.Rules {
+		text = r.Pattern.ReplaceAllString(text, r.Replacement)
+	}
+	return text
+}
+
+// sanitize scrubs request and response message content with the
+// configured Sanitizer. Messages are copied rather than modified in place,
+// since callers may still hold the original request.
+func (o *Options) sanitize(entry *api.CacheEntry) {
+	if o.Sanitizer == nil {
+		return
+	}
+
+	entry.Request.Messages = sanitizeMessages(o.Sanitizer, entry.Request.Messages)
+
+	if len(entry.Response.Choices) > 0 {
+		choices := make([]api.Choice, len(entry.Response.Choices))
+		copy(choices, entry.Response.Choices)
+		for i := range choices {
+			choices[i].Message.Content = sanitizeContent(o.Sanitizer, choices[i].Message.Content)
+		}
+		entry.Response.Choices = choices
+	}
+}
+
+// sanitizeMessages returns a copy of msgs with sanitized content.
+func sanitizeMessages(s Sanitizer, msgs []api.Message) []api.Message {
+	if len(msgs) == 0 {
+		return msgs
+	}
+	out := make([]api.Message, len(msgs))
+	copy(out, msgs)
+	for i := range out {
+		out[i].Content = sanitizeContent(s, out[i].Content)
+	}
+	return out
+}
+
+// sanitizeContent sanitizes string content and the text of content parts,
+// in either typed or JSON-decoded form. Other content is returned as is.
+func sanitizeContent(s Sanitizer, content interface{}) interface{} {
+	switch c := content.(type) {
+	case string:
+		return s.Sanitize(c)
+	case []api.ContentPart:
+		parts := make([]api.ContentPart, len(c))
+		copy(parts, c)
+		for i := range parts {
+			if parts[i].Text != "" {
+				parts[i].Text = s.Sanitize(parts[i].Text)
+			}
+		}
+		return parts
+	case []interface{}:
+		parts := make([]interface{}, len(c))
+		for i, raw := range c {
+			p, ok := raw.(map[string]interface{})
+			text, isText := p["text"].(string)
+			if !ok || !isText {
+				parts[i] = raw
+				continue
+			}
+			cp := make(map[string]interface{}, len(p))
+			for k, v := range p {
+				cp[k] = v
+			}
+			cp["text"] = s.Sanitize(text)
+			parts[i] = cp
+		}
+		return parts
+	default:
+		return content
+	}
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+func TestPIISanitizer(t *testing.T) {
+	s := NewPIISanitizer()
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"email", "mail jane.doe+x@example.co.uk today", "mail [EMAIL] today"},
+		{"card with spaces", "card 4111 1111 1111 1111 ok", "card [CARD] ok"},
+		{"card with dashes", "4111-1111-1111-1111", "[CARD]"},
+		{"phone", "call (555) 123-4567", "call [PHONE]"},
+		{"international phone", "call +1 555.123.4567 now", "call [PHONE] now"},
+		{"plain text", "what is 2 + 2?", "what is 2 + 2?"},
+		{"short numbers", "order 12345 of 2024", "order 12345 of 2024"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Sanitize(tt.input); got != tt.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheSanitizer(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(&Options{
+		MaxSize:         10,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		Sanitizer:       NewPIISanitizer(),
+	})
+
+	messages := []api.Message{
+		{Role: "system", Content: "Contact admin@example.com"},
+		{Role: "user", Content: []api.ContentPart{{Type: "text", Text: "my phone is 555-123-4567"}}},
+		{Role: "user", Content: []interface{}{
+			map[string]interface{}{"type": "text", "text": "card 4111111111111111"},
+		}},
+	}
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	entry.Request.Messages = messages
+	entry.Response.Choices[0].Message.Content = "I emailed admin@example.com"
+
+	if err := cache.Set(ctx, entry); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	got, ok := cache.GetByID(ctx, entry.ID)
+	if !ok {
+		t.Fatal("expected entry to be stored")
+	}
+	if c := got.Request.Messages[0].Content; c != "Contact [EMAIL]" {
+		t.Errorf("expected string content scrubbed, got %v", c)
+	}
+	if c := got.Request.Messages[1].Content.([]api.ContentPart)[0].Text; c != "my phone is [PHONE]" {
+		t.Errorf("expected content part scrubbed, got %v", c)
+	}
+	if c := got.Request.Messages[2].Content.([]interface{})[0].(map[string]interface{})["text"]; c != "card [CARD]" {
+		t.Errorf("expected decoded content part scrubbed, got %v", c)
+	}
+	if c := got.Response.Choices[0].Message.Content; c != "I emailed [EMAIL]" {
+		t.Errorf("expected response content scrubbed, got %v", c)
+	}
+
+	// The caller's request is left untouched
+	if messages[0].Content != "Contact admin@example.com" {
+		t.Errorf("expected caller's messages to be unmodified, got %v", messages[0].Content)
+	}
+}
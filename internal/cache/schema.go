@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// ErrIncompatibleEntry is returned for a stored entry that cannot be
+// upgraded to api.CacheEntrySchemaVersion.
+var ErrIncompatibleEntry = errors.New("incompatible cache entry")
+
+// migrateEntry upgrades an entry loaded from storage or a snapshot to
+// api.CacheEntrySchemaVersion, filling in fields older versions lacked.
+// Entries written by a newer version, or missing what lookups depend on,
+// are rejected with ErrIncompatibleEntry for the caller to drop.
+func migrateEntry(entry *api.CacheEntry) error {
+	version := max(entry.SchemaVersion, 1)
+	if version > api.CacheEntrySchemaVersion {
+		return fmt.Errorf("%w: schema version %d is newer than %d", ErrIncompatibleEntry, version, api.CacheEntrySchemaVersion)
+	}
+
+	if version < 2 {
+		// Version 1 had no IDs or request hashes, and left LastHitAt zero
+		// until the first hit
+		if entry.ID == "" {
+			entry.ID = NewEntryID()
+		}
+		applyRequestHash(entry)
+		if entry.LastHitAt.IsZero() {
+			entry.LastHitAt = entry.CreatedAt
+		}
+	}
+
+	switch {
+	case len(entry.Embedding) == 0:
+		return fmt.Errorf("%w: no embedding", ErrIncompatibleEntry)
+	case CheckFinite(entry.Embedding) != nil:
+		return fmt.Errorf("%w: non-finite embedding", ErrIncompatibleEntry)
+	case !entry.Negative && len(entry.Response.Choices) == 0:
+		return fmt.Errorf("%w: no response", ErrIncompatibleEntry)
+	}
+	entry.SchemaVersion = api.CacheEntrySchemaVersion
+	return nil
+}
+
+// logIncompatible logs the removal of an entry migrateEntry rejected at
+// warn level, since the cache loses it.
+func (o *Options) logIncompatible(ctx context.Context, id string, err error) {
+	if o.logEnabled(ctx, slog.LevelWarn) {
+		o.Logger.LogAttrs(ctx, slog.LevelWarn, "incompatible cache entry removed", slog.String("id", id), slog.String("reason", err.Error()))
+	}
+}
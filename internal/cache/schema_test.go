@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMigrateEntry(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(*api.CacheEntry)
+		compatible bool
+	}{
+		{"current", func(e *api.CacheEntry) {
+			e.ID, e.RequestHash, e.SchemaVersion = "id", "hash", api.CacheEntrySchemaVersion
+		}, true},
+		{"unversioned", func(e *api.CacheEntry) { e.ID, e.RequestHash = "", "" }, true},
+		{"negative without response", func(e *api.CacheEntry) { e.Negative, e.Response = true, api.ChatCompletionResponse{} }, true},
+		{"newer version", func(e *api.CacheEntry) { e.SchemaVersion = api.CacheEntrySchemaVersion + 1 }, false},
+		{"no embedding", func(e *api.CacheEntry) { e.Embedding = nil }, false},
+		{"no response", func(e *api.CacheEntry) { e.Response.Choices = nil }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+			tt.modify(entry)
+			err := migrateEntry(entry)
+			if !tt.compatible {
+				if !errors.Is(err, ErrIncompatibleEntry) {
+					t.Errorf("expected ErrIncompatibleEntry, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("migrateEntry failed: %v", err)
+			}
+			if entry.SchemaVersion != api.CacheEntrySchemaVersion || entry.ID == "" || entry.RequestHash == "" {
+				t.Errorf("expected an upgraded entry, got version %d, ID %q, request hash %q", entry.SchemaVersion, entry.ID, entry.RequestHash)
+			}
+		})
+	}
+}
+
+// v1Entry is a cache entry as dumped before schema versions, IDs and
+// request hashes existed.
+const v1Entry = `{"request":{"model":"gpt-4o","messages":[{"role":"user","content":"What is the capital of France?"}]},` +
+	`"response":{"id":"chatcmpl-1","object":"chat.completion","created":1700000000,"model":"gpt-4o",` +
+	`"choices":[{"index":0,"message":{"role":"assistant","content":"Paris."},"finish_reason":"stop"}]},` +
+	`"embedding":[1,0,0],"created_at":"2024-01-01T00:00:00Z","expires_at":%q,"hit_count":3,"last_hit_at":"0001-01-01T00:00:00Z"}`
+
+func TestLoadFromReaderUpgradesV1Entries(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(&Options{MaxSize: 10, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	defer c.Close()
+
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	input := strings.Join([]string{
+		fmt.Sprintf(v1Entry, expires),
+		// Written by a newer version, so skipped
+		`{"schema_version":99,"embedding":[0,1,0],"expires_at":"` + expires + `"}`,
+		// Nothing to match lookups against, so skipped
+		`{"response":{"choices":[{"message":{"role":"assistant","content":"?"}}]},"expires_at":"` + expires + `"}`,
+	}, "\n")
+
+	n, err := c.LoadFromReader(ctx, strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("LoadFromReader failed: %v", err)
+	}
+	if n != 1 || c.Size(ctx) != 1 {
+		t.Fatalf("expected 1 entry loaded, got %d (size %d)", n, c.Size(ctx))
+	}
+
+	entry, _, found := c.Get(ctx, []float64{1, 0, 0}, 0.99)
+	if !found {
+		t.Fatal("expected the v1 entry to be found")
+	}
+	if entry.SchemaVersion != api.CacheEntrySchemaVersion || entry.ID == "" {
+		t.Errorf("expected an upgraded entry with an ID, got version %d, ID %q", entry.SchemaVersion, entry.ID)
+	}
+	if entry.Response.Choices[0].Message.Content != "Paris." {
+		t.Errorf("expected the cached response, got %q", entry.Response.Choices[0].Message.Content)
+	}
+
+	req := api.ChatCompletionRequest{Model: "gpt-4o", Messages: []api.Message{{Role: "user", Content: "What is the capital of France?"}}}
+	if _, found := c.GetExact(ctx, &req); !found {
+		t.Error("expected the v1 entry to be found by exact match")
+	}
+}
+
+func TestBoltCacheUpgradesOldRecords(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	cache := newTestBoltCache(t, path, 10)
+	old := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	newer := newTestEntry([]float64{0, 1, 0}, time.Hour)
+	for _, e := range []*api.CacheEntry{old, newer} {
+		if err := cache.Set(ctx, e); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	// Rewrite the records as an older and a newer version would have
+	records := map[string]func(*boltRecord){
+		old.ID:   func(r *boltRecord) { r.SchemaVersion, r.RequestHash = 0, "" },
+		newer.ID: func(r *boltRecord) { r.SchemaVersion = api.CacheEntrySchemaVersion + 1 },
+	}
+	err := cache.db.Update(func(tx *bolt.Tx) error {
+		for id, modify := range records {
+			rec := recordFor(cache.entries[cache.byID[id]])
+			modify(&rec)
+			data, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err := tx.Bucket(boltEntriesBucket).Put([]byte(id), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to rewrite records: %v", err)
+	}
+	cache.Close()
+
+	cache = newTestBoltCache(t, path, 10)
+	got, ok := cache.GetByID(ctx, old.ID)
+	if !ok {
+		t.Fatal("expected the old entry to be upgraded")
+	}
+	if got.SchemaVersion != api.CacheEntrySchemaVersion || got.RequestHash != old.RequestHash {
+		t.Errorf("expected version %d with request hash %q, got version %d with %q", api.CacheEntrySchemaVersion, old.RequestHash, got.SchemaVersion, got.RequestHash)
+	}
+	if _, ok := cache.GetByID(ctx, newer.ID); ok {
+		t.Error("expected the newer entry to be dropped")
+	}
+	if err := cache.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltEntriesBucket).Get([]byte(newer.ID)) != nil {
+			return errors.New("still stored")
+		}
+		return nil
+	}); err != nil {
+		t.Errorf("expected the newer entry to be deleted: %v", err)
+	}
+}
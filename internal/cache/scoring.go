@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"math"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// ScoringOptions weighs entry age and popularity against similarity when
+// ranking candidates, so a fresh near-match can beat a slightly closer one
+// that may be stale. Candidates must still reach the similarity threshold.
+// The zero value ranks by similarity alone.
+type ScoringOptions struct {
+	// AgeWeight is subtracted from the similarity for every hour since
+	// the entry was created.
+	AgeWeight float64
+	// HitWeight is added per unit of ln(1 + hit count), favoring entries
+	// that have served well.
+	HitWeight float64
+}
+
+// enabled reports whether scoring departs from pure similarity.
+func (s ScoringOptions) enabled() bool {
+	return s.AgeWeight != 0 || s.HitWeight != 0
+}
+
+// confidence returns the rank of a candidate with the given similarity, in
+// ordered form (higher is better), under Options.Scoring.
+func (o *Options) confidence(entry *api.CacheEntry, similarity float64, now time.Time) float64 {
+	s := o.Scoring
+	if !s.enabled() {
+		return similarity
+	}
+	if s.AgeWeight != 0 {
+		similarity -= s.AgeWeight * now.Sub(entry.CreatedAt).Hours()
+	}
+	if s.HitWeight != 0 {
+		similarity += s.HitWeight * math.Log1p(float64(entry.HitCount))
+	}
+	return similarity
+}
@@ -1,10 +1,89 @@
 // Package cache provides caching functionality for mimir.
 package cache
 
-import "math"
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// Metric selects how embeddings are compared.
+type Metric int
+
+const (
+	// MetricCosine compares vectors by the cosine of the angle between them.
+	MetricCosine Metric = iota
+	// MetricDotProduct uses the raw dot product. It equals cosine similarity
+	// only when vectors are unit length, so callers are responsible for
+	// normalizing (see Options.NormalizeOnSet).
+	MetricDotProduct
+	// MetricEuclidean uses Euclidean distance mapped to a similarity in
+	// (0, 1] via 1/(1+d), so identical vectors score 1.
+	MetricEuclidean
+	// MetricEuclideanDistance uses raw Euclidean distance, where smaller is
+	// better: thresholds are maximum distances and Get and Search report
+	// distances in place of similarities.
+	MetricEuclideanDistance
+	// MetricManhattanDistance uses raw Manhattan (L1) distance, which
+	// suits sparse or binary-like embeddings. Like MetricEuclideanDistance,
+	// smaller is better.
+	MetricManhattanDistance
+)
+
+// Near-duplicate bounds: entries this close are replaced by Set and
+// removed by DeleteByEmbedding. The distance matches the similarity
+// under MetricEuclidean's 1/(1+d) mapping and applies to either distance
+// metric.
+const (
+	nearDuplicateSimilarity = 0.99
+	nearDuplicateDistance   = 1/nearDuplicateSimilarity - 1
+)
+
+// String returns the metric name.
+func (m Metric) String() string {
+	switch m {
+	case MetricCosine:
+		return "cosine"
+	case MetricDotProduct:
+		return "dot"
+	case MetricEuclidean:
+		return "euclidean"
+	case MetricEuclideanDistance:
+		return "euclidean_distance"
+	case MetricManhattanDistance:
+		return "manhattan_distance"
+	default:
+		return "unknown"
+	}
+}
+
+// Similarity compares two vectors using the metric.
+// Higher values always mean more similar; for the distance metrics it is
+// the negated distance so that ordering holds.
+func (m Metric) Similarity(a, b []float64) float64 {
+	switch m {
+	case MetricDotProduct:
+		return DotProduct(a, b)
+	case MetricEuclideanDistance:
+		return -EuclideanDistance(a, b)
+	case MetricManhattanDistance:
+		return -ManhattanDistance(a, b)
+	case MetricEuclidean:
+		d := EuclideanDistance(a, b)
+		if math.IsInf(d, 1) {
+			return 0
+		}
+		return 1 / (1 + d)
+	default:
+		return CosineSimilarity(a, b)
+	}
+}
 
 // CosineSimilarity calculates the cosine similarity between two vectors.
 // Returns a value between -1 and 1, where 1 means identical vectors.
+// Instead of NaN, vectors with non-finite values (which Set rejects, see
+// ErrInvalidEmbedding) have similarity 0; likewise the other functions
+// here return 0 for products and +Inf for distances.
 func CosineSimilarity(a, b []float64) float64 {
 	if len(a) != len(b) || len(a) == 0 {
 		return 0
@@ -22,7 +101,22 @@ func CosineSimilarity(a, b []float64) float64 {
 		return 0
 	}
 
-	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB))
+	return definedSimilarity(dotProduct / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
+
+// DotProduct calculates the dot product of two vectors.
+// For unit-length vectors this equals their cosine similarity.
+func DotProduct(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+
+	return definedSimilarity(sum)
 }
 
 // EuclideanDistance calculates the Euclidean distance between two vectors.
@@ -37,7 +131,62 @@ func EuclideanDistance(a, b []float64) float64 {
 		sum += diff * diff
 	}
 
-	return math.Sqrt(sum)
+	return definedDistance(math.Sqrt(sum))
+}
+
+// ManhattanDistance calculates the Manhattan (L1) distance between two
+// vectors: the sum of absolute differences.
+func ManhattanDistance(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return math.Inf(1)
+	}
+
+	var sum float64
+	for i := range a {
+		sum += math.Abs(a[i] - b[i])
+	}
+
+	return definedDistance(sum)
+}
+
+// definedSimilarity returns s, or 0 if it is NaN or infinite.
+func definedSimilarity(s float64) float64 {
+	if math.IsNaN(s) || math.IsInf(s, 0) {
+		return 0
+	}
+	return s
+}
+
+// definedDistance returns d, or +Inf if it is NaN. An infinite distance
+// is meaningful: one vector is infinitely far from the other.
+func definedDistance(d float64) float64 {
+	if math.IsNaN(d) {
+		return math.Inf(1)
+	}
+	return d
+}
+
+// CheckFinite returns ErrInvalidEmbedding if the embedding contains NaN or
+// infinite values, which a broken embedder may produce and which compare
+// as nothing.
+func CheckFinite(embedding []float64) error {
+	for i, f := range embedding {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("%w: element %d is %v", ErrInvalidEmbedding, i, f)
+		}
+	}
+	return nil
+}
+
+// unitQuery returns the query and metric to compare stored embeddings
+// with. Under NormalizeOnSet every stored embedding is unit length, so
+// cosine similarity reduces to the dot product with the normalized query,
+// which skips computing the entry's norm on every comparison.
+func (o *Options) unitQuery(embedding []float64, metric Metric) ([]float64, Metric) {
+	if o.NormalizeOnSet && metric == MetricCosine {
+		return NormalizeVector(embedding), MetricDotProduct
+	}
+	return embedding, metric
 }
 
 // NormalizeVector normalizes a vector to unit length.
@@ -59,3 +208,250 @@ func NormalizeVector(v []float64) []float64 {
 
 	return result
 }
+
+// Similarity32 is Similarity for float32 vectors.
+func (m Metric) Similarity32(a, b []float32) float64 {
+	switch m {
+	case MetricDotProduct:
+		return float64(DotProduct32(a, b))
+	case MetricEuclideanDistance:
+		return -EuclideanDistance32(a, b)
+	case MetricManhattanDistance:
+		return -ManhattanDistance32(a, b)
+	case MetricEuclidean:
+		d := EuclideanDistance32(a, b)
+		if math.IsInf(d, 1) {
+			return 0
+		}
+		return 1 / (1 + d)
+	default:
+		return CosineSimilarity32(a, b)
+	}
+}
+
+// CosineSimilarity32 calculates the cosine similarity between two float32
+// vectors. Embedding models emit float32 precision, so this loses nothing
+// meaningful over CosineSimilarity while halving memory traffic on scans.
+func CosineSimilarity32(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	b = b[:len(a)] // lets the compiler drop bounds checks in the loop
+
+	var dotProduct, normA, normB float32
+	for i, x := range a {
+		y := b[i]
+		dotProduct += x * y
+		normA += x * x
+		normB += y * y
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return definedSimilarity(float64(dotProduct) / (math.Sqrt(float64(normA)) * math.Sqrt(float64(normB))))
+}
+
+// DotProduct32 calculates the dot product of two float32 vectors.
+func DotProduct32(a, b []float32) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	b = b[:len(a)]
+
+	var sum float32
+	for i, x := range a {
+		sum += x * b[i]
+	}
+
+	return float32(definedSimilarity(float64(sum)))
+}
+
+// EuclideanDistance32 calculates the Euclidean distance between two
+// float32 vectors.
+func EuclideanDistance32(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return math.Inf(1)
+	}
+	b = b[:len(a)]
+
+	var sum float32
+	for i := range a {
+		diff := a[i] - b[i]
+		sum += diff * diff
+	}
+
+	return definedDistance(math.Sqrt(float64(sum)))
+}
+
+// ManhattanDistance32 calculates the Manhattan distance between two
+// float32 vectors.
+func ManhattanDistance32(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return math.Inf(1)
+	}
+	b = b[:len(a)]
+
+	var sum float32
+	for i := range a {
+		if diff := a[i] - b[i]; diff < 0 {
+			sum -= diff
+		} else {
+			sum += diff
+		}
+	}
+
+	return definedDistance(float64(sum))
+}
+
+// pruneStride is how many dimensions the bounded distance functions
+// accumulate between checks against the bound.
+const pruneStride = 16
+
+// euclideanWithinBound is EuclideanDistance32 for top-1 scans: it stops
+// as soon as the running squared distance exceeds bound squared and
+// reports false, since the vector can no longer beat the bound. When it
+// reports true the distance is exactly EuclideanDistance32's.
+func euclideanWithinBound(a, b []float32, bound float64) (float64, bool) {
+	if len(a) != len(b) || len(a) == 0 {
+		return math.Inf(1), false
+	}
+	b = b[:len(a)]
+	limit := bound * bound
+
+	// Summed in the same order as EuclideanDistance32; partial sums only
+	// grow, so crossing the limit is final. The full sum is compared as a
+	// distance below, so a vector exactly at the bound isn't lost to
+	// rounding in limit.
+	var sum float32
+	for start := 0; start < len(a); start += pruneStride {
+		end := min(start+pruneStride, len(a))
+		for i := start; i < end; i++ {
+			diff := a[i] - b[i]
+			sum += diff * diff
+		}
+		if end < len(a) && float64(sum) > limit {
+			return math.Inf(1), false
+		}
+	}
+
+	d := math.Sqrt(float64(sum))
+	return d, d <= bound
+}
+
+// manhattanWithinBound is ManhattanDistance32 with the same early exit as
+// euclideanWithinBound.
+func manhattanWithinBound(a, b []float32, bound float64) (float64, bool) {
+	if len(a) != len(b) || len(a) == 0 {
+		return math.Inf(1), false
+	}
+	b = b[:len(a)]
+
+	var sum float32
+	for start := 0; start < len(a); start += pruneStride {
+		end := min(start+pruneStride, len(a))
+		for i := start; i < end; i++ {
+			if diff := a[i] - b[i]; diff < 0 {
+				sum -= diff
+			} else {
+				sum += diff
+			}
+		}
+		if end < len(a) && float64(sum) > bound {
+			return math.Inf(1), false
+		}
+	}
+
+	return float64(sum), float64(sum) <= bound
+}
+
+// similarityAbove is Similarity32 for scans that only care about vectors
+// scoring at least floor (a Similarity value). Distance-based metrics stop
+// comparing as soon as the vector is known to fall short; it then reports
+// false and the returned similarity is meaningless.
+func (m Metric) similarityAbove(a, b []float32, floor float64) (float64, bool) {
+	switch m {
+	case MetricEuclideanDistance:
+		d, ok := euclideanWithinBound(a, b, -floor)
+		return -d, ok
+	case MetricManhattanDistance:
+		d, ok := manhattanWithinBound(a, b, -floor)
+		return -d, ok
+	case MetricEuclidean:
+		// 1/(1+d) >= floor  <=>  d <= 1/floor - 1
+		bound := math.Inf(1)
+		if floor > 0 {
+			bound = 1/floor - 1
+		}
+		d, ok := euclideanWithinBound(a, b, bound)
+		if !ok {
+			return 0, false
+		}
+		s := 1 / (1 + d)
+		return s, s >= floor
+	default:
+		s := m.Similarity32(a, b)
+		return s, s >= floor
+	}
+}
+
+// toFloat32 converts an embedding to float32.
+func toFloat32(v []float64) []float32 {
+	out := make([]float32, len(v))
+	for i, f := range v {
+		out[i] = float32(f)
+	}
+	return out
+}
+
+// toFloat64 converts an embedding back to float64.
+func toFloat64(v []float32) []float64 {
+	out := make([]float64, len(v))
+	for i, f := range v {
+		out[i] = float64(f)
+	}
+	return out
+}
+
+// LowerIsBetter reports whether the metric's scores and thresholds are
+// distances rather than similarities.
+func (m Metric) LowerIsBetter() bool {
+	return m == MetricEuclideanDistance || m == MetricManhattanDistance
+}
+
+// ordered converts between a threshold or score in the metric's own terms
+// and the higher-is-better value returned by Similarity. It is its own
+// inverse.
+func (m Metric) ordered(score float64) float64 {
+	if m.LowerIsBetter() {
+		return -score
+	}
+	return score
+}
+
+// isNearDuplicate reports whether a Similarity value marks two vectors as
+// near-duplicates.
+func (m Metric) isNearDuplicate(similarity float64) bool {
+	if m.LowerIsBetter() {
+		return -similarity < nearDuplicateDistance
+	}
+	return similarity > nearDuplicateSimilarity
+}
+
+type metricContextKey struct{}
+
+// WithMetric returns a context overriding the cache's metric for Get and
+// Search, e.g. to compare by Euclidean distance for one embedding model.
+// The threshold passed alongside is read in the metric's terms.
+func WithMetric(ctx context.Context, metric Metric) context.Context {
+	return context.WithValue(ctx, metricContextKey{}, metric)
+}
+
+// queryMetric returns the metric set by WithMetric, or the configured one.
+func (o *Options) queryMetric(ctx context.Context) Metric {
+	if m, ok := ctx.Value(metricContextKey{}).(Metric); ok {
+		return m
+	}
+	return o.Metric
+}
@@ -1,8 +1,12 @@
 package cache
 
 import (
+	"context"
+	"errors"
 	"math"
+	"math/rand"
 	"testing"
+	"time"
 )
 
 func TestCosineSimilarity(t *testing.T) {
@@ -88,6 +92,91 @@ func TestCosineSimilarity(t *testing.T) {
 	}
 }
 
+func TestDotProduct(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        []float64
+		b        []float64
+		expected float64
+	}{
+		{"simple vectors", []float64{1, 2, 3}, []float64{4, 5, 6}, 32},
+		{"orthogonal vectors", []float64{1, 0}, []float64{0, 1}, 0},
+		{"unit vectors equal cosine", []float64{0.6, 0.8}, []float64{0.6, 0.8}, 1},
+		{"different length vectors", []float64{1, 2}, []float64{1, 2, 3}, 0},
+		{"empty vectors", []float64{}, []float64{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := DotProduct(tt.a, tt.b)
+			if math.Abs(result-tt.expected) > 0.0001 {
+				t.Errorf("expected %f, got %f", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestMetricSimilarity(t *testing.T) {
+	a := []float64{1, 0, 0}
+	b := []float64{0, 1, 0}
+
+	tests := []struct {
+		metric    Metric
+		identical float64
+		different float64
+	}{
+		{MetricCosine, 1, 0},
+		{MetricDotProduct, 1, 0},
+		{MetricEuclidean, 1, 1 / (1 + math.Sqrt2)},
+		{MetricEuclideanDistance, 0, -math.Sqrt2},
+		{MetricManhattanDistance, 0, -2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.metric.String(), func(t *testing.T) {
+			if got := tt.metric.Similarity(a, a); math.Abs(got-tt.identical) > 0.0001 {
+				t.Errorf("identical: expected %f, got %f", tt.identical, got)
+			}
+			if got := tt.metric.Similarity(a, b); math.Abs(got-tt.different) > 0.0001 {
+				t.Errorf("different: expected %f, got %f", tt.different, got)
+			}
+		})
+	}
+
+	t.Run("euclidean length mismatch", func(t *testing.T) {
+		if got := MetricEuclidean.Similarity([]float64{1}, []float64{1, 2}); got != 0 {
+			t.Errorf("expected 0 for mismatched lengths, got %f", got)
+		}
+	})
+}
+
+func TestManhattanDistance(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        []float64
+		b        []float64
+		expected float64
+	}{
+		{"identical vectors", []float64{1, 2, 3}, []float64{1, 2, 3}, 0},
+		{"unit distance", []float64{0, 0}, []float64{1, 0}, 1},
+		{"3-4 legs", []float64{0, 0}, []float64{3, 4}, 7},
+		{"negative components", []float64{-1, 2, -3}, []float64{1, -2, 3}, 12},
+		{"different length vectors", []float64{1, 2}, []float64{1, 2, 3}, math.Inf(1)},
+		{"empty vectors", []float64{}, []float64{}, math.Inf(1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ManhattanDistance(tt.a, tt.b); got != tt.expected {
+				t.Errorf("expected %f, got %f", tt.expected, got)
+			}
+			if got := ManhattanDistance32(toFloat32(tt.a), toFloat32(tt.b)); got != tt.expected {
+				t.Errorf("float32: expected %f, got %f", tt.expected, got)
+			}
+		})
+	}
+}
+
 func TestEuclideanDistance(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -147,6 +236,58 @@ func TestEuclideanDistance(t *testing.T) {
 	}
 }
 
+func TestNonFiniteVectors(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	finite := []float64{1, 2, 3}
+
+	tests := []struct {
+		name       string
+		a          []float64
+		similarity float64 // expected from the similarity functions
+		distance   float64 // expected from the distance functions
+	}{
+		{"nan", []float64{1, nan, 3}, 0, inf},
+		{"positive inf", []float64{1, inf, 3}, 0, inf},
+		{"negative inf", []float64{1, -inf, 3}, 0, inf},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a32, b32 := toFloat32(tt.a), toFloat32(finite)
+			similarities := map[string]float64{
+				"cosine":   CosineSimilarity(tt.a, finite),
+				"dot":      DotProduct(tt.a, finite),
+				"cosine32": CosineSimilarity32(a32, b32),
+				"dot32":    float64(DotProduct32(a32, b32)),
+			}
+			for name, got := range similarities {
+				if got != tt.similarity {
+					t.Errorf("%s: expected %v, got %v", name, tt.similarity, got)
+				}
+			}
+			distances := map[string]float64{
+				"euclidean":   EuclideanDistance(tt.a, tt.a),
+				"manhattan":   ManhattanDistance(tt.a, tt.a),
+				"euclidean32": EuclideanDistance32(a32, a32),
+				"manhattan32": ManhattanDistance32(a32, a32),
+			}
+			for name, got := range distances {
+				if got != tt.distance {
+					t.Errorf("%s: expected %v, got %v", name, tt.distance, got)
+				}
+			}
+
+			if err := CheckFinite(tt.a); !errors.Is(err, ErrInvalidEmbedding) {
+				t.Errorf("expected ErrInvalidEmbedding, got %v", err)
+			}
+		})
+	}
+
+	if err := CheckFinite(finite); err != nil {
+		t.Errorf("expected finite vector to pass, got %v", err)
+	}
+}
+
 func TestNormalizeVector(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -212,6 +353,167 @@ func TestNormalizeVector(t *testing.T) {
 	})
 }
 
+func TestSimilarity32MatchesFloat64(t *testing.T) {
+	a := make([]float64, 1536)
+	b := make([]float64, 1536)
+	for i := range a {
+		a[i] = math.Sin(float64(i))
+		b[i] = math.Sin(float64(i) + 0.1)
+	}
+	a32, b32 := toFloat32(a), toFloat32(b)
+
+	for _, metric := range []Metric{MetricCosine, MetricDotProduct, MetricEuclidean} {
+		t.Run(metric.String(), func(t *testing.T) {
+			want := metric.Similarity(a, b)
+			got := metric.Similarity32(a32, b32)
+			if math.Abs(got-want) > 1e-4*math.Max(1, math.Abs(want)) {
+				t.Errorf("expected %f, got %f", want, got)
+			}
+		})
+	}
+
+	if CosineSimilarity32(a32, b32[:10]) != 0 {
+		t.Error("expected 0 for mismatched lengths")
+	}
+	if CosineSimilarity32(nil, nil) != 0 {
+		t.Error("expected 0 for empty vectors")
+	}
+}
+
+func TestWithinBound(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	vecs := randomVectors(rng, 50, 100)
+	query := toFloat32(vecs[0])
+
+	distances := []struct {
+		name    string
+		exact   func(a, b []float32) float64
+		bounded func(a, b []float32, bound float64) (float64, bool)
+	}{
+		{"euclidean", EuclideanDistance32, euclideanWithinBound},
+		{"manhattan", ManhattanDistance32, manhattanWithinBound},
+	}
+
+	for _, dist := range distances {
+		t.Run(dist.name, func(t *testing.T) {
+			for i := 1; i < len(vecs); i++ {
+				v := toFloat32(vecs[i])
+				want := dist.exact(query, v)
+
+				// Within the bound, the exact distance is reported
+				if got, ok := dist.bounded(query, v, want); !ok || got != want {
+					t.Fatalf("vector %d: expected %f within bound, got %f ok=%v", i, want, got, ok)
+				}
+				if _, ok := dist.bounded(query, v, want*0.99); ok {
+					t.Fatalf("vector %d: expected distance %f to exceed bound", i, want)
+				}
+			}
+
+			if _, ok := dist.bounded(query, query[:10], math.Inf(1)); ok {
+				t.Error("expected mismatched lengths never to be within bound")
+			}
+		})
+	}
+}
+
+func TestPrunedScanMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	vecs := randomVectors(rng, 300, 64)
+	queries := randomVectors(rng, 20, 64)
+
+	for _, metric := range []Metric{MetricEuclidean, MetricEuclideanDistance, MetricManhattanDistance, MetricCosine} {
+		t.Run(metric.String(), func(t *testing.T) {
+			cache := NewMemoryCache(&Options{MaxSize: len(vecs), DefaultTTL: time.Hour, CleanupInterval: time.Hour, Metric: metric})
+			defer cache.Close()
+			for i, v := range vecs {
+				me := &memoryEntry{entry: newTestEntry(nil, time.Hour), idx: i}
+				me.setVector(toFloat32(v), QuantizationNone)
+				cache.entries = append(cache.entries, me)
+			}
+
+			for qi, q := range queries {
+				query := toFloat32(q)
+				want, wantSim := -1, math.Inf(-1)
+				for i, v := range vecs {
+					if s := metric.Similarity32(query, toFloat32(v)); s > wantSim {
+						want, wantSim = i, s
+					}
+				}
+
+				got, gotSim := cache.scanRange(context.Background(), cache.entries, query, metric, scope{}, math.Inf(-1), time.Now())
+				if got != cache.entries[want] || gotSim != wantSim {
+					t.Fatalf("query %d: expected entry %d (%f), got %f", qi, want, wantSim, gotSim)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEuclideanScan compares a top-1 Euclidean scan computing every
+// distance in full against one pruned by the best distance so far. With
+// no close match, random high-dimensional vectors are all about equally
+// far apart and pruning barely helps; once a near match is found, the
+// rest are rejected after a few dimensions.
+func BenchmarkEuclideanScan(b *testing.B) {
+	rng := rand.New(rand.NewSource(6))
+	vecs := make([][]float32, 1000)
+	for i, v := range randomVectors(rng, len(vecs), 768) {
+		vecs[i] = toFloat32(v)
+	}
+	unrelated := toFloat32(randomVectors(rng, 1, 768)[0])
+	nearMatch := make([]float32, 768)
+	for i, x := range vecs[10] {
+		nearMatch[i] = x + float32(rng.NormFloat64()*0.05)
+	}
+
+	for _, q := range []struct {
+		name  string
+		query []float32
+	}{
+		{"no match", unrelated},
+		{"near match", nearMatch},
+	} {
+		b.Run(q.name+"/naive", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				best := math.Inf(1)
+				for _, v := range vecs {
+					if d := EuclideanDistance32(q.query, v); d < best {
+						best = d
+					}
+				}
+			}
+		})
+		b.Run(q.name+"/pruned", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				best := math.Inf(1)
+				for _, v := range vecs {
+					if d, ok := euclideanWithinBound(q.query, v, best); ok && d < best {
+						best = d
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDotProduct(b *testing.B) {
+	a := NormalizeVector(make768(0))
+	vecB := NormalizeVector(make768(1))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DotProduct(a, vecB)
+	}
+}
+
+func make768(offset int) []float64 {
+	v := make([]float64, 768)
+	for i := range v {
+		v[i] = float64(i+offset) / 768.0
+	}
+	return v
+}
+
 func BenchmarkCosineSimilarity(b *testing.B) {
 	// Create 768-dimensional vectors (typical embedding size)
 	a := make([]float64, 768)
@@ -226,3 +528,30 @@ func BenchmarkCosineSimilarity(b *testing.B) {
 		CosineSimilarity(a, vecB)
 	}
 }
+
+func make1536() (a, b []float64) {
+	a = make([]float64, 1536)
+	b = make([]float64, 1536)
+	for i := range a {
+		a[i] = float64(i) / 1536.0
+		b[i] = float64(i+1) / 1536.0
+	}
+	return a, b
+}
+
+func BenchmarkCosineSimilarity1536(b *testing.B) {
+	x, y := make1536()
+
+	b.Run("float64", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			CosineSimilarity(x, y)
+		}
+	})
+
+	x32, y32 := toFloat32(x), toFloat32(y)
+	b.Run("float32", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			CosineSimilarity32(x32, y32)
+		}
+	})
+}
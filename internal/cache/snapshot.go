@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// loadJSONL stores each JSON-encoded entry read from r in c, skipping
+// entries that have already expired. It returns the number stored.
+func loadJSONL(ctx context.Context, c Cache, r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	now := time.Now()
+	loaded := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return loaded, err
+		}
+
+		var entry api.CacheEntry
+		if err := dec.Decode(&entry); errors.Is(err, io.EOF) {
+			return loaded, nil
+		} else if err != nil {
+			return loaded, fmt.Errorf("failed to decode entry %d: %w", loaded+1, err)
+		}
+
+		if !entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt) {
+			continue
+		}
+		// Entries dumped with a checksum must still match it
+		if !validChecksum(&entry) {
+			continue
+		}
+		// Older entries are upgraded; ones that can't be are skipped
+		if err := migrateEntry(&entry); err != nil {
+			continue
+		}
+		if err := c.Set(ctx, &entry); err != nil {
+			return loaded, fmt.Errorf("failed to store entry %s: %w", entry.ID, err)
+		}
+		loaded++
+	}
+}
+
+// dumpJSONL writes entries to w, one JSON object per line.
+func dumpJSONL(w io.Writer, entries []*api.CacheEntry) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("failed to encode entry %s: %w", e.ID, err)
+		}
+	}
+	return nil
+}
+
+// entryBefore orders entries for Entries: oldest first, ties broken by ID
+// so pages are stable.
+func entryBefore(a, b *api.CacheEntry) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+// pageBounds returns the bounds of the page of n items starting at offset
+// with at most limit items; limit <= 0 means the rest.
+func pageBounds(n, offset, limit int) (int, int) {
+	lo := min(max(offset, 0), n)
+	hi := n
+	if limit > 0 && limit < hi-lo {
+		hi = lo + limit
+	}
+	return lo, hi
+}
+
+// pageEntries returns copies of a page of the entries that have not
+// expired, in Entries order.
+func pageEntries(entries []*api.CacheEntry, now time.Time, offset, limit int) []*api.CacheEntry {
+	live := make([]*api.CacheEntry, 0, len(entries))
+	for _, e := range entries {
+		if now.Before(e.ExpiresAt) {
+			live = append(live, e)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool { return entryBefore(live[i], live[j]) })
+
+	lo, hi := pageBounds(len(live), offset, limit)
+	page := make([]*api.CacheEntry, 0, hi-lo)
+	for _, e := range live[lo:hi] {
+		page = append(page, e.Clone())
+	}
+	return page
+}
+
+// liveEntries returns copies of the entries that have not expired.
+func liveEntries(entries []*api.CacheEntry, now time.Time) []*api.CacheEntry {
+	live := make([]*api.CacheEntry, 0, len(entries))
+	for _, e := range entries {
+		if now.Before(e.ExpiresAt) {
+			c := *e
+			live = append(live, &c)
+		}
+	}
+	return live
+}
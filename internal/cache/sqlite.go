@@ -0,0 +1,947 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// SQLiteDriverName is the database/sql driver used by NewSQLiteCache.
+// It defaults to modernc.org/sqlite, a pure Go driver that works with
+// CGO_ENABLED=0; set it to use another driver registered by the binary.
+var SQLiteDriverName = "sqlite"
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS cache_entries (
+	id              TEXT    PRIMARY KEY,
+	request         TEXT    NOT NULL,
+	response        TEXT    NOT NULL,
+	embedding       BLOB    NOT NULL,
+	created_at      INTEGER NOT NULL,
+	expires_at      INTEGER NOT NULL,
+	hit_count       INTEGER NOT NULL DEFAULT 0,
+	last_hit_at     INTEGER NOT NULL,
+	namespace       TEXT    NOT NULL DEFAULT '',
+	request_hash    TEXT    NOT NULL DEFAULT '',
+	embedding_model TEXT    NOT NULL DEFAULT '',
+	pinned          INTEGER NOT NULL DEFAULT 0,
+	checksum        TEXT    NOT NULL DEFAULT '',
+	schema_version  INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_cache_entries_expires_at ON cache_entries(expires_at);
+CREATE TABLE IF NOT EXISTS cache_counters (
+	name  TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+INSERT OR IGNORE INTO cache_counters (name, value) VALUES ('hits', 0), ('misses', 0), ('saved_micro_usd', 0);
+`
+
+// Ensure SQLiteCache implements Cache.
+var _ Cache = (*SQLiteCache)(nil)
+
+// SQLiteCache implements a persistent semantic cache backed by a SQLite file.
+// All entries are mirrored in memory so lookups never deserialize rows;
+// the database is only touched on writes and on open. Hit counts and
+// statistics are written every Options.FlushInterval.
+type SQLiteCache struct {
+	mu      sync.RWMutex
+	db      *sql.DB
+	entries []*api.CacheEntry
+	byID    map[string]int // entry ID -> index in entries
+	opts    *Options
+
+	pending pendingWrites
+	flushMu sync.Mutex // serializes flushes with Clear
+
+	done      chan struct{}
+	closeOnce sync.Once
+	loops     sync.WaitGroup
+
+	// Stats (persisted in cache_counters)
+	hits          atomic.Int64
+	exactHits     atomic.Int64
+	misses        atomic.Int64
+	savedMicroUSD atomic.Int64
+	evictions     atomic.Int64
+	byModel       modelStats
+}
+
+// NewSQLiteCache opens (or creates) a SQLite cache at path and loads
+// existing entries into memory.
+func NewSQLiteCache(path string, opts *Options) (*SQLiteCache, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+
+	db, err := sql.Open(SQLiteDriverName, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	// SQLite serializes writers; a single connection avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+	// Databases created before namespaces, exact matching, model tagging,
+	// pinning, checksums or schema versions lack the columns
+	for _, column := range []string{
+		"namespace TEXT NOT NULL DEFAULT ''",
+		"request_hash TEXT NOT NULL DEFAULT ''",
+		"embedding_model TEXT NOT NULL DEFAULT ''",
+		"pinned INTEGER NOT NULL DEFAULT 0",
+		"checksum TEXT NOT NULL DEFAULT ''",
+		"schema_version INTEGER NOT NULL DEFAULT 0",
+	} {
+		if _, err := db.Exec(`ALTER TABLE cache_entries ADD COLUMN ` + column); err != nil &&
+			!strings.Contains(err.Error(), "duplicate column") {
+			db.Close()
+			return nil, fmt.Errorf("failed to migrate schema: %w", err)
+		}
+	}
+
+	sc := &SQLiteCache{
+		db:   db,
+		byID: make(map[string]int),
+		opts: opts,
+		done: make(chan struct{}),
+	}
+
+	if err := sc.load(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	sc.loops.Add(2)
+	go sc.cleanupLoop()
+	go func() {
+		defer sc.loops.Done()
+		opts.flushLoop(sc.done, sc.flush)
+	}()
+
+	return sc, nil
+}
+
+// load reads counters and all rows into memory, then deletes rows that
+// failed integrity verification.
+func (s *SQLiteCache) load(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, value FROM cache_counters`)
+	if err != nil {
+		return fmt.Errorf("failed to load counters: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		var value int64
+		if err := rows.Scan(&name, &value); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan counter: %w", err)
+		}
+		if kind, model, ok := strings.Cut(name, ":"); ok {
+			c := s.byModel.get(model)
+			switch kind {
+			case "hits":
+				c.hits = value
+			case "misses":
+				c.misses = value
+			case "saved_micro_usd":
+				c.savedUSD = float64(value) / 1e6
+			}
+			continue
+		}
+		switch name {
+		case "hits":
+			s.hits.Store(value)
+		case "exact_hits":
+			s.exactHits.Store(value)
+		case "misses":
+			s.misses.Store(value)
+		case "saved_micro_usd":
+			s.savedMicroUSD.Store(value)
+		case "evictions":
+			s.evictions.Store(value)
+		}
+	}
+	rows.Close()
+
+	corrupt, incompatible, err := s.loadEntries(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range corrupt {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM cache_entries WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete corrupt entry %s: %w", id, err)
+		}
+		s.opts.logCorrupt(ctx, id)
+	}
+	for _, id := range incompatible {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM cache_entries WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete incompatible entry %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// loadEntries reads all rows into memory, upgrading those of older schema
+// versions, and returns the IDs of those that failed integrity
+// verification or could not be upgraded, which are left out.
+func (s *SQLiteCache) loadEntries(ctx context.Context) (corrupt, incompatible []string, err error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, request, response, embedding, created_at, expires_at, hit_count, last_hit_at, namespace, request_hash, embedding_model, pinned, checksum, schema_version FROM cache_entries`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load entries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id, namespace, requestHash    string
+			embeddingModel, checksum      string
+			reqJSON, respJSON, embBlob    []byte
+			createdAt, expiresAt, lastHit int64
+			hitCount                      int64
+			pinned                        bool
+			schemaVersion                 int
+		)
+		if err := rows.Scan(&id, &reqJSON, &respJSON, &embBlob, &createdAt, &expiresAt, &hitCount, &lastHit, &namespace, &requestHash, &embeddingModel, &pinned, &checksum, &schemaVersion); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan entry: %w", err)
+		}
+
+		entry := &api.CacheEntry{
+			ID:        id,
+			CreatedAt: time.Unix(0, createdAt),
+			ExpiresAt: time.Unix(0, expiresAt),
+			HitCount:  hitCount,
+			LastHitAt: time.Unix(0, lastHit),
+			Namespace: namespace,
+			Pinned:    pinned,
+
+			EmbeddingModel: embeddingModel,
+			RequestHash:    requestHash,
+			Checksum:       checksum,
+
+			SchemaVersion: schemaVersion,
+		}
+		if reqJSON, err = decompress(reqJSON); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode request for entry %s: %w", id, err)
+		}
+		if respJSON, err = decompress(respJSON); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode response for entry %s: %w", id, err)
+		}
+		if entry.Embedding, err = decodeEmbedding(embBlob); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode embedding for entry %s: %w", id, err)
+		}
+		// A request or response whose fields changed type can't be upgraded
+		if err := json.Unmarshal(reqJSON, &entry.Request); err != nil {
+			s.opts.logIncompatible(ctx, id, fmt.Errorf("%w: %v", ErrIncompatibleEntry, err))
+			incompatible = append(incompatible, id)
+			continue
+		}
+		if err := json.Unmarshal(respJSON, &entry.Response); err != nil {
+			s.opts.logIncompatible(ctx, id, fmt.Errorf("%w: %v", ErrIncompatibleEntry, err))
+			incompatible = append(incompatible, id)
+			continue
+		}
+		// Entries written before NormalizeOnSet was enabled are raw; lookups
+		// assume every embedding is unit length
+		if s.opts.NormalizeOnSet {
+			entry.Embedding = NormalizeVector(entry.Embedding)
+		}
+
+		if !s.opts.intact(entry) {
+			corrupt = append(corrupt, id)
+			continue
+		}
+		if err := migrateEntry(entry); err != nil {
+			s.opts.logIncompatible(ctx, id, err)
+			incompatible = append(incompatible, id)
+			continue
+		}
+
+		s.byID[id] = len(s.entries)
+		s.entries = append(s.entries, entry)
+	}
+
+	return corrupt, incompatible, rows.Err()
+}
+
+// Get retrieves a cached response based on semantic similarity.
+func (s *SQLiteCache) Get(ctx context.Context, embedding []float64, threshold float64) (*api.CacheEntry, float64, bool) {
+	threshold = s.opts.lookupThreshold(ctx, threshold)
+	s.mu.RLock()
+	var best *api.CacheEntry
+	var bestSimilarity, bestScore float64
+
+	now := time.Now()
+	ns := namespaceFromContext(ctx)
+	model := s.opts.embeddingModel(ctx)
+	metric := s.opts.queryMetric(ctx)
+	query, scanMetric := s.opts.unitQuery(embedding, metric)
+	threshold = metric.ordered(threshold)
+
+	for _, e := range s.entries {
+		if e.Negative || e.Namespace != ns || now.After(e.ExpiresAt) || !sameEmbeddingModel(e, model) {
+			continue
+		}
+
+		similarity := scanMetric.Similarity(query, e.Embedding)
+		if similarity < threshold {
+			continue
+		}
+		if score := s.opts.confidence(e, similarity, now); best == nil || score > bestScore {
+			bestSimilarity, bestScore = similarity, score
+			best = e
+			if s.opts.reachesHardThreshold(metric, similarity) {
+				break
+			}
+		}
+	}
+	s.mu.RUnlock()
+	bestSimilarity = metric.ordered(bestSimilarity)
+
+	if best == nil {
+		s.recordMiss(ctx, embedding)
+		return nil, 0, false
+	}
+
+	hit := s.recordHit(ctx, best, now, false)
+	s.opts.onHit(hit, bestSimilarity)
+	return hit, bestSimilarity, true
+}
+
+// GetBatch looks up several embeddings in one pass over the entries.
+func (s *SQLiteCache) GetBatch(ctx context.Context, embeddings [][]float64, threshold float64) []*SearchResult {
+	threshold = s.opts.modelThreshold(ctx, threshold)
+	now := time.Now()
+	metric := s.opts.queryMetric(ctx)
+
+	s.mu.RLock()
+	best, bestSim := s.opts.scanBatch(ctx, s.entries, embeddings, metric, namespaceFromContext(ctx), metric.ordered(threshold), now)
+	s.mu.RUnlock()
+
+	cancelled := ctx.Err() != nil
+	results := make([]*SearchResult, len(embeddings))
+	for i, embedding := range embeddings {
+		if best[i] == nil || cancelled {
+			s.recordMiss(ctx, embedding)
+			continue
+		}
+		similarity := metric.ordered(bestSim[i])
+		confidence := s.opts.confidence(best[i], bestSim[i], now)
+		hit := s.recordHit(ctx, best[i], now, false)
+		s.opts.onHit(hit, similarity)
+		results[i] = &SearchResult{Entry: hit, Similarity: similarity, Confidence: confidence}
+	}
+	return results
+}
+
+// recordMiss updates miss statistics, queueing them to be persisted.
+func (s *SQLiteCache) recordMiss(ctx context.Context, embedding []float64) {
+	model := modelFromContext(ctx)
+	s.misses.Add(1)
+	s.byModel.recordMiss(model)
+	s.pending.addCounters(map[string]int64{"misses": 1, "misses:" + model: 1})
+	s.opts.onMiss(embedding)
+}
+
+// GetExact retrieves the entry whose request canonicalizes identically to
+// req. OnHit receives a similarity of 1.
+func (s *SQLiteCache) GetExact(ctx context.Context, req *api.ChatCompletionRequest) (*api.CacheEntry, bool) {
+	hash := api.RequestHash(req)
+	ns := namespaceFromContext(ctx)
+	now := time.Now()
+
+	s.mu.RLock()
+	var match *api.CacheEntry
+	for _, e := range s.entries {
+		if e.RequestHash == hash && e.Namespace == ns && !now.After(e.ExpiresAt) {
+			match = e
+			break
+		}
+	}
+	s.mu.RUnlock()
+	if match == nil {
+		return nil, false
+	}
+
+	hit := s.recordHit(ctx, match, now, true)
+	s.opts.onHit(hit, 1)
+	return hit, true
+}
+
+// recordHit updates hit statistics for an entry, queueing them to be
+// persisted, and returns a copy of it for the caller.
+func (s *SQLiteCache) recordHit(ctx context.Context, best *api.CacheEntry, now time.Time, exact bool) *api.CacheEntry {
+	saved := int64(s.opts.hitSavings(best) * 1e6)
+	model := best.Request.Model
+	if model == "" {
+		model = unknownModel
+	}
+	s.hits.Add(1)
+	s.savedMicroUSD.Add(saved)
+	s.byModel.recordHit(model, float64(saved)/1e6)
+
+	counters := map[string]int64{
+		"hits":                     1,
+		"saved_micro_usd":          saved,
+		"hits:" + model:            1,
+		"saved_micro_usd:" + model: saved,
+	}
+	if exact {
+		s.exactHits.Add(1)
+		counters["exact_hits"] = 1
+	}
+	s.pending.addCounters(counters)
+
+	s.mu.Lock()
+	best.HitCount++
+	best.LastHitAt = now
+	hit := best.Clone()
+	s.mu.Unlock()
+
+	s.pending.addHit(hit.ID)
+	return hit
+}
+
+// Search returns up to k live entries with similarity at or above
+// threshold, most similar first.
+func (s *SQLiteCache) Search(ctx context.Context, embedding []float64, threshold float64, k int) []SearchResult {
+	threshold = s.opts.lookupThreshold(ctx, threshold)
+	if k <= 0 {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	ns := namespaceFromContext(ctx)
+	model := s.opts.embeddingModel(ctx)
+	metric := s.opts.queryMetric(ctx)
+	query, scanMetric := s.opts.unitQuery(embedding, metric)
+	threshold = metric.ordered(threshold)
+
+	var results []SearchResult
+	for _, e := range s.entries {
+		if e.Negative || e.Namespace != ns || now.After(e.ExpiresAt) || !sameEmbeddingModel(e, model) {
+			continue
+		}
+		if similarity := scanMetric.Similarity(query, e.Embedding); similarity >= threshold {
+			results = append(results, SearchResult{Entry: e.Clone(), Similarity: similarity, Confidence: s.opts.confidence(e, similarity, now)})
+		}
+	}
+	return metricResults(metric, topResults(results, k))
+}
+
+// GetByID retrieves an entry by its ID without affecting hit statistics.
+func (s *SQLiteCache) GetByID(ctx context.Context, id string) (*api.CacheEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, ok := s.byID[id]
+	if !ok || time.Now().After(s.entries[i].ExpiresAt) {
+		return nil, false
+	}
+	return s.entries[i].Clone(), true
+}
+
+// flush persists the counter increments and hit counts recorded since
+// the last flush in one transaction. On failure they are kept for the next.
+func (s *SQLiteCache) flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	counters, hits := s.pending.take()
+	if len(counters) == 0 && len(hits) == 0 {
+		return nil
+	}
+	if err := s.writePending(ctx, counters, hits); err != nil {
+		s.pending.restore(counters, hits)
+		return err
+	}
+	return nil
+}
+
+// writePending writes counter increments, and the current hit counts of the
+// entries hit, in one transaction.
+func (s *SQLiteCache) writePending(ctx context.Context, counters map[string]int64, hits map[string]struct{}) error {
+	type hitRow struct {
+		id        string
+		hitCount  int64
+		lastHitAt int64
+	}
+	// Entries removed since their hit are skipped
+	s.mu.RLock()
+	rows := make([]hitRow, 0, len(hits))
+	for id := range hits {
+		if i, ok := s.byID[id]; ok {
+			e := s.entries[i]
+			rows = append(rows, hitRow{id, e.HitCount, e.LastHitAt.UnixNano()})
+		}
+	}
+	s.mu.RUnlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for name, delta := range counters {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO cache_counters (name, value) VALUES (?, ?)
+			ON CONFLICT(name) DO UPDATE SET value = value + excluded.value`, name, delta); err != nil {
+			return fmt.Errorf("failed to update counter %s: %w", name, err)
+		}
+	}
+	for _, r := range rows {
+		if _, err := tx.ExecContext(ctx, `UPDATE cache_entries SET hit_count = ?, last_hit_at = ? WHERE id = ?`,
+			r.hitCount, r.lastHitAt, r.id); err != nil {
+			return fmt.Errorf("failed to update entry %s: %w", r.id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Set stores a response with its embedding.
+func (s *SQLiteCache) Set(ctx context.Context, entry *api.CacheEntry) error {
+	s.opts.onSet(entry)
+	if err := checkResponseFormat(entry); err != nil {
+		return err
+	}
+	if err := s.opts.checkToolCalls(entry); err != nil {
+		return err
+	}
+	if err := CheckFinite(entry.Embedding); err != nil {
+		return err
+	}
+	applyNamespace(ctx, entry)
+	s.opts.applyEmbeddingModel(ctx, entry)
+	applyRequestHash(entry)
+	s.opts.sanitize(entry)
+	if s.opts.NormalizeOnSet {
+		entry.Embedding = NormalizeVector(entry.Embedding)
+	}
+	s.opts.resolveExpiry(entry)
+	s.opts.applyNegativeTTL(entry)
+	if err := s.opts.applyConfidence(entry); err != nil {
+		return err
+	}
+	s.opts.applyChecksum(entry)
+	if entry.ID == "" {
+		entry.ID = NewEntryID()
+	}
+	entry.SchemaVersion = api.CacheEntrySchemaVersion
+
+	reqJSON, err := json.Marshal(entry.Request)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	respJSON, err := json.Marshal(entry.Response)
+	if err != nil {
+		return fmt.Errorf("failed to encode response: %w", err)
+	}
+	if reqJSON, err = s.opts.Compression.compress(reqJSON); err != nil {
+		return err
+	}
+	if respJSON, err = s.opts.Compression.compress(respJSON); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Same ID, or a duplicate by duplicateOf, replaces the existing entry
+	replace, exists := s.byID[entry.ID]
+	if !exists {
+		for i, e := range s.entries {
+			if shadows(e, entry) {
+				return nil
+			}
+			if s.opts.duplicateOf(entry, e) {
+				replace, exists = i, true
+				break
+			}
+		}
+	}
+
+	victim := -1
+	if exists {
+		victim = replace
+		// Replacements of pinned entries stay pinned
+		entry.Pinned = entry.Pinned || s.entries[replace].Pinned
+	} else if len(s.entries) >= s.opts.MaxSize && len(s.entries) > 0 {
+		// Evict if at capacity (LRU-style: remove oldest)
+		if victim = s.oldest(); victim < 0 {
+			return ErrAllPinned
+		}
+	}
+
+	// The replaced or evicted row goes in the same transaction as the
+	// insert, so a failed insert leaves it in place
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if victim >= 0 {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM cache_entries WHERE id = ?`, s.entries[victim].ID); err != nil {
+			return fmt.Errorf("failed to delete entry: %w", err)
+		}
+	}
+	// Negative entries are short-lived, so they are kept in memory only
+	if !entry.Negative {
+		_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO cache_entries
+			(id, request, response, embedding, created_at, expires_at, hit_count, last_hit_at, namespace, request_hash, embedding_model, pinned, checksum, schema_version)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			entry.ID, reqJSON, respJSON, encodeEmbedding(entry.Embedding),
+			entry.CreatedAt.UnixNano(), entry.ExpiresAt.UnixNano(), entry.HitCount, entry.LastHitAt.UnixNano(), entry.Namespace, entry.RequestHash, entry.EmbeddingModel, entry.Pinned, entry.Checksum, entry.SchemaVersion)
+		if err != nil {
+			return fmt.Errorf("failed to insert entry: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if victim >= 0 {
+		if !exists {
+			s.evictions.Add(1)
+			s.opts.logEviction(ctx, s.entries[victim].ID)
+			s.pending.addCounters(map[string]int64{"evictions": 1})
+		}
+		s.dropAt(victim)
+	}
+	s.byID[entry.ID] = len(s.entries)
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// oldest returns the index of the least recently hit unpinned entry, or
+// -1 if all are pinned. Caller must hold the lock.
+func (s *SQLiteCache) oldest() int {
+	oldestIdx := -1
+	for i, e := range s.entries {
+		if !e.Pinned && (oldestIdx < 0 || e.LastHitAt.Before(s.entries[oldestIdx].LastHitAt)) {
+			oldestIdx = i
+		}
+	}
+	return oldestIdx
+}
+
+// removeAt deletes the entry at index i from the database and the index.
+// Caller must hold the write lock.
+func (s *SQLiteCache) removeAt(ctx context.Context, i int) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM cache_entries WHERE id = ?`, s.entries[i].ID); err != nil {
+		return fmt.Errorf("failed to delete entry: %w", err)
+	}
+	s.dropAt(i)
+	return nil
+}
+
+// dropAt removes the entry at index i from memory.
+// Caller must hold the write lock.
+func (s *SQLiteCache) dropAt(i int) {
+	id := s.entries[i].ID
+
+	// Remove by swapping with last element
+	last := len(s.entries) - 1
+	s.entries[i] = s.entries[last]
+	s.byID[s.entries[i].ID] = i
+	s.entries[last] = nil
+	s.entries = s.entries[:last]
+	delete(s.byID, id)
+}
+
+// Delete removes an entry by its ID.
+func (s *SQLiteCache) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i, ok := s.byID[id]; ok {
+		return s.removeAt(ctx, i)
+	}
+	return nil
+}
+
+// Pin exempts the entry with the given ID from eviction.
+func (s *SQLiteCache) Pin(ctx context.Context, id string) error {
+	return s.setPinned(ctx, id, true)
+}
+
+// Unpin makes a pinned entry evictable again.
+func (s *SQLiteCache) Unpin(ctx context.Context, id string) error {
+	return s.setPinned(ctx, id, false)
+}
+
+// setPinned updates and persists the pinned flag of the entry with the
+// given ID.
+func (s *SQLiteCache) setPinned(ctx context.Context, id string, pinned bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.byID[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if _, err := s.db.ExecContext(ctx, `UPDATE cache_entries SET pinned = ? WHERE id = ?`, pinned, id); err != nil {
+		return fmt.Errorf("failed to update entry: %w", err)
+	}
+	s.entries[i].Pinned = pinned
+	return nil
+}
+
+// DeleteByEmbedding removes the entry nearly identical to the embedding
+// in the context's namespace.
+func (s *SQLiteCache) DeleteByEmbedding(ctx context.Context, embedding []float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ns := namespaceFromContext(ctx)
+	for i, e := range s.entries {
+		if e.Namespace != ns {
+			continue
+		}
+		if s.opts.Metric.isNearDuplicate(s.opts.Metric.Similarity(embedding, e.Embedding)) {
+			return s.removeAt(ctx, i)
+		}
+	}
+
+	return nil
+}
+
+// Clear removes all entries from the cache.
+func (s *SQLiteCache) Clear(ctx context.Context) error {
+	// Statistics recorded before Clear must not be flushed after it
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM cache_entries`); err != nil {
+		return fmt.Errorf("failed to clear entries: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM cache_counters`); err != nil {
+		return fmt.Errorf("failed to reset counters: %w", err)
+	}
+
+	s.entries = nil
+	s.byID = make(map[string]int)
+	s.pending.take()
+	s.hits.Store(0)
+	s.exactHits.Store(0)
+	s.misses.Store(0)
+	s.savedMicroUSD.Store(0)
+	s.evictions.Store(0)
+	s.byModel.reset()
+
+	return nil
+}
+
+// ClearNamespace removes all entries in a namespace.
+func (s *SQLiteCache) ClearNamespace(ctx context.Context, namespace string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM cache_entries WHERE namespace = ?`, namespace); err != nil {
+		return fmt.Errorf("failed to clear namespace: %w", err)
+	}
+
+	kept := make([]*api.CacheEntry, 0, len(s.entries))
+	s.byID = make(map[string]int, len(s.entries))
+	for _, e := range s.entries {
+		if e.Namespace != namespace {
+			s.byID[e.ID] = len(kept)
+			kept = append(kept, e)
+		}
+	}
+	s.entries = kept
+	return nil
+}
+
+// DeleteByModel removes all entries for the request model.
+func (s *SQLiteCache) DeleteByModel(ctx context.Context, model string) (int, error) {
+	return s.deleteWhere(ctx, func(e *api.CacheEntry) bool { return e.Request.Model == model })
+}
+
+// DeleteOlderThan removes all entries created before t.
+func (s *SQLiteCache) DeleteOlderThan(ctx context.Context, t time.Time) (int, error) {
+	return s.deleteWhere(ctx, func(e *api.CacheEntry) bool { return e.CreatedAt.Before(t) })
+}
+
+// deleteWhere removes matching entries in a single transaction and returns
+// the number removed.
+func (s *SQLiteCache) deleteWhere(ctx context.Context, match func(*api.CacheEntry) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for _, e := range s.entries {
+		if match(e) {
+			ids = append(ids, e.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM cache_entries WHERE id = ?`, id); err != nil {
+			return 0, fmt.Errorf("failed to delete entries: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	kept := make([]*api.CacheEntry, 0, len(s.entries)-len(ids))
+	s.byID = make(map[string]int, len(s.entries))
+	for _, e := range s.entries {
+		if !match(e) {
+			s.byID[e.ID] = len(kept)
+			kept = append(kept, e)
+		}
+	}
+	s.entries = kept
+	return len(ids), nil
+}
+
+// LoadFromReader stores JSONL entries written by DumpToWriter.
+func (s *SQLiteCache) LoadFromReader(ctx context.Context, r io.Reader) (int, error) {
+	return loadJSONL(ctx, s, r)
+}
+
+// DumpToWriter writes all live entries as JSONL.
+func (s *SQLiteCache) DumpToWriter(ctx context.Context, w io.Writer) error {
+	s.mu.RLock()
+	entries := liveEntries(s.entries, time.Now())
+	s.mu.RUnlock()
+
+	return dumpJSONL(w, entries)
+}
+
+// Entries returns copies of a page of live entries, oldest first.
+func (s *SQLiteCache) Entries(ctx context.Context, offset, limit int) ([]*api.CacheEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return pageEntries(s.entries, time.Now(), offset, limit), nil
+}
+
+// Stats returns cache statistics.
+func (s *SQLiteCache) Stats(ctx context.Context) *api.CacheStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hits := s.hits.Load()
+	exactHits := s.exactHits.Load()
+	misses := s.misses.Load()
+	total := hits + misses
+
+	var hitRate float64
+	if total > 0 {
+		hitRate = float64(hits) / float64(total)
+	}
+
+	return &api.CacheStats{
+		TotalEntries:   int64(len(s.entries)),
+		TotalHits:      hits,
+		ExactHits:      exactHits,
+		SemanticHits:   hits - exactHits,
+		TotalMisses:    misses,
+		HitRate:        hitRate,
+		EstimatedSaved: float64(s.savedMicroUSD.Load()) / 1e6,
+		Evictions:      s.evictions.Load(),
+	}
+}
+
+// StatsByModel returns cache statistics broken down by request model.
+func (s *SQLiteCache) StatsByModel(ctx context.Context) map[string]*api.CacheStats {
+	s.mu.RLock()
+	entries := make(map[string]int64)
+	for _, e := range s.entries {
+		entries[e.Request.Model]++
+	}
+	s.mu.RUnlock()
+
+	return s.byModel.snapshot(entries)
+}
+
+// Cleanup removes expired entries.
+func (s *SQLiteCache) Cleanup(ctx context.Context) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM cache_entries WHERE expires_at <= ?`, now.UnixNano()); err != nil {
+		return 0
+	}
+
+	removed := 0
+	active := make([]*api.CacheEntry, 0, len(s.entries))
+	s.byID = make(map[string]int, len(s.entries))
+	for _, e := range s.entries {
+		if now.Before(e.ExpiresAt) {
+			s.byID[e.ID] = len(active)
+			active = append(active, e)
+		} else {
+			removed++
+		}
+	}
+
+	s.entries = active
+	s.opts.logCleanup(ctx, removed)
+	return removed
+}
+
+// Size returns the number of entries in the cache.
+func (s *SQLiteCache) Size(ctx context.Context) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries)
+}
+
+// cleanupLoop periodically removes expired entries.
+func (s *SQLiteCache) cleanupLoop() {
+	defer s.loops.Done()
+	ticker := time.NewTicker(s.opts.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.Cleanup(context.Background())
+		}
+	}
+}
+
+// Close stops the background goroutines, persists pending statistics and
+// closes the database.
+func (s *SQLiteCache) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.loops.Wait()
+		err = s.flush(context.Background())
+		if closeErr := s.db.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+func newTestSQLiteCache(t *testing.T, path string) *SQLiteCache {
+	t.Helper()
+
+	cache, err := NewSQLiteCache(path, &Options{
+		MaxSize:         100,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		FlushInterval:   time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewSQLiteCache failed: %v", err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+func TestEmbeddingEncoding(t *testing.T) {
+	original := []float64{0.1, -2.5, 3e10, 0}
+
+	decoded, err := decodeEmbedding(encodeEmbedding(original))
+	if err != nil {
+		t.Fatalf("decodeEmbedding failed: %v", err)
+	}
+	if len(decoded) != len(original) {
+		t.Fatalf("expected %d values, got %d", len(original), len(decoded))
+	}
+	for i := range original {
+		if decoded[i] != original[i] {
+			t.Errorf("value %d: expected %f, got %f", i, original[i], decoded[i])
+		}
+	}
+
+	if _, err := decodeEmbedding([]byte{1, 2, 3}); err == nil {
+		t.Error("expected error for truncated embedding")
+	}
+}
+
+func TestSQLiteCacheSetAndGet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	cache := newTestSQLiteCache(t, path)
+	ctx := context.Background()
+
+	embedding := []float64{1, 0, 0}
+	entry := newTestEntry(embedding, time.Hour)
+	if err := cache.Set(ctx, entry); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	result, _, found := cache.Get(ctx, embedding, 0.99)
+	if !found {
+		t.Fatal("expected to find cached entry")
+	}
+	if result.Response.ID != entry.Response.ID {
+		t.Error("returned entry doesn't match stored entry")
+	}
+
+	if _, _, found := cache.Get(ctx, []float64{0, 1, 0}, 0.9); found {
+		t.Error("expected cache miss for dissimilar vector")
+	}
+}
+
+func TestSQLiteCachePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	ctx := context.Background()
+
+	cache := newTestSQLiteCache(t, path)
+	cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour))
+	cache.Get(ctx, []float64{1, 0, 0}, 0.9) // hit
+	cache.Get(ctx, []float64{0, 1, 0}, 0.9) // miss
+	cache.Close()
+
+	reopened := newTestSQLiteCache(t, path)
+	if reopened.Size(ctx) != 1 {
+		t.Fatalf("expected 1 entry after reopen, got %d", reopened.Size(ctx))
+	}
+
+	stats := reopened.Stats(ctx)
+	if stats.TotalHits != 1 || stats.TotalMisses != 1 {
+		t.Errorf("expected persisted hits=1 misses=1, got hits=%d misses=%d", stats.TotalHits, stats.TotalMisses)
+	}
+
+	result, _, found := reopened.Get(ctx, []float64{1, 0, 0}, 0.99)
+	if !found {
+		t.Fatal("expected to find persisted entry")
+	}
+	if result.HitCount != 2 {
+		t.Errorf("expected HitCount=2, got %d", result.HitCount)
+	}
+}
+
+func TestSQLiteCacheCleanup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	cache := newTestSQLiteCache(t, path)
+	ctx := context.Background()
+
+	cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour))
+	cache.Set(ctx, newTestEntry([]float64{0, 1, 0}, -time.Hour)) // Already expired
+
+	if removed := cache.Cleanup(ctx); removed != 1 {
+		t.Errorf("expected 1 removed, got %d", removed)
+	}
+
+	var rows int
+	cache.db.QueryRow(`SELECT COUNT(*) FROM cache_entries`).Scan(&rows)
+	if rows != 1 {
+		t.Errorf("expected 1 row after cleanup, got %d", rows)
+	}
+}
+
+func TestSQLiteCacheFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	cache := newTestSQLiteCache(t, path)
+	ctx := context.Background()
+
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	cache.Set(ctx, entry)
+	cache.Get(ctx, []float64{1, 0, 0}, 0.9) // hit
+	cache.Get(ctx, []float64{0, 1, 0}, 0.9) // miss
+
+	// Hits are written by the flush, not by the lookup
+	var hitCount, hits int64
+	cache.db.QueryRow(`SELECT hit_count FROM cache_entries WHERE id = ?`, entry.ID).Scan(&hitCount)
+	if hitCount != 0 {
+		t.Errorf("expected hit_count=0 before flush, got %d", hitCount)
+	}
+
+	if err := cache.flush(ctx); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	cache.db.QueryRow(`SELECT hit_count FROM cache_entries WHERE id = ?`, entry.ID).Scan(&hitCount)
+	cache.db.QueryRow(`SELECT value FROM cache_counters WHERE name = 'hits'`).Scan(&hits)
+	if hitCount != 1 || hits != 1 {
+		t.Errorf("expected hit_count=1 hits=1 after flush, got hit_count=%d hits=%d", hitCount, hits)
+	}
+
+	// Statistics recorded before Clear are dropped with it
+	cache.Get(ctx, []float64{1, 0, 0}, 0.9)
+	cache.Clear(ctx)
+	if err := cache.flush(ctx); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	var counters int
+	cache.db.QueryRow(`SELECT COUNT(*) FROM cache_counters`).Scan(&counters)
+	if counters != 0 {
+		t.Errorf("expected no counters after Clear, got %d", counters)
+	}
+}
+
+func TestSQLiteCacheReplaceKeepsRowOnFailedInsert(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	cache := newTestSQLiteCache(t, path)
+	ctx := context.Background()
+
+	first := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	if err := cache.Set(ctx, first); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// Make the insert of the replacement fail after the old row's delete
+	if _, err := cache.db.Exec(`CREATE TRIGGER reject_insert BEFORE INSERT ON cache_entries
+		BEGIN SELECT RAISE(ABORT, 'rejected'); END`); err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+	if err := cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour)); err == nil {
+		t.Fatal("expected Set to fail")
+	}
+
+	var rows int
+	cache.db.QueryRow(`SELECT COUNT(*) FROM cache_entries WHERE id = ?`, first.ID).Scan(&rows)
+	if rows != 1 {
+		t.Errorf("expected the replaced row to survive, got %d rows", rows)
+	}
+	if _, ok := cache.GetByID(ctx, first.ID); !ok {
+		t.Error("expected the replaced entry to remain in memory")
+	}
+}
+
+func TestSQLiteCacheNegativeEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	cache := newTestSQLiteCache(t, path)
+	ctx := context.Background()
+
+	good := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	if err := cache.Set(ctx, good); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// A failure of a similar prompt neither replaces nor answers for it
+	other := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	other.Request.Messages = []api.Message{{Role: "user", Content: "test, but longer"}}
+	other.Negative = true
+	other.StatusCode = 400
+	if err := cache.Set(ctx, other); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if result, _, found := cache.Get(ctx, []float64{1, 0, 0}, 0.99); !found || result.Negative {
+		t.Fatalf("expected the response to be found, got %+v", result)
+	}
+	if result, found := cache.GetExact(ctx, &other.Request); !found || !result.Negative {
+		t.Error("expected the failure to be found for its own request")
+	}
+
+	// A failure of the same request is dropped
+	same := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	same.Negative = true
+	if err := cache.Set(ctx, same); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if result, found := cache.GetExact(ctx, &good.Request); !found || result.Negative {
+		t.Errorf("expected the response to be kept, got %+v", result)
+	}
+	if cache.Size(ctx) != 2 {
+		t.Errorf("expected 2 entries, got %d", cache.Size(ctx))
+	}
+}
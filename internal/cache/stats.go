@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// unknownModel labels stats for lookups made without a model in context.
+const unknownModel = "unknown"
+
+type modelContextKey struct{}
+
+// WithModel returns a context carrying the requested model name, used to
+// attribute cache misses in per-model statistics.
+func WithModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelContextKey{}, model)
+}
+
+// modelFromContext returns the model set by WithModel, or unknownModel.
+func modelFromContext(ctx context.Context) string {
+	if model, ok := ctx.Value(modelContextKey{}).(string); ok && model != "" {
+		return model
+	}
+	return unknownModel
+}
+
+// modelCounters holds hit/miss counters for a single model.
+type modelCounters struct {
+	hits     int64
+	misses   int64
+	savedUSD float64
+}
+
+// modelStats tracks counters keyed by model name.
+type modelStats struct {
+	mu     sync.Mutex
+	models map[string]*modelCounters
+}
+
+func (s *modelStats) get(model string) *modelCounters {
+	if model == "" {
+		model = unknownModel
+	}
+	if s.models == nil {
+		s.models = make(map[string]*modelCounters)
+	}
+	c, ok := s.models[model]
+	if !ok {
+		c = &modelCounters{}
+		s.models[model] = c
+	}
+	return c
+}
+
+func (s *modelStats) recordHit(model string, savedUSD float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.get(model)
+	c.hits++
+	c.savedUSD += savedUSD
+}
+
+func (s *modelStats) recordMiss(model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(model).misses++
+}
+
+func (s *modelStats) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.models = nil
+}
+
+// snapshot combines the counters with per-model entry counts.
+func (s *modelStats) snapshot(entries map[string]int64) map[string]*api.CacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string]*api.CacheStats)
+	statsFor := func(model string) *api.CacheStats {
+		st, ok := result[model]
+		if !ok {
+			st = &api.CacheStats{}
+			result[model] = st
+		}
+		return st
+	}
+
+	for model, c := range s.models {
+		st := statsFor(model)
+		st.TotalHits = c.hits
+		st.TotalMisses = c.misses
+		st.EstimatedSaved = c.savedUSD
+		if total := c.hits + c.misses; total > 0 {
+			st.HitRate = float64(c.hits) / float64(total)
+		}
+	}
+	for model, n := range entries {
+		if model == "" {
+			model = unknownModel
+		}
+		statsFor(model).TotalEntries += n
+	}
+
+	return result
+}
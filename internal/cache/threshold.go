@@ -0,0 +1,64 @@
+package cache
+
+import "context"
+
+type inputLengthKey struct{}
+
+// WithInputLength returns a context recording the length, in characters,
+// of the text embedded for a lookup, which Options.LengthAdjustments
+// adjusts the similarity threshold by.
+func WithInputLength(ctx context.Context, chars int) context.Context {
+	return context.WithValue(ctx, inputLengthKey{}, chars)
+}
+
+// inputLength returns the length set by WithInputLength.
+func inputLength(ctx context.Context) (int, bool) {
+	n, ok := ctx.Value(inputLengthKey{}).(int)
+	return n, ok
+}
+
+// LengthAdjustment is a point on the curve of Options.LengthAdjustments:
+// inputs of Chars characters have Delta added to their similarity
+// threshold.
+type LengthAdjustment struct {
+	Chars int
+	Delta float64
+}
+
+// lookupThreshold returns the similarity threshold for a lookup made with
+// ctx: the model's threshold (see modelThreshold) adjusted for the input
+// length, if the context carries one. Under a distance metric the
+// adjustment is reversed, so a positive delta still asks for a closer
+// match.
+func (o *Options) lookupThreshold(ctx context.Context, threshold float64) float64 {
+	threshold = o.modelThreshold(ctx, threshold)
+	n, ok := inputLength(ctx)
+	if !ok || len(o.LengthAdjustments) == 0 {
+		return threshold
+	}
+	delta := o.lengthAdjustment(n)
+	if o.queryMetric(ctx).LowerIsBetter() {
+		return max(threshold-delta, 0)
+	}
+	return min(threshold+delta, 1)
+}
+
+// lengthAdjustment interpolates LengthAdjustments linearly at chars,
+// holding the end points' deltas beyond them.
+func (o *Options) lengthAdjustment(chars int) float64 {
+	points := o.LengthAdjustments
+	if chars <= points[0].Chars {
+		return points[0].Delta
+	}
+	for i := 1; i < len(points); i++ {
+		lo, hi := points[i-1], points[i]
+		if chars <= hi.Chars {
+			if hi.Chars == lo.Chars {
+				return hi.Delta
+			}
+			f := float64(chars-lo.Chars) / float64(hi.Chars-lo.Chars)
+			return lo.Delta + f*(hi.Delta-lo.Delta)
+		}
+	}
+	return points[len(points)-1].Delta
+}
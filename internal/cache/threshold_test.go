@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLookupThreshold(t *testing.T) {
+	opts := &Options{LengthAdjustments: []LengthAdjustment{
+		{Chars: 10, Delta: 0.04},
+		{Chars: 110, Delta: -0.02},
+	}}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected float64
+	}{
+		{"no length", context.Background(), 0.9},
+		{"shorter than the first point", WithInputLength(context.Background(), 2), 0.94},
+		{"between points", WithInputLength(context.Background(), 60), 0.91},
+		{"longer than the last point", WithInputLength(context.Background(), 500), 0.88},
+		{"distance metric", WithMetric(WithInputLength(context.Background(), 2), MetricEuclideanDistance), 0.86},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := opts.lookupThreshold(tt.ctx, 0.9); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	// Capped at 1
+	if got := opts.lookupThreshold(WithInputLength(context.Background(), 1), 0.99); got != 1 {
+		t.Errorf("expected threshold capped at 1, got %v", got)
+	}
+}
+
+func TestMemoryCacheLengthAdjustments(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(&Options{
+		MaxSize:           10,
+		DefaultTTL:        time.Hour,
+		CleanupInterval:   time.Hour,
+		LengthAdjustments: []LengthAdjustment{{Chars: 5, Delta: 0.05}, {Chars: 50, Delta: 0}},
+	})
+	defer cache.Close()
+
+	if err := cache.Set(ctx, newTestEntry([]float64{1, 0}, time.Hour)); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	query := []float64{0.93, math.Sqrt(1 - 0.93*0.93)} // similarity 0.93
+
+	if _, _, found := cache.Get(WithInputLength(ctx, 2), query, 0.9); found {
+		t.Error("expected a short input to need a closer match")
+	}
+	if _, _, found := cache.Get(WithInputLength(ctx, 200), query, 0.9); !found {
+		t.Error("expected a long input to match at the base threshold")
+	}
+	if got := cache.Search(WithInputLength(ctx, 2), query, 0.9, 5); len(got) != 0 {
+		t.Errorf("expected Search to apply the adjustment, got %d results", len(got))
+	}
+}
@@ -0,0 +1,287 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// Ensure TieredCache implements Cache.
+var _ Cache = (*TieredCache)(nil)
+
+// TieredOptions configures a TieredCache.
+type TieredOptions struct {
+	// L1Size is the maximum number of entries in the MemoryCache created
+	// when no L1 is given. Defaults to 1000.
+	L1Size int
+	// Promote decides whether an L2 hit is copied into L1. If nil, every
+	// L2 hit is promoted.
+	Promote func(entry *api.CacheEntry, similarity float64) bool
+}
+
+// TieredCache serves hot entries from a fast L1 cache in front of a larger,
+// slower L2. Writes go through to both tiers; L2 is authoritative, so L1
+// write failures (e.g. ErrCacheFull) are ignored.
+//
+// Stats reports hits from both tiers, misses from L2 (an L1 miss that hits
+// L2 is not a miss overall), and other counts from L2, since L1 holds a
+// subset of it.
+type TieredCache struct {
+	l1   Cache
+	l2   Cache
+	opts *TieredOptions
+}
+
+// NewTieredCache creates a cache with l1 in front of l2. If l1 is nil, a
+// MemoryCache with opts.L1Size entries is used.
+func NewTieredCache(l1, l2 Cache, opts *TieredOptions) *TieredCache {
+	if opts == nil {
+		opts = &TieredOptions{}
+	}
+	if opts.L1Size <= 0 {
+		opts.L1Size = 1000
+	}
+	if l1 == nil {
+		l1Opts := DefaultOptions()
+		l1Opts.MaxSize = opts.L1Size
+		l1 = NewMemoryCache(l1Opts)
+	}
+
+	return &TieredCache{
+		l1:   l1,
+		l2:   l2,
+		opts: opts,
+	}
+}
+
+// Get checks L1, then L2, promoting L2 hits into L1.
+func (t *TieredCache) Get(ctx context.Context, embedding []float64, threshold float64) (*api.CacheEntry, float64, bool) {
+	if entry, sim, found := t.l1.Get(ctx, embedding, threshold); found {
+		return entry, sim, true
+	}
+
+	entry, sim, found := t.l2.Get(ctx, embedding, threshold)
+	if !found {
+		return nil, sim, false
+	}
+	if t.opts.Promote == nil || t.opts.Promote(entry, sim) {
+		t.l1.Set(ctx, copyEntry(entry))
+	}
+	return entry, sim, true
+}
+
+// GetBatch checks L1 for every query, then L2 for those L1 missed,
+// promoting L2 hits into L1.
+func (t *TieredCache) GetBatch(ctx context.Context, embeddings [][]float64, threshold float64) []*SearchResult {
+	results := t.l1.GetBatch(ctx, embeddings, threshold)
+
+	var missed []int
+	var queries [][]float64
+	for i, r := range results {
+		if r == nil {
+			missed = append(missed, i)
+			queries = append(queries, embeddings[i])
+		}
+	}
+	if len(missed) == 0 {
+		return results
+	}
+
+	for j, r := range t.l2.GetBatch(ctx, queries, threshold) {
+		if r == nil {
+			continue
+		}
+		if t.opts.Promote == nil || t.opts.Promote(r.Entry, r.Similarity) {
+			t.l1.Set(ctx, copyEntry(r.Entry))
+		}
+		results[missed[j]] = r
+	}
+	return results
+}
+
+// GetExact checks L1, then L2, promoting L2 hits into L1.
+func (t *TieredCache) GetExact(ctx context.Context, req *api.ChatCompletionRequest) (*api.CacheEntry, bool) {
+	if entry, found := t.l1.GetExact(ctx, req); found {
+		return entry, true
+	}
+
+	entry, found := t.l2.GetExact(ctx, req)
+	if !found {
+		return nil, false
+	}
+	if t.opts.Promote == nil || t.opts.Promote(entry, 1) {
+		t.l1.Set(ctx, copyEntry(entry))
+	}
+	return entry, true
+}
+
+// Search returns results from L2, which holds every entry.
+func (t *TieredCache) Search(ctx context.Context, embedding []float64, threshold float64, k int) []SearchResult {
+	return t.l2.Search(ctx, embedding, threshold, k)
+}
+
+// GetByID retrieves an entry from L1 or, failing that, L2.
+func (t *TieredCache) GetByID(ctx context.Context, id string) (*api.CacheEntry, bool) {
+	if entry, ok := t.l1.GetByID(ctx, id); ok {
+		return entry, true
+	}
+	return t.l2.GetByID(ctx, id)
+}
+
+// Set writes the entry to L2, then to L1.
+func (t *TieredCache) Set(ctx context.Context, entry *api.CacheEntry) error {
+	if err := t.l2.Set(ctx, entry); err != nil {
+		return err
+	}
+	t.l1.Set(ctx, copyEntry(entry))
+	return nil
+}
+
+// Delete removes an entry from both tiers.
+func (t *TieredCache) Delete(ctx context.Context, id string) error {
+	t.l1.Delete(ctx, id)
+	return t.l2.Delete(ctx, id)
+}
+
+// Pin pins the entry in both tiers. L2 is authoritative; an entry missing
+// from L1 is not an error.
+func (t *TieredCache) Pin(ctx context.Context, id string) error {
+	t.l1.Pin(ctx, id)
+	return t.l2.Pin(ctx, id)
+}
+
+// Unpin unpins the entry in both tiers.
+func (t *TieredCache) Unpin(ctx context.Context, id string) error {
+	t.l1.Unpin(ctx, id)
+	return t.l2.Unpin(ctx, id)
+}
+
+// DeleteByEmbedding removes the entry nearly identical to the embedding
+// from both tiers.
+func (t *TieredCache) DeleteByEmbedding(ctx context.Context, embedding []float64) error {
+	t.l1.DeleteByEmbedding(ctx, embedding)
+	return t.l2.DeleteByEmbedding(ctx, embedding)
+}
+
+// Clear removes all entries from both tiers.
+func (t *TieredCache) Clear(ctx context.Context) error {
+	t.l1.Clear(ctx)
+	return t.l2.Clear(ctx)
+}
+
+// ClearNamespace removes a namespace's entries from both tiers.
+func (t *TieredCache) ClearNamespace(ctx context.Context, namespace string) error {
+	t.l1.ClearNamespace(ctx, namespace)
+	return t.l2.ClearNamespace(ctx, namespace)
+}
+
+// DeleteByModel removes the model's entries from both tiers, returning the
+// number removed from L2.
+func (t *TieredCache) DeleteByModel(ctx context.Context, model string) (int, error) {
+	t.l1.DeleteByModel(ctx, model)
+	return t.l2.DeleteByModel(ctx, model)
+}
+
+// DeleteOlderThan removes entries created before ts from both tiers,
+// returning the number removed from L2.
+func (t *TieredCache) DeleteOlderThan(ctx context.Context, ts time.Time) (int, error) {
+	t.l1.DeleteOlderThan(ctx, ts)
+	return t.l2.DeleteOlderThan(ctx, ts)
+}
+
+// LoadFromReader loads entries into L2; L1 fills as they are hit.
+func (t *TieredCache) LoadFromReader(ctx context.Context, r io.Reader) (int, error) {
+	return t.l2.LoadFromReader(ctx, r)
+}
+
+// DumpToWriter writes the entries in L2, which holds every entry.
+func (t *TieredCache) DumpToWriter(ctx context.Context, w io.Writer) error {
+	return t.l2.DumpToWriter(ctx, w)
+}
+
+// Entries pages the entries in L2, which holds every entry.
+func (t *TieredCache) Entries(ctx context.Context, offset, limit int) ([]*api.CacheEntry, error) {
+	return t.l2.Entries(ctx, offset, limit)
+}
+
+// Stats returns statistics merged across both tiers.
+func (t *TieredCache) Stats(ctx context.Context) *api.CacheStats {
+	return mergeTierStats(t.l1.Stats(ctx), t.l2.Stats(ctx))
+}
+
+// StatsByModel returns per-model statistics merged across both tiers.
+func (t *TieredCache) StatsByModel(ctx context.Context) map[string]*api.CacheStats {
+	l1 := t.l1.StatsByModel(ctx)
+	l2 := t.l2.StatsByModel(ctx)
+
+	merged := make(map[string]*api.CacheStats, len(l2))
+	for model, s := range l2 {
+		l1Stats, ok := l1[model]
+		if !ok {
+			l1Stats = &api.CacheStats{}
+		}
+		merged[model] = mergeTierStats(l1Stats, s)
+	}
+	for model, s := range l1 {
+		if _, ok := merged[model]; !ok {
+			merged[model] = mergeTierStats(s, &api.CacheStats{})
+		}
+	}
+	return merged
+}
+
+// mergeTierStats combines L1 and L2 statistics as described on TieredCache.
+func mergeTierStats(l1, l2 *api.CacheStats) *api.CacheStats {
+	hits := l1.TotalHits + l2.TotalHits
+	total := hits + l2.TotalMisses
+
+	var hitRate float64
+	if total > 0 {
+		hitRate = float64(hits) / float64(total)
+	}
+
+	return &api.CacheStats{
+		TotalEntries:        l2.TotalEntries,
+		TotalHits:           hits,
+		ExactHits:           l1.ExactHits + l2.ExactHits,
+		SemanticHits:        l1.SemanticHits + l2.SemanticHits,
+		TotalMisses:         l2.TotalMisses,
+		HitRate:             hitRate,
+		EstimatedSaved:      l1.EstimatedSaved + l2.EstimatedSaved,
+		TotalBytes:          l1.TotalBytes + l2.TotalBytes,
+		Evictions:           l2.Evictions,
+		Merged:              l1.Merged + l2.Merged,
+		DimensionMismatches: l2.DimensionMismatches,
+	}
+}
+
+// Cleanup removes expired entries from both tiers, returning the number
+// removed from L2.
+func (t *TieredCache) Cleanup(ctx context.Context) int {
+	t.l1.Cleanup(ctx)
+	return t.l2.Cleanup(ctx)
+}
+
+// Size returns the number of entries in L2.
+func (t *TieredCache) Size(ctx context.Context) int {
+	return t.l2.Size(ctx)
+}
+
+// Close closes both tiers.
+func (t *TieredCache) Close() error {
+	err := t.l1.Close()
+	if err2 := t.l2.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// copyEntry returns a shallow copy of entry with its own embedding slice,
+// so one tier normalizing or storing it doesn't affect the other.
+func copyEntry(entry *api.CacheEntry) *api.CacheEntry {
+	c := *entry
+	c.Embedding = append([]float64(nil), entry.Embedding...)
+	return &c
+}
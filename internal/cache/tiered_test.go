@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+func newTestTieredCache(t *testing.T, opts *TieredOptions) (*TieredCache, *MemoryCache, *MemoryCache) {
+	t.Helper()
+	l1 := NewMemoryCache(&Options{MaxSize: 2, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	l2 := NewMemoryCache(&Options{MaxSize: 100, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	cache := NewTieredCache(l1, l2, opts)
+	t.Cleanup(func() { cache.Close() })
+	return cache, l1, l2
+}
+
+func TestTieredCacheSetAndGet(t *testing.T) {
+	ctx := context.Background()
+	cache, l1, l2 := newTestTieredCache(t, nil)
+
+	vecs := [][]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for _, v := range vecs {
+		if err := cache.Set(ctx, newTestEntry(v, time.Hour)); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	// Writes go through to both tiers; L1 keeps only the newest
+	if l2.Size(ctx) != 3 || l1.Size(ctx) != 2 {
+		t.Fatalf("expected L1=2 L2=3, got L1=%d L2=%d", l1.Size(ctx), l2.Size(ctx))
+	}
+	if cache.Size(ctx) != 3 {
+		t.Errorf("expected Size to report L2, got %d", cache.Size(ctx))
+	}
+
+	// {1,0,0} was evicted from L1, so it is served from L2 and promoted
+	if _, _, found := l1.Get(ctx, vecs[0], 0.99); found {
+		t.Fatal("expected first entry to be evicted from L1")
+	}
+	if _, _, found := cache.Get(ctx, vecs[0], 0.99); !found {
+		t.Fatal("expected hit from L2")
+	}
+	if _, _, found := l1.Get(ctx, vecs[0], 0.99); !found {
+		t.Error("expected L2 hit to be promoted into L1")
+	}
+
+	if _, _, found := cache.Get(ctx, []float64{1, 1, 1}, 0.99); found {
+		t.Error("expected miss")
+	}
+
+	stats := cache.Stats(ctx)
+	// Hits: L2 hit + direct L1 probe above; misses come from L2 only
+	if stats.TotalHits != 2 || stats.TotalMisses != 1 || stats.TotalEntries != 3 {
+		t.Errorf("unexpected merged stats: %+v", stats)
+	}
+}
+
+func TestTieredCacheGetBatch(t *testing.T) {
+	ctx := context.Background()
+	cache, l1, _ := newTestTieredCache(t, nil)
+
+	vecs := [][]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for _, v := range vecs {
+		cache.Set(ctx, newTestEntry(v, time.Hour))
+	}
+
+	// {1,0,0} is only in L2; the others are in L1
+	results := cache.GetBatch(ctx, [][]float64{vecs[2], {1, 1, 1}, vecs[0]}, 0.99)
+	if results[0] == nil || results[1] != nil || results[2] == nil {
+		t.Fatalf("expected hit, miss, hit, got %v", results)
+	}
+	if results[2].Entry.Embedding[0] != 1 {
+		t.Errorf("expected L2 hit for {1,0,0}, got %v", results[2].Entry.Embedding)
+	}
+	if _, _, found := l1.Get(ctx, vecs[0], 0.99); !found {
+		t.Error("expected L2 hit to be promoted into L1")
+	}
+}
+
+func TestTieredCachePromote(t *testing.T) {
+	ctx := context.Background()
+	cache, l1, _ := newTestTieredCache(t, &TieredOptions{
+		Promote: func(entry *api.CacheEntry, similarity float64) bool { return entry.HitCount >= 2 },
+	})
+
+	for _, v := range [][]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}} {
+		cache.Set(ctx, newTestEntry(v, time.Hour))
+	}
+
+	cache.Get(ctx, []float64{1, 0, 0}, 0.99)
+	if _, ok := l1.GetByID(ctx, mustSearchID(t, cache, []float64{1, 0, 0})); ok {
+		t.Fatal("expected first L2 hit not to be promoted")
+	}
+
+	cache.Get(ctx, []float64{1, 0, 0}, 0.99)
+	if _, ok := l1.GetByID(ctx, mustSearchID(t, cache, []float64{1, 0, 0})); !ok {
+		t.Error("expected second L2 hit to be promoted")
+	}
+}
+
+func TestTieredCacheDelete(t *testing.T) {
+	ctx := context.Background()
+	cache, l1, l2 := newTestTieredCache(t, nil)
+
+	entry := newTestEntry([]float64{1, 0, 0}, time.Hour)
+	cache.Set(ctx, entry)
+
+	if err := cache.Delete(ctx, entry.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if l1.Size(ctx) != 0 || l2.Size(ctx) != 0 {
+		t.Errorf("expected entry removed from both tiers, got L1=%d L2=%d", l1.Size(ctx), l2.Size(ctx))
+	}
+}
+
+func mustSearchID(t *testing.T, c Cache, embedding []float64) string {
+	t.Helper()
+	results := c.Search(context.Background(), embedding, 0.99, 1)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 search result, got %d", len(results))
+	}
+	return results[0].Entry.ID
+}
+
+func TestTieredCacheStatsMerged(t *testing.T) {
+	ctx := context.Background()
+	opts := func() *Options {
+		return &Options{
+			MaxSize:           100,
+			DefaultTTL:        time.Hour,
+			CleanupInterval:   time.Hour,
+			Metric:            MetricCosine,
+			Compaction:        CompactionOptions{Threshold: 0.96},
+			DisableDedupOnSet: true,
+		}
+	}
+	l1, l2 := NewMemoryCache(opts()), NewMemoryCache(opts())
+	cache := NewTieredCache(l1, l2, nil)
+	defer cache.Close()
+
+	for i, v := range [][]float64{{1, 0, 0}, {1, 0.1, 0}, {1, 0.2, 0}} {
+		entry := newTestEntry(v, time.Hour)
+		entry.Request.Messages[0].Content = string(rune('a' + i))
+		if err := l2.Set(ctx, entry); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	if merged := l2.Compact(ctx); merged != 2 {
+		t.Fatalf("expected 2 entries merged in L2, got %d", merged)
+	}
+	if merged := cache.Stats(ctx).Merged; merged != 2 {
+		t.Errorf("expected Stats to report 2 merged, got %d", merged)
+	}
+}
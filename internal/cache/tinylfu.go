@@ -0,0 +1,232 @@
+package cache
+
+import (
+	"container/list"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+// tinyLFUEvictor implements W-TinyLFU (Einziger et al., 2017): new entries
+// enter a small LRU window; when the window overflows, its oldest entry is
+// admitted to the main LRU only if a frequency sketch estimates it is
+// requested more often than the main region's victim. Otherwise the
+// window entry itself is evicted. This keeps one-off scans from flushing
+// popular entries while still letting new entries prove themselves.
+//
+// Frequencies are tracked per quantized embedding, so hits, Sets and the
+// misses preceding a Set all count towards an entry's popularity.
+type tinyLFUEvictor struct {
+	window    *list.List // front = newest
+	main      *list.List // front = most recently used
+	windowCap int
+	sketch    *countMinSketch
+}
+
+// tinyLFUWindowRatio is the share of capacity given to the window.
+const tinyLFUWindowRatio = 0.01
+
+func newTinyLFUEvictor(capacity int) *tinyLFUEvictor {
+	windowCap := int(float64(capacity) * tinyLFUWindowRatio)
+	if windowCap < 1 {
+		windowCap = 1
+	}
+	return &tinyLFUEvictor{
+		window:    list.New(),
+		main:      list.New(),
+		windowCap: windowCap,
+		sketch:    newCountMinSketch(capacity),
+	}
+}
+
+func (e *tinyLFUEvictor) add(me *memoryEntry) {
+	me.sketchKey = sketchKey(me.vector())
+	me.inMain = false
+	e.sketch.increment(me.sketchKey)
+	me.elem = e.window.PushFront(me)
+
+	// Overflow moves to main freely while the cache has room; once full,
+	// victim has already admitted or evicted the window's oldest entry.
+	if e.window.Len() > e.windowCap {
+		e.promote(e.window.Back().Value.(*memoryEntry))
+	}
+}
+
+// promote moves a window entry into the main region.
+func (e *tinyLFUEvictor) promote(me *memoryEntry) {
+	e.window.Remove(me.elem)
+	me.inMain = true
+	me.elem = e.main.PushFront(me)
+}
+
+func (e *tinyLFUEvictor) touch(me *memoryEntry) {
+	e.sketch.increment(me.sketchKey)
+	if me.elem == nil {
+		return
+	}
+	if me.inMain {
+		e.main.MoveToFront(me.elem)
+	} else {
+		e.window.MoveToFront(me.elem)
+	}
+}
+
+func (e *tinyLFUEvictor) remove(me *memoryEntry) {
+	if me.inMain {
+		e.main.Remove(me.elem)
+	} else {
+		e.window.Remove(me.elem)
+	}
+}
+
+// victim runs the admission contest between the window's oldest entry,
+// which the next add would push out of the window, and the main region's
+// least recently used entry. The winner stays; the loser is returned.
+func (e *tinyLFUEvictor) victim(now time.Time) *memoryEntry {
+	if e.window.Len() < e.windowCap {
+		if back := e.main.Back(); back != nil {
+			return back.Value.(*memoryEntry)
+		}
+		if back := e.window.Back(); back != nil {
+			return back.Value.(*memoryEntry)
+		}
+		return nil
+	}
+
+	candidate := e.window.Back().Value.(*memoryEntry)
+	back := e.main.Back()
+	if back == nil {
+		return candidate
+	}
+	victim := back.Value.(*memoryEntry)
+	if e.sketch.estimate(candidate.sketchKey) <= e.sketch.estimate(victim.sketchKey) {
+		return candidate
+	}
+
+	e.promote(candidate)
+	return victim
+}
+
+// victimAmong skips the admission contest and evicts the least recently
+// used eligible entry, from the main region first.
+func (e *tinyLFUEvictor) victimAmong(now time.Time, eligible func(*memoryEntry) bool) *memoryEntry {
+	if me := backmost(e.main, eligible); me != nil {
+		return me
+	}
+	return backmost(e.window, eligible)
+}
+
+func (e *tinyLFUEvictor) reset() {
+	untrackList(e.window)
+	untrackList(e.main)
+	e.sketch.reset()
+}
+
+// recordMiss counts a lookup that found no entry, so an entry later stored
+// for the same query starts with that popularity.
+func (e *tinyLFUEvictor) recordMiss(query []float32) {
+	e.sketch.increment(sketchKey(query))
+}
+
+// sketchKey hashes an embedding quantized after normalization, so the
+// same prompt maps to the same key whether or not it was normalized.
+func sketchKey(vec []float32) uint64 {
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		norm = 1
+	}
+	scale := 64 / math.Sqrt(norm)
+
+	h := fnv.New64a()
+	var buf [2]byte
+	for _, v := range vec {
+		binary.LittleEndian.PutUint16(buf[:], uint16(int16(math.Round(float64(v)*scale))))
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+// countMinSketch estimates key frequencies in fixed memory. Counters are
+// halved after every sampleSize increments so old popularity fades.
+type countMinSketch struct {
+	mu         sync.Mutex
+	rows       [4][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := 16
+	for width < capacity {
+		width <<= 1
+	}
+	s := &countMinSketch{
+		mask:       uint64(width - 1),
+		sampleSize: 10 * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// index returns the counter position for key in row i.
+func (s *countMinSketch) index(key uint64, i int) uint64 {
+	h := key + uint64(i)*(key>>32|1)
+	h ^= h >> 29
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 32
+	return h & s.mask
+}
+
+func (s *countMinSketch) increment(key uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.rows {
+		if c := &s.rows[i][s.index(key, i)]; *c < math.MaxUint8 {
+			*c++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sampleSize {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *countMinSketch) estimate(key uint64) uint8 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	est := uint8(math.MaxUint8)
+	for i := range s.rows {
+		if c := s.rows[i][s.index(key, i)]; c < est {
+			est = c
+		}
+	}
+	return est
+}
+
+func (s *countMinSketch) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = 0
+		}
+	}
+	s.additions = 0
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// simulateHitRate replays a trace of keys against a MemoryCache, setting
+// each key on a miss, and returns the hit rate.
+func simulateHitRate(policy EvictionPolicy, trace []int, vecs map[int][]float64) float64 {
+	ctx := context.Background()
+	cache := NewMemoryCache(&Options{
+		MaxSize:         100,
+		DefaultTTL:      time.Hour,
+		CleanupInterval: time.Hour,
+		EvictionPolicy:  policy,
+	})
+	defer cache.Close()
+
+	hits := 0
+	for _, key := range trace {
+		if _, _, found := cache.Get(ctx, vecs[key], 0.99); found {
+			hits++
+			continue
+		}
+		cache.Set(ctx, newTestEntry(vecs[key], time.Hour))
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+func TestTinyLFUHitRate(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	zipf := rand.NewZipf(rng, 1.1, 1, 999)
+
+	// A Zipfian workload over 1000 keys interrupted by scans of keys that
+	// are requested only once.
+	var trace []int
+	nextScanKey := 1000
+	for len(trace) < 20000 {
+		for i := 0; i < 50; i++ {
+			trace = append(trace, int(zipf.Uint64()))
+		}
+		for i := 0; i < 30; i++ {
+			trace = append(trace, nextScanKey)
+			nextScanKey++
+		}
+	}
+
+	vecs := make(map[int][]float64)
+	for _, key := range trace {
+		if _, ok := vecs[key]; !ok {
+			vecs[key] = randomVectors(rng, 1, 32)[0]
+		}
+	}
+
+	lru := simulateHitRate(EvictLRU, trace, vecs)
+	lfu := simulateHitRate(EvictTinyLFU, trace, vecs)
+	t.Logf("hit rate: lru=%.3f tinylfu=%.3f", lru, lfu)
+
+	if lfu < lru*1.1 {
+		t.Errorf("expected TinyLFU to beat LRU by at least 10%%, got lru=%.3f tinylfu=%.3f", lru, lfu)
+	}
+}
+
+func TestCountMinSketch(t *testing.T) {
+	s := newCountMinSketch(64)
+
+	for i := 0; i < 5; i++ {
+		s.increment(1)
+	}
+	s.increment(2)
+
+	if got := s.estimate(1); got < 5 {
+		t.Errorf("expected estimate >= 5 for key 1, got %d", got)
+	}
+	if got := s.estimate(3); got > 1 {
+		t.Errorf("expected near-zero estimate for unseen key, got %d", got)
+	}
+
+	// Counters halve once sampleSize increments are reached
+	before := s.estimate(1)
+	s.additions = s.sampleSize - 1
+	s.increment(2)
+	if got := s.estimate(1); got != before/2 {
+		t.Errorf("expected key 1 to age from %d to %d, got %d", before, before/2, got)
+	}
+}
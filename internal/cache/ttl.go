@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// ttlFor resolves an entry's TTL: the entry's own TTL, then TTLFunc,
+// then DefaultTTL.
+func (o *Options) ttlFor(entry *api.CacheEntry) time.Duration {
+	if entry.TTL > 0 {
+		return entry.TTL
+	}
+	if o.TTLFunc != nil {
+		if ttl := o.TTLFunc(entry); ttl > 0 {
+			return ttl
+		}
+	}
+	return o.DefaultTTL
+}
+
+// resolveExpiry sets ExpiresAt from the resolved TTL, jittered by
+// TTLJitter, unless the caller already set it explicitly. An entry that was never hit counts as used
+// when created, so least-recently-hit eviction doesn't pick entries that
+// were just stored over older ones.
+func (o *Options) resolveExpiry(entry *api.CacheEntry) {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	if entry.LastHitAt.IsZero() {
+		entry.LastHitAt = entry.CreatedAt
+	}
+	if !entry.ExpiresAt.IsZero() {
+		return
+	}
+	if ttl := o.ttlFor(entry); ttl > 0 {
+		entry.ExpiresAt = entry.CreatedAt.Add(o.jitter(ttl))
+	}
+}
+
+// jitter spreads ttl uniformly within ±TTLJitter of itself, so entries
+// stored together don't all expire at once.
+func (o *Options) jitter(ttl time.Duration) time.Duration {
+	if o.TTLJitter <= 0 {
+		return ttl
+	}
+	f := min(o.TTLJitter, 1)
+	return time.Duration(float64(ttl) * (1 + f*(2*rand.Float64()-1)))
+}
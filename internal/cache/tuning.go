@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// tuningBuckets is the number of histogram buckets over similarities
+// [0, 1], so suggestions have a resolution of 0.01.
+const tuningBuckets = 100
+
+// TuningOptions configures threshold tuning; see MemoryCache.SuggestThreshold.
+type TuningOptions struct {
+	// SampleRate is the fraction of hits whose similarity is recorded.
+	// Zero disables tuning.
+	SampleRate float64
+	// FalseHitTolerance is the acceptable fraction of false hits, i.e.
+	// hits whose response didn't fit the prompt. Defaults to 0.01.
+	FalseHitTolerance float64
+	// MinSamples is the number of feedback reports, or failing that sampled
+	// hits, needed before a suggestion is made. Defaults to 100.
+	MinSamples int
+}
+
+// thresholdTuner keeps histograms of hit similarities and feedback.
+type thresholdTuner struct {
+	opts TuningOptions
+
+	mu        sync.Mutex
+	hits      [tuningBuckets]int64
+	labeled   [tuningBuckets]int64
+	falseHits [tuningBuckets]int64
+	nHits     int64
+	nLabeled  int64
+}
+
+func newThresholdTuner(opts TuningOptions) *thresholdTuner {
+	if opts.FalseHitTolerance <= 0 {
+		opts.FalseHitTolerance = 0.01
+	}
+	if opts.MinSamples <= 0 {
+		opts.MinSamples = 100
+	}
+	return &thresholdTuner{opts: opts}
+}
+
+// tuningBucket returns the histogram bucket of a similarity.
+func tuningBucket(similarity float64) int {
+	b := int(similarity * tuningBuckets)
+	if b < 0 {
+		return 0
+	}
+	if b >= tuningBuckets {
+		return tuningBuckets - 1
+	}
+	return b
+}
+
+// recordHit records a sampled fraction of hit similarities.
+func (t *thresholdTuner) recordHit(similarity float64) {
+	if rand.Float64() >= t.opts.SampleRate {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hits[tuningBucket(similarity)]++
+	t.nHits++
+}
+
+// recordFeedback records whether a hit at the given similarity was false.
+func (t *thresholdTuner) recordFeedback(similarity float64, falseHit bool) {
+	b := tuningBucket(similarity)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.labeled[b]++
+	if falseHit {
+		t.falseHits[b]++
+	}
+	t.nLabeled++
+}
+
+// suggest returns the suggested threshold, or fallback without enough data.
+//
+// With enough feedback, it is the lowest threshold at which the observed
+// false hit rate of the hits kept is within tolerance, maximizing the hit
+// rate. Without feedback, the least similar FalseHitTolerance of sampled
+// hits are assumed to be the false ones, so the threshold is raised just
+// enough to exclude them.
+func (t *thresholdTuner) suggest(fallback float64) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.nLabeled >= int64(t.opts.MinSamples) {
+		var labeled, falseHits int64
+		suggestion := 1.0
+		lowest := -1
+		for b := tuningBuckets - 1; b >= 0; b-- {
+			if t.labeled[b] == 0 {
+				continue
+			}
+			labeled += t.labeled[b]
+			falseHits += t.falseHits[b]
+			if float64(falseHits) <= t.opts.FalseHitTolerance*float64(labeled) {
+				lowest = b
+			}
+		}
+		if lowest >= 0 {
+			suggestion = float64(lowest) / tuningBuckets
+		}
+		return suggestion
+	}
+
+	if t.nHits >= int64(t.opts.MinSamples) {
+		drop := int64(math.Floor(t.opts.FalseHitTolerance * float64(t.nHits)))
+		for b := 0; b < tuningBuckets; b++ {
+			if drop < t.hits[b] {
+				return float64(b) / tuningBuckets
+			}
+			drop -= t.hits[b]
+		}
+	}
+
+	return fallback
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestThresholdTunerSuggest(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   func(tuner *thresholdTuner)
+		expected float64
+	}{
+		{
+			name:     "no data",
+			record:   func(tuner *thresholdTuner) {},
+			expected: 0.9,
+		},
+		{
+			name: "feedback",
+			record: func(tuner *thresholdTuner) {
+				// Hits below 0.95 are often false; above, rarely
+				for i := 0; i < 100; i++ {
+					tuner.recordFeedback(0.97, false)
+					tuner.recordFeedback(0.93, i%2 == 0)
+				}
+			},
+			expected: 0.97,
+		},
+		{
+			name: "feedback within tolerance everywhere",
+			record: func(tuner *thresholdTuner) {
+				for i := 0; i < 100; i++ {
+					tuner.recordFeedback(0.97, false)
+					tuner.recordFeedback(0.91, false)
+				}
+			},
+			expected: 0.91,
+		},
+		{
+			name: "feedback never within tolerance",
+			record: func(tuner *thresholdTuner) {
+				for i := 0; i < 100; i++ {
+					tuner.recordFeedback(0.99, true)
+				}
+			},
+			expected: 1,
+		},
+		{
+			name: "hit distribution only",
+			record: func(tuner *thresholdTuner) {
+				// The least similar 10% of hits are assumed false
+				for i := 0; i < 90; i++ {
+					tuner.recordHit(0.98)
+				}
+				for i := 0; i < 10; i++ {
+					tuner.recordHit(0.92)
+				}
+			},
+			expected: 0.98,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tuner := newThresholdTuner(TuningOptions{SampleRate: 1, FalseHitTolerance: 0.1})
+			tt.record(tuner)
+			if got := tuner.suggest(0.9); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("expected %.2f, got %.2f", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheSuggestThreshold(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(&Options{
+		MaxSize:             100,
+		DefaultTTL:          time.Hour,
+		CleanupInterval:     time.Hour,
+		SimilarityThreshold: 0.8,
+		Tuning:              TuningOptions{SampleRate: 1, MinSamples: 10},
+	})
+	defer cache.Close()
+
+	cache.Set(ctx, newTestEntry([]float64{1, 0, 0}, time.Hour))
+	if got := cache.SuggestThreshold(); got != 0.8 {
+		t.Errorf("expected configured threshold before any hits, got %f", got)
+	}
+
+	for i := 0; i < 10; i++ {
+		_, sim, found := cache.Get(ctx, []float64{1, 0.5, 0}, 0.8)
+		if !found {
+			t.Fatal("expected hit")
+		}
+		cache.RecordFeedback(sim, false)
+	}
+	// cos = 1/sqrt(1.25) ≈ 0.894
+	if got := cache.SuggestThreshold(); math.Abs(got-0.89) > 1e-9 {
+		t.Errorf("expected 0.89, got %f", got)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		disabled := NewMemoryCache(&Options{MaxSize: 10, CleanupInterval: time.Hour, SimilarityThreshold: 0.95})
+		defer disabled.Close()
+		disabled.RecordFeedback(0.5, true)
+		if got := disabled.SuggestThreshold(); got != 0.95 {
+			t.Errorf("expected configured threshold, got %f", got)
+		}
+	})
+}
@@ -2,6 +2,7 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
 	"strconv"
 	"time"
@@ -15,42 +16,121 @@ type Config struct {
 	LogJSON bool   `json:"log_json"`
 
 	// Embedding settings
-	EmbeddingProvider string `json:"embedding_provider"` // "openai" or "ollama"
-	EmbeddingModel    string `json:"embedding_model"`
+	EmbeddingProvider   string   `json:"embedding_provider"` // "openai", "ollama", "cohere" or "tei"
+	EmbeddingModel      string   `json:"embedding_model"`
+	EmbeddingDimensions int      `json:"embedding_dimensions"` // OpenAI v3 models; 0 uses the model default
+	EmbeddingCacheSize  int      `json:"embedding_cache_size"` // memoized prompt embeddings; 0 disables
+	PrecomputeQueue     int      `json:"precompute_queue"`     // misses embedded and stored in the background; 0 stores inline
+	StripPrefixes       []string `json:"strip_prefixes"`       // boilerplate removed from messages before embedding
+	MaxInputChars       int      `json:"max_input_chars"`      // embedding input is truncated to this length; 0 disables
+	InputTruncation     string   `json:"input_truncation"`     // part of long input kept: "tail", "head" or "middle"
+	ConversationInput   string   `json:"conversation_input"`   // messages embedded: "full", "last" or "weighted"
+	TurnDecay           float64  `json:"turn_decay"`           // weight of a message relative to the next under "weighted"
+
+	// Embedder circuit breaker: after BreakerThreshold consecutive
+	// failures, embedding fails fast for BreakerCooldown. A zero
+	// threshold disables the breaker.
+	BreakerThreshold int           `json:"breaker_threshold"`
+	BreakerCooldown  time.Duration `json:"breaker_cooldown"`
+
+	// Bridge for migrating between embedding models of different
+	// dimensions: embeddings of other lengths are projected to
+	// ProjectionDims by ProjectionMethod ("random" or "truncate"), random
+	// projections being drawn from ProjectionSeed. Zero dims disables it.
+	ProjectionDims   int    `json:"projection_dims"`
+	ProjectionMethod string `json:"projection_method"`
+	ProjectionSeed   int64  `json:"projection_seed"`
 
 	// OpenAI settings (when provider is "openai")
 	OpenAIAPIKey  string `json:"openai_api_key"`
 	OpenAIBaseURL string `json:"openai_base_url"`
 
 	// Ollama settings (when provider is "ollama")
-	OllamaBaseURL string `json:"ollama_base_url"`
+	OllamaBaseURL       string `json:"ollama_base_url"`
+	OllamaMaxConcurrent int    `json:"ollama_max_concurrent"` // requests in flight to Ollama; 0 is unlimited
+
+	// Ollama timeouts for connecting, for the response once the request
+	// is sent (the embedding compute) and for the request as a whole; 0
+	// keeps the embedder's defaults
+	OllamaDialTimeout           time.Duration `json:"ollama_dial_timeout"`
+	OllamaResponseHeaderTimeout time.Duration `json:"ollama_response_header_timeout"`
+	OllamaTimeout               time.Duration `json:"ollama_timeout"`
+
+	// Cohere settings (when provider is "cohere")
+	CohereAPIKey  string `json:"cohere_api_key"`
+	CohereBaseURL string `json:"cohere_base_url"`
+
+	// Text-Embeddings-Inference settings (when provider is "tei")
+	TEIBaseURL string `json:"tei_base_url"`
 
 	// Cache settings
 	SimilarityThreshold float64       `json:"similarity_threshold"`
+	HardThreshold       float64       `json:"hard_threshold"`  // 0 disables early exit
+	RiskyThreshold      float64       `json:"risky_threshold"` // hits below it are logged as risky; 0 disables
 	CacheTTL            time.Duration `json:"cache_ttl"`
+	TTLJitter           float64       `json:"ttl_jitter"` // fraction of the TTL by which expiry is randomized either way
 	MaxCacheSize        int           `json:"max_cache_size"`
+	MaxCacheBytes       int64         `json:"max_cache_bytes"`       // 0 disables the byte bound
+	MinCacheTemperature float64       `json:"min_cache_temperature"` // 0 disables
+	RequireSeed         bool          `json:"require_seed"`
+	ShadowMode          bool          `json:"shadow_mode"`        // look up but never serve hits; log how they compare to upstream
+	ToolCallPolicy      string        `json:"tool_call_policy"`   // "cache", "never" or "argument-free"
+	OnEmbedError        string        `json:"on_embed_error"`     // "skip" or "propagate"; requests are forwarded either way
+	NegativeTTL         time.Duration `json:"negative_ttl"`       // 0 disables caching of upstream failures
+	MinAvgLogprob       float64       `json:"min_avg_logprob"`    // responses less confident than this aren't cached; 0 disables
+	LowConfidenceTTL    time.Duration `json:"low_confidence_ttl"` // cache low-confidence responses this long instead of skipping them
+	ScrubPII            bool          `json:"scrub_pii"`          // redact emails, phone and card numbers before caching
+	NamespaceByUser     bool          `json:"namespace_by_user"`  // partition the cache by the request's user field
+	SnapshotPath        string        `json:"snapshot_path"`      // load entries from here on start, save on shutdown
+	PricingFile         string        `json:"pricing_file"`       // JSON model prices overriding the built-in ones
+
+	// StaleWhileRevalidate serves entries this long past expiry while
+	// they are refreshed in the background; 0 disables
+	StaleWhileRevalidate time.Duration `json:"stale_while_revalidate"`
+
+	// Background compaction merges entries at least CompactThreshold
+	// similar to a more-hit one every CompactInterval; 0 disables
+	CompactThreshold float64       `json:"compact_threshold"`
+	CompactInterval  time.Duration `json:"compact_interval"`
 
 	// Metrics settings
-	MetricsEnabled bool `json:"metrics_enabled"`
-	MetricsPort    int  `json:"metrics_port"`
+	MetricsEnabled      bool          `json:"metrics_enabled"`
+	MetricsPort         int           `json:"metrics_port"`
+	StatsStreamInterval time.Duration `json:"stats_stream_interval"` // default push interval of /stats/stream
+
+	// GRPCPort serves the cache over gRPC on this port; 0 disables
+	GRPCPort int `json:"grpc_port"`
+
+	// ReadyRequiresEmbedder fails /readyz while the embedder is
+	// unreachable; otherwise the proxy reports ready and forwards requests
+	// uncached.
+	ReadyRequiresEmbedder bool `json:"ready_requires_embedder"`
 }
 
 // DefaultConfig returns the default configuration.
 func DefaultConfig() *Config {
 	return &Config{
-		Port:              8080,
-		Host:              "0.0.0.0",
-		LogJSON:           false,
-		EmbeddingProvider: "ollama", // default to free local embeddings
-		EmbeddingModel:    "nomic-embed-text",
-		OpenAIAPIKey:      "",
-		OpenAIBaseURL:     "https://api.openai.com/v1",
-		OllamaBaseURL:     "http://localhost:11434",
+		Port:                8080,
+		Host:                "0.0.0.0",
+		LogJSON:             false,
+		EmbeddingProvider:   "ollama", // default to free local embeddings
+		EmbeddingModel:      "nomic-embed-text",
+		EmbeddingCacheSize:  1000,
+		BreakerThreshold:    5,
+		BreakerCooldown:     30 * time.Second,
+		OpenAIAPIKey:        "",
+		OpenAIBaseURL:       "https://api.openai.com/v1",
+		OllamaBaseURL:       "http://localhost:11434",
+		CohereBaseURL:       "https://api.cohere.com",
+		TEIBaseURL:          "http://localhost:8081",
 		SimilarityThreshold: 0.95,
 		CacheTTL:            time.Hour * 24,
 		MaxCacheSize:        10000,
 		MetricsEnabled:      true,
 		MetricsPort:         9090,
+		StatsStreamInterval: 2 * time.Second,
+
+		ReadyRequiresEmbedder: true,
 	}
 }
 
@@ -80,6 +160,80 @@ func LoadFromEnv() *Config {
 		cfg.EmbeddingModel = model
 	}
 
+	if dims := os.Getenv("MIMIR_EMBEDDING_DIMENSIONS"); dims != "" {
+		if d, err := strconv.Atoi(dims); err == nil {
+			cfg.EmbeddingDimensions = d
+		}
+	}
+
+	if size := os.Getenv("MIMIR_EMBEDDING_CACHE_SIZE"); size != "" {
+		if s, err := strconv.Atoi(size); err == nil {
+			cfg.EmbeddingCacheSize = s
+		}
+	}
+
+	if threshold := os.Getenv("MIMIR_BREAKER_THRESHOLD"); threshold != "" {
+		if n, err := strconv.Atoi(threshold); err == nil {
+			cfg.BreakerThreshold = n
+		}
+	}
+
+	if cooldown := os.Getenv("MIMIR_BREAKER_COOLDOWN"); cooldown != "" {
+		if d, err := time.ParseDuration(cooldown); err == nil {
+			cfg.BreakerCooldown = d
+		}
+	}
+
+	if size := os.Getenv("MIMIR_PRECOMPUTE_QUEUE"); size != "" {
+		if s, err := strconv.Atoi(size); err == nil {
+			cfg.PrecomputeQueue = s
+		}
+	}
+
+	if maxChars := os.Getenv("MIMIR_MAX_INPUT_CHARS"); maxChars != "" {
+		if n, err := strconv.Atoi(maxChars); err == nil {
+			cfg.MaxInputChars = n
+		}
+	}
+
+	if truncation := os.Getenv("MIMIR_INPUT_TRUNCATION"); truncation != "" {
+		cfg.InputTruncation = truncation
+	}
+
+	if conversation := os.Getenv("MIMIR_CONVERSATION_INPUT"); conversation != "" {
+		cfg.ConversationInput = conversation
+	}
+
+	if decay := os.Getenv("MIMIR_TURN_DECAY"); decay != "" {
+		if d, err := strconv.ParseFloat(decay, 64); err == nil {
+			cfg.TurnDecay = d
+		}
+	}
+
+	if dims := os.Getenv("MIMIR_PROJECTION_DIMS"); dims != "" {
+		if n, err := strconv.Atoi(dims); err == nil {
+			cfg.ProjectionDims = n
+		}
+	}
+
+	if method := os.Getenv("MIMIR_PROJECTION_METHOD"); method != "" {
+		cfg.ProjectionMethod = method
+	}
+
+	if seed := os.Getenv("MIMIR_PROJECTION_SEED"); seed != "" {
+		if n, err := strconv.ParseInt(seed, 10, 64); err == nil {
+			cfg.ProjectionSeed = n
+		}
+	}
+
+	// A JSON array, so prefixes may contain newlines
+	if prefixes := os.Getenv("MIMIR_STRIP_PREFIXES"); prefixes != "" {
+		var p []string
+		if err := json.Unmarshal([]byte(prefixes), &p); err == nil {
+			cfg.StripPrefixes = p
+		}
+	}
+
 	if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
 		cfg.OpenAIAPIKey = apiKey
 		// Auto-switch to OpenAI if API key is provided
@@ -99,24 +253,169 @@ func LoadFromEnv() *Config {
 		cfg.OllamaBaseURL = ollamaURL
 	}
 
+	if maxConcurrent := os.Getenv("MIMIR_OLLAMA_MAX_CONCURRENT"); maxConcurrent != "" {
+		if n, err := strconv.Atoi(maxConcurrent); err == nil {
+			cfg.OllamaMaxConcurrent = n
+		}
+	}
+
+	if dialTimeout := os.Getenv("MIMIR_OLLAMA_DIAL_TIMEOUT"); dialTimeout != "" {
+		if d, err := time.ParseDuration(dialTimeout); err == nil {
+			cfg.OllamaDialTimeout = d
+		}
+	}
+
+	if headerTimeout := os.Getenv("MIMIR_OLLAMA_RESPONSE_HEADER_TIMEOUT"); headerTimeout != "" {
+		if d, err := time.ParseDuration(headerTimeout); err == nil {
+			cfg.OllamaResponseHeaderTimeout = d
+		}
+	}
+
+	if timeout := os.Getenv("MIMIR_OLLAMA_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil {
+			cfg.OllamaTimeout = d
+		}
+	}
+
+	if apiKey := os.Getenv("COHERE_API_KEY"); apiKey != "" {
+		cfg.CohereAPIKey = apiKey
+	}
+
+	if baseURL := os.Getenv("COHERE_BASE_URL"); baseURL != "" {
+		cfg.CohereBaseURL = baseURL
+	}
+
+	if baseURL := os.Getenv("TEI_BASE_URL"); baseURL != "" {
+		cfg.TEIBaseURL = baseURL
+	}
+
+	// The default model is an Ollama model
+	if os.Getenv("MIMIR_EMBEDDING_MODEL") == "" {
+		switch cfg.EmbeddingProvider {
+		case "cohere":
+			cfg.EmbeddingModel = "embed-english-v3.0"
+		case "tei":
+			// TEI serves whichever model it was started with
+			cfg.EmbeddingModel = ""
+		}
+	}
+
 	if threshold := os.Getenv("MIMIR_SIMILARITY_THRESHOLD"); threshold != "" {
 		if t, err := strconv.ParseFloat(threshold, 64); err == nil {
 			cfg.SimilarityThreshold = t
 		}
 	}
 
+	if threshold := os.Getenv("MIMIR_HARD_THRESHOLD"); threshold != "" {
+		if t, err := strconv.ParseFloat(threshold, 64); err == nil {
+			cfg.HardThreshold = t
+		}
+	}
+
+	if threshold := os.Getenv("MIMIR_RISKY_THRESHOLD"); threshold != "" {
+		if t, err := strconv.ParseFloat(threshold, 64); err == nil {
+			cfg.RiskyThreshold = t
+		}
+	}
+
 	if ttl := os.Getenv("MIMIR_CACHE_TTL"); ttl != "" {
 		if d, err := time.ParseDuration(ttl); err == nil {
 			cfg.CacheTTL = d
 		}
 	}
 
+	if jitter := os.Getenv("MIMIR_TTL_JITTER"); jitter != "" {
+		if f, err := strconv.ParseFloat(jitter, 64); err == nil {
+			cfg.TTLJitter = f
+		}
+	}
+
 	if maxSize := os.Getenv("MIMIR_MAX_CACHE_SIZE"); maxSize != "" {
 		if s, err := strconv.Atoi(maxSize); err == nil {
 			cfg.MaxCacheSize = s
 		}
 	}
 
+	if maxBytes := os.Getenv("MIMIR_MAX_CACHE_BYTES"); maxBytes != "" {
+		if b, err := strconv.ParseInt(maxBytes, 10, 64); err == nil {
+			cfg.MaxCacheBytes = b
+		}
+	}
+
+	if negTTL := os.Getenv("MIMIR_NEGATIVE_TTL"); negTTL != "" {
+		if d, err := time.ParseDuration(negTTL); err == nil {
+			cfg.NegativeTTL = d
+		}
+	}
+
+	if swr := os.Getenv("MIMIR_STALE_WHILE_REVALIDATE"); swr != "" {
+		if d, err := time.ParseDuration(swr); err == nil {
+			cfg.StaleWhileRevalidate = d
+		}
+	}
+
+	if threshold := os.Getenv("MIMIR_COMPACT_THRESHOLD"); threshold != "" {
+		if t, err := strconv.ParseFloat(threshold, 64); err == nil {
+			cfg.CompactThreshold = t
+		}
+	}
+
+	if interval := os.Getenv("MIMIR_COMPACT_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			cfg.CompactInterval = d
+		}
+	}
+
+	if minLogprob := os.Getenv("MIMIR_MIN_AVG_LOGPROB"); minLogprob != "" {
+		if f, err := strconv.ParseFloat(minLogprob, 64); err == nil {
+			cfg.MinAvgLogprob = f
+		}
+	}
+
+	if lowTTL := os.Getenv("MIMIR_LOW_CONFIDENCE_TTL"); lowTTL != "" {
+		if d, err := time.ParseDuration(lowTTL); err == nil {
+			cfg.LowConfidenceTTL = d
+		}
+	}
+
+	if minTemp := os.Getenv("MIMIR_MIN_CACHE_TEMPERATURE"); minTemp != "" {
+		if t, err := strconv.ParseFloat(minTemp, 64); err == nil {
+			cfg.MinCacheTemperature = t
+		}
+	}
+
+	if requireSeed := os.Getenv("MIMIR_REQUIRE_SEED"); requireSeed == "true" {
+		cfg.RequireSeed = true
+	}
+
+	if shadow := os.Getenv("MIMIR_SHADOW_MODE"); shadow == "true" {
+		cfg.ShadowMode = true
+	}
+
+	if toolCalls := os.Getenv("MIMIR_TOOL_CALL_POLICY"); toolCalls != "" {
+		cfg.ToolCallPolicy = toolCalls
+	}
+
+	if onEmbedError := os.Getenv("MIMIR_ON_EMBED_ERROR"); onEmbedError != "" {
+		cfg.OnEmbedError = onEmbedError
+	}
+
+	if scrubPII := os.Getenv("MIMIR_SCRUB_PII"); scrubPII == "true" {
+		cfg.ScrubPII = true
+	}
+
+	if namespaceByUser := os.Getenv("MIMIR_NAMESPACE_BY_USER"); namespaceByUser == "true" {
+		cfg.NamespaceByUser = true
+	}
+
+	if snapshotPath := os.Getenv("MIMIR_SNAPSHOT_PATH"); snapshotPath != "" {
+		cfg.SnapshotPath = snapshotPath
+	}
+
+	if pricingFile := os.Getenv("MIMIR_PRICING_FILE"); pricingFile != "" {
+		cfg.PricingFile = pricingFile
+	}
+
 	if metricsEnabled := os.Getenv("MIMIR_METRICS_ENABLED"); metricsEnabled == "false" {
 		cfg.MetricsEnabled = false
 	}
@@ -127,23 +426,120 @@ func LoadFromEnv() *Config {
 		}
 	}
 
+	if grpcPort := os.Getenv("MIMIR_GRPC_PORT"); grpcPort != "" {
+		if p, err := strconv.Atoi(grpcPort); err == nil {
+			cfg.GRPCPort = p
+		}
+	}
+
+	if interval := os.Getenv("MIMIR_STATS_STREAM_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			cfg.StatsStreamInterval = d
+		}
+	}
+
+	if requireEmbedder := os.Getenv("MIMIR_READY_REQUIRES_EMBEDDER"); requireEmbedder != "" {
+		cfg.ReadyRequiresEmbedder = requireEmbedder == "true"
+	}
+
 	return cfg
 }
 
 // Validate validates the configuration.
 func (c *Config) Validate() error {
-	if c.EmbeddingProvider != "openai" && c.EmbeddingProvider != "ollama" {
-		return &ConfigError{Field: "MIMIR_EMBEDDING_PROVIDER", Message: "must be 'openai' or 'ollama'"}
+	switch c.EmbeddingProvider {
+	case "openai", "ollama", "cohere", "tei":
+	default:
+		return &ConfigError{Field: "MIMIR_EMBEDDING_PROVIDER", Message: "must be 'openai', 'ollama', 'cohere' or 'tei'"}
 	}
 	if c.EmbeddingProvider == "openai" && c.OpenAIAPIKey == "" {
 		return &ConfigError{Field: "OPENAI_API_KEY", Message: "required when using OpenAI provider"}
 	}
+	if c.EmbeddingProvider == "cohere" && c.CohereAPIKey == "" {
+		return &ConfigError{Field: "COHERE_API_KEY", Message: "required when using Cohere provider"}
+	}
 	if c.SimilarityThreshold < 0 || c.SimilarityThreshold > 1 {
 		return &ConfigError{Field: "MIMIR_SIMILARITY_THRESHOLD", Message: "must be between 0 and 1"}
 	}
+	if c.HardThreshold < 0 || c.HardThreshold > 1 {
+		return &ConfigError{Field: "MIMIR_HARD_THRESHOLD", Message: "must be between 0 and 1"}
+	}
+	if c.RiskyThreshold < 0 || c.RiskyThreshold > 1 {
+		return &ConfigError{Field: "MIMIR_RISKY_THRESHOLD", Message: "must be between 0 and 1"}
+	}
 	if c.MaxCacheSize < 1 {
 		return &ConfigError{Field: "MIMIR_MAX_CACHE_SIZE", Message: "must be at least 1"}
 	}
+	if c.TTLJitter < 0 || c.TTLJitter > 1 {
+		return &ConfigError{Field: "MIMIR_TTL_JITTER", Message: "must be between 0 and 1"}
+	}
+	if c.StaleWhileRevalidate < 0 {
+		return &ConfigError{Field: "MIMIR_STALE_WHILE_REVALIDATE", Message: "must not be negative"}
+	}
+	if c.CompactThreshold != 0 && (c.CompactThreshold < c.SimilarityThreshold || c.CompactThreshold > 1) {
+		return &ConfigError{Field: "MIMIR_COMPACT_THRESHOLD", Message: "must be between MIMIR_SIMILARITY_THRESHOLD and 1"}
+	}
+	if c.CompactInterval < 0 {
+		return &ConfigError{Field: "MIMIR_COMPACT_INTERVAL", Message: "must not be negative"}
+	}
+	if c.MinAvgLogprob > 0 {
+		return &ConfigError{Field: "MIMIR_MIN_AVG_LOGPROB", Message: "must not be positive"}
+	}
+	if c.MaxCacheBytes < 0 {
+		return &ConfigError{Field: "MIMIR_MAX_CACHE_BYTES", Message: "must not be negative"}
+	}
+	if c.BreakerThreshold < 0 {
+		return &ConfigError{Field: "MIMIR_BREAKER_THRESHOLD", Message: "must not be negative"}
+	}
+	if c.BreakerThreshold > 0 && c.BreakerCooldown <= 0 {
+		return &ConfigError{Field: "MIMIR_BREAKER_COOLDOWN", Message: "must be positive"}
+	}
+	if c.OllamaMaxConcurrent < 0 {
+		return &ConfigError{Field: "MIMIR_OLLAMA_MAX_CONCURRENT", Message: "must not be negative"}
+	}
+	if c.OllamaDialTimeout < 0 {
+		return &ConfigError{Field: "MIMIR_OLLAMA_DIAL_TIMEOUT", Message: "must not be negative"}
+	}
+	if c.OllamaResponseHeaderTimeout < 0 {
+		return &ConfigError{Field: "MIMIR_OLLAMA_RESPONSE_HEADER_TIMEOUT", Message: "must not be negative"}
+	}
+	if c.OllamaTimeout < 0 {
+		return &ConfigError{Field: "MIMIR_OLLAMA_TIMEOUT", Message: "must not be negative"}
+	}
+	if c.MaxInputChars < 0 {
+		return &ConfigError{Field: "MIMIR_MAX_INPUT_CHARS", Message: "must not be negative"}
+	}
+	switch c.InputTruncation {
+	case "", "tail", "head", "middle":
+	default:
+		return &ConfigError{Field: "MIMIR_INPUT_TRUNCATION", Message: "must be 'tail', 'head' or 'middle'"}
+	}
+	switch c.ConversationInput {
+	case "", "full", "last", "weighted":
+	default:
+		return &ConfigError{Field: "MIMIR_CONVERSATION_INPUT", Message: "must be 'full', 'last' or 'weighted'"}
+	}
+	if c.TurnDecay < 0 || c.TurnDecay > 1 {
+		return &ConfigError{Field: "MIMIR_TURN_DECAY", Message: "must be between 0 and 1"}
+	}
+	if c.ProjectionDims < 0 {
+		return &ConfigError{Field: "MIMIR_PROJECTION_DIMS", Message: "must not be negative"}
+	}
+	switch c.ProjectionMethod {
+	case "", "random", "truncate":
+	default:
+		return &ConfigError{Field: "MIMIR_PROJECTION_METHOD", Message: "must be 'random' or 'truncate'"}
+	}
+	switch c.ToolCallPolicy {
+	case "", "cache", "never", "argument-free":
+	default:
+		return &ConfigError{Field: "MIMIR_TOOL_CALL_POLICY", Message: "must be 'cache', 'never' or 'argument-free'"}
+	}
+	switch c.OnEmbedError {
+	case "", "skip", "propagate":
+	default:
+		return &ConfigError{Field: "MIMIR_ON_EMBED_ERROR", Message: "must be 'skip' or 'propagate'"}
+	}
 	return nil
 }
 
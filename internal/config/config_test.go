@@ -24,6 +24,9 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.OllamaBaseURL != "http://localhost:11434" {
 		t.Errorf("expected OllamaBaseURL=http://localhost:11434, got %s", cfg.OllamaBaseURL)
 	}
+	if cfg.TEIBaseURL != "http://localhost:8081" {
+		t.Errorf("expected TEIBaseURL=http://localhost:8081, got %s", cfg.TEIBaseURL)
+	}
 	if cfg.SimilarityThreshold != 0.95 {
 		t.Errorf("expected SimilarityThreshold=0.95, got %f", cfg.SimilarityThreshold)
 	}
@@ -163,6 +166,15 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid tei config",
+			cfg: &Config{
+				EmbeddingProvider:   "tei",
+				SimilarityThreshold: 0.95,
+				MaxCacheSize:        1000,
+			},
+			wantErr: false,
+		},
 		{
 			name: "invalid provider",
 			cfg: &Config{
@@ -184,6 +196,16 @@ func TestValidate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "OPENAI_API_KEY",
 		},
+		{
+			name: "cohere without api key",
+			cfg: &Config{
+				EmbeddingProvider:   "cohere",
+				SimilarityThreshold: 0.95,
+				MaxCacheSize:        1000,
+			},
+			wantErr: true,
+			errMsg:  "COHERE_API_KEY",
+		},
 		{
 			name: "similarity threshold too high",
 			cfg: &Config{
@@ -204,6 +226,17 @@ func TestValidate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "MIMIR_SIMILARITY_THRESHOLD",
 		},
+		{
+			name: "hard threshold too high",
+			cfg: &Config{
+				EmbeddingProvider:   "ollama",
+				SimilarityThreshold: 0.95,
+				HardThreshold:       1.2,
+				MaxCacheSize:        1000,
+			},
+			wantErr: true,
+			errMsg:  "MIMIR_HARD_THRESHOLD",
+		},
 		{
 			name: "max cache size zero",
 			cfg: &Config{
@@ -214,6 +247,106 @@ func TestValidate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "MIMIR_MAX_CACHE_SIZE",
 		},
+		{
+			name: "unknown tool call policy",
+			cfg: &Config{
+				EmbeddingProvider:   "ollama",
+				SimilarityThreshold: 0.95,
+				MaxCacheSize:        1000,
+				ToolCallPolicy:      "sometimes",
+			},
+			wantErr: true,
+			errMsg:  "MIMIR_TOOL_CALL_POLICY",
+		},
+		{
+			name: "unknown embed error policy",
+			cfg: &Config{
+				EmbeddingProvider:   "ollama",
+				SimilarityThreshold: 0.95,
+				MaxCacheSize:        1000,
+				OnEmbedError:        "retry",
+			},
+			wantErr: true,
+			errMsg:  "MIMIR_ON_EMBED_ERROR",
+		},
+		{
+			name: "negative stale-while-revalidate window",
+			cfg: &Config{
+				EmbeddingProvider:    "ollama",
+				SimilarityThreshold:  0.95,
+				MaxCacheSize:         1000,
+				StaleWhileRevalidate: -time.Minute,
+			},
+			wantErr: true,
+			errMsg:  "MIMIR_STALE_WHILE_REVALIDATE",
+		},
+		{
+			name: "negative Ollama dial timeout",
+			cfg: &Config{
+				EmbeddingProvider:   "ollama",
+				SimilarityThreshold: 0.95,
+				MaxCacheSize:        1000,
+				OllamaDialTimeout:   -time.Second,
+			},
+			wantErr: true,
+			errMsg:  "MIMIR_OLLAMA_DIAL_TIMEOUT",
+		},
+		{
+			name: "compact threshold below similarity threshold",
+			cfg: &Config{
+				EmbeddingProvider:   "ollama",
+				SimilarityThreshold: 0.95,
+				MaxCacheSize:        1000,
+				CompactThreshold:    0.9,
+			},
+			wantErr: true,
+			errMsg:  "MIMIR_COMPACT_THRESHOLD",
+		},
+		{
+			name: "unknown projection method",
+			cfg: &Config{
+				EmbeddingProvider:   "ollama",
+				SimilarityThreshold: 0.95,
+				MaxCacheSize:        1000,
+				ProjectionDims:      384,
+				ProjectionMethod:    "pca",
+			},
+			wantErr: true,
+			errMsg:  "MIMIR_PROJECTION_METHOD",
+		},
+		{
+			name: "unknown input truncation",
+			cfg: &Config{
+				EmbeddingProvider:   "ollama",
+				SimilarityThreshold: 0.95,
+				MaxCacheSize:        1000,
+				InputTruncation:     "sideways",
+			},
+			wantErr: true,
+			errMsg:  "MIMIR_INPUT_TRUNCATION",
+		},
+		{
+			name: "unknown conversation input",
+			cfg: &Config{
+				EmbeddingProvider:   "ollama",
+				SimilarityThreshold: 0.95,
+				MaxCacheSize:        1000,
+				ConversationInput:   "first",
+			},
+			wantErr: true,
+			errMsg:  "MIMIR_CONVERSATION_INPUT",
+		},
+		{
+			name: "breaker without cooldown",
+			cfg: &Config{
+				EmbeddingProvider:   "ollama",
+				SimilarityThreshold: 0.95,
+				MaxCacheSize:        1000,
+				BreakerThreshold:    3,
+			},
+			wantErr: true,
+			errMsg:  "MIMIR_BREAKER_COOLDOWN",
+		},
 	}
 
 	for _, tt := range tests {
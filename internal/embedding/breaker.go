@@ -0,0 +1,234 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Ensure BreakerEmbedder implements Embedder.
+var _ Embedder = (*BreakerEmbedder)(nil)
+
+// ErrCircuitOpen is returned without calling the wrapped embedder while
+// the circuit is open.
+var ErrCircuitOpen = errors.New("embedder circuit open")
+
+// BreakerState is the state of a BreakerEmbedder's circuit.
+type BreakerState int
+
+const (
+	// BreakerClosed passes calls through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails calls fast until the cooldown ends.
+	BreakerOpen
+	// BreakerHalfOpen lets one probe call through; its outcome closes or
+	// reopens the circuit.
+	BreakerHalfOpen
+)
+
+// String returns the state name.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig configures a BreakerEmbedder.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens
+	// the circuit. Defaults to 5.
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before a probe call is
+	// let through. Defaults to 30s.
+	Cooldown time.Duration
+	// OnStateChange, if set, is called when the circuit changes state.
+	// It must not call back into the embedder.
+	OnStateChange func(from, to BreakerState)
+}
+
+// BreakerEmbedder wraps an Embedder with a circuit breaker. After
+// FailureThreshold consecutive failures it fails calls fast with
+// ErrCircuitOpen for Cooldown, instead of every request waiting out a
+// timeout against a provider that is down; then it lets one call through
+// to probe whether the provider is back.
+type BreakerEmbedder struct {
+	inner     Embedder
+	threshold int
+	cooldown  time.Duration
+	onChange  func(from, to BreakerState)
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+}
+
+// NewBreakerEmbedder wraps inner with a circuit breaker.
+func NewBreakerEmbedder(inner Embedder, cfg *BreakerConfig) *BreakerEmbedder {
+	if cfg == nil {
+		cfg = &BreakerConfig{}
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+	return &BreakerEmbedder{
+		inner:     inner,
+		threshold: cfg.FailureThreshold,
+		cooldown:  cfg.Cooldown,
+		onChange:  cfg.OnStateChange,
+		now:       time.Now,
+	}
+}
+
+// Embed embeds text unless the circuit is open.
+func (b *BreakerEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	var embedding []float64
+	err := b.call(ctx, func() error {
+		var err error
+		embedding, err = b.inner.Embed(ctx, text)
+		return err
+	})
+	return embedding, err
+}
+
+// EmbedBatch embeds texts unless the circuit is open.
+func (b *BreakerEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	var embeddings [][]float64
+	err := b.call(ctx, func() error {
+		var err error
+		embeddings, err = b.inner.EmbedBatch(ctx, texts)
+		return err
+	})
+	return embeddings, err
+}
+
+// State returns the circuit's state. An open circuit whose cooldown has
+// ended reports BreakerHalfOpen, since the next call will probe.
+func (b *BreakerEmbedder) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Dimensions returns the wrapped embedder's dimensions.
+func (b *BreakerEmbedder) Dimensions() int {
+	return b.inner.Dimensions()
+}
+
+// Model returns the wrapped embedder's model.
+func (b *BreakerEmbedder) Model() string {
+	return b.inner.Model()
+}
+
+// Unwrap returns the wrapped embedder.
+func (b *BreakerEmbedder) Unwrap() Embedder {
+	return b.inner
+}
+
+// call runs embed if the circuit allows it and records the outcome.
+// Failures caused by the caller's context ending say nothing about the
+// provider and are not counted.
+func (b *BreakerEmbedder) call(ctx context.Context, embed func() error) error {
+	if !b.allow() {
+		return ErrCircuitOpen
+	}
+	err := embed()
+	if err != nil && ctx.Err() != nil {
+		b.release()
+		return err
+	}
+	b.record(err == nil)
+	return err
+}
+
+// allow reports whether a call may proceed, moving an open circuit whose
+// cooldown has ended to half-open for a single probe.
+func (b *BreakerEmbedder) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		return true
+	default:
+		// A probe is already in flight
+		return false
+	}
+}
+
+// release returns an uncounted probe's slot, so the next call probes
+// instead.
+func (b *BreakerEmbedder) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+		b.openedAt = time.Time{}
+	}
+}
+
+// record updates the circuit with a call's outcome.
+func (b *BreakerEmbedder) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ok {
+		b.failures = 0
+		b.setState(BreakerClosed)
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// setState moves the circuit to state, notifying OnStateChange. The
+// caller holds b.mu.
+func (b *BreakerEmbedder) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(from, state)
+	}
+}
+
+// CircuitOpen reports whether e, or an embedder it wraps, is a
+// BreakerEmbedder whose circuit is open, in which case embedding fails
+// fast and callers may skip the cache altogether.
+func CircuitOpen(e Embedder) bool {
+	for e != nil {
+		if b, ok := e.(*BreakerEmbedder); ok {
+			return b.State() == BreakerOpen
+		}
+		u, ok := e.(interface{ Unwrap() Embedder })
+		if !ok {
+			return false
+		}
+		e = u.Unwrap()
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerEmbedder(t *testing.T) {
+	ctx := context.Background()
+	stub := &stubEmbedder{model: "m", err: errors.New("down")}
+	var transitions []string
+	breaker := NewBreakerEmbedder(stub, &BreakerConfig{
+		FailureThreshold: 2,
+		Cooldown:         time.Minute,
+		OnStateChange: func(from, to BreakerState) {
+			transitions = append(transitions, from.String()+">"+to.String())
+		},
+	})
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	// Failures below the threshold pass through
+	for i := 0; i < 2; i++ {
+		if _, err := breaker.Embed(ctx, "x"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("call %d: expected the embedder's error, got %v", i, err)
+		}
+	}
+	if breaker.State() != BreakerOpen || !CircuitOpen(NewCachingEmbedder(breaker, 10)) {
+		t.Fatalf("expected circuit to open, got %s", breaker.State())
+	}
+
+	// Open: fail fast without calling the embedder
+	if _, err := breaker.Embed(ctx, "x"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if stub.calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", stub.calls)
+	}
+
+	// After the cooldown a failed probe reopens the circuit
+	now = now.Add(time.Minute)
+	if breaker.State() != BreakerHalfOpen {
+		t.Fatalf("expected half-open after cooldown, got %s", breaker.State())
+	}
+	if _, err := breaker.Embed(ctx, "x"); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("expected the probe to reach the embedder")
+	}
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("expected failed probe to reopen, got %s", breaker.State())
+	}
+
+	// A successful probe closes it
+	now = now.Add(time.Minute)
+	stub.err = nil
+	if _, err := breaker.EmbedBatch(ctx, []string{"x"}); err != nil {
+		t.Fatalf("expected probe to succeed, got %v", err)
+	}
+	if breaker.State() != BreakerClosed {
+		t.Fatalf("expected circuit to close, got %s", breaker.State())
+	}
+
+	want := []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}
+	if len(transitions) != len(want) {
+		t.Fatalf("expected transitions %v, got %v", want, transitions)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("expected transitions %v, got %v", want, transitions)
+			break
+		}
+	}
+}
+
+func TestBreakerEmbedderIgnoresCancellation(t *testing.T) {
+	breaker := NewBreakerEmbedder(&stubEmbedder{model: "m", block: true}, &BreakerConfig{FailureThreshold: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := breaker.Embed(ctx, "x"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if breaker.State() != BreakerClosed {
+		t.Errorf("expected cancelled calls not to open the circuit, got %s", breaker.State())
+	}
+}
@@ -0,0 +1,217 @@
+package embedding
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Ensure CachingEmbedder implements Embedder.
+var _ Embedder = (*CachingEmbedder)(nil)
+
+// CachingEmbedder memoizes another Embedder's vectors in a bounded LRU
+// keyed by a hash of the input text and input type, so identical prompts
+// skip the call.
+type CachingEmbedder struct {
+	inner   Embedder
+	maxSize int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	lru     *list.List // front = most recently used
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// embeddingItem is a cached vector.
+type embeddingItem struct {
+	key   [sha256.Size]byte
+	vec   []float64
+	model string // model that produced vec
+}
+
+// NewCachingEmbedder wraps inner with an LRU of up to maxSize vectors.
+// A maxSize below 1 defaults to 1000.
+func NewCachingEmbedder(inner Embedder, maxSize int) *CachingEmbedder {
+	if maxSize < 1 {
+		maxSize = 1000
+	}
+	return &CachingEmbedder{
+		inner:   inner,
+		maxSize: maxSize,
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Embed returns the cached vector for text, embedding it on a miss.
+func (e *CachingEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	key := cacheKey(ctx, text)
+	if vec, model, ok := e.lookup(key); ok {
+		reportModel(ctx, model)
+		return vec, nil
+	}
+
+	innerCtx, usedModel := e.withModelReport(ctx)
+	vec, err := e.inner.Embed(innerCtx, text)
+	if err != nil {
+		return nil, err
+	}
+	model := usedModel()
+	reportModel(ctx, model)
+	e.store(key, vec, model)
+	return vec, nil
+}
+
+// EmbedBatch serves cached vectors and embeds the remaining texts in a
+// single call to the wrapped embedder.
+func (e *CachingEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	results := make([][]float64, len(texts))
+	keys := make([][sha256.Size]byte, len(texts))
+
+	// A batch mixing models reports the last one; callers that care
+	// embed one text at a time.
+	var missing []int
+	var missingTexts []string
+	for i, text := range texts {
+		keys[i] = cacheKey(ctx, text)
+		if vec, model, ok := e.lookup(keys[i]); ok {
+			reportModel(ctx, model)
+			results[i] = vec
+			continue
+		}
+		missing = append(missing, i)
+		missingTexts = append(missingTexts, text)
+	}
+	if len(missing) == 0 {
+		return results, nil
+	}
+
+	innerCtx, usedModel := e.withModelReport(ctx)
+	vecs, err := e.inner.EmbedBatch(innerCtx, missingTexts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vecs) != len(missing) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(missing), len(vecs))
+	}
+	model := usedModel()
+	reportModel(ctx, model)
+	for j, i := range missing {
+		e.store(keys[i], vecs[j], model)
+		results[i] = vecs[j]
+	}
+	return results, nil
+}
+
+// cacheKey hashes the text together with the context's input type, since
+// some embedders embed queries and documents differently.
+func cacheKey(ctx context.Context, text string) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(InputTypeFromContext(ctx)))
+	h.Write([]byte{0})
+	h.Write([]byte(text))
+
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key
+}
+
+// withModelReport returns a context reporting the model the wrapped
+// embedder used, which defaults to its Model.
+func (e *CachingEmbedder) withModelReport(ctx context.Context) (context.Context, func() string) {
+	ctx, usedModel := WithModelReport(ctx)
+	return ctx, func() string {
+		if model := usedModel(); model != "" {
+			return model
+		}
+		return e.inner.Model()
+	}
+}
+
+// lookup returns a copy of the cached vector for key and the model that
+// produced it, counting the hit or miss.
+func (e *CachingEmbedder) lookup(key [sha256.Size]byte) ([]float64, string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	elem, ok := e.entries[key]
+	if !ok {
+		e.misses.Add(1)
+		return nil, "", false
+	}
+	e.hits.Add(1)
+	e.lru.MoveToFront(elem)
+	item := elem.Value.(*embeddingItem)
+	return append([]float64(nil), item.vec...), item.model, true
+}
+
+// store caches a copy of vec, evicting the least recently used vector if
+// the cache is full.
+func (e *CachingEmbedder) store(key [sha256.Size]byte, vec []float64, model string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	vec = append([]float64(nil), vec...)
+	if elem, ok := e.entries[key]; ok {
+		item := elem.Value.(*embeddingItem)
+		item.vec, item.model = vec, model
+		e.lru.MoveToFront(elem)
+		return
+	}
+
+	e.entries[key] = e.lru.PushFront(&embeddingItem{key: key, vec: vec, model: model})
+	if e.lru.Len() > e.maxSize {
+		oldest := e.lru.Back()
+		e.lru.Remove(oldest)
+		delete(e.entries, oldest.Value.(*embeddingItem).key)
+	}
+}
+
+// Hits returns the number of inputs served from the cache.
+func (e *CachingEmbedder) Hits() int64 {
+	return e.hits.Load()
+}
+
+// Misses returns the number of inputs passed to the wrapped embedder.
+func (e *CachingEmbedder) Misses() int64 {
+	return e.misses.Load()
+}
+
+// Len returns the number of cached vectors.
+func (e *CachingEmbedder) Len() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lru.Len()
+}
+
+// Dimensions returns the dimensionality of the wrapped embedder.
+func (e *CachingEmbedder) Dimensions() int {
+	return e.inner.Dimensions()
+}
+
+// Model returns the model name of the wrapped embedder.
+func (e *CachingEmbedder) Model() string {
+	return e.inner.Model()
+}
+
+// Unwrap returns the wrapped embedder.
+func (e *CachingEmbedder) Unwrap() Embedder {
+	return e.inner
+}
+
+// Uncached returns e without the CachingEmbedders wrapping it, so calls
+// reach the provider, e.g. to probe whether it is up.
+func Uncached(e Embedder) Embedder {
+	for {
+		c, ok := e.(*CachingEmbedder)
+		if !ok {
+			return e
+		}
+		e = c.inner
+	}
+}
@@ -0,0 +1,119 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// countingEmbedder returns the text length as a one-dimensional vector
+// and counts the texts it embeds.
+type countingEmbedder struct {
+	calls int
+	err   error
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	e.calls++
+	return []float64{float64(len(text))}, nil
+}
+
+func (e *countingEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	out := make([][]float64, len(texts))
+	for i, text := range texts {
+		emb, err := e.Embed(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = emb
+	}
+	return out, nil
+}
+
+func (e *countingEmbedder) Dimensions() int { return 1 }
+
+func (e *countingEmbedder) Model() string { return "counting" }
+
+func TestCachingEmbedderEmbed(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingEmbedder{}
+	embedder := NewCachingEmbedder(inner, 2)
+
+	tests := []struct {
+		text      string
+		wantCalls int
+	}{
+		{"a", 1},
+		{"a", 1},  // hit
+		{"bb", 2}, // miss
+		{"ccc", 3},
+		{"a", 4}, // evicted by "ccc"
+		{"ccc", 4},
+	}
+
+	for _, tt := range tests {
+		emb, err := embedder.Embed(ctx, tt.text)
+		if err != nil {
+			t.Fatalf("Embed(%q) failed: %v", tt.text, err)
+		}
+		if emb[0] != float64(len(tt.text)) {
+			t.Errorf("Embed(%q): expected %d, got %v", tt.text, len(tt.text), emb)
+		}
+		if inner.calls != tt.wantCalls {
+			t.Errorf("Embed(%q): expected %d inner calls, got %d", tt.text, tt.wantCalls, inner.calls)
+		}
+	}
+
+	if embedder.Hits() != 2 || embedder.Misses() != 4 {
+		t.Errorf("expected 2 hits and 4 misses, got %d and %d", embedder.Hits(), embedder.Misses())
+	}
+	if embedder.Len() != 2 {
+		t.Errorf("expected 2 cached vectors, got %d", embedder.Len())
+	}
+
+	// Callers may modify returned vectors without corrupting the cache
+	emb, _ := embedder.Embed(ctx, "ccc")
+	emb[0] = 0
+	if emb, _ := embedder.Embed(ctx, "ccc"); emb[0] != 3 {
+		t.Errorf("expected cached vector to be unaffected, got %v", emb)
+	}
+}
+
+func TestCachingEmbedderEmbedBatch(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingEmbedder{}
+	embedder := NewCachingEmbedder(inner, 10)
+
+	if _, err := embedder.Embed(ctx, "bb"); err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+
+	texts := []string{"a", "bb", "ccc", "a"}
+	embs, err := embedder.EmbedBatch(ctx, texts)
+	if err != nil {
+		t.Fatalf("EmbedBatch failed: %v", err)
+	}
+	for i, emb := range embs {
+		if emb[0] != float64(len(texts[i])) {
+			t.Errorf("embedding %d: expected %d, got %v", i, len(texts[i]), emb)
+		}
+	}
+	if inner.calls != 4 {
+		t.Errorf("expected only uncached texts to be embedded (4 calls), got %d", inner.calls)
+	}
+}
+
+func TestCachingEmbedderError(t *testing.T) {
+	inner := &countingEmbedder{err: errors.New("unavailable")}
+	embedder := NewCachingEmbedder(inner, 10)
+
+	if _, err := embedder.Embed(context.Background(), "a"); err == nil {
+		t.Error("expected error from wrapped embedder")
+	}
+	if embedder.Len() != 0 {
+		t.Errorf("expected failures not to be cached, got %d entries", embedder.Len())
+	}
+}
@@ -0,0 +1,107 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Ensure ChainEmbedder implements Embedder.
+var _ Embedder = (*ChainEmbedder)(nil)
+
+// ChainLink is one embedder in a ChainEmbedder.
+type ChainLink struct {
+	Embedder Embedder
+	// Timeout bounds each call to Embedder; zero means only the caller's
+	// deadline applies.
+	Timeout time.Duration
+}
+
+// ChainEmbedder tries an ordered list of embedders, falling back to the
+// next when one fails or times out, so a flaky primary provider doesn't
+// take the cache down with it.
+//
+// Different models embed into different spaces, so callers should use
+// WithModelReport to learn which model produced a vector and keep it
+// apart from the others in the cache.
+type ChainEmbedder struct {
+	links []ChainLink
+}
+
+// NewChainEmbedder returns an embedder trying links in order. The first
+// link is the primary, whose Model and Dimensions the chain reports.
+func NewChainEmbedder(links ...ChainLink) *ChainEmbedder {
+	return &ChainEmbedder{links: links}
+}
+
+// Embed embeds text with the first embedder that succeeds.
+func (c *ChainEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	var embedding []float64
+	err := c.try(ctx, func(ctx context.Context, e Embedder) error {
+		var err error
+		embedding, err = e.Embed(ctx, text)
+		return err
+	})
+	return embedding, err
+}
+
+// EmbedBatch embeds texts with the first embedder that succeeds, so all
+// embeddings of a batch come from the same model.
+func (c *ChainEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	var embeddings [][]float64
+	err := c.try(ctx, func(ctx context.Context, e Embedder) error {
+		var err error
+		embeddings, err = e.EmbedBatch(ctx, texts)
+		return err
+	})
+	return embeddings, err
+}
+
+// try calls embed with each link in turn until one succeeds, reporting
+// that link's model. It gives up early once ctx is done.
+func (c *ChainEmbedder) try(ctx context.Context, embed func(context.Context, Embedder) error) error {
+	if len(c.links) == 0 {
+		return errors.New("no embedders configured")
+	}
+
+	var errs []error
+	for _, link := range c.links {
+		err := c.call(ctx, link, embed)
+		if err == nil {
+			reportModel(ctx, link.Embedder.Model())
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", link.Embedder.Model(), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return fmt.Errorf("all embedders failed: %w", errors.Join(errs...))
+}
+
+// call runs embed against one link, bounded by its timeout.
+func (c *ChainEmbedder) call(ctx context.Context, link ChainLink, embed func(context.Context, Embedder) error) error {
+	if link.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, link.Timeout)
+		defer cancel()
+	}
+	return embed(ctx, link.Embedder)
+}
+
+// Dimensions returns the dimensionality of the primary embedder.
+func (c *ChainEmbedder) Dimensions() int {
+	if len(c.links) == 0 {
+		return 0
+	}
+	return c.links[0].Embedder.Dimensions()
+}
+
+// Model returns the model name of the primary embedder.
+func (c *ChainEmbedder) Model() string {
+	if len(c.links) == 0 {
+		return ""
+	}
+	return c.links[0].Embedder.Model()
+}
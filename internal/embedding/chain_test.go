@@ -0,0 +1,164 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubEmbedder returns a fixed vector under its model name, optionally
+// failing or blocking until the context is done.
+type stubEmbedder struct {
+	model string
+	err   error
+	block bool
+	calls int
+}
+
+func (e *stubEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	e.calls++
+	if e.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return []float64{float64(len(e.model))}, nil
+}
+
+func (e *stubEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	out := make([][]float64, len(texts))
+	for i, text := range texts {
+		emb, err := e.Embed(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = emb
+	}
+	return out, nil
+}
+
+func (e *stubEmbedder) Dimensions() int { return 1 }
+
+func (e *stubEmbedder) Model() string { return e.model }
+
+func TestChainEmbedder(t *testing.T) {
+	failing := errors.New("unavailable")
+
+	tests := []struct {
+		name      string
+		links     func() []ChainLink
+		wantModel string
+		wantErr   string
+	}{
+		{
+			name: "primary succeeds",
+			links: func() []ChainLink {
+				return []ChainLink{{Embedder: &stubEmbedder{model: "primary"}}, {Embedder: &stubEmbedder{model: "fallback"}}}
+			},
+			wantModel: "primary",
+		},
+		{
+			name: "falls back on error",
+			links: func() []ChainLink {
+				return []ChainLink{{Embedder: &stubEmbedder{model: "primary", err: failing}}, {Embedder: &stubEmbedder{model: "fallback"}}}
+			},
+			wantModel: "fallback",
+		},
+		{
+			name: "falls back on timeout",
+			links: func() []ChainLink {
+				return []ChainLink{
+					{Embedder: &stubEmbedder{model: "primary", block: true}, Timeout: 10 * time.Millisecond},
+					{Embedder: &stubEmbedder{model: "fallback"}},
+				}
+			},
+			wantModel: "fallback",
+		},
+		{
+			name: "all fail",
+			links: func() []ChainLink {
+				return []ChainLink{{Embedder: &stubEmbedder{model: "primary", err: failing}}, {Embedder: &stubEmbedder{model: "fallback", err: failing}}}
+			},
+			wantErr: "all embedders failed",
+		},
+		{
+			name:    "empty",
+			links:   func() []ChainLink { return nil },
+			wantErr: "no embedders configured",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := NewChainEmbedder(tt.links()...)
+
+			ctx, usedModel := WithModelReport(context.Background())
+			emb, err := chain.Embed(ctx, "hello")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Embed failed: %v", err)
+			}
+			if want := float64(len(tt.wantModel)); len(emb) != 1 || emb[0] != want {
+				t.Errorf("expected embedding from %s, got %v", tt.wantModel, emb)
+			}
+			if got := usedModel(); got != tt.wantModel {
+				t.Errorf("expected model %q reported, got %q", tt.wantModel, got)
+			}
+
+			ctx, usedModel = WithModelReport(context.Background())
+			if _, err := chain.EmbedBatch(ctx, []string{"a", "b"}); err != nil {
+				t.Fatalf("EmbedBatch failed: %v", err)
+			}
+			if got := usedModel(); got != tt.wantModel {
+				t.Errorf("expected batch model %q reported, got %q", tt.wantModel, got)
+			}
+		})
+	}
+}
+
+func TestChainEmbedderStopsWhenContextDone(t *testing.T) {
+	primary := &stubEmbedder{model: "primary", block: true}
+	fallback := &stubEmbedder{model: "fallback"}
+	chain := NewChainEmbedder(ChainLink{Embedder: primary}, ChainLink{Embedder: fallback})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := chain.Embed(ctx, "hello"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if fallback.calls != 0 {
+		t.Errorf("expected fallback not to be tried, got %d calls", fallback.calls)
+	}
+}
+
+func TestCachingEmbedderReportsModel(t *testing.T) {
+	primary := &stubEmbedder{model: "primary", err: errors.New("unavailable")}
+	embedder := NewCachingEmbedder(NewChainEmbedder(ChainLink{Embedder: primary}, ChainLink{Embedder: &stubEmbedder{model: "fallback"}}), 10)
+
+	for _, source := range []string{"miss", "hit"} {
+		ctx, usedModel := WithModelReport(context.Background())
+		if _, err := embedder.Embed(ctx, "hello"); err != nil {
+			t.Fatalf("Embed failed: %v", err)
+		}
+		if got := usedModel(); got != "fallback" {
+			t.Errorf("%s: expected fallback reported, got %q", source, got)
+		}
+	}
+
+	ctx, usedModel := WithModelReport(context.Background())
+	if _, err := NewCachingEmbedder(&countingEmbedder{}, 10).Embed(ctx, "hello"); err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	if got := usedModel(); got != "counting" {
+		t.Errorf("expected inner model reported by default, got %q", got)
+	}
+}
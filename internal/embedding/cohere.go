@@ -0,0 +1,178 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Ensure CohereEmbedder implements Embedder.
+var _ Embedder = (*CohereEmbedder)(nil)
+
+// cohereMaxBatch is the most texts the embed API accepts per call.
+const cohereMaxBatch = 96
+
+// CohereEmbedder generates embeddings using the Cohere embed API.
+// The v3+ models embed queries and documents differently; tag calls with
+// WithInputType (queries are the default).
+type CohereEmbedder struct {
+	apiKey     string
+	baseURL    string
+	model      string
+	dimensions int
+	client     *http.Client
+}
+
+// CohereConfig configures the Cohere embedder.
+type CohereConfig struct {
+	APIKey  string
+	BaseURL string
+	Model   string
+	Timeout time.Duration
+}
+
+// cohereRequest is the request body for the Cohere v2 embed API.
+type cohereRequest struct {
+	Model          string   `json:"model"`
+	Texts          []string `json:"texts"`
+	InputType      string   `json:"input_type"`
+	EmbeddingTypes []string `json:"embedding_types"`
+}
+
+// cohereResponse is the response from the Cohere v2 embed API.
+type cohereResponse struct {
+	Embeddings struct {
+		Float [][]float64 `json:"float"`
+	} `json:"embeddings"`
+	Message string `json:"message,omitempty"`
+}
+
+// NewCohereEmbedder creates a new Cohere embedder.
+func NewCohereEmbedder(cfg *CohereConfig) *CohereEmbedder {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "https://api.cohere.com"
+	}
+	if cfg.Model == "" {
+		cfg.Model = "embed-english-v3.0"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+
+	// Dimensions vary by model
+	dimensions := 1024 // default for embed-english-v3.0
+	switch cfg.Model {
+	case "embed-english-light-v3.0", "embed-multilingual-light-v3.0":
+		dimensions = 384
+	case "embed-v4.0":
+		dimensions = 1536
+	}
+
+	return &CohereEmbedder{
+		apiKey:     cfg.APIKey,
+		baseURL:    cfg.BaseURL,
+		model:      cfg.Model,
+		dimensions: dimensions,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+	}
+}
+
+// Embed generates an embedding for the given text.
+func (e *CohereEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	embeddings, err := e.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) == 0 {
+		return nil, fmt.Errorf("no embeddings returned")
+	}
+	return embeddings[0], nil
+}
+
+// EmbedBatch generates embeddings for multiple texts, splitting them into
+// calls of at most 96 texts.
+func (e *CohereEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	inputType := InputTypeFromContext(ctx)
+	results := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += cohereMaxBatch {
+		end := start + cohereMaxBatch
+		if end > len(texts) {
+			end = len(texts)
+		}
+		embeddings, err := e.embed(ctx, texts[start:end], inputType)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, embeddings...)
+	}
+	return results, nil
+}
+
+// embed performs a single embed API call.
+func (e *CohereEmbedder) embed(ctx context.Context, texts []string, inputType InputType) ([][]float64, error) {
+	jsonBody, err := json.Marshal(cohereRequest{
+		Model:          e.model,
+		Texts:          texts,
+		InputType:      string(inputType),
+		EmbeddingTypes: []string{"float"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"/v2/embed", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.apiKey)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var cohereResp cohereResponse
+	if resp.StatusCode != http.StatusOK {
+		if json.Unmarshal(body, &cohereResp) == nil && cohereResp.Message != "" {
+			return nil, fmt.Errorf("API error: %s", cohereResp.Message)
+		}
+		return nil, fmt.Errorf("API error: status %d", resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, &cohereResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(cohereResp.Embeddings.Float) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(cohereResp.Embeddings.Float))
+	}
+
+	return cohereResp.Embeddings.Float, nil
+}
+
+// Dimensions returns the dimensionality of the embeddings.
+func (e *CohereEmbedder) Dimensions() int {
+	return e.dimensions
+}
+
+// Model returns the model name used for embeddings.
+func (e *CohereEmbedder) Model() string {
+	return e.model
+}
@@ -0,0 +1,126 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newCohereServer returns a server answering embed calls with one vector per
+// text, [batch index, position], recording each request.
+func newCohereServer(t *testing.T, requests *[]cohereRequest) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/embed" {
+			t.Errorf("expected /v2/embed, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("expected bearer auth, got %q", r.Header.Get("Authorization"))
+		}
+
+		var req cohereRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		*requests = append(*requests, req)
+
+		var resp cohereResponse
+		for i := range req.Texts {
+			resp.Embeddings.Float = append(resp.Embeddings.Float, []float64{float64(len(*requests) - 1), float64(i)})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestNewCohereEmbedder(t *testing.T) {
+	tests := []struct {
+		model      string
+		dimensions int
+	}{
+		{"", 1024}, // default embed-english-v3.0
+		{"embed-multilingual-v3.0", 1024},
+		{"embed-english-light-v3.0", 384},
+		{"embed-multilingual-light-v3.0", 384},
+		{"embed-v4.0", 1536},
+	}
+
+	for _, tt := range tests {
+		embedder := NewCohereEmbedder(&CohereConfig{APIKey: "test-key", Model: tt.model})
+		if embedder.Dimensions() != tt.dimensions {
+			t.Errorf("model %q: expected dimensions=%d, got %d", tt.model, tt.dimensions, embedder.Dimensions())
+		}
+	}
+}
+
+func TestCohereEmbedderInputType(t *testing.T) {
+	var requests []cohereRequest
+	server := newCohereServer(t, &requests)
+	defer server.Close()
+
+	embedder := NewCohereEmbedder(&CohereConfig{APIKey: "test-key", BaseURL: server.URL})
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"default query", context.Background(), "search_query"},
+		{"document", WithInputType(context.Background(), InputTypeDocument), "search_document"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = nil
+			if _, err := embedder.Embed(tt.ctx, "hello"); err != nil {
+				t.Fatalf("Embed failed: %v", err)
+			}
+			if requests[0].InputType != tt.want {
+				t.Errorf("expected input_type %q, got %q", tt.want, requests[0].InputType)
+			}
+			if requests[0].Model != "embed-english-v3.0" {
+				t.Errorf("expected default model, got %q", requests[0].Model)
+			}
+		})
+	}
+}
+
+func TestCohereEmbedderEmbedBatch(t *testing.T) {
+	var requests []cohereRequest
+	server := newCohereServer(t, &requests)
+	defer server.Close()
+
+	embedder := NewCohereEmbedder(&CohereConfig{APIKey: "test-key", BaseURL: server.URL})
+
+	texts := make([]string, 200)
+	embeddings, err := embedder.EmbedBatch(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("EmbedBatch failed: %v", err)
+	}
+
+	if len(requests) != 3 {
+		t.Fatalf("expected 200 texts split into 3 calls, got %d", len(requests))
+	}
+	if len(embeddings) != 200 {
+		t.Fatalf("expected 200 embeddings, got %d", len(embeddings))
+	}
+	// Text 100 is the 5th text of the second batch
+	if emb := embeddings[100]; emb[0] != 1 || emb[1] != 4 {
+		t.Errorf("expected embeddings in input order, got %v for text 100", emb)
+	}
+}
+
+func TestCohereEmbedderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"message":"invalid model"}`))
+	}))
+	defer server.Close()
+
+	embedder := NewCohereEmbedder(&CohereConfig{APIKey: "test-key", BaseURL: server.URL})
+	_, err := embedder.Embed(context.Background(), "test")
+	if err == nil || err.Error() != "API error: invalid model" {
+		t.Errorf("expected API error message, got %v", err)
+	}
+}
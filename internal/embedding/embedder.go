@@ -17,3 +17,50 @@ type Embedder interface {
 	// Model returns the model name used for embeddings.
 	Model() string
 }
+
+// InputType tells embedders that distinguish them whether text is a
+// lookup query or a stored document.
+type InputType string
+
+const (
+	// InputTypeQuery marks text used to search, e.g. an incoming prompt.
+	InputTypeQuery InputType = "search_query"
+	// InputTypeDocument marks text being stored for later retrieval.
+	InputTypeDocument InputType = "search_document"
+)
+
+type inputTypeKey struct{}
+
+// WithInputType returns a context tagging embed calls with the input type.
+// Embedders that don't distinguish input types ignore it.
+func WithInputType(ctx context.Context, t InputType) context.Context {
+	return context.WithValue(ctx, inputTypeKey{}, t)
+}
+
+// InputTypeFromContext returns the input type set by WithInputType, or
+// InputTypeQuery if none was set.
+func InputTypeFromContext(ctx context.Context) InputType {
+	if t, ok := ctx.Value(inputTypeKey{}).(InputType); ok && t != "" {
+		return t
+	}
+	return InputTypeQuery
+}
+
+type modelReportKey struct{}
+
+// WithModelReport returns a context that records which model produced the
+// embeddings of calls made with it, and a function returning that model.
+// Embedders that fall back between models, like ChainEmbedder, report the
+// one that answered; the function returns "" if none reported.
+func WithModelReport(ctx context.Context) (context.Context, func() string) {
+	var model string
+	return context.WithValue(ctx, modelReportKey{}, &model), func() string { return model }
+}
+
+// reportModel records model as the producer of the context's embeddings,
+// if the context came from WithModelReport.
+func reportModel(ctx context.Context, model string) {
+	if m, ok := ctx.Value(modelReportKey{}).(*string); ok {
+		*m = model
+	}
+}
@@ -0,0 +1,83 @@
+package embedding
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Ensure HashEmbedder implements Embedder.
+var _ Embedder = (*HashEmbedder)(nil)
+
+// HashEmbedder deterministically maps text to a vector by hashing each
+// lowercased word into one of a fixed number of buckets (the "hashing
+// trick"), then normalizing to unit length. Texts sharing words are similar
+// and identical texts are identical, which makes it a hermetic stand-in for
+// a real model in tests. It has no semantic understanding.
+type HashEmbedder struct {
+	dimensions int
+}
+
+// NewHashEmbedder creates a hash embedder producing vectors of the given
+// dimension. A dimension below 1 defaults to 256.
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	if dimensions < 1 {
+		dimensions = 256
+	}
+	return &HashEmbedder{dimensions: dimensions}
+}
+
+// Embed generates an embedding for the given text. Text without words
+// yields the zero vector.
+func (e *HashEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	vec := make([]float64, e.dimensions)
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		h := fnv.New64a()
+		h.Write([]byte(w))
+		sum := h.Sum64()
+
+		// The top bit picks the sign so collisions tend to cancel
+		sign := 1.0
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		vec[sum%uint64(e.dimensions)] += sign
+	}
+
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vec {
+			vec[i] /= norm
+		}
+	}
+	return vec, nil
+}
+
+// EmbedBatch generates embeddings for multiple texts.
+func (e *HashEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	results := make([][]float64, len(texts))
+	for i, text := range texts {
+		results[i], _ = e.Embed(ctx, text)
+	}
+	return results, nil
+}
+
+// Dimensions returns the dimensionality of the embeddings.
+func (e *HashEmbedder) Dimensions() int {
+	return e.dimensions
+}
+
+// Model returns "hash".
+func (e *HashEmbedder) Model() string {
+	return "hash"
+}
@@ -0,0 +1,75 @@
+package embedding
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+func TestHashEmbedder(t *testing.T) {
+	ctx := context.Background()
+	embedder := NewHashEmbedder(512)
+
+	if embedder.Dimensions() != 512 || embedder.Model() != "hash" {
+		t.Errorf("unexpected dimensions=%d model=%s", embedder.Dimensions(), embedder.Model())
+	}
+	if NewHashEmbedder(0).Dimensions() != 256 {
+		t.Error("expected default dimension 256")
+	}
+
+	tests := []struct {
+		name   string
+		a, b   string
+		minSim float64
+		maxSim float64
+	}{
+		{"identical", "What is the capital of France?", "What is the capital of France?", 0.9999, 1.0001},
+		{"case and punctuation", "What is the capital of France?", "what is the capital of france", 0.9999, 1.0001},
+		{"overlapping", "What is the capital of France?", "What is the capital of Spain?", 0.6, 0.99},
+		{"unrelated", "What is the capital of France?", "sort a list in python", -0.3, 0.3},
+		{"empty", "", "anything", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := embedder.Embed(ctx, tt.a)
+			b, _ := embedder.Embed(ctx, tt.b)
+			if len(a) != 512 {
+				t.Fatalf("expected 512 dimensions, got %d", len(a))
+			}
+			if sim := cosine(a, b); sim < tt.minSim || sim > tt.maxSim {
+				t.Errorf("expected similarity in [%.2f, %.2f], got %.4f", tt.minSim, tt.maxSim, sim)
+			}
+		})
+	}
+}
+
+func TestHashEmbedderEmbedBatch(t *testing.T) {
+	ctx := context.Background()
+	embedder := NewHashEmbedder(64)
+
+	texts := []string{"alpha beta", "gamma"}
+	batch, err := embedder.EmbedBatch(ctx, texts)
+	if err != nil {
+		t.Fatalf("EmbedBatch failed: %v", err)
+	}
+	for i, text := range texts {
+		single, _ := embedder.Embed(ctx, text)
+		if cosine(batch[i], single) < 0.9999 {
+			t.Errorf("embedding %d: expected batch to match Embed", i)
+		}
+	}
+}
@@ -6,25 +6,75 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Ensure OllamaEmbedder implements Embedder.
+var _ Embedder = (*OllamaEmbedder)(nil)
+
 // OllamaEmbedder generates embeddings using a local Ollama instance.
+// Dimensions starts from a table of well-known models and is corrected by
+// DetectDimensions or the first embedding returned.
 type OllamaEmbedder struct {
 	baseURL    string
 	model      string
-	dimensions int
+	dimensions atomic.Int64
+	detected   atomic.Bool
 	client     *http.Client
+	workers    int
+	sem        chan struct{} // nil when requests are unlimited
+
+	maxRetries     int
+	retryBaseDelay time.Duration
 }
 
 // OllamaConfig configures the Ollama embedder.
 type OllamaConfig struct {
 	BaseURL string
 	Model   string
+
+	// Timeout bounds each request as a whole, from connecting to reading
+	// the embedding. Defaults to 30s.
 	Timeout time.Duration
+	// DialTimeout bounds connecting to Ollama, so an unreachable instance
+	// fails fast instead of using up Timeout. Defaults to 5s.
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout bounds the wait for Ollama to respond once the
+	// request is sent, which is mostly computing the embedding (and, on
+	// first use, loading the model). Zero leaves it to Timeout.
+	ResponseHeaderTimeout time.Duration
+	// KeepAlive is the interval between TCP keep-alive probes on
+	// connections to Ollama. Defaults to 30s; negative disables them.
+	KeepAlive time.Duration
+
+	// BatchWorkers is the number of concurrent requests EmbedBatch issues.
+	// Defaults to 1 (sequential).
+	BatchWorkers int
+
+	// MaxRetries is the number of retries on connection errors and 5xx
+	// responses, e.g. while Ollama is loading the model. Defaults to 2;
+	// negative disables retries.
+	MaxRetries int
+	// RetryBaseDelay is the initial backoff delay, doubled on each retry.
+	RetryBaseDelay time.Duration
+
+	// MaxConcurrent caps the requests in flight to Ollama across all
+	// callers, including EmbedBatch workers, so a burst of lookups queues
+	// instead of overwhelming Ollama or exhausting file descriptors. Zero
+	// means no limit.
+	MaxConcurrent int
 }
 
+// ollamaIdleConns is the number of idle connections kept to Ollama when
+// MaxConcurrent doesn't set it; the default of 2 churns connections under
+// concurrent lookups.
+const ollamaIdleConns = 16
+
 // ollamaRequest is the request body for Ollama embeddings API.
 type ollamaRequest struct {
 	Model  string `json:"model"`
@@ -36,6 +86,13 @@ type ollamaResponse struct {
 	Embedding []float64 `json:"embedding"`
 }
 
+// ollamaShowResponse is the part of the /api/show response describing the
+// model's architecture, e.g. {"general.architecture": "nomic-bert",
+// "nomic-bert.embedding_length": 768}.
+type ollamaShowResponse struct {
+	ModelInfo map[string]interface{} `json:"model_info"`
+}
+
 // NewOllamaEmbedder creates a new Ollama embedder.
 func NewOllamaEmbedder(cfg *OllamaConfig) *OllamaEmbedder {
 	if cfg.BaseURL == "" {
@@ -47,8 +104,26 @@ func NewOllamaEmbedder(cfg *OllamaConfig) *OllamaEmbedder {
 	if cfg.Timeout == 0 {
 		cfg.Timeout = 30 * time.Second
 	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	if cfg.KeepAlive == 0 {
+		cfg.KeepAlive = 30 * time.Second
+	}
+	if cfg.BatchWorkers <= 0 {
+		cfg.BatchWorkers = 1
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 2
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryBaseDelay == 0 {
+		cfg.RetryBaseDelay = 250 * time.Millisecond
+	}
 
-	// Dimensions vary by model
+	// Dimensions vary by model; used until the real value is detected
 	dimensions := 768 // default for nomic-embed-text
 	switch cfg.Model {
 	case "nomic-embed-text":
@@ -59,17 +134,112 @@ func NewOllamaEmbedder(cfg *OllamaConfig) *OllamaEmbedder {
 		dimensions = 384
 	}
 
-	return &OllamaEmbedder{
-		baseURL:    cfg.BaseURL,
-		model:      cfg.Model,
-		dimensions: dimensions,
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: cfg.KeepAlive}).DialContext
+	transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	transport.MaxIdleConnsPerHost = ollamaIdleConns
+	if cfg.MaxConcurrent > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxConcurrent
+		transport.MaxConnsPerHost = cfg.MaxConcurrent
+	}
+
+	e := &OllamaEmbedder{
+		baseURL: cfg.BaseURL,
+		model:   cfg.Model,
 		client: &http.Client{
-			Timeout: cfg.Timeout,
+			Timeout:   cfg.Timeout,
+			Transport: transport,
 		},
+		workers:        cfg.BatchWorkers,
+		maxRetries:     cfg.MaxRetries,
+		retryBaseDelay: cfg.RetryBaseDelay,
+	}
+	if cfg.MaxConcurrent > 0 {
+		e.sem = make(chan struct{}, cfg.MaxConcurrent)
+		if e.workers > cfg.MaxConcurrent {
+			e.workers = cfg.MaxConcurrent
+		}
+	}
+	e.dimensions.Store(int64(dimensions))
+	return e
+}
+
+// DetectDimensions asks Ollama for the model's embedding length via
+// /api/show, falling back to embedding a probe text, and caches the result
+// for Dimensions. If both fail, the static estimate is kept and the error
+// returned.
+func (e *OllamaEmbedder) DetectDimensions(ctx context.Context) (int, error) {
+	if e.detected.Load() {
+		return e.Dimensions(), nil
+	}
+
+	if dims, err := e.showDimensions(ctx); err == nil {
+		e.setDimensions(dims)
+		return dims, nil
+	}
+
+	if _, err := e.Embed(ctx, "dimension probe"); err != nil {
+		return e.Dimensions(), fmt.Errorf("failed to detect dimensions: %w", err)
+	}
+	return e.Dimensions(), nil
+}
+
+// showDimensions reads the embedding length from the model's metadata.
+func (e *OllamaEmbedder) showDimensions(ctx context.Context) (int, error) {
+	jsonBody, err := json.Marshal(map[string]string{"model": e.model})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"/api/show", bytes.NewReader(jsonBody))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	release, err := e.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Ollama error (status %d)", resp.StatusCode)
+	}
+
+	var show ollamaShowResponse
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	arch, _ := show.ModelInfo["general.architecture"].(string)
+	if length, ok := show.ModelInfo[arch+".embedding_length"].(float64); ok && length > 0 {
+		return int(length), nil
 	}
+	// Fall back to any embedding_length key if the architecture is missing
+	for key, value := range show.ModelInfo {
+		if length, ok := value.(float64); ok && length > 0 && strings.HasSuffix(key, ".embedding_length") {
+			return int(length), nil
+		}
+	}
+	return 0, fmt.Errorf("model info has no embedding length")
+}
+
+// setDimensions records the detected dimension.
+func (e *OllamaEmbedder) setDimensions(dims int) {
+	e.dimensions.Store(int64(dims))
+	e.detected.Store(true)
 }
 
 // Embed generates an embedding for the given text.
+// Connection errors and 5xx responses are retried with exponential backoff,
+// giving up early rather than sleeping past the context deadline.
 func (e *OllamaEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
 	reqBody := ollamaRequest{
 		Model:  e.model,
@@ -81,59 +251,166 @@ func (e *OllamaEmbedder) Embed(ctx context.Context, text string) ([]float64, err
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
+	for attempt := 0; ; attempt++ {
+		emb, retryable, err := e.doRequest(ctx, jsonBody)
+		if err == nil {
+			if !e.detected.Load() {
+				e.setDimensions(len(emb))
+			}
+			return emb, nil
+		}
+		if !retryable || attempt >= e.maxRetries || ctx.Err() != nil {
+			return nil, err
+		}
+
+		delay := e.retryBaseDelay << attempt
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// acquire waits for a request slot under MaxConcurrent. The returned
+// function releases it.
+func (e *OllamaEmbedder) acquire(ctx context.Context) (func(), error) {
+	if e.sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case e.sem <- struct{}{}:
+		return func() { <-e.sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// doRequest performs a single embeddings API call. It reports whether a
+// failure is transient and worth retrying.
+func (e *OllamaEmbedder) doRequest(ctx context.Context, jsonBody []byte) ([]float64, bool, error) {
+	release, err := e.acquire(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+
 	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"/api/embeddings", bytes.NewReader(jsonBody))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, false, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := e.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed (is Ollama running?): %w", err)
+		return nil, true, fmt.Errorf("request failed (is Ollama running?): %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, true, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Ollama error (status %d): %s", resp.StatusCode, string(body))
+		return nil, resp.StatusCode >= 500, fmt.Errorf("Ollama error (status %d): %s", resp.StatusCode, string(body))
 	}
 
 	var ollamaResp ollamaResponse
 	if err := json.Unmarshal(body, &ollamaResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, false, fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	if len(ollamaResp.Embedding) == 0 {
-		return nil, fmt.Errorf("empty embedding returned")
+		return nil, false, fmt.Errorf("empty embedding returned")
 	}
 
-	return ollamaResp.Embedding, nil
+	return ollamaResp.Embedding, false, nil
 }
 
 // EmbedBatch generates embeddings for multiple texts.
-// Ollama doesn't support batch embeddings natively, so we do them sequentially.
+// Ollama doesn't support batch embeddings natively, so we issue one request
+// per text, up to BatchWorkers at a time within MaxConcurrent. It stops
+// early on the first error or when ctx is cancelled.
 func (e *OllamaEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
 	results := make([][]float64, len(texts))
 
-	for i, text := range texts {
-		emb, err := e.Embed(ctx, text)
-		if err != nil {
-			return nil, fmt.Errorf("failed to embed text %d: %w", i, err)
+	if e.workers <= 1 || len(texts) <= 1 {
+		for i, text := range texts {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+			emb, err := e.Embed(ctx, text)
+			if err != nil {
+				return nil, fmt.Errorf("failed to embed text %d: %w", i, err)
+			}
+			results[i] = emb
 		}
-		results[i] = emb
+		return results, nil
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	next := make(chan int)
+
+	workers := e.workers
+	if workers > len(texts) {
+		workers = len(texts)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				emb, err := e.Embed(ctx, texts[i])
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("failed to embed text %d: %w", i, err)
+						cancel()
+					})
+					continue
+				}
+				results[i] = emb
+			}
+		}()
+	}
+
+feed:
+	for i := range texts {
+		select {
+		case <-ctx.Done():
+			break feed
+		case next <- i:
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return results, nil
 }
 
-// Dimensions returns the dimensionality of the embeddings.
+// Dimensions returns the dimensionality of the embeddings: the detected
+// value once known, otherwise an estimate for well-known models.
 func (e *OllamaEmbedder) Dimensions() int {
-	return e.dimensions
+	return int(e.dimensions.Load())
 }
 
 // Model returns the model name used for embeddings.
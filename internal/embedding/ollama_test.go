@@ -3,8 +3,10 @@ package embedding
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -19,8 +21,8 @@ func TestNewOllamaEmbedder(t *testing.T) {
 		if embedder.model != "nomic-embed-text" {
 			t.Errorf("expected default model nomic-embed-text, got %s", embedder.model)
 		}
-		if embedder.dimensions != 768 {
-			t.Errorf("expected dimensions=768 for nomic-embed-text, got %d", embedder.dimensions)
+		if embedder.Dimensions() != 768 {
+			t.Errorf("expected dimensions=768 for nomic-embed-text, got %d", embedder.Dimensions())
 		}
 	})
 
@@ -37,8 +39,8 @@ func TestNewOllamaEmbedder(t *testing.T) {
 		if embedder.model != "mxbai-embed-large" {
 			t.Errorf("expected model mxbai-embed-large, got %s", embedder.model)
 		}
-		if embedder.dimensions != 1024 {
-			t.Errorf("expected dimensions=1024 for mxbai-embed-large, got %d", embedder.dimensions)
+		if embedder.Dimensions() != 1024 {
+			t.Errorf("expected dimensions=1024 for mxbai-embed-large, got %d", embedder.Dimensions())
 		}
 	})
 
@@ -55,8 +57,8 @@ func TestNewOllamaEmbedder(t *testing.T) {
 
 		for _, tt := range tests {
 			embedder := NewOllamaEmbedder(&OllamaConfig{Model: tt.model})
-			if embedder.dimensions != tt.dimensions {
-				t.Errorf("model %s: expected dimensions=%d, got %d", tt.model, tt.dimensions, embedder.dimensions)
+			if embedder.Dimensions() != tt.dimensions {
+				t.Errorf("model %s: expected dimensions=%d, got %d", tt.model, tt.dimensions, embedder.Dimensions())
 			}
 		}
 	})
@@ -166,6 +168,138 @@ func TestOllamaEmbedderEmbed(t *testing.T) {
 	})
 }
 
+func TestOllamaEmbedderRetry(t *testing.T) {
+	t.Run("retries on 5xx", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls < 3 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(ollamaResponse{Embedding: []float64{0.1, 0.2}})
+		}))
+		defer server.Close()
+
+		embedder := NewOllamaEmbedder(&OllamaConfig{
+			BaseURL:        server.URL,
+			RetryBaseDelay: time.Millisecond,
+		})
+
+		if _, err := embedder.Embed(context.Background(), "test"); err != nil {
+			t.Fatalf("Embed failed: %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 calls, got %d", calls)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		embedder := NewOllamaEmbedder(&OllamaConfig{
+			BaseURL:        server.URL,
+			MaxRetries:     3,
+			RetryBaseDelay: time.Millisecond,
+		})
+
+		if _, err := embedder.Embed(context.Background(), "test"); err == nil {
+			t.Error("expected error after exhausting retries")
+		}
+		if calls != 4 {
+			t.Errorf("expected 4 calls (1 + 3 retries), got %d", calls)
+		}
+	})
+
+	t.Run("does not retry 4xx", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		embedder := NewOllamaEmbedder(&OllamaConfig{
+			BaseURL:        server.URL,
+			RetryBaseDelay: time.Millisecond,
+		})
+
+		if _, err := embedder.Embed(context.Background(), "test"); err == nil {
+			t.Error("expected error on not found")
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	})
+
+	t.Run("stops at context deadline", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		embedder := NewOllamaEmbedder(&OllamaConfig{
+			BaseURL:        server.URL,
+			MaxRetries:     5,
+			RetryBaseDelay: time.Second,
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if _, err := embedder.Embed(ctx, "test"); err == nil {
+			t.Error("expected error")
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("expected retries to respect the deadline, took %v", elapsed)
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	})
+}
+
+func TestOllamaEmbedderTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		json.NewEncoder(w).Encode(ollamaResponse{Embedding: []float64{1}})
+	}))
+	defer server.Close()
+	defer close(release)
+
+	embedder := NewOllamaEmbedder(&OllamaConfig{
+		BaseURL:    server.URL,
+		MaxRetries: -1,
+
+		Timeout:               time.Minute,
+		ResponseHeaderTimeout: 50 * time.Millisecond,
+	})
+
+	transport := embedder.client.Transport.(*http.Transport)
+	if embedder.client.Timeout != time.Minute || transport.ResponseHeaderTimeout != 50*time.Millisecond {
+		t.Errorf("expected overall timeout 1m and response header timeout 50ms, got %v and %v",
+			embedder.client.Timeout, transport.ResponseHeaderTimeout)
+	}
+
+	// A slow response fails on the header timeout, well before the overall one
+	start := time.Now()
+	if _, err := embedder.Embed(context.Background(), "slow"); err == nil {
+		t.Fatal("expected error when Ollama doesn't respond in time")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the response header timeout to apply, took %v", elapsed)
+	}
+}
+
 func TestOllamaEmbedderEmbedBatch(t *testing.T) {
 	callCount := 0
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -199,6 +333,64 @@ func TestOllamaEmbedderEmbedBatch(t *testing.T) {
 	}
 }
 
+func TestOllamaEmbedderEmbedBatchCancellation(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+	}{
+		{"sequential", 1},
+		{"concurrent", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) == 2 {
+					cancel()
+				}
+				json.NewEncoder(w).Encode(ollamaResponse{Embedding: []float64{0.1, 0.2}})
+			}))
+			defer server.Close()
+
+			embedder := NewOllamaEmbedder(&OllamaConfig{BaseURL: server.URL, BatchWorkers: tt.workers})
+			_, err := embedder.EmbedBatch(ctx, make([]string, 500))
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("expected context.Canceled, got %v", err)
+			}
+			if n := atomic.LoadInt32(&calls); n > int32(2+tt.workers) {
+				t.Errorf("expected batch to stop promptly, got %d calls", n)
+			}
+		})
+	}
+}
+
+func TestOllamaEmbedderEmbedBatchConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		resp := ollamaResponse{Embedding: []float64{float64(len(req.Prompt))}}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	embedder := NewOllamaEmbedder(&OllamaConfig{BaseURL: server.URL, BatchWorkers: 3})
+
+	texts := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	embeddings, err := embedder.EmbedBatch(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("EmbedBatch failed: %v", err)
+	}
+	for i, emb := range embeddings {
+		if emb[0] != float64(len(texts[i])) {
+			t.Errorf("embedding %d: expected results in input order, got %v", i, emb)
+		}
+	}
+}
+
 func TestOllamaEmbedderMethods(t *testing.T) {
 	embedder := NewOllamaEmbedder(&OllamaConfig{
 		Model: "all-minilm",
@@ -212,3 +404,148 @@ func TestOllamaEmbedderMethods(t *testing.T) {
 		t.Errorf("expected Dimensions()=384, got %d", embedder.Dimensions())
 	}
 }
+
+func TestOllamaEmbedderDetectDimensions(t *testing.T) {
+	tests := []struct {
+		name      string
+		show      func(w http.ResponseWriter)
+		embedding []float64
+		want      int
+		wantErr   bool
+	}{
+		{
+			name: "from model info",
+			show: func(w http.ResponseWriter) {
+				w.Write([]byte(`{"model_info":{"general.architecture":"bert","bert.embedding_length":1536}}`))
+			},
+			want: 1536,
+		},
+		{
+			name: "probe embed when show fails",
+			show: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			embedding: []float64{0.1, 0.2, 0.3},
+			want:      3,
+		},
+		{
+			name: "probe embed when model info lacks length",
+			show: func(w http.ResponseWriter) {
+				w.Write([]byte(`{"model_info":{"general.architecture":"bert"}}`))
+			},
+			embedding: []float64{0.1, 0.2},
+			want:      2,
+		},
+		{
+			name: "static estimate when both fail",
+			show: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			want:    768,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/show":
+					tt.show(w)
+				case "/api/embeddings":
+					if tt.embedding == nil {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					json.NewEncoder(w).Encode(ollamaResponse{Embedding: tt.embedding})
+				}
+			}))
+			defer server.Close()
+
+			embedder := NewOllamaEmbedder(&OllamaConfig{BaseURL: server.URL, Model: "custom-model"})
+			dims, err := embedder.DetectDimensions(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if dims != tt.want || embedder.Dimensions() != tt.want {
+				t.Errorf("expected dimensions=%d, got %d (Dimensions()=%d)", tt.want, dims, embedder.Dimensions())
+			}
+		})
+	}
+
+	t.Run("first embedding corrects estimate", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(ollamaResponse{Embedding: make([]float64, 4096)})
+		}))
+		defer server.Close()
+
+		embedder := NewOllamaEmbedder(&OllamaConfig{BaseURL: server.URL, Model: "custom-model"})
+		if _, err := embedder.Embed(context.Background(), "hello"); err != nil {
+			t.Fatalf("Embed failed: %v", err)
+		}
+		if embedder.Dimensions() != 4096 {
+			t.Errorf("expected dimensions=4096, got %d", embedder.Dimensions())
+		}
+	})
+}
+
+func TestOllamaEmbedderMaxConcurrent(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		json.NewEncoder(w).Encode(ollamaResponse{Embedding: []float64{1}})
+	}))
+	defer server.Close()
+
+	embedder := NewOllamaEmbedder(&OllamaConfig{BaseURL: server.URL, BatchWorkers: 8, MaxConcurrent: 2})
+
+	// Concurrent batches and single lookups share the limit
+	done := make(chan error, 3)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := embedder.EmbedBatch(context.Background(), []string{"a", "b", "c", "d"})
+			done <- err
+		}()
+	}
+	go func() {
+		_, err := embedder.Embed(context.Background(), "e")
+		done <- err
+	}()
+	for i := 0; i < 3; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("embedding failed: %v", err)
+		}
+	}
+
+	if p := peak.Load(); p > 2 {
+		t.Errorf("expected at most 2 requests in flight, got %d", p)
+	}
+}
+
+func TestOllamaEmbedderMaxConcurrentCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		json.NewEncoder(w).Encode(ollamaResponse{Embedding: []float64{1}})
+	}))
+	defer server.Close()
+	defer close(release)
+
+	embedder := NewOllamaEmbedder(&OllamaConfig{BaseURL: server.URL, MaxConcurrent: 1})
+	go embedder.Embed(context.Background(), "holds the only slot")
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := embedder.Embed(ctx, "waits"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded while waiting for a slot, got %v", err)
+	}
+}
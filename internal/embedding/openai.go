@@ -7,26 +7,47 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aqstack/mimir/pkg/api"
 )
 
+// Ensure OpenAIEmbedder implements Embedder.
+var _ Embedder = (*OpenAIEmbedder)(nil)
+
 // OpenAIEmbedder generates embeddings using the OpenAI API.
 type OpenAIEmbedder struct {
 	apiKey     string
 	baseURL    string
 	model      string
 	dimensions int
-	client     *http.Client
+	// requestDimensions is sent as the "dimensions" field for models that
+	// support shortened embeddings (text-embedding-3-*). Zero omits it.
+	requestDimensions int
+	maxRetries        int
+	retryBaseDelay    time.Duration
+	client            *http.Client
 }
 
 // OpenAIConfig configures the OpenAI embedder.
 type OpenAIConfig struct {
-	APIKey   string
-	BaseURL  string
-	Model    string
-	Timeout  time.Duration
+	APIKey  string
+	BaseURL string
+	Model   string
+	Timeout time.Duration
+
+	// Dimensions requests shortened embeddings from the v3 models.
+	// Ignored for models that don't support it (e.g. ada-002).
+	Dimensions int
+
+	// MaxRetries is the number of retries on 429 rate-limit responses.
+	// Defaults to 3; negative disables retries.
+	MaxRetries int
+	// RetryBaseDelay is the initial backoff delay, doubled on each retry.
+	// A Retry-After header from the API takes precedence.
+	RetryBaseDelay time.Duration
 }
 
 // NewOpenAIEmbedder creates a new OpenAI embedder.
@@ -40,6 +61,15 @@ func NewOpenAIEmbedder(cfg *OpenAIConfig) *OpenAIEmbedder {
 	if cfg.Timeout == 0 {
 		cfg.Timeout = 30 * time.Second
 	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryBaseDelay == 0 {
+		cfg.RetryBaseDelay = 500 * time.Millisecond
+	}
 
 	// Determine dimensions based on model
 	dimensions := 1536 // default for text-embedding-3-small
@@ -50,11 +80,21 @@ func NewOpenAIEmbedder(cfg *OpenAIConfig) *OpenAIEmbedder {
 		dimensions = 1536
 	}
 
+	// Only the v3 models accept a custom output dimension
+	var requestDimensions int
+	if cfg.Dimensions > 0 && strings.HasPrefix(cfg.Model, "text-embedding-3") {
+		requestDimensions = cfg.Dimensions
+		dimensions = cfg.Dimensions
+	}
+
 	return &OpenAIEmbedder{
-		apiKey:     cfg.APIKey,
-		baseURL:    cfg.BaseURL,
-		model:      cfg.Model,
-		dimensions: dimensions,
+		apiKey:            cfg.APIKey,
+		baseURL:           cfg.BaseURL,
+		model:             cfg.Model,
+		dimensions:        dimensions,
+		requestDimensions: requestDimensions,
+		maxRetries:        cfg.MaxRetries,
+		retryBaseDelay:    cfg.RetryBaseDelay,
 		client: &http.Client{
 			Timeout: cfg.Timeout,
 		},
@@ -83,15 +123,69 @@ func (e *OpenAIEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]fl
 		Input: texts,
 		Model: e.model,
 	}
+	if e.requestDimensions > 0 {
+		dims := e.requestDimensions
+		reqBody.Dimensions = &dims
+	}
 
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
+	var body []byte
+	for attempt := 0; ; attempt++ {
+		var retryAfter time.Duration
+		var status int
+		status, retryAfter, body, err = e.doRequest(ctx, jsonBody)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusTooManyRequests || attempt >= e.maxRetries {
+			if status != http.StatusOK {
+				var errResp api.ErrorResponse
+				if json.Unmarshal(body, &errResp) == nil && errResp.Error.Message != "" {
+					return nil, fmt.Errorf("API error: %s", errResp.Error.Message)
+				}
+				return nil, fmt.Errorf("API error: status %d", status)
+			}
+			break
+		}
+
+		// Rate limited: back off before retrying
+		delay := e.retryBaseDelay << attempt
+		if retryAfter > 0 {
+			delay = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	var embResp api.EmbeddingResponse
+	if err := json.Unmarshal(body, &embResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	result := make([][]float64, len(embResp.Data))
+	for _, d := range embResp.Data {
+		if d.Index < 0 || d.Index >= len(result) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		result[d.Index] = d.Embedding
+	}
+
+	return result, nil
+}
+
+// doRequest performs a single embeddings API call, returning the status code,
+// any Retry-After delay, and the response body.
+func (e *OpenAIEmbedder) doRequest(ctx context.Context, jsonBody []byte) (int, time.Duration, []byte, error) {
 	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"/embeddings", bytes.NewReader(jsonBody))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return 0, 0, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -99,34 +193,21 @@ func (e *OpenAIEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]fl
 
 	resp, err := e.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return 0, 0, nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		var errResp api.ErrorResponse
-		if json.Unmarshal(body, &errResp) == nil {
-			return nil, fmt.Errorf("API error: %s", errResp.Error.Message)
-		}
-		return nil, fmt.Errorf("API error: status %d", resp.StatusCode)
-	}
-
-	var embResp api.EmbeddingResponse
-	if err := json.Unmarshal(body, &embResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return 0, 0, nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	result := make([][]float64, len(embResp.Data))
-	for _, d := range embResp.Data {
-		result[d.Index] = d.Embedding
+	var retryAfter time.Duration
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		retryAfter = time.Duration(secs) * time.Second
 	}
 
-	return result, nil
+	return resp.StatusCode, retryAfter, body, nil
 }
 
 // Dimensions returns the dimensionality of the embeddings.
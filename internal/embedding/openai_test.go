@@ -261,3 +261,147 @@ func TestOpenAIEmbedderMethods(t *testing.T) {
 		t.Errorf("expected Dimensions()=3072, got %d", embedder.Dimensions())
 	}
 }
+
+func TestOpenAIEmbedderDimensions(t *testing.T) {
+	t.Run("v3 model sends dimensions", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req api.EmbeddingRequest
+			json.NewDecoder(r.Body).Decode(&req)
+
+			if req.Dimensions == nil || *req.Dimensions != 256 {
+				t.Errorf("expected dimensions=256 in request, got %v", req.Dimensions)
+			}
+
+			json.NewEncoder(w).Encode(api.EmbeddingResponse{
+				Data: []api.EmbeddingData{{Embedding: make([]float64, 256), Index: 0}},
+			})
+		}))
+		defer server.Close()
+
+		embedder := NewOpenAIEmbedder(&OpenAIConfig{
+			APIKey:     "test-key",
+			BaseURL:    server.URL,
+			Model:      "text-embedding-3-large",
+			Dimensions: 256,
+		})
+		if embedder.Dimensions() != 256 {
+			t.Errorf("expected Dimensions()=256, got %d", embedder.Dimensions())
+		}
+
+		if _, err := embedder.Embed(context.Background(), "test"); err != nil {
+			t.Fatalf("Embed failed: %v", err)
+		}
+	})
+
+	t.Run("ada-002 ignores dimensions", func(t *testing.T) {
+		embedder := NewOpenAIEmbedder(&OpenAIConfig{
+			APIKey:     "test-key",
+			Model:      "text-embedding-ada-002",
+			Dimensions: 256,
+		})
+		if embedder.Dimensions() != 1536 {
+			t.Errorf("expected Dimensions()=1536, got %d", embedder.Dimensions())
+		}
+		if embedder.requestDimensions != 0 {
+			t.Errorf("expected no request dimensions, got %d", embedder.requestDimensions)
+		}
+	})
+}
+
+func TestOpenAIEmbedderRateLimitRetry(t *testing.T) {
+	t.Run("retries on 429", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls < 3 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			json.NewEncoder(w).Encode(api.EmbeddingResponse{
+				Data: []api.EmbeddingData{{Embedding: []float64{0.1, 0.2}, Index: 0}},
+			})
+		}))
+		defer server.Close()
+
+		embedder := NewOpenAIEmbedder(&OpenAIConfig{
+			APIKey:         "test-key",
+			BaseURL:        server.URL,
+			RetryBaseDelay: time.Millisecond,
+		})
+
+		if _, err := embedder.Embed(context.Background(), "test"); err != nil {
+			t.Fatalf("Embed failed: %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 calls, got %d", calls)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		embedder := NewOpenAIEmbedder(&OpenAIConfig{
+			APIKey:         "test-key",
+			BaseURL:        server.URL,
+			MaxRetries:     2,
+			RetryBaseDelay: time.Millisecond,
+		})
+
+		if _, err := embedder.Embed(context.Background(), "test"); err == nil {
+			t.Error("expected error after exhausting retries")
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 calls (1 + 2 retries), got %d", calls)
+		}
+	})
+
+	t.Run("negative disables retries", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		embedder := NewOpenAIEmbedder(&OpenAIConfig{
+			APIKey:         "test-key",
+			BaseURL:        server.URL,
+			MaxRetries:     -1,
+			RetryBaseDelay: time.Millisecond,
+		})
+
+		if _, err := embedder.Embed(context.Background(), "test"); err == nil {
+			t.Error("expected error on rate limit")
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 call without retries, got %d", calls)
+		}
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		embedder := NewOpenAIEmbedder(&OpenAIConfig{
+			APIKey:         "test-key",
+			BaseURL:        server.URL,
+			RetryBaseDelay: time.Millisecond,
+		})
+
+		if _, err := embedder.Embed(context.Background(), "test"); err == nil {
+			t.Error("expected error on bad request")
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	})
+}
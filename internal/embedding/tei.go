@@ -0,0 +1,171 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Ensure TEIEmbedder implements Embedder.
+var _ Embedder = (*TEIEmbedder)(nil)
+
+// TEIEmbedder generates embeddings using a HuggingFace
+// Text-Embeddings-Inference server. TEI serves a single model, so the
+// dimension is learned from the first response rather than looked up.
+type TEIEmbedder struct {
+	baseURL      string
+	model        string
+	maxBatchSize int
+	dimensions   atomic.Int64
+	client       *http.Client
+}
+
+// TEIConfig configures the TEI embedder.
+type TEIConfig struct {
+	BaseURL string
+	// Model names the model the server was started with. TEI ignores it;
+	// it is reported by Model. Defaults to "tei".
+	Model   string
+	Timeout time.Duration
+	// MaxBatchSize is the most texts sent per call; it must not exceed
+	// the server's --max-client-batch-size. Defaults to 32, TEI's default.
+	MaxBatchSize int
+	// Dimensions, if set, is reported until the first response reveals
+	// the model's actual dimension.
+	Dimensions int
+}
+
+// teiRequest is the request body for TEI's /embed endpoint.
+type teiRequest struct {
+	Inputs   []string `json:"inputs"`
+	Truncate bool     `json:"truncate"`
+}
+
+// teiError is the error body returned by TEI.
+type teiError struct {
+	Error     string `json:"error"`
+	ErrorType string `json:"error_type"`
+}
+
+// NewTEIEmbedder creates a new TEI embedder.
+func NewTEIEmbedder(cfg *TEIConfig) *TEIEmbedder {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "http://localhost:8081"
+	}
+	if cfg.Model == "" {
+		cfg.Model = "tei"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.MaxBatchSize <= 0 {
+		cfg.MaxBatchSize = 32
+	}
+
+	e := &TEIEmbedder{
+		baseURL:      cfg.BaseURL,
+		model:        cfg.Model,
+		maxBatchSize: cfg.MaxBatchSize,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+	}
+	e.dimensions.Store(int64(cfg.Dimensions))
+	return e
+}
+
+// Embed generates an embedding for the given text.
+func (e *TEIEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	embeddings, err := e.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) == 0 {
+		return nil, fmt.Errorf("no embeddings returned")
+	}
+	return embeddings[0], nil
+}
+
+// EmbedBatch generates embeddings for multiple texts, splitting them into
+// calls of at most MaxBatchSize texts.
+func (e *TEIEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	results := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += e.maxBatchSize {
+		end := start + e.maxBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		embeddings, err := e.embed(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, embeddings...)
+	}
+	return results, nil
+}
+
+// embed performs a single /embed call.
+func (e *TEIEmbedder) embed(ctx context.Context, texts []string) ([][]float64, error) {
+	jsonBody, err := json.Marshal(teiRequest{Inputs: texts, Truncate: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"/embed", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var teiErr teiError
+		if json.Unmarshal(body, &teiErr) == nil && teiErr.Error != "" {
+			return nil, fmt.Errorf("API error: %s", teiErr.Error)
+		}
+		return nil, fmt.Errorf("API error: status %d", resp.StatusCode)
+	}
+
+	var embeddings [][]float64
+	if err := json.Unmarshal(body, &embeddings); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embeddings))
+	}
+	if len(embeddings[0]) > 0 {
+		e.dimensions.Store(int64(len(embeddings[0])))
+	}
+
+	return embeddings, nil
+}
+
+// Dimensions returns the dimensionality of the embeddings, as seen in the
+// last response. It is zero (or TEIConfig.Dimensions) before the first call.
+func (e *TEIEmbedder) Dimensions() int {
+	return int(e.dimensions.Load())
+}
+
+// Model returns the configured model name.
+func (e *TEIEmbedder) Model() string {
+	return e.model
+}
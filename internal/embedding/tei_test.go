@@ -0,0 +1,90 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTEIEmbedder(t *testing.T) {
+	var batches [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embed" {
+			t.Errorf("expected /embed, got %s", r.URL.Path)
+		}
+
+		var req teiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		batches = append(batches, req.Inputs)
+
+		embeddings := make([][]float64, len(req.Inputs))
+		for i, text := range req.Inputs {
+			embeddings[i] = []float64{float64(len(text)), 0, 1}
+		}
+		json.NewEncoder(w).Encode(embeddings)
+	}))
+	defer server.Close()
+
+	embedder := NewTEIEmbedder(&TEIConfig{BaseURL: server.URL, Model: "bge-small-en", MaxBatchSize: 2})
+	if embedder.Dimensions() != 0 {
+		t.Errorf("expected unknown dimensions before the first call, got %d", embedder.Dimensions())
+	}
+
+	texts := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	embeddings, err := embedder.EmbedBatch(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("EmbedBatch failed: %v", err)
+	}
+
+	if len(batches) != 3 {
+		t.Errorf("expected 3 calls of at most 2 texts, got %d", len(batches))
+	}
+	for i, emb := range embeddings {
+		if int(emb[0]) != len(texts[i]) {
+			t.Errorf("embedding %d out of order: %v", i, emb)
+		}
+	}
+	if embedder.Dimensions() != 3 {
+		t.Errorf("expected detected dimensions=3, got %d", embedder.Dimensions())
+	}
+	if embedder.Model() != "bge-small-en" {
+		t.Errorf("expected model bge-small-en, got %s", embedder.Model())
+	}
+}
+
+func TestTEIEmbedderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"api error", http.StatusRequestEntityTooLarge, `{"error":"batch size 64 > maximum allowed batch size 32","error_type":"validation"}`, "maximum allowed batch size"},
+		{"status only", http.StatusInternalServerError, "oops", "status 500"},
+		{"wrong count", http.StatusOK, `[[1,2],[3,4]]`, "expected 1 embeddings, got 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			embedder := NewTEIEmbedder(&TEIConfig{BaseURL: server.URL, Dimensions: 384})
+			_, err := embedder.Embed(context.Background(), "hello")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if embedder.Dimensions() != 384 {
+				t.Errorf("expected configured dimensions to stand after a failure, got %d", embedder.Dimensions())
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+// Package grpc serves a cache.Cache over gRPC, so services written in
+// other languages can consult one central mimir cache. The service is
+// defined in proto/mimir/cache/v1/cache.proto; cachepb holds the code
+// generated from it with make proto.
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aqstack/mimir/internal/cache"
+	"github.com/aqstack/mimir/internal/grpc/cachepb"
+	"github.com/aqstack/mimir/pkg/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Ensure Server implements cachepb.CacheServiceServer.
+var _ cachepb.CacheServiceServer = (*Server)(nil)
+
+// Server implements the CacheService over any cache.Cache.
+type Server struct {
+	cachepb.UnimplementedCacheServiceServer
+	cache cache.Cache
+}
+
+// NewServer creates a server for c.
+func NewServer(c cache.Cache) *Server {
+	return &Server{cache: c}
+}
+
+// Register registers the service with gs.
+func (s *Server) Register(gs *grpc.Server) {
+	cachepb.RegisterCacheServiceServer(gs, s)
+}
+
+// Get returns the most similar live entry at or above the threshold.
+func (s *Server) Get(ctx context.Context, req *cachepb.GetRequest) (*cachepb.GetResponse, error) {
+	if len(req.Embedding) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "embedding is required")
+	}
+	ctx = cache.WithNamespace(ctx, req.Namespace)
+	if req.Model != "" {
+		ctx = cache.WithModel(ctx, req.Model)
+	}
+
+	entry, similarity, found := s.cache.Get(ctx, req.Embedding, req.Threshold)
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if !found {
+		return &cachepb.GetResponse{}, nil
+	}
+	pb, err := toProto(entry)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &cachepb.GetResponse{Found: true, Entry: pb, Similarity: similarity}, nil
+}
+
+// Search streams up to k live entries at or above the threshold, most
+// similar first.
+func (s *Server) Search(req *cachepb.SearchRequest, stream grpc.ServerStreamingServer[cachepb.SearchResult]) error {
+	if len(req.Embedding) == 0 {
+		return status.Error(codes.InvalidArgument, "embedding is required")
+	}
+	if req.K <= 0 {
+		return status.Error(codes.InvalidArgument, "k must be positive")
+	}
+	ctx := cache.WithNamespace(stream.Context(), req.Namespace)
+
+	for _, result := range s.cache.Search(ctx, req.Embedding, req.Threshold, int(req.K)) {
+		pb, err := toProto(result.Entry)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err := stream.Send(&cachepb.SearchResult{Entry: pb, Similarity: result.Similarity}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set stores an entry and returns its ID.
+func (s *Server) Set(ctx context.Context, req *cachepb.SetRequest) (*cachepb.SetResponse, error) {
+	if req.Entry == nil {
+		return nil, status.Error(codes.InvalidArgument, "entry is required")
+	}
+	entry, err := fromProto(req.Entry)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.cache.Set(ctx, entry); err != nil {
+		return nil, status.Error(setErrorCode(err), err.Error())
+	}
+	return &cachepb.SetResponse{Id: entry.ID}, nil
+}
+
+// setErrorCode returns the status code for an error from Cache.Set.
+func setErrorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, cache.ErrDimensionMismatch), errors.Is(err, cache.ErrInvalidEmbedding),
+		errors.Is(err, cache.ErrFormatMismatch), errors.Is(err, cache.ErrToolCalls),
+		errors.Is(err, cache.ErrLowConfidence):
+		return codes.InvalidArgument
+	case errors.Is(err, cache.ErrCacheFull):
+		return codes.ResourceExhausted
+	case errors.Is(err, cache.ErrCacheClosed):
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
+
+// Delete removes an entry by ID.
+func (s *Server) Delete(ctx context.Context, req *cachepb.DeleteRequest) (*cachepb.DeleteResponse, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	if err := s.cache.Delete(ctx, req.Id); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &cachepb.DeleteResponse{}, nil
+}
+
+// Clear removes all entries, or only those in a namespace if one is given.
+func (s *Server) Clear(ctx context.Context, req *cachepb.ClearRequest) (*cachepb.ClearResponse, error) {
+	var err error
+	if req.Namespace != "" {
+		err = s.cache.ClearNamespace(ctx, req.Namespace)
+	} else {
+		err = s.cache.Clear(ctx)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &cachepb.ClearResponse{}, nil
+}
+
+// Stats returns cache statistics.
+func (s *Server) Stats(ctx context.Context, req *cachepb.StatsRequest) (*cachepb.StatsResponse, error) {
+	stats := s.cache.Stats(ctx)
+	return &cachepb.StatsResponse{
+		TotalEntries:        stats.TotalEntries,
+		TotalHits:           stats.TotalHits,
+		TotalMisses:         stats.TotalMisses,
+		HitRate:             stats.HitRate,
+		EstimatedSavedUsd:   stats.EstimatedSaved,
+		Evictions:           stats.Evictions,
+		DimensionMismatches: stats.DimensionMismatches,
+	}, nil
+}
+
+// toProto converts a cache entry to its wire form.
+func toProto(e *api.CacheEntry) (*cachepb.Entry, error) {
+	reqJSON, err := json.Marshal(e.Request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	respJSON, err := json.Marshal(e.Response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode response: %w", err)
+	}
+	return &cachepb.Entry{
+		Id:           e.ID,
+		RequestJson:  reqJSON,
+		ResponseJson: respJSON,
+		Embedding:    e.Embedding,
+		CreatedAt:    timestamp(e.CreatedAt),
+		ExpiresAt:    timestamp(e.ExpiresAt),
+		HitCount:     e.HitCount,
+		LastHitAt:    timestamp(e.LastHitAt),
+		Namespace:    e.Namespace,
+	}, nil
+}
+
+// fromProto converts an entry received on the wire. Unset timestamps are
+// left zero for the cache to fill in.
+func fromProto(pb *cachepb.Entry) (*api.CacheEntry, error) {
+	e := &api.CacheEntry{
+		ID:        pb.Id,
+		Embedding: pb.Embedding,
+		CreatedAt: fromTimestamp(pb.CreatedAt),
+		ExpiresAt: fromTimestamp(pb.ExpiresAt),
+		HitCount:  pb.HitCount,
+		LastHitAt: fromTimestamp(pb.LastHitAt),
+		Namespace: pb.Namespace,
+	}
+	if len(e.Embedding) == 0 {
+		return nil, errors.New("embedding is required")
+	}
+	if err := json.Unmarshal(pb.RequestJson, &e.Request); err != nil {
+		return nil, fmt.Errorf("invalid request_json: %w", err)
+	}
+	if err := json.Unmarshal(pb.ResponseJson, &e.Response); err != nil {
+		return nil, fmt.Errorf("invalid response_json: %w", err)
+	}
+	return e, nil
+}
+
+// timestamp converts t, leaving the zero time unset.
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// fromTimestamp converts ts, mapping unset to the zero time.
+func fromTimestamp(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
@@ -0,0 +1,268 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/internal/cache"
+	"github.com/aqstack/mimir/internal/grpc/cachepb"
+	"github.com/aqstack/mimir/pkg/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves c over an in-memory connection and returns a
+// client for it.
+func newTestClient(t *testing.T, c cache.Cache) cachepb.CacheServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	NewServer(c).Register(gs)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return cachepb.NewCacheServiceClient(conn)
+}
+
+func newTestCache(t *testing.T) *cache.MemoryCache {
+	t.Helper()
+	c := cache.NewMemoryCache(&cache.Options{MaxSize: 10, DefaultTTL: time.Hour, CleanupInterval: time.Hour})
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// testEntry returns a wire entry answering prompt with answer.
+func testEntry(t *testing.T, prompt, answer string, embedding []float64) *cachepb.Entry {
+	t.Helper()
+	req, err := json.Marshal(api.ChatCompletionRequest{
+		Model:    "test-model",
+		Messages: []api.Message{{Role: "user", Content: prompt}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := json.Marshal(api.ChatCompletionResponse{
+		ID:      "chatcmpl-" + prompt,
+		Object:  "chat.completion",
+		Model:   "test-model",
+		Choices: []api.Choice{{Message: api.Message{Role: "assistant", Content: answer}, FinishReason: "stop"}},
+		Usage:   api.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &cachepb.Entry{RequestJson: req, ResponseJson: resp, Embedding: embedding}
+}
+
+func TestServerSetGetDelete(t *testing.T) {
+	client := newTestClient(t, newTestCache(t))
+	ctx := context.Background()
+
+	set, err := client.Set(ctx, &cachepb.SetRequest{Entry: testEntry(t, "capital of France", "Paris", []float64{1, 0, 0})})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if set.Id == "" {
+		t.Fatal("expected Set to return the generated ID")
+	}
+
+	got, err := client.Get(ctx, &cachepb.GetRequest{Embedding: []float64{1, 0.05, 0}, Threshold: 0.95, Model: "test-model"})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !got.Found || got.Entry.Id != set.Id || got.Similarity < 0.95 {
+		t.Fatalf("expected a hit on the stored entry, got %+v", got)
+	}
+	var resp api.ChatCompletionResponse
+	if err := json.Unmarshal(got.Entry.ResponseJson, &resp); err != nil {
+		t.Fatalf("invalid response_json: %v", err)
+	}
+	if resp.Choices[0].Message.Content != "Paris" {
+		t.Errorf("expected the cached response, got %+v", resp)
+	}
+	if got.Entry.CreatedAt == nil || got.Entry.ExpiresAt == nil || got.Entry.HitCount != 1 {
+		t.Errorf("expected timestamps and one hit, got %+v", got.Entry)
+	}
+
+	// The threshold is applied
+	if got, err := client.Get(ctx, &cachepb.GetRequest{Embedding: []float64{1, 0.5, 0}, Threshold: 0.99}); err != nil || got.Found {
+		t.Errorf("expected a miss below the threshold, got %+v (%v)", got, err)
+	}
+	// So is the namespace
+	if got, err := client.Get(ctx, &cachepb.GetRequest{Embedding: []float64{1, 0, 0}, Threshold: 0.95, Namespace: "other"}); err != nil || got.Found {
+		t.Errorf("expected a miss in another namespace, got %+v (%v)", got, err)
+	}
+
+	if _, err := client.Delete(ctx, &cachepb.DeleteRequest{Id: set.Id}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got, err := client.Get(ctx, &cachepb.GetRequest{Embedding: []float64{1, 0, 0}, Threshold: 0.95}); err != nil || got.Found {
+		t.Errorf("expected a miss after Delete, got %+v (%v)", got, err)
+	}
+}
+
+func TestServerSearch(t *testing.T) {
+	client := newTestClient(t, newTestCache(t))
+	ctx := context.Background()
+
+	for _, e := range []struct {
+		prompt    string
+		embedding []float64
+	}{
+		{"far", []float64{0, 1, 0}},
+		{"near", []float64{1, 0.3, 0}},
+		{"nearest", []float64{1, 0.1, 0}},
+	} {
+		if _, err := client.Set(ctx, &cachepb.SetRequest{Entry: testEntry(t, e.prompt, e.prompt, e.embedding)}); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	stream, err := client.Search(ctx, &cachepb.SearchRequest{Embedding: []float64{1, 0, 0}, Threshold: 0.9, K: 5})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	var prompts []string
+	for {
+		result, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		var req api.ChatCompletionRequest
+		if err := json.Unmarshal(result.Entry.RequestJson, &req); err != nil {
+			t.Fatalf("invalid request_json: %v", err)
+		}
+		prompts = append(prompts, req.Messages[0].Content.(string))
+	}
+	if len(prompts) != 2 || prompts[0] != "nearest" || prompts[1] != "near" {
+		t.Errorf("expected [nearest near], got %v", prompts)
+	}
+
+	stream, err = client.Search(ctx, &cachepb.SearchRequest{Embedding: []float64{1, 0, 0}})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument without k, got %v", err)
+	}
+}
+
+func TestServerStatsAndClear(t *testing.T) {
+	client := newTestClient(t, newTestCache(t))
+	ctx := context.Background()
+
+	for i, ns := range []string{"", "team-a"} {
+		entry := testEntry(t, "prompt "+ns, "answer", []float64{float64(i), 1, 0})
+		entry.Namespace = ns
+		if _, err := client.Set(ctx, &cachepb.SetRequest{Entry: entry}); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	client.Get(ctx, &cachepb.GetRequest{Embedding: []float64{0, 1, 0}, Threshold: 0.95})
+	client.Get(ctx, &cachepb.GetRequest{Embedding: []float64{0, 0, 1}, Threshold: 0.95})
+
+	stats, err := client.Stats(ctx, &cachepb.StatsRequest{})
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.TotalEntries != 2 || stats.TotalHits != 1 || stats.TotalMisses != 1 || stats.HitRate != 0.5 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// Clearing a namespace leaves the others
+	if _, err := client.Clear(ctx, &cachepb.ClearRequest{Namespace: "team-a"}); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if stats, _ := client.Stats(ctx, &cachepb.StatsRequest{}); stats.TotalEntries != 1 {
+		t.Errorf("expected 1 entry after clearing a namespace, got %d", stats.TotalEntries)
+	}
+	if _, err := client.Clear(ctx, &cachepb.ClearRequest{}); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if stats, _ := client.Stats(ctx, &cachepb.StatsRequest{}); stats.TotalEntries != 0 || stats.TotalHits != 0 {
+		t.Errorf("expected an empty cache after Clear, got %+v", stats)
+	}
+}
+
+func TestServerInvalidArguments(t *testing.T) {
+	client := newTestClient(t, newTestCache(t))
+	ctx := context.Background()
+
+	if _, err := client.Set(ctx, &cachepb.SetRequest{Entry: testEntry(t, "a", "b", []float64{1, 0, 0})}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	badJSON := testEntry(t, "a", "b", []float64{1, 0, 0})
+	badJSON.ResponseJson = []byte("{not json")
+
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"get without embedding", func() error {
+			_, err := client.Get(ctx, &cachepb.GetRequest{Threshold: 0.9})
+			return err
+		}, codes.InvalidArgument},
+		{"set without entry", func() error {
+			_, err := client.Set(ctx, &cachepb.SetRequest{})
+			return err
+		}, codes.InvalidArgument},
+		{"set with invalid JSON", func() error {
+			_, err := client.Set(ctx, &cachepb.SetRequest{Entry: badJSON})
+			return err
+		}, codes.InvalidArgument},
+		{"set with another dimension", func() error {
+			_, err := client.Set(ctx, &cachepb.SetRequest{Entry: testEntry(t, "c", "d", []float64{1, 0})})
+			return err
+		}, codes.InvalidArgument},
+		{"delete without id", func() error {
+			_, err := client.Delete(ctx, &cachepb.DeleteRequest{})
+			return err
+		}, codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := status.Code(tt.call()); code != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, code)
+			}
+		})
+	}
+}
+
+func TestSetErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{cache.ErrDimensionMismatch, codes.InvalidArgument},
+		{cache.ErrAllPinned, codes.ResourceExhausted},
+		{cache.ErrCacheClosed, codes.Unavailable},
+		{errors.New("disk full"), codes.Internal},
+	}
+	for _, tt := range tests {
+		if got := setErrorCode(tt.err); got != tt.want {
+			t.Errorf("%v: expected %v, got %v", tt.err, tt.want, got)
+		}
+	}
+}
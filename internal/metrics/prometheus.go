@@ -0,0 +1,232 @@
+// Package metrics exports mimir cache metrics to Prometheus.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/aqstack/mimir/internal/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// SimilarityBuckets are the upper bounds of the similarity histogram.
+var SimilarityBuckets = []float64{0.80, 0.85, 0.90, 0.93, 0.95, 0.97, 0.99, 1.0}
+
+var (
+	hitsDesc       = prometheus.NewDesc("mimir_cache_hits_total", "Total number of cache hits.", nil, nil)
+	exactHitsDesc  = prometheus.NewDesc("mimir_cache_exact_hits_total", "Cache hits served by exact request match, without embedding.", nil, nil)
+	missesDesc     = prometheus.NewDesc("mimir_cache_misses_total", "Total number of cache misses.", nil, nil)
+	hitRateDesc    = prometheus.NewDesc("mimir_cache_hit_rate", "Ratio of hits to lookups since start or last clear.", nil, nil)
+	entriesDesc    = prometheus.NewDesc("mimir_cache_entries", "Number of entries currently cached.", nil, nil)
+	bytesDesc      = prometheus.NewDesc("mimir_cache_bytes", "Approximate memory taken by cached entries.", nil, nil)
+	evictionsDesc  = prometheus.NewDesc("mimir_cache_evictions_total", "Total number of entries evicted to make room.", nil, nil)
+	mergedDesc     = prometheus.NewDesc("mimir_cache_merged_total", "Near-duplicate entries removed by compaction.", nil, nil)
+	mismatchesDesc = prometheus.NewDesc("mimir_cache_dimension_mismatches_total", "Lookups whose embedding dimension differed from cached entries.", nil, nil)
+	savedDesc      = prometheus.NewDesc("mimir_cache_estimated_saved_usd", "Estimated upstream cost avoided by cache hits.", nil, nil)
+
+	queueDepthDesc   = prometheus.NewDesc("mimir_precompute_queue_depth", "Responses waiting to be embedded and stored.", nil, nil)
+	queueDroppedDesc = prometheus.NewDesc("mimir_precompute_dropped_total", "Responses not cached because the precompute queue was full.", nil, nil)
+
+	modelHitsDesc    = prometheus.NewDesc("mimir_cache_model_hits_total", "Cache hits by request model.", []string{"model"}, nil)
+	modelMissesDesc  = prometheus.NewDesc("mimir_cache_model_misses_total", "Cache misses by request model.", []string{"model"}, nil)
+	modelEntriesDesc = prometheus.NewDesc("mimir_cache_model_entries", "Cached entries by request model.", []string{"model"}, nil)
+)
+
+// Ensure Collector implements prometheus.Collector.
+var _ prometheus.Collector = (*Collector)(nil)
+
+// Collector is a prometheus.Collector for cache metrics. Cache gauges and
+// counters are read live from Cache.Stats on every scrape; per-request
+// similarity scores are recorded via ObserveSimilarity. It also serves its
+// own metrics over HTTP.
+//
+// Cache statistics restart from zero on Clear, while Prometheus counters
+// must not decrease, so counters accumulate the increase between scrapes
+// instead of exporting the statistics as they are. A statistic below its
+// value at the previous scrape is taken to have restarted from zero since.
+type Collector struct {
+	cache   cache.Cache
+	queue   QueueStats
+	handler http.Handler
+
+	similarity       prometheus.Histogram
+	shadowHits       prometheus.Counter
+	shadowMismatches prometheus.Counter
+
+	mu          sync.Mutex
+	hits        monotonic
+	exactHits   monotonic
+	misses      monotonic
+	evictions   monotonic
+	merged      monotonic
+	mismatches  monotonic
+	saved       monotonic
+	modelHits   map[string]*monotonic
+	modelMisses map[string]*monotonic
+}
+
+// NewCollector creates a collector reading from c.
+func NewCollector(c cache.Cache) *Collector {
+	collector := &Collector{
+		cache: c,
+		similarity: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "mimir_cache_hit_similarity",
+			Help:    "Similarity scores of cache hits.",
+			Buckets: SimilarityBuckets,
+		}),
+		shadowHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "mimir_shadow_hits_total",
+			Help: "Would-be hits compared against upstream in shadow mode.",
+		}),
+		shadowMismatches: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "mimir_shadow_mismatches_total",
+			Help: "Shadow-mode hits whose cached response differed from upstream's.",
+		}),
+		modelHits:   make(map[string]*monotonic),
+		modelMisses: make(map[string]*monotonic),
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	collector.handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return collector
+}
+
+// QueueStats is implemented by background write queues, such as the
+// proxy's precompute queue.
+type QueueStats interface {
+	Depth() int
+	Dropped() int64
+}
+
+// WatchQueue exports the depth and drop count of q on every scrape.
+// It must be called before the collector is served.
+func (c *Collector) WatchQueue(q QueueStats) {
+	c.queue = q
+}
+
+// ObserveSimilarity records the similarity score of a cache hit.
+func (c *Collector) ObserveSimilarity(similarity float64) {
+	c.similarity.Observe(similarity)
+}
+
+// ObserveShadow records a would-be hit in shadow mode and whether the
+// cached response matched the live one.
+func (c *Collector) ObserveShadow(match bool) {
+	c.shadowHits.Inc()
+	if !match {
+		c.shadowMismatches.Inc()
+	}
+}
+
+// ServeHTTP writes all metrics in the Prometheus exposition format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.handler.ServeHTTP(w, r)
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		hitsDesc, exactHitsDesc, missesDesc, hitRateDesc, entriesDesc, bytesDesc,
+		evictionsDesc, mergedDesc, mismatchesDesc, savedDesc,
+		queueDepthDesc, queueDroppedDesc,
+		modelHitsDesc, modelMissesDesc, modelEntriesDesc,
+	} {
+		ch <- desc
+	}
+	c.similarity.Describe(ch)
+	c.shadowHits.Describe(ch)
+	c.shadowMismatches.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	stats := c.cache.Stats(ctx)
+	byModel := c.cache.StatsByModel(ctx)
+
+	c.mu.Lock()
+	counter(ch, hitsDesc, c.hits.observe(float64(stats.TotalHits)))
+	counter(ch, exactHitsDesc, c.exactHits.observe(float64(stats.ExactHits)))
+	counter(ch, missesDesc, c.misses.observe(float64(stats.TotalMisses)))
+	counter(ch, evictionsDesc, c.evictions.observe(float64(stats.Evictions)))
+	counter(ch, mergedDesc, c.merged.observe(float64(stats.Merged)))
+	counter(ch, mismatchesDesc, c.mismatches.observe(float64(stats.DimensionMismatches)))
+	counter(ch, savedDesc, c.saved.observe(stats.EstimatedSaved))
+
+	// Models gone from the statistics since a Clear keep their totals
+	for model, s := range byModel {
+		modelCounter(c.modelHits, model).observe(float64(s.TotalHits))
+		modelCounter(c.modelMisses, model).observe(float64(s.TotalMisses))
+	}
+	for model, m := range c.modelHits {
+		if _, ok := byModel[model]; !ok {
+			m.observe(0)
+		}
+		counter(ch, modelHitsDesc, m.total, model)
+	}
+	for model, m := range c.modelMisses {
+		if _, ok := byModel[model]; !ok {
+			m.observe(0)
+		}
+		counter(ch, modelMissesDesc, m.total, model)
+	}
+	c.mu.Unlock()
+
+	gauge(ch, hitRateDesc, stats.HitRate)
+	gauge(ch, entriesDesc, float64(stats.TotalEntries))
+	gauge(ch, bytesDesc, float64(stats.TotalBytes))
+	for model, s := range byModel {
+		gauge(ch, modelEntriesDesc, float64(s.TotalEntries), model)
+	}
+
+	if c.queue != nil {
+		gauge(ch, queueDepthDesc, float64(c.queue.Depth()))
+		counter(ch, queueDroppedDesc, float64(c.queue.Dropped()))
+	}
+
+	c.similarity.Collect(ch)
+	c.shadowHits.Collect(ch)
+	c.shadowMismatches.Collect(ch)
+}
+
+// monotonic turns a statistic that restarts from zero on Clear into a
+// counter that only increases.
+type monotonic struct {
+	total float64
+	last  float64
+}
+
+// observe adds the increase of the statistic since the previous
+// observation to the total and returns it. A value below the previous one
+// means the statistic restarted from zero, so all of it is new.
+func (m *monotonic) observe(value float64) float64 {
+	if value >= m.last {
+		m.total += value - m.last
+	} else {
+		m.total += value
+	}
+	m.last = value
+	return m.total
+}
+
+// modelCounter returns the counter for model in counters, adding it if
+// missing.
+func modelCounter(counters map[string]*monotonic, model string) *monotonic {
+	m, ok := counters[model]
+	if !ok {
+		m = &monotonic{}
+		counters[model] = m
+	}
+	return m
+}
+
+func counter(ch chan<- prometheus.Metric, desc *prometheus.Desc, value float64, labels ...string) {
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, labels...)
+}
+
+func gauge(ch chan<- prometheus.Metric, desc *prometheus.Desc, value float64, labels ...string) {
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+}
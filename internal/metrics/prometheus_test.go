@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/internal/cache"
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+func TestCollectorServeHTTP(t *testing.T) {
+	c := cache.NewMemoryCache(cache.DefaultOptions())
+	ctx := context.Background()
+
+	c.Set(ctx, &api.CacheEntry{
+		Request:   api.ChatCompletionRequest{Model: "gpt-4"},
+		Embedding: []float64{1, 0, 0},
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	c.Get(ctx, []float64{1, 0, 0}, 0.9)
+	c.Get(cache.WithModel(ctx, `my"model`), []float64{0, 1, 0}, 0.9)
+
+	collector := NewCollector(c)
+	collector.ObserveSimilarity(0.96)
+	collector.ObserveSimilarity(1.0)
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("expected text/plain content type, got %s", ct)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE mimir_cache_hits_total counter",
+		"mimir_cache_hits_total 1\n",
+		"mimir_cache_exact_hits_total 0\n",
+		"mimir_cache_misses_total 1\n",
+		"mimir_cache_hit_rate 0.5\n",
+		"mimir_cache_entries 1\n",
+		"mimir_cache_evictions_total 0\n",
+		"mimir_cache_merged_total 0\n",
+		`mimir_cache_model_hits_total{model="gpt-4"} 1`,
+		`mimir_cache_model_misses_total{model="my\"model"} 1`,
+		"# TYPE mimir_cache_hit_similarity histogram",
+		`mimir_cache_hit_similarity_bucket{le="0.95"} 0`,
+		`mimir_cache_hit_similarity_bucket{le="0.97"} 1`,
+		`mimir_cache_hit_similarity_bucket{le="1"} 2`,
+		`mimir_cache_hit_similarity_bucket{le="+Inf"} 2`,
+		"mimir_cache_hit_similarity_sum 1.96\n",
+		"mimir_cache_hit_similarity_count 2\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected output to contain %q\n%s", want, body)
+		}
+	}
+}
+
+type fakeQueue struct{}
+
+func (fakeQueue) Depth() int     { return 3 }
+func (fakeQueue) Dropped() int64 { return 7 }
+
+func TestCollectorWatchQueue(t *testing.T) {
+	collector := NewCollector(cache.NewMemoryCache(cache.DefaultOptions()))
+
+	if strings.Contains(scrape(collector), "mimir_precompute") {
+		t.Error("expected no queue metrics without a watched queue")
+	}
+
+	collector.WatchQueue(fakeQueue{})
+	with := scrape(collector)
+	for _, want := range []string{
+		"mimir_precompute_queue_depth 3\n",
+		"mimir_precompute_dropped_total 7\n",
+	} {
+		if !strings.Contains(with, want) {
+			t.Errorf("expected output to contain %q", want)
+		}
+	}
+}
+
+func TestCollectorObserveShadow(t *testing.T) {
+	collector := NewCollector(cache.NewMemoryCache(cache.DefaultOptions()))
+	collector.ObserveShadow(true)
+	collector.ObserveShadow(false)
+	collector.ObserveShadow(true)
+
+	out := scrape(collector)
+	for _, want := range []string{
+		"mimir_shadow_hits_total 3\n",
+		"mimir_shadow_mismatches_total 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q", want)
+		}
+	}
+}
+
+func TestCollectorCountersSurviveClear(t *testing.T) {
+	c := cache.NewMemoryCache(cache.DefaultOptions())
+	ctx := context.Background()
+	collector := NewCollector(c)
+
+	c.Set(ctx, &api.CacheEntry{
+		Request:   api.ChatCompletionRequest{Model: "gpt-4"},
+		Embedding: []float64{1, 0, 0},
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	c.Get(ctx, []float64{1, 0, 0}, 0.9)
+	c.Get(ctx, []float64{1, 0, 0}, 0.9)
+	scrape(collector)
+
+	// Clear resets the cache's statistics, not the exported counters
+	c.Clear(ctx)
+	c.Get(ctx, []float64{0, 1, 0}, 0.9)
+
+	body := scrape(collector)
+	for _, want := range []string{
+		"mimir_cache_hits_total 2\n",
+		"mimir_cache_misses_total 1\n",
+		"mimir_cache_entries 0\n",
+		`mimir_cache_model_hits_total{model="gpt-4"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected output to contain %q\n%s", want, body)
+		}
+	}
+}
+
+// scrape returns the metrics collector serves over HTTP.
+func scrape(collector *Collector) string {
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	return rec.Body.String()
+}
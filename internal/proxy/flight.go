@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aqstack/mimir/internal/cache"
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// flightGroup collapses concurrent identical misses into one upstream
+// call: the first request for a key leads and goes upstream, later ones
+// wait for it and share its response. Unlike golang.org/x/sync/singleflight
+// the leader runs its own code path rather than a shared function, since
+// it writes its own HTTP response.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is an upstream call in progress for one key.
+type flight struct {
+	done      chan struct{}
+	resp      *api.ChatCompletionResponse // set by land; nil if the leader got nothing cacheable
+	createdAt time.Time
+}
+
+// flightKey identifies requests that may share a response: the same
+// canonical request in the same namespace.
+func flightKey(ctx context.Context, req *api.ChatCompletionRequest) string {
+	return cache.NamespaceFromContext(ctx) + "\x00" + api.RequestHash(req)
+}
+
+// join returns the flight for key and whether the caller leads it. The
+// leader must call land when done.
+func (g *flightGroup) join(key string) (*flight, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if f, ok := g.flights[key]; ok {
+		return f, false
+	}
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	return f, true
+}
+
+// land publishes the leader's response, nil if it got none worth sharing,
+// and releases the waiters. Requests joining afterwards lead a new flight.
+func (g *flightGroup) land(key string, f *flight, resp *api.ChatCompletionResponse) {
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+
+	f.resp = resp
+	f.createdAt = time.Now()
+	close(f.done)
+}
+
+// wait blocks until the flight lands or ctx is done, and returns a copy
+// of the leader's response, or nil if there is none.
+func (f *flight) wait(ctx context.Context) *api.ChatCompletionResponse {
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return nil
+	}
+	if f.resp == nil {
+		return nil
+	}
+	resp := f.resp.Clone()
+	return &resp
+}
+
+// share returns a copy of resp for waiters, taken before the cache may
+// scrub resp in place.
+func share(resp *api.ChatCompletionResponse) *api.ChatCompletionResponse {
+	c := resp.Clone()
+	return &c
+}
+
+// refresh runs fetch in the background to replace a stale entry, unless
+// a refresh or miss for key is already in flight. Misses arriving
+// meanwhile wait for it like for any other flight.
+func (g *flightGroup) refresh(key string, fetch func() *api.ChatCompletionResponse) {
+	f, leader := g.join(key)
+	if !leader {
+		return
+	}
+	go func() {
+		var resp *api.ChatCompletionResponse
+		defer func() { g.land(key, f, resp) }()
+		resp = fetch()
+	}()
+}
@@ -5,16 +5,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/aqstack/mimir/internal/cache"
 	"github.com/aqstack/mimir/internal/config"
 	"github.com/aqstack/mimir/internal/embedding"
 	"github.com/aqstack/mimir/internal/logger"
+	"github.com/aqstack/mimir/internal/metrics"
 	"github.com/aqstack/mimir/internal/reports"
 	"github.com/aqstack/mimir/pkg/api"
 )
@@ -27,11 +31,19 @@ type Handler struct {
 	client    *http.Client
 	logger    *logger.Logger
 	collector *reports.Collector
+	metrics   *metrics.Collector
+	policy    *cache.Options // cacheability and embedding input rules
+	precomp   *Precomputer   // stores misses off the request path; nil stores inline
+	flights   flightGroup    // concurrent identical misses in progress
+	probe     embedderProbe  // recent embedder reachability, for /readyz
 }
 
 // NewHandler creates a new proxy handler.
 func NewHandler(cfg *config.Config, c cache.Cache, e embedding.Embedder, log *logger.Logger) *Handler {
-	return &Handler{
+	truncation, _ := cache.ParseTruncation(cfg.InputTruncation) // checked by Validate
+	conversation, _ := cache.ParseConversation(cfg.ConversationInput)
+	onEmbedError, _ := cache.ParseEmbedErrorPolicy(cfg.OnEmbedError)
+	h := &Handler{
 		cfg:      cfg,
 		cache:    c,
 		embedder: e,
@@ -40,16 +52,63 @@ func NewHandler(cfg *config.Config, c cache.Cache, e embedding.Embedder, log *lo
 		},
 		logger:    log,
 		collector: reports.NewCollector(),
+		metrics:   metrics.NewCollector(c),
+		policy: &cache.Options{
+			MinCacheTemperature: cfg.MinCacheTemperature,
+			RequireSeed:         cfg.RequireSeed,
+			StripPrefixes:       cfg.StripPrefixes,
+			MaxInputChars:       cfg.MaxInputChars,
+			Truncation:          truncation,
+			Conversation:        conversation,
+			TurnDecay:           cfg.TurnDecay,
+			OnEmbedError:        onEmbedError,
+			ShadowMode:          cfg.ShadowMode,
+		},
+	}
+	h.policy.OnShadow = h.recordShadow
+	if cfg.PrecomputeQueue > 0 {
+		h.precomp = NewPrecomputer(c, e, &PrecomputeOptions{
+			QueueSize: cfg.PrecomputeQueue,
+			Input:     h.policy.EmbeddingInput,
+			Turns:     h.policy.EmbeddingTurns,
+			Combine:   h.policy.CombineTurns,
+
+			OnEmbedError: onEmbedError,
+			OnError: func(req *api.ChatCompletionRequest, err error) {
+				log.Warn("failed to cache response in background", "model", req.Model, "error", err)
+			},
+		})
+		h.metrics.WatchQueue(h.precomp)
+	}
+	return h
+}
+
+// Close waits for responses queued for background caching to be stored.
+func (h *Handler) Close() error {
+	if h.precomp != nil {
+		return h.precomp.Close()
 	}
+	return nil
+}
+
+// Metrics returns the Prometheus metrics handler for this proxy's cache.
+func (h *Handler) Metrics() http.Handler {
+	return h.metrics
 }
 
 // ServeHTTP handles incoming requests.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch {
-	case r.URL.Path == "/health":
+	case r.URL.Path == "/health" || r.URL.Path == "/healthz":
 		h.handleHealth(w, r)
+	case r.URL.Path == "/readyz":
+		h.handleReady(w, r)
 	case r.URL.Path == "/stats":
 		h.handleStats(w, r)
+	case r.URL.Path == "/stats/models":
+		h.handleStatsByModel(w, r)
+	case r.URL.Path == "/stats/stream":
+		h.handleStatsStream(w, r)
 	case r.URL.Path == "/reports" || r.URL.Path == "/reports/":
 		h.handleDashboard(w, r)
 	case r.URL.Path == "/reports/data":
@@ -68,7 +127,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleHealth handles health check requests.
+// handleHealth handles liveness checks: the process is up and serving.
 func (h *Handler) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
@@ -81,6 +140,40 @@ func (h *Handler) handleStats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
+// handleStatsByModel handles per-model cache statistics requests.
+func (h *Handler) handleStatsByModel(w http.ResponseWriter, r *http.Request) {
+	stats := h.cache.StatsByModel(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// thresholdFor returns the similarity threshold for a request: the
+// X-Mimir-Threshold header if it holds a value in (0, 1], otherwise the
+// configured threshold.
+func (h *Handler) thresholdFor(r *http.Request) float64 {
+	if v := r.Header.Get("X-Mimir-Threshold"); v != "" {
+		if t, err := strconv.ParseFloat(v, 64); err == nil && t > 0 && t <= 1 {
+			return t
+		}
+		h.logger.Debug("ignoring invalid threshold header", "value", v)
+	}
+	return h.cfg.SimilarityThreshold
+}
+
+// namespaceFor returns the cache namespace for a request: the
+// X-Mimir-Namespace header if set, otherwise the request's user field when
+// NamespaceByUser is enabled. Requests in different namespaces never share
+// cached responses.
+func (h *Handler) namespaceFor(r *http.Request, req *api.ChatCompletionRequest) string {
+	if ns := r.Header.Get("X-Mimir-Namespace"); ns != "" {
+		return ns
+	}
+	if h.cfg.NamespaceByUser {
+		return req.User
+	}
+	return ""
+}
+
 // handleChatCompletions handles chat completion requests with caching.
 func (h *Handler) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -101,9 +194,17 @@ func (h *Handler) handleChatCompletions(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Skip caching for streaming requests
-	if req.Stream {
-		h.logger.Debug("skipping cache for streaming request")
+	// Skip caching for requests that deliberately want varied output
+	if !h.policy.ShouldCache(&req) {
+		h.logger.Debug("skipping cache for non-deterministic request")
+		h.forwardRequest(w, r, body)
+		return
+	}
+
+	// While the embedder is down, go straight upstream rather than half
+	// serve from the cache
+	if embedding.CircuitOpen(h.embedder) {
+		h.logger.Debug("skipping cache while the embedder circuit is open")
 		h.forwardRequest(w, r, body)
 		return
 	}
@@ -111,32 +212,87 @@ func (h *Handler) handleChatCompletions(w http.ResponseWriter, r *http.Request)
 	// Generate cache key from messages
 	cacheKey := h.generateCacheKey(req)
 
-	// Get embedding for cache lookup
-	emb, err := h.embedder.Embed(ctx, cacheKey)
+	// The model attributes misses in per-model stats
+	ctx = cache.WithModel(ctx, req.Model)
+	ctx = cache.WithNamespace(ctx, h.namespaceFor(r, &req))
+	ctx = cache.WithInputLength(ctx, utf8.RuneCountInString(cacheKey))
+
+	// Exact repeats (retries, polling) skip embedding altogether. In
+	// shadow mode hits are only remembered, to compare with upstream.
+	var shadow *cache.SearchResult
+	if entry, found := h.cache.GetExact(ctx, &req); found && h.servable(&req, entry) {
+		if !h.policy.ShadowMode {
+			h.serveHit(w, &req, entry, 1, cacheKey, startTime)
+			h.revalidate(ctx, r, &req, body, entry, entry.Embedding, entry.EmbeddingModel)
+			return
+		}
+		shadow = &cache.SearchResult{Entry: entry, Similarity: 1}
+	}
+
+	// Get embedding for cache lookup. A fallback embedder may answer with
+	// another model, whose entries are kept apart from the primary's.
+	embedCtx, usedModel := embedding.WithModelReport(ctx)
+	emb, err := embedRequest(embedCtx, h.embedder, cacheKey, h.policy.EmbeddingTurns(&req), h.policy.CombineTurns)
 	if err != nil {
-		h.logger.Warn("failed to generate embedding, forwarding request", "error", err)
+		// The request is served either way; the policy only decides
+		// whether the uncached miss is reported
+		if h.policy.OnEmbedError.Handle(err) != nil {
+			h.logger.Warn("failed to generate embedding, forwarding request", "error", err)
+		} else {
+			h.logger.Debug("failed to generate embedding, forwarding request", "error", err)
+		}
 		h.forwardRequest(w, r, body)
 		return
 	}
+	embeddingModel := h.embedder.Model()
+	if m := usedModel(); m != "" {
+		embeddingModel = m
+	}
+	ctx = cache.WithEmbeddingModel(ctx, embeddingModel)
 
 	// Check cache
-	if entry, similarity, found := h.cache.Get(ctx, emb, h.cfg.SimilarityThreshold); found {
-		latencyMs := time.Since(startTime).Milliseconds()
-		h.logger.Info("cache hit",
-			"similarity", fmt.Sprintf("%.4f", similarity),
-			"latency_ms", latencyMs,
-		)
+	threshold := h.thresholdFor(r)
+	if shadow == nil {
+		if entry, similarity, found := h.cache.Get(ctx, emb, threshold); found && h.servable(&req, entry) {
+			if !h.policy.ShadowMode {
+				h.serveHit(w, &req, entry, similarity, cacheKey, startTime)
+				h.revalidate(ctx, r, &req, body, entry, emb, embeddingModel)
+				return
+			}
+			shadow = &cache.SearchResult{Entry: entry, Similarity: similarity}
+		}
+	}
 
-		// Record metrics - estimate tokens saved based on response
-		tokensSaved := entry.Response.Usage.TotalTokens
-		h.collector.RecordRequest(true, similarity, latencyMs, tokensSaved, cacheKey)
-		h.collector.AddLog("hit", fmt.Sprintf("[HIT] %.2f%% sim, %dms - %s", similarity*100, latencyMs, truncatePrompt(cacheKey, 80)))
+	// Concurrent identical misses wait for the first to come back from
+	// upstream and are served its response, so only one is paid for. In
+	// shadow mode every request goes upstream to be compared.
+	var shared *api.ChatCompletionResponse
+	if !h.policy.ShadowMode {
+		key := flightKey(ctx, &req)
+		f, leader := h.flights.join(key)
+		if leader {
+			defer func() { h.flights.land(key, f, shared) }()
+		} else if resp := f.wait(ctx); resp != nil {
+			h.logger.Debug("served response of concurrent identical miss")
+			entry := &api.CacheEntry{Request: req, Response: *resp, CreatedAt: f.createdAt}
+			h.serveHit(w, &req, entry, 1, cacheKey, startTime)
+			return
+		}
+	}
 
-		// Return cached response with cache header
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("X-Mimir-Cache", "HIT")
-		w.Header().Set("X-Mimir-Similarity", fmt.Sprintf("%.4f", similarity))
-		json.NewEncoder(w).Encode(entry.Response)
+	// Streaming misses are relayed as they arrive and cached once the
+	// stream completes; they are not compared in shadow mode
+	if req.Stream {
+		h.logger.Debug("cache miss, streaming from upstream")
+		w.Header().Set(HeaderCache, "MISS")
+		if live := h.streamRequest(w, r, body); live != nil {
+			shared = share(live)
+			h.storeResponse(ctx, &req, live, emb, embeddingModel)
+		}
+
+		latencyMs := time.Since(startTime).Milliseconds()
+		h.collector.RecordRequest(false, 0, latencyMs, 0, cacheKey)
+		h.collector.AddLog("miss", fmt.Sprintf("[MISS] %dms - %s", latencyMs, truncatePrompt(cacheKey, 80)))
 		return
 	}
 
@@ -154,26 +310,48 @@ func (h *Handler) handleChatCompletions(w http.ResponseWriter, r *http.Request)
 	for k, v := range resp.Header {
 		w.Header()[k] = v
 	}
-	w.Header().Set("X-Mimir-Cache", "MISS")
+	w.Header().Set(HeaderCache, "MISS")
 
-	// If successful, cache the response
+	var live *api.ChatCompletionResponse
 	if resp.StatusCode == http.StatusOK {
 		var chatResp api.ChatCompletionResponse
 		if err := json.Unmarshal(respBody, &chatResp); err == nil {
-			entry := &api.CacheEntry{
-				Request:   req,
-				Response:  chatResp,
-				Embedding: emb,
-				CreatedAt: time.Now(),
-				ExpiresAt: time.Now().Add(h.cfg.CacheTTL),
-				HitCount:  0,
-				LastHitAt: time.Now(),
-			}
-			if err := h.cache.Set(ctx, entry); err != nil {
-				h.logger.Warn("failed to cache response", "error", err)
-			} else {
-				h.logger.Debug("cached response", "model", chatResp.Model)
-			}
+			live = &chatResp
+		}
+	}
+
+	// Compare before caching, which may scrub the response in place
+	if shadow != nil {
+		h.policy.Shadow(shadow.Entry, shadow.Similarity, live)
+	}
+
+	// If successful, cache the response
+	if live != nil {
+		shared = share(live)
+		h.storeResponse(ctx, &req, live, emb, embeddingModel)
+	}
+
+	// Remember deterministic failures so retries of the same prompt fail fast
+	if h.cfg.NegativeTTL > 0 && isNegativeCacheable(resp.StatusCode) {
+		apiErr := api.APIError{Message: http.StatusText(resp.StatusCode), Type: "upstream_error"}
+		var errResp api.ErrorResponse
+		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error.Message != "" {
+			apiErr = errResp.Error
+		}
+		entry := &api.CacheEntry{
+			Request:    req,
+			Embedding:  emb,
+			CreatedAt:  time.Now(),
+			ExpiresAt:  time.Now().Add(h.cfg.NegativeTTL),
+			LastHitAt:  time.Now(),
+			Negative:   true,
+			StatusCode: resp.StatusCode,
+			Error:      &apiErr,
+
+			EmbeddingModel: embeddingModel,
+		}
+		if err := h.cache.Set(ctx, entry); err != nil {
+			h.logger.Warn("failed to cache upstream failure", "error", err)
 		}
 	}
 
@@ -192,31 +370,134 @@ func (h *Handler) handleChatCompletions(w http.ResponseWriter, r *http.Request)
 	)
 }
 
-// generateCacheKey creates a cache key from the request messages.
-func (h *Handler) generateCacheKey(req api.ChatCompletionRequest) string {
-	var sb strings.Builder
-
-	for _, msg := range req.Messages {
-		sb.WriteString(msg.Role)
-		sb.WriteString(": ")
-
-		switch content := msg.Content.(type) {
-		case string:
-			sb.WriteString(content)
-		case []interface{}:
-			// Handle multimodal content
-			for _, part := range content {
-				if p, ok := part.(map[string]interface{}); ok {
-					if text, ok := p["text"].(string); ok {
-						sb.WriteString(text)
-					}
-				}
-			}
+// storeResponse caches an upstream response for req, in the background
+// if a precomputer is set up.
+func (h *Handler) storeResponse(ctx context.Context, req *api.ChatCompletionRequest, live *api.ChatCompletionResponse, emb []float64, embeddingModel string) {
+	if h.precomp != nil {
+		if err := h.precomp.SetAsync(ctx, req, live); err != nil {
+			h.logger.Warn("failed to queue response for caching", "error", err)
+		}
+		return
+	}
+
+	entry := &api.CacheEntry{
+		Request:   *req,
+		Response:  *live,
+		Embedding: emb,
+		CreatedAt: time.Now(),
+		HitCount:  0,
+		LastHitAt: time.Now(),
+
+		EmbeddingModel: embeddingModel,
+	}
+	if err := h.cache.Set(ctx, entry); errors.Is(err, cache.ErrDimensionMismatch) {
+		h.logger.Warn("embedding dimension changed; clear the cache or restore the previous embedding model", "error", err)
+	} else if errors.Is(err, cache.ErrFormatMismatch) {
+		h.logger.Debug("skipping cache for response not matching response_format")
+	} else if errors.Is(err, cache.ErrLowConfidence) {
+		h.logger.Debug("skipping cache for low-confidence response")
+	} else if errors.Is(err, cache.ErrToolCalls) {
+		h.logger.Debug("skipping cache for response with tool calls")
+	} else if err != nil {
+		h.logger.Warn("failed to cache response", "error", err)
+	} else {
+		h.logger.Debug("cached response", "model", live.Model)
+	}
+}
+
+// revalidate refreshes a stale hit in the background: it sends req
+// upstream unstreamed and caches the response with emb, replacing the
+// stale entry. The refresh outlives the client's request; only one runs
+// per request at a time.
+func (h *Handler) revalidate(ctx context.Context, r *http.Request, req *api.ChatCompletionRequest, body []byte, entry *api.CacheEntry, emb []float64, embeddingModel string) {
+	if !entry.Stale {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	r = r.Clone(ctx)
+	if req.Stream {
+		body = unstreamed(body)
+	}
+
+	h.flights.refresh(flightKey(ctx, req), func() *api.ChatCompletionResponse {
+		resp, respBody, err := h.doUpstreamRequest(ctx, r, body)
+		if err != nil {
+			h.logger.Warn("failed to refresh stale entry", "error", err)
+			return nil
+		}
+		var live api.ChatCompletionResponse
+		if resp.StatusCode != http.StatusOK || json.Unmarshal(respBody, &live) != nil {
+			h.logger.Debug("upstream refused refresh of stale entry", "status", resp.StatusCode)
+			return nil
 		}
-		sb.WriteString("\n")
+		shared := share(&live)
+		h.storeResponse(ctx, req, &live, emb, embeddingModel)
+		h.logger.Debug("refreshed stale entry", "entry_id", entry.ID)
+		return shared
+	})
+}
+
+// unstreamed returns a request body asking for a single JSON response
+// instead of an event stream. Unknown fields are passed through.
+func unstreamed(body []byte) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	delete(fields, "stream")
+	delete(fields, "stream_options")
+	if b, err := json.Marshal(fields); err == nil {
+		return b
+	}
+	return body
+}
+
+// recordShadow is the default Options.OnShadow: it logs a would-be hit
+// and counts whether it matched upstream. A remembered failure matches
+// when upstream failed too.
+func (h *Handler) recordShadow(hit *api.CacheEntry, similarity float64, live *api.ChatCompletionResponse) {
+	var match bool
+	if hit.Negative || live == nil {
+		match = hit.Negative && live == nil
+	} else {
+		match = cache.ResponsesMatch(&hit.Response, live)
 	}
 
-	return sb.String()
+	h.metrics.ObserveShadow(match)
+	h.logger.Info("shadow hit",
+		"similarity", fmt.Sprintf("%.4f", similarity),
+		"match", match,
+		"entry_id", hit.ID,
+	)
+}
+
+// isNegativeCacheable reports whether an upstream status is a failure that
+// would recur for the same prompt. Auth, timeout and rate-limit errors
+// depend on the caller or the moment rather than the prompt.
+func isNegativeCacheable(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return status >= 400 && status < 500
+}
+
+// embedRequest embeds input, or, when turns is set, embeds each turn in
+// one batch and merges them with combine.
+func embedRequest(ctx context.Context, e embedding.Embedder, input string, turns []string, combine func([][]float64) []float64) ([]float64, error) {
+	if len(turns) == 0 {
+		return e.Embed(ctx, input)
+	}
+	embs, err := e.EmbedBatch(ctx, turns)
+	if err != nil {
+		return nil, err
+	}
+	return combine(embs), nil
+}
+
+// generateCacheKey creates a cache key from the request messages.
+func (h *Handler) generateCacheKey(req api.ChatCompletionRequest) string {
+	return h.policy.EmbeddingInput(&req)
 }
 
 // forwardRequest forwards a request to the upstream without caching.
@@ -234,13 +515,69 @@ func (h *Handler) forwardRequest(w http.ResponseWriter, r *http.Request, body []
 	w.Write(respBody)
 }
 
-// doUpstreamRequest sends a request to the upstream OpenAI API.
-func (h *Handler) doUpstreamRequest(ctx context.Context, r *http.Request, body []byte) (*http.Response, []byte, error) {
+// streamRequest forwards a request to the upstream, relaying the response
+// body to the client as it arrives so streamed chunks aren't delayed. A
+// successful event stream is assembled as it passes and returned once
+// complete, for caching; anything else returns nil.
+func (h *Handler) streamRequest(w http.ResponseWriter, r *http.Request, body []byte) *api.ChatCompletionResponse {
+	req, err := h.newUpstreamRequest(r.Context(), r, body)
+	if err != nil {
+		h.writeError(w, "Upstream request failed", http.StatusBadGateway)
+		return nil
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		h.logger.Error("upstream request failed", "error", err)
+		h.writeError(w, "Upstream request failed", http.StatusBadGateway)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	if resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		live, err := teeStream(w, resp.Body)
+		if errors.Is(err, errClientGone) || r.Context().Err() != nil {
+			h.logger.Debug("client disconnected mid-stream, not caching")
+		} else if err != nil {
+			h.logger.Warn("upstream stream interrupted", "error", err)
+		}
+		return live
+	}
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				// Client went away
+				return nil
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				h.logger.Warn("upstream stream interrupted", "error", err)
+			}
+			return nil
+		}
+	}
+}
+
+// newUpstreamRequest builds the upstream request for r, passing through
+// the client's headers, including its Authorization.
+func (h *Handler) newUpstreamRequest(ctx context.Context, r *http.Request, body []byte) (*http.Request, error) {
 	upstreamURL := h.cfg.OpenAIBaseURL + r.URL.Path
 
 	req, err := http.NewRequestWithContext(ctx, r.Method, upstreamURL, bytes.NewReader(body))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// Copy headers
@@ -252,6 +589,15 @@ func (h *Handler) doUpstreamRequest(ctx context.Context, r *http.Request, body [
 	if req.Header.Get("Authorization") == "" {
 		req.Header.Set("Authorization", "Bearer "+h.cfg.OpenAIAPIKey)
 	}
+	return req, nil
+}
+
+// doUpstreamRequest sends a request to the upstream OpenAI API.
+func (h *Handler) doUpstreamRequest(ctx context.Context, r *http.Request, body []byte) (*http.Response, []byte, error) {
+	req, err := h.newUpstreamRequest(ctx, r, body)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	resp, err := h.client.Do(req)
 	if err != nil {
@@ -313,6 +659,98 @@ func (h *Handler) handleClearLogs(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "cleared"})
 }
 
+// servable reports whether a cached entry may answer req. A similar
+// prompt's response may not satisfy this request's response_format, have
+// as many choices as its n asks for, or have been generated with other
+// stop sequences or max_tokens, so such hits are treated as misses. A
+// remembered failure answers only the identical request.
+func (h *Handler) servable(req *api.ChatCompletionRequest, entry *api.CacheEntry) bool {
+	if entry.Negative {
+		// A failure is replayed only for the request that caused it, and
+		// an expired one is retried rather than replayed
+		if entry.RequestHash != api.RequestHash(req) || !cache.GenerationMatches(req, &entry.Request, &entry.Response) {
+			h.logger.Debug("ignoring negative cache hit for another request", "entry_id", entry.ID)
+			return false
+		}
+		return !entry.Stale
+	}
+	if reason := hitMismatch(req, entry); reason != "" {
+		h.logger.Debug("ignoring cache hit "+reason, "entry_id", entry.ID)
+		return false
+	}
+	return true
+}
+
+// hitMismatch returns why a cached completion cannot answer req, or ""
+// if it can.
+func hitMismatch(req *api.ChatCompletionRequest, entry *api.CacheEntry) string {
+	switch {
+	case !cache.ResponseMatchesFormat(req, &entry.Response):
+		return "not matching response_format"
+	case !cache.ResponseHasChoices(req, &entry.Response):
+		return fmt.Sprintf("with too few choices for n=%d", cache.RequestedChoices(req))
+	case !cache.GenerationMatches(req, &entry.Request, &entry.Response):
+		return "generated with other parameters"
+	}
+	return ""
+}
+
+// serveHit writes a cached response, or replays a cached upstream failure
+// for negative entries, and records the hit.
+func (h *Handler) serveHit(w http.ResponseWriter, req *api.ChatCompletionRequest, entry *api.CacheEntry, similarity float64, cacheKey string, startTime time.Time) {
+	if entry.Negative {
+		// Known-bad prompt: fail fast instead of hitting upstream again
+		h.logger.Info("negative cache hit",
+			"similarity", fmt.Sprintf("%.4f", similarity),
+			"status", entry.StatusCode,
+		)
+		apiErr := api.APIError{Message: http.StatusText(entry.StatusCode), Type: "upstream_error"}
+		if entry.Error != nil {
+			apiErr = *entry.Error
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(HeaderCache, "NEGATIVE")
+		w.WriteHeader(entry.StatusCode)
+		json.NewEncoder(w).Encode(api.ErrorResponse{Error: apiErr})
+		return
+	}
+
+	latencyMs := time.Since(startTime).Milliseconds()
+	h.logger.Info("cache hit",
+		"similarity", fmt.Sprintf("%.4f", similarity),
+		"latency_ms", latencyMs,
+	)
+	if similarity < h.cfg.RiskyThreshold {
+		h.logger.Warn("risky cache hit",
+			"similarity", fmt.Sprintf("%.4f", similarity),
+			"risky_threshold", h.cfg.RiskyThreshold,
+			"prompt", truncatePrompt(cacheKey, 80),
+		)
+	}
+
+	// Record metrics - estimate tokens saved based on response
+	tokensSaved := entry.Response.Usage.TotalTokens
+	h.collector.RecordRequest(true, similarity, latencyMs, tokensSaved, cacheKey)
+	h.metrics.ObserveSimilarity(similarity)
+	h.collector.AddLog("hit", fmt.Sprintf("[HIT] %.2f%% sim, %dms - %s", similarity*100, latencyMs, truncatePrompt(cacheKey, 80)))
+
+	// Return cached response with cache header, with as many choices as
+	// requested
+	cache.TrimChoices(req, &entry.Response)
+	SetHitHeaders(w.Header(), cache.SearchResult{Entry: entry, Similarity: similarity}, time.Now())
+	if req.Stream {
+		// Replay the cached response as the chunks upstream would send
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		if err := api.WriteStream(w, &entry.Response, api.DefaultStreamChunkSize); err != nil {
+			h.logger.Debug("failed to stream cached response", "error", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry.Response)
+}
+
 // truncatePrompt truncates a prompt for display.
 func truncatePrompt(s string, maxLen int) string {
 	s = strings.ReplaceAll(s, "\n", " ")
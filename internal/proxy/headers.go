@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aqstack/mimir/internal/cache"
+)
+
+// Response headers describing how a request was served.
+const (
+	HeaderCache      = "X-Mimir-Cache"
+	HeaderSimilarity = "X-Mimir-Similarity"
+	HeaderEntryAge   = "X-Mimir-Entry-Age"
+)
+
+// SetHitHeaders marks a response as served from the cache, recording the
+// match's similarity and how long ago its entry was stored, e.g.
+//
+//	X-Mimir-Cache: HIT
+//	X-Mimir-Similarity: 0.9730
+//	X-Mimir-Entry-Age: 42s
+//
+// Stale entries, served while they are refreshed, are marked STALE.
+func SetHitHeaders(h http.Header, hit cache.SearchResult, now time.Time) {
+	if hit.Entry.Stale {
+		h.Set(HeaderCache, "STALE")
+	} else {
+		h.Set(HeaderCache, "HIT")
+	}
+	h.Set(HeaderSimilarity, fmt.Sprintf("%.4f", hit.Similarity))
+	if created := hit.Entry.CreatedAt; !created.IsZero() {
+		age := now.Sub(created).Round(time.Second)
+		if age < 0 {
+			age = 0
+		}
+		h.Set(HeaderEntryAge, age.String())
+	}
+}
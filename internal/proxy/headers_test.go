@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/internal/cache"
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+func TestSetHitHeaders(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		created   time.Time
+		stale     bool
+		wantCache string
+		wantAge   string
+	}{
+		{"seconds", now.Add(-42 * time.Second), false, "HIT", "42s"},
+		{"rounded", now.Add(-90*time.Second - 400*time.Millisecond), false, "HIT", "1m30s"},
+		{"clock skew", now.Add(time.Second), false, "HIT", "0s"},
+		{"unknown creation time", time.Time{}, false, "HIT", ""},
+		{"stale", now.Add(-time.Hour), true, "STALE", "1h0m0s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			SetHitHeaders(h, cache.SearchResult{
+				Entry:      &api.CacheEntry{CreatedAt: tt.created, Stale: tt.stale},
+				Similarity: 0.97301,
+			}, now)
+
+			if got := h.Get(HeaderCache); got != tt.wantCache {
+				t.Errorf("expected %s %s, got %q", HeaderCache, tt.wantCache, got)
+			}
+			if got := h.Get(HeaderSimilarity); got != "0.9730" {
+				t.Errorf("expected similarity 0.9730, got %q", got)
+			}
+			if got := h.Get(HeaderEntryAge); got != tt.wantAge {
+				t.Errorf("expected age %q, got %q", tt.wantAge, got)
+			}
+		})
+	}
+}
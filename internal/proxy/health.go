@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aqstack/mimir/internal/embedding"
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+const (
+	// probeTTL is how long an embedder probe's result is reused, so
+	// frequent readiness checks don't hammer the embedder.
+	probeTTL = 5 * time.Second
+	// probeTimeout bounds a single embedder probe.
+	probeTimeout = 2 * time.Second
+)
+
+// embedderProbe remembers the outcome of the last embedder probe.
+type embedderProbe struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// check probes e unless the last probe is recent, and returns its error.
+// Memoized vectors are bypassed, so the probe reaches the provider.
+func (p *embedderProbe) check(ctx context.Context, e embedding.Embedder) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.checkedAt.IsZero() && time.Since(p.checkedAt) < probeTTL {
+		return p.err
+	}
+
+	// A readiness request hanging up must not fail the cached result
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), probeTimeout)
+	defer cancel()
+	_, p.err = embedding.Uncached(e).Embed(ctx, "readiness probe")
+	p.checkedAt = time.Now()
+	return p.err
+}
+
+// readiness is the body of a /readyz response.
+type readiness struct {
+	Status   string          `json:"status"` // "ready" or "not ready"
+	Embedder embedderHealth  `json:"embedder"`
+	Cache    *api.CacheStats `json:"cache"`
+}
+
+// embedderHealth describes the embedder in a /readyz response.
+type embedderHealth struct {
+	Model     string `json:"model"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// handleReady handles readiness checks. It probes the embedder and reports
+// cache statistics, failing with 503 when the embedder is unreachable and
+// ReadyRequiresEmbedder is set.
+func (h *Handler) handleReady(w http.ResponseWriter, r *http.Request) {
+	status := readiness{
+		Status:   "ready",
+		Embedder: embedderHealth{Model: h.embedder.Model(), Reachable: true},
+		Cache:    h.cache.Stats(r.Context()),
+	}
+	code := http.StatusOK
+	if err := h.probe.check(r.Context(), h.embedder); err != nil {
+		status.Embedder.Reachable = false
+		status.Embedder.Error = err.Error()
+		if h.cfg.ReadyRequiresEmbedder {
+			status.Status = "not ready"
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
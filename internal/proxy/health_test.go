@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aqstack/mimir/internal/cache"
+	"github.com/aqstack/mimir/internal/config"
+	"github.com/aqstack/mimir/internal/embedding"
+	"github.com/aqstack/mimir/internal/logger"
+)
+
+// flakyEmbedder fails while down and counts calls.
+type flakyEmbedder struct {
+	*embedding.HashEmbedder
+	down  bool
+	calls int
+}
+
+func (e *flakyEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	e.calls++
+	if e.down {
+		return nil, errors.New("connection refused")
+	}
+	return e.HashEmbedder.Embed(ctx, text)
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name            string
+		down            bool
+		requireEmbedder bool
+		wantCode        int
+		wantStatus      string
+	}{
+		{"embedder up", false, true, http.StatusOK, "ready"},
+		{"embedder down", true, true, http.StatusServiceUnavailable, "not ready"},
+		{"embedder down but not required", true, false, http.StatusOK, "ready"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cache.NewMemoryCache(cache.DefaultOptions())
+			defer c.Close()
+			cfg := config.DefaultConfig()
+			cfg.ReadyRequiresEmbedder = tt.requireEmbedder
+			e := &flakyEmbedder{HashEmbedder: embedding.NewHashEmbedder(8), down: tt.down}
+			// Memoized vectors must not answer the probe
+			h := NewHandler(cfg, c, embedding.NewCachingEmbedder(e, 10), logger.New(false))
+
+			for i := 0; i < 2; i++ {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+				if rec.Code != tt.wantCode {
+					t.Fatalf("expected %d, got %d", tt.wantCode, rec.Code)
+				}
+				var body readiness
+				if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+					t.Fatalf("invalid body: %v", err)
+				}
+				if body.Status != tt.wantStatus || body.Embedder.Reachable == tt.down || body.Cache == nil {
+					t.Errorf("unexpected body %+v", body)
+				}
+			}
+
+			// The second check reuses the first probe
+			if e.calls != 1 {
+				t.Errorf("expected 1 probe, got %d", e.calls)
+			}
+		})
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	c := cache.NewMemoryCache(cache.DefaultOptions())
+	defer c.Close()
+	e := &flakyEmbedder{HashEmbedder: embedding.NewHashEmbedder(8), down: true}
+	h := NewHandler(config.DefaultConfig(), c, e, logger.New(false))
+
+	// Liveness doesn't depend on the embedder
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK || e.calls != 0 {
+		t.Errorf("expected 200 without probing, got %d after %d calls", rec.Code, e.calls)
+	}
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"context"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aqstack/mimir/internal/cache"
+	"github.com/aqstack/mimir/internal/embedding"
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// Loader pairs a cache with the embedder its entries are made with, for
+// callers outside the HTTP handler that want cached completions without
+// writing the embed, look up, compute and store sequence themselves.
+type Loader struct {
+	cache    cache.Cache
+	embedder embedding.Embedder
+	policy   *cache.Options
+	flights  flightGroup
+}
+
+// NewLoader creates a loader looking up and storing in c. The policy
+// decides which requests are cached, how they are embedded, the
+// similarity threshold and OnEmbedError; nil uses cache.DefaultOptions.
+func NewLoader(c cache.Cache, e embedding.Embedder, policy *cache.Options) *Loader {
+	if policy == nil {
+		policy = cache.DefaultOptions()
+	}
+	return &Loader{cache: c, embedder: e, policy: policy}
+}
+
+// GetOrCompute returns the cached completion for req if there is one, and
+// otherwise calls compute and caches its result. The bool reports a hit.
+// Concurrent misses for the same request call compute once: the rest
+// wait for it and get its result as a hit, or call compute themselves if
+// it failed. Requests the policy doesn't cache go straight to compute. A
+// compute error is returned as is, and nothing is stored.
+//
+// Failing to cache never loses a computed response: rejected stores are
+// skipped, and if req cannot be embedded the response is returned with
+// the error OnEmbedError makes of it, nil under cache.EmbedErrorSkip.
+//
+// A stale hit (see cache.Options.StaleWhileRevalidate) is returned at
+// once and refreshed by calling compute in the background, so compute
+// may run after GetOrCompute returns and must not depend on ctx.
+func (l *Loader) GetOrCompute(ctx context.Context, req *api.ChatCompletionRequest, compute func() (api.ChatCompletionResponse, error)) (api.ChatCompletionResponse, bool, error) {
+	if !l.policy.ShouldCache(req) {
+		resp, err := compute()
+		return resp, false, err
+	}
+
+	input := l.policy.EmbeddingInput(req)
+	ctx = cache.WithModel(ctx, req.Model)
+	ctx = cache.WithInputLength(ctx, utf8.RuneCountInString(input))
+
+	if entry, found := l.cache.GetExact(ctx, req); found && l.usable(req, entry) {
+		l.revalidate(ctx, req, entry, entry.Embedding, entry.EmbeddingModel, compute)
+		return hitResponse(req, entry), true, nil
+	}
+
+	embedCtx, usedModel := embedding.WithModelReport(ctx)
+	emb, embedErr := embedRequest(embedCtx, l.embedder, input, l.policy.EmbeddingTurns(req), l.policy.CombineTurns)
+	embeddingModel := l.embedder.Model()
+	if m := usedModel(); m != "" {
+		embeddingModel = m
+	}
+	if embedErr == nil {
+		ctx = cache.WithEmbeddingModel(ctx, embeddingModel)
+		if entry, _, found := l.cache.Get(ctx, emb, l.policy.SimilarityThreshold); found && l.usable(req, entry) {
+			l.revalidate(ctx, req, entry, emb, embeddingModel, compute)
+			return hitResponse(req, entry), true, nil
+		}
+	}
+
+	key := flightKey(ctx, req)
+	f, leader := l.flights.join(key)
+	var shared *api.ChatCompletionResponse
+	if leader {
+		defer func() { l.flights.land(key, f, shared) }()
+	} else if resp := f.wait(ctx); resp != nil {
+		return *resp, true, nil
+	}
+
+	resp, err := compute()
+	if err != nil {
+		return resp, false, err
+	}
+	shared = share(&resp)
+	if embedErr != nil {
+		return resp, false, l.policy.OnEmbedError.Handle(embedErr)
+	}
+
+	l.store(ctx, req, &resp, emb, embeddingModel)
+	return resp, false, nil
+}
+
+// revalidate refreshes a stale hit in the background with compute,
+// caching the result for req with emb. Only one refresh runs per request
+// at a time; a failed one leaves the stale entry in place.
+func (l *Loader) revalidate(ctx context.Context, req *api.ChatCompletionRequest, entry *api.CacheEntry, emb []float64, embeddingModel string, compute func() (api.ChatCompletionResponse, error)) {
+	if !entry.Stale {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	r := req.Clone()
+	req = &r
+	l.flights.refresh(flightKey(ctx, req), func() *api.ChatCompletionResponse {
+		resp, err := compute()
+		if err != nil {
+			return nil
+		}
+		shared := share(&resp)
+		l.store(ctx, req, &resp, emb, embeddingModel)
+		return shared
+	})
+}
+
+// store caches resp for req, ignoring rejections. The cache may scrub
+// what it stores, so it is given copies.
+func (l *Loader) store(ctx context.Context, req *api.ChatCompletionRequest, resp *api.ChatCompletionResponse, emb []float64, embeddingModel string) {
+	now := time.Now()
+	l.cache.Set(ctx, &api.CacheEntry{
+		Request:   req.Clone(),
+		Response:  resp.Clone(),
+		Embedding: emb,
+		CreatedAt: now,
+		LastHitAt: now,
+
+		EmbeddingModel: embeddingModel,
+	})
+}
+
+// hitResponse returns a copy of the response cached in entry with as many
+// choices as req asks for.
+func hitResponse(req *api.ChatCompletionRequest, entry *api.CacheEntry) api.ChatCompletionResponse {
+	resp := entry.Response.Clone()
+	cache.TrimChoices(req, &resp)
+	return resp
+}
+
+// usable reports whether a cached entry can answer req. Remembered
+// upstream failures are left to the handler, which replays them.
+func (l *Loader) usable(req *api.ChatCompletionRequest, entry *api.CacheEntry) bool {
+	return !entry.Negative && hitMismatch(req, entry) == ""
+}
@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/internal/cache"
+	"github.com/aqstack/mimir/internal/embedding"
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+func TestLoaderGetOrCompute(t *testing.T) {
+	ctx := context.Background()
+	upstreamErr := errors.New("upstream unavailable")
+
+	tests := []struct {
+		name         string
+		policy       func(*cache.Options)
+		embedderDown bool
+		computeErr   error
+		wantCalls    int // compute calls over two identical requests
+		wantHit      bool
+		wantErr      error
+	}{
+		{name: "miss then hit", wantCalls: 1, wantHit: true},
+		{name: "compute error is not cached", computeErr: upstreamErr, wantCalls: 2, wantErr: upstreamErr},
+		{
+			name:      "uncacheable request",
+			policy:    func(o *cache.Options) { o.RequireSeed = true },
+			wantCalls: 2,
+		},
+		{name: "embed error skipped", embedderDown: true, wantCalls: 2},
+		{
+			name:         "embed error propagated",
+			policy:       func(o *cache.Options) { o.OnEmbedError = cache.EmbedErrorPropagate },
+			embedderDown: true,
+			wantCalls:    2,
+			wantErr:      cache.ErrEmbedFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := cache.DefaultOptions()
+			if tt.policy != nil {
+				tt.policy(policy)
+			}
+			c := cache.NewMemoryCache(cache.DefaultOptions())
+			defer c.Close()
+			e := &flakyEmbedder{HashEmbedder: embedding.NewHashEmbedder(64), down: tt.embedderDown}
+			l := NewLoader(c, e, policy)
+
+			calls := 0
+			compute := func() (api.ChatCompletionResponse, error) {
+				calls++
+				return *testResponse(), tt.computeErr
+			}
+
+			req := testRequest("what is the capital of france")
+			var hit bool
+			var err error
+			for i := 0; i < 2; i++ {
+				var resp api.ChatCompletionResponse
+				resp, hit, err = l.GetOrCompute(ctx, req, compute)
+				if err == nil && resp.ID != "resp" {
+					t.Errorf("expected the computed response, got %q", resp.ID)
+				}
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d compute calls, got %d", tt.wantCalls, calls)
+			}
+			if hit != tt.wantHit {
+				t.Errorf("expected hit=%v on the second request, got %v", tt.wantHit, hit)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoaderCollapsesConcurrentMisses(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache(cache.DefaultOptions())
+	defer c.Close()
+	l := NewLoader(c, embedding.NewHashEmbedder(64), nil)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	compute := func() (api.ChatCompletionResponse, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return *testResponse(), nil
+	}
+
+	const followers = 4
+	req := testRequest("what is the capital of france")
+	hits := make(chan bool, followers+1)
+	var wg sync.WaitGroup
+	run := func() {
+		defer wg.Done()
+		resp, hit, err := l.GetOrCompute(ctx, req, compute)
+		if err != nil || resp.ID != "resp" {
+			t.Errorf("expected the computed response, got %q (%v)", resp.ID, err)
+		}
+		hits <- hit
+	}
+
+	wg.Add(1)
+	go run()
+	<-started
+	for i := 0; i < followers; i++ {
+		wg.Add(1)
+		go run()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(hits)
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected compute to run once, ran %d times", got)
+	}
+	var hitCount int
+	for hit := range hits {
+		if hit {
+			hitCount++
+		}
+	}
+	if hitCount != followers {
+		t.Errorf("expected %d hits for the waiting requests, got %d", followers, hitCount)
+	}
+}
+
+func TestLoaderTrimsChoices(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache(cache.DefaultOptions())
+	defer c.Close()
+	l := NewLoader(c, embedding.NewHashEmbedder(64), nil)
+
+	three, one := 3, 1
+	req := testRequest("what is the capital of france")
+	req.N = &three
+	resp := testResponse()
+	resp.Choices = append(resp.Choices, resp.Choices[0], resp.Choices[0])
+	resp.Choices[1].Index, resp.Choices[2].Index = 1, 2
+	if _, _, err := l.GetOrCompute(ctx, req, func() (api.ChatCompletionResponse, error) { return *resp, nil }); err != nil {
+		t.Fatalf("GetOrCompute failed: %v", err)
+	}
+
+	single := testRequest("what is the capital of france")
+	single.N = &one
+	got, hit, err := l.GetOrCompute(ctx, single, func() (api.ChatCompletionResponse, error) {
+		t.Error("expected a hit, not a compute")
+		return *testResponse(), nil
+	})
+	if err != nil || !hit {
+		t.Fatalf("expected a hit, got hit=%v (%v)", hit, err)
+	}
+	if len(got.Choices) != 1 {
+		t.Errorf("expected 1 choice for n=1, got %d", len(got.Choices))
+	}
+
+	// The cached entry keeps all its choices
+	got, _, _ = l.GetOrCompute(ctx, req, nil)
+	if len(got.Choices) != 3 {
+		t.Errorf("expected 3 choices for n=3, got %d", len(got.Choices))
+	}
+}
+
+func TestLoaderRevalidatesStaleHit(t *testing.T) {
+	ctx := context.Background()
+	opts := cache.DefaultOptions()
+	opts.StaleWhileRevalidate = time.Hour
+	c := cache.NewMemoryCache(opts)
+	defer c.Close()
+	e := embedding.NewHashEmbedder(64)
+	l := NewLoader(c, e, nil)
+
+	req := testRequest("what is the capital of france")
+	emb, err := e.Embed(ctx, l.policy.EmbeddingInput(req))
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	old := testResponse()
+	old.ID = "old"
+	if err := c.Set(ctx, &api.CacheEntry{
+		Request:   *req,
+		Response:  *old,
+		Embedding: emb,
+		CreatedAt: time.Now().Add(-2 * time.Hour),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	refreshed := make(chan struct{})
+	resp, hit, err := l.GetOrCompute(ctx, req, func() (api.ChatCompletionResponse, error) {
+		defer close(refreshed)
+		return *testResponse(), nil
+	})
+	if err != nil || !hit || resp.ID != "old" {
+		t.Fatalf("expected the stale response as a hit, got %q hit=%v (%v)", resp.ID, hit, err)
+	}
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("stale entry was not refreshed")
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		entry, found := c.GetExact(ctx, req)
+		if found && !entry.Stale && entry.Response.ID == "resp" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("refreshed response was not cached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -34,7 +34,8 @@ func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Mimir-Namespace, X-Mimir-Threshold")
+		w.Header().Set("Access-Control-Expose-Headers", HeaderCache+", "+HeaderSimilarity+", "+HeaderEntryAge)
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
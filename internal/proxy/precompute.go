@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aqstack/mimir/internal/cache"
+	"github.com/aqstack/mimir/internal/embedding"
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// PrecomputeOptions configures a Precomputer.
+type PrecomputeOptions struct {
+	// QueueSize is the number of pending stores buffered before new ones
+	// are dropped. Defaults to 256.
+	QueueSize int
+	// Workers is the number of goroutines embedding and storing queued
+	// responses. Defaults to 1.
+	Workers int
+	// Input returns the text to embed for a request. Defaults to
+	// api.RequestEmbeddingInput.
+	Input func(req *api.ChatCompletionRequest) string
+	// Turns, if set, returns the messages of a request to embed one by
+	// one and merge with Combine in place of Input; it returns nil for
+	// requests embedded whole.
+	Turns   func(req *api.ChatCompletionRequest) []string
+	Combine func(embeddings [][]float64) []float64
+	// OnEmbedError selects whether a response that fails to embed is
+	// dropped silently or reported to OnError. Defaults to
+	// cache.EmbedErrorSkip.
+	OnEmbedError cache.EmbedErrorPolicy
+	// OnError, if set, is called when a queued response fails to store,
+	// or to embed under cache.EmbedErrorPropagate.
+	OnError func(req *api.ChatCompletionRequest, err error)
+}
+
+// precomputeJob is a response waiting to be embedded and stored.
+type precomputeJob struct {
+	ctx  context.Context
+	req  api.ChatCompletionRequest
+	resp api.ChatCompletionResponse
+}
+
+// Precomputer embeds and stores upstream responses off the request path,
+// so a miss is returned as soon as upstream answers. Pending stores are
+// held in a bounded queue; when it is full new ones are dropped and
+// counted rather than slowing requests down.
+type Precomputer struct {
+	cache    cache.Cache
+	embedder embedding.Embedder
+	opts     *PrecomputeOptions
+	queue    chan precomputeJob
+	wg       sync.WaitGroup
+	dropped  atomic.Int64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewPrecomputer creates a precomputer storing into c and starts its
+// workers.
+func NewPrecomputer(c cache.Cache, e embedding.Embedder, opts *PrecomputeOptions) *Precomputer {
+	if opts == nil {
+		opts = &PrecomputeOptions{}
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 256
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.Input == nil {
+		opts.Input = api.RequestEmbeddingInput
+	}
+
+	p := &Precomputer{
+		cache:    c,
+		embedder: e,
+		opts:     opts,
+		queue:    make(chan precomputeJob, opts.QueueSize),
+	}
+	for i := 0; i < opts.Workers; i++ {
+		p.wg.Add(1)
+		go p.run()
+	}
+	return p
+}
+
+// run stores queued responses until the queue is closed.
+func (p *Precomputer) run() {
+	defer p.wg.Done()
+	for job := range p.queue {
+		if err := p.store(job); err != nil && p.opts.OnError != nil {
+			p.opts.OnError(&job.req, err)
+		}
+	}
+}
+
+// store embeds the request as a document and caches the response.
+func (p *Precomputer) store(job precomputeJob) error {
+	ctx, usedModel := embedding.WithModelReport(embedding.WithInputType(job.ctx, embedding.InputTypeDocument))
+	var turns []string
+	if p.opts.Turns != nil && p.opts.Combine != nil {
+		turns = p.opts.Turns(&job.req)
+	}
+	emb, err := embedRequest(ctx, p.embedder, p.opts.Input(&job.req), turns, p.opts.Combine)
+	if err != nil {
+		return p.opts.OnEmbedError.Handle(err)
+	}
+	embeddingModel := p.embedder.Model()
+	if m := usedModel(); m != "" {
+		embeddingModel = m
+	}
+
+	now := time.Now()
+	entry := &api.CacheEntry{
+		Request:   job.req,
+		Response:  job.resp,
+		Embedding: emb,
+		CreatedAt: now,
+		LastHitAt: now,
+
+		EmbeddingModel: embeddingModel,
+	}
+	return p.cache.Set(job.ctx, entry)
+}
+
+// SetAsync queues resp to be embedded and stored for req, and returns
+// without waiting. When the queue is full the response is dropped and
+// counted. The context's values (e.g. the namespace) apply to the store,
+// but its cancellation does not. SetAsync returns cache.ErrCacheClosed
+// after Close.
+func (p *Precomputer) SetAsync(ctx context.Context, req *api.ChatCompletionRequest, resp *api.ChatCompletionResponse) error {
+	job := precomputeJob{ctx: context.WithoutCancel(ctx), req: *req, resp: *resp}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return cache.ErrCacheClosed
+	}
+
+	select {
+	case p.queue <- job:
+	default:
+		p.dropped.Add(1)
+	}
+	return nil
+}
+
+// Depth returns the number of responses waiting to be stored.
+func (p *Precomputer) Depth() int {
+	return len(p.queue)
+}
+
+// Dropped returns the number of responses dropped because the queue was
+// full.
+func (p *Precomputer) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+// Close stops accepting responses and waits for queued ones to be stored.
+// It does not close the cache. It is safe to call more than once.
+func (p *Precomputer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.queue)
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return nil
+}
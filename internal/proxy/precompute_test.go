@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/internal/cache"
+	"github.com/aqstack/mimir/internal/embedding"
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// blockingEmbedder waits for release before embedding.
+type blockingEmbedder struct {
+	*embedding.HashEmbedder
+	release chan struct{}
+}
+
+func (e *blockingEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	<-e.release
+	return e.HashEmbedder.Embed(ctx, text)
+}
+
+func testRequest(prompt string) *api.ChatCompletionRequest {
+	return &api.ChatCompletionRequest{
+		Model:    "test-model",
+		Messages: []api.Message{{Role: "user", Content: prompt}},
+	}
+}
+
+func testResponse() *api.ChatCompletionResponse {
+	return &api.ChatCompletionResponse{
+		ID:    "resp",
+		Model: "test-model",
+		Choices: []api.Choice{{
+			Message:      api.Message{Role: "assistant", Content: "answer"},
+			FinishReason: "stop",
+		}},
+	}
+}
+
+func TestPrecomputer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("stores in the background", func(t *testing.T) {
+		c := cache.NewMemoryCache(cache.DefaultOptions())
+		defer c.Close()
+		embedder := embedding.NewHashEmbedder(64)
+		p := NewPrecomputer(c, embedder, nil)
+
+		req := testRequest("what is the capital of france")
+		if err := p.SetAsync(ctx, req, testResponse()); err != nil {
+			t.Fatalf("SetAsync: %v", err)
+		}
+		p.Close()
+
+		emb, _ := embedder.Embed(ctx, api.RequestEmbeddingInput(req))
+		entry, _, found := c.Get(ctx, emb, 0.99)
+		if !found {
+			t.Fatal("expected response to be cached after Close")
+		}
+		if entry.Response.ID != "resp" {
+			t.Errorf("unexpected cached response %q", entry.Response.ID)
+		}
+	})
+
+	t.Run("drops when the queue is full", func(t *testing.T) {
+		c := cache.NewMemoryCache(cache.DefaultOptions())
+		defer c.Close()
+		embedder := &blockingEmbedder{embedding.NewHashEmbedder(64), make(chan struct{})}
+		p := NewPrecomputer(c, embedder, &PrecomputeOptions{QueueSize: 1})
+
+		// One is taken by the worker, one fills the queue, the rest drop
+		for i := 0; i < 4; i++ {
+			p.SetAsync(ctx, testRequest(string(rune('a'+i))), testResponse())
+			time.Sleep(5 * time.Millisecond)
+		}
+		if got := p.Depth(); got != 1 {
+			t.Errorf("expected depth 1, got %d", got)
+		}
+		if got := p.Dropped(); got != 2 {
+			t.Errorf("expected 2 dropped, got %d", got)
+		}
+
+		close(embedder.release)
+		p.Close()
+		if got := c.Size(ctx); got != 2 {
+			t.Errorf("expected 2 stored, got %d", got)
+		}
+	})
+
+	t.Run("reports errors and rejects after close", func(t *testing.T) {
+		c := cache.NewMemoryCache(cache.DefaultOptions())
+		defer c.Close()
+
+		var mu sync.Mutex
+		var errs []error
+		p := NewPrecomputer(c, embedding.NewHashEmbedder(64), &PrecomputeOptions{
+			OnError: func(req *api.ChatCompletionRequest, err error) {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			},
+		})
+
+		// Responses not matching response_format are rejected by the cache
+		req := testRequest("give me json")
+		req.ResponseFormat = &api.ResponseFormat{Type: "json_object"}
+		p.SetAsync(ctx, req, testResponse())
+		p.Close()
+
+		if len(errs) != 1 || !errors.Is(errs[0], cache.ErrFormatMismatch) {
+			t.Errorf("expected one ErrFormatMismatch, got %v", errs)
+		}
+		if err := p.SetAsync(ctx, testRequest("late"), testResponse()); !errors.Is(err, cache.ErrCacheClosed) {
+			t.Errorf("expected ErrCacheClosed, got %v", err)
+		}
+	})
+	t.Run("embed errors follow the policy", func(t *testing.T) {
+		for _, policy := range []cache.EmbedErrorPolicy{cache.EmbedErrorSkip, cache.EmbedErrorPropagate} {
+			c := cache.NewMemoryCache(cache.DefaultOptions())
+			var errs []error
+			p := NewPrecomputer(c, &flakyEmbedder{HashEmbedder: embedding.NewHashEmbedder(64), down: true}, &PrecomputeOptions{
+				OnEmbedError: policy,
+				OnError: func(req *api.ChatCompletionRequest, err error) {
+					errs = append(errs, err)
+				},
+			})
+			p.SetAsync(ctx, testRequest("unembeddable"), testResponse())
+			p.Close()
+			c.Close()
+
+			switch policy {
+			case cache.EmbedErrorSkip:
+				if len(errs) != 0 {
+					t.Errorf("expected no errors under skip, got %v", errs)
+				}
+			case cache.EmbedErrorPropagate:
+				if len(errs) != 1 || !errors.Is(errs[0], cache.ErrEmbedFailed) {
+					t.Errorf("expected one ErrEmbedFailed under propagate, got %v", errs)
+				}
+			}
+			if got := c.Size(ctx); got != 0 {
+				t.Errorf("%v: expected nothing stored, got %d", policy, got)
+			}
+		}
+	})
+}
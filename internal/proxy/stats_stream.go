@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// minStatsStreamInterval bounds how often a client may ask for updates.
+const minStatsStreamInterval = 100 * time.Millisecond
+
+// statsSnapshot is the payload of a /stats/stream event.
+type statsSnapshot struct {
+	Stats  *api.CacheStats            `json:"stats"`
+	Models map[string]*api.CacheStats `json:"models,omitempty"`
+}
+
+// handleStatsStream pushes cache statistics as server-sent events, for
+// live dashboards. Stats are read every interval (the "interval" query
+// parameter, or the configured default) and an event is sent only when
+// they changed, so an idle cache costs nothing on the wire. The stream
+// ends when the client disconnects.
+func (h *Handler) handleStatsStream(w http.ResponseWriter, r *http.Request) {
+	interval := h.cfg.StatsStreamInterval
+	if v := r.URL.Query().Get("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < minStatsStreamInterval {
+			h.writeError(w, fmt.Sprintf("interval must be a duration of at least %s", minStatsStreamInterval), http.StatusBadRequest)
+			return
+		}
+		interval = d
+	}
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+		h.logger.Debug("failed to clear write deadline for stats stream", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ctx := r.Context()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last []byte
+	for {
+		data, err := json.Marshal(statsSnapshot{
+			Stats:  h.cache.Stats(ctx),
+			Models: h.cache.StatsByModel(ctx),
+		})
+		if err != nil {
+			h.logger.Warn("failed to encode stats", "error", err)
+			return
+		}
+
+		// Unchanged stats are coalesced into the last event sent
+		if !bytes.Equal(data, last) {
+			if _, err := fmt.Fprintf(w, "event: stats\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			last = data
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
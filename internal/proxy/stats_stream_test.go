@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/internal/cache"
+	"github.com/aqstack/mimir/internal/config"
+	"github.com/aqstack/mimir/internal/embedding"
+	"github.com/aqstack/mimir/internal/logger"
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+func TestStatsStream(t *testing.T) {
+	c := cache.NewMemoryCache(cache.DefaultOptions())
+	defer c.Close()
+	h := NewHandler(config.DefaultConfig(), c, embedding.NewHashEmbedder(8), logger.New(false))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	t.Run("rejects a bad interval", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/stats/stream?interval=1ms")
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", resp.StatusCode)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/stats/stream?interval=100ms", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+
+	events := make(chan statsSnapshot)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var snap statsSnapshot
+			if err := json.Unmarshal([]byte(data), &snap); err != nil {
+				t.Errorf("invalid event data %q: %v", data, err)
+				return
+			}
+			events <- snap
+		}
+	}()
+	next := func(wait time.Duration) (statsSnapshot, bool) {
+		select {
+		case snap, ok := <-events:
+			return snap, ok
+		case <-time.After(wait):
+			return statsSnapshot{}, false
+		}
+	}
+
+	// The current stats are sent straight away
+	snap, ok := next(time.Second)
+	if !ok || snap.Stats == nil || snap.Stats.TotalEntries != 0 {
+		t.Fatalf("expected an initial event for an empty cache, got %+v", snap)
+	}
+
+	// Unchanged stats send nothing
+	if _, ok := next(350 * time.Millisecond); ok {
+		t.Error("expected no event while stats are unchanged")
+	}
+
+	c.Set(context.Background(), &api.CacheEntry{
+		Request:   api.ChatCompletionRequest{Model: "gpt-4"},
+		Embedding: []float64{1, 0, 0},
+	})
+	snap, ok = next(time.Second)
+	if !ok || snap.Stats.TotalEntries != 1 {
+		t.Fatalf("expected an event with 1 entry, got %+v", snap.Stats)
+	}
+	if m := snap.Models["gpt-4"]; m == nil || m.TotalEntries != 1 {
+		t.Errorf("expected per-model stats for gpt-4, got %+v", snap.Models)
+	}
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// errClientGone is returned by teeStream when writing to the client fails.
+var errClientGone = errors.New("client disconnected")
+
+// teeStream relays an upstream Server-Sent Events body to the client line
+// by line, flushing as it goes, while assembling the chunks it carries.
+// Only the assembled response is held, never the raw stream. It returns
+// the response once upstream sends [DONE] and the body ends cleanly;
+// otherwise it returns nil, with an error if the client went away or
+// upstream broke off, so a partial response is never cached.
+func teeStream(w http.ResponseWriter, body io.Reader) (*api.ChatCompletionResponse, error) {
+	flusher, _ := w.(http.Flusher)
+	reader := bufio.NewReader(body)
+	var assembler api.StreamAssembler
+	done, valid := false, true
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if _, werr := w.Write(line); werr != nil {
+				return nil, errClientGone
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+
+			if data, ok := bytes.CutPrefix(bytes.TrimRight(line, "\r\n"), []byte("data:")); ok {
+				data = bytes.TrimSpace(data)
+				var chunk api.ChatCompletionChunk
+				switch {
+				case string(data) == "[DONE]":
+					done = true
+				case done:
+					valid = false
+				case json.Unmarshal(data, &chunk) != nil:
+					valid = false
+				case assembler.Add(&chunk) != nil:
+					valid = false
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read upstream stream: %w", err)
+		}
+	}
+
+	if !done || !valid {
+		return nil, nil
+	}
+	return assembler.Response(), nil
+}
@@ -0,0 +1,251 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aqstack/mimir/internal/cache"
+	"github.com/aqstack/mimir/internal/config"
+	"github.com/aqstack/mimir/internal/embedding"
+	"github.com/aqstack/mimir/internal/logger"
+	"github.com/aqstack/mimir/pkg/api"
+)
+
+// testStream returns the event stream for testResponse.
+func testStream(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := api.WriteStream(&buf, testResponse(), 4); err != nil {
+		t.Fatalf("WriteStream failed: %v", err)
+	}
+	return buf.String()
+}
+
+// failingWriter is a ResponseWriter whose client has gone away.
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w failingWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestTeeStream(t *testing.T) {
+	stream := testStream(t)
+	withoutDone := strings.TrimSuffix(stream, "data: [DONE]\n\n")
+
+	tests := []struct {
+		name       string
+		body       string
+		clientGone bool
+		wantCached bool
+		wantErr    error
+	}{
+		{name: "complete stream", body: stream, wantCached: true},
+		{name: "stream without done", body: withoutDone},
+		{name: "malformed chunk", body: withoutDone + "data: {not json\n\ndata: [DONE]\n\n"},
+		{name: "choice index out of range", body: withoutDone + `data: {"choices":[{"index":100000,"delta":{}}]}` + "\n\ndata: [DONE]\n\n"},
+		{name: "client disconnected", body: stream, clientGone: true, wantErr: errClientGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			var w http.ResponseWriter = rec
+			if tt.clientGone {
+				w = failingWriter{rec}
+			}
+
+			live, err := teeStream(w, strings.NewReader(tt.body))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if (live != nil) != tt.wantCached {
+				t.Fatalf("expected assembled response=%v, got %+v", tt.wantCached, live)
+			}
+			if tt.wantCached {
+				if got := live.Choices[0].Message.Content; got != "answer" {
+					t.Errorf("expected assembled content %q, got %q", "answer", got)
+				}
+			}
+			if !tt.clientGone && rec.Body.String() != tt.body {
+				t.Errorf("expected the stream to be relayed unchanged, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestStreamingMissIsCached(t *testing.T) {
+	stream := testStream(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for _, event := range strings.SplitAfter(stream, "\n\n") {
+			w.Write([]byte(event))
+			flusher.Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.OpenAIBaseURL = upstream.URL
+	c := cache.NewMemoryCache(cache.DefaultOptions())
+	defer c.Close()
+	h := NewHandler(cfg, c, embedding.NewHashEmbedder(8), logger.New(false))
+
+	send := func(stream bool) *httptest.ResponseRecorder {
+		body := `{"model":"test-model","messages":[{"role":"user","content":"what is the answer"}]`
+		if stream {
+			body += `,"stream":true`
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body+"}")))
+		return rec
+	}
+
+	rec := send(true)
+	if got := rec.Header().Get(HeaderCache); got != "MISS" {
+		t.Fatalf("expected first request to miss, got %q", got)
+	}
+	if rec.Body.String() != stream {
+		t.Errorf("expected the upstream stream to be relayed unchanged, got %q", rec.Body.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for c.Size(ctx) == 0 && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	rec = send(false)
+	if got := rec.Header().Get(HeaderCache); got != "HIT" {
+		t.Fatalf("expected the streamed response to be cached, got %q", got)
+	}
+	if !strings.Contains(rec.Body.String(), `"answer"`) {
+		t.Errorf("expected the cached answer, got %s", rec.Body.String())
+	}
+}
+
+func TestConcurrentIdenticalMissesShareUpstream(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(testResponse())
+	}))
+	defer upstream.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.OpenAIBaseURL = upstream.URL
+	c := cache.NewMemoryCache(cache.DefaultOptions())
+	defer c.Close()
+	h := NewHandler(cfg, c, embedding.NewHashEmbedder(8), logger.New(false))
+
+	const followers = 4
+	results := make(chan *httptest.ResponseRecorder, followers+1)
+	var wg sync.WaitGroup
+	send := func(stream bool) {
+		defer wg.Done()
+		body := `{"model":"test-model","messages":[{"role":"user","content":"what is the answer"}]`
+		if stream {
+			body += `,"stream":true`
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body+"}")))
+		results <- rec
+	}
+
+	wg.Add(1)
+	go send(false)
+	<-started
+	for i := 0; i < followers; i++ {
+		wg.Add(1)
+		go send(i%2 == 1)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected one upstream call, got %d", got)
+	}
+	var hits int
+	for rec := range results {
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "answer") {
+			t.Errorf("expected the upstream answer, got %d %s", rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get(HeaderCache) == "HIT" {
+			hits++
+		}
+	}
+	if hits != followers {
+		t.Errorf("expected %d waiting requests to be served as hits, got %d", followers, hits)
+	}
+}
+
+func TestStaleHitIsRefreshedUnstreamed(t *testing.T) {
+	bodies := make(chan string, 2)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(testResponse())
+	}))
+	defer upstream.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.OpenAIBaseURL = upstream.URL
+	opts := cache.DefaultOptions()
+	opts.DefaultTTL = time.Millisecond
+	opts.StaleWhileRevalidate = time.Hour
+	c := cache.NewMemoryCache(opts)
+	defer c.Close()
+	h := NewHandler(cfg, c, embedding.NewHashEmbedder(8), logger.New(false))
+
+	send := func(stream bool) *httptest.ResponseRecorder {
+		body := `{"model":"test-model","messages":[{"role":"user","content":"what is the answer"}]`
+		if stream {
+			body += `,"stream":true`
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body+"}")))
+		return rec
+	}
+
+	if got := send(false).Header().Get(HeaderCache); got != "MISS" {
+		t.Fatalf("expected first request to miss, got %q", got)
+	}
+	<-bodies
+	time.Sleep(5 * time.Millisecond)
+
+	rec := send(true)
+	if got := rec.Header().Get(HeaderCache); got != "STALE" {
+		t.Fatalf("expected the expired entry to be served stale, got %q", got)
+	}
+	if !strings.Contains(rec.Body.String(), "answer") {
+		t.Errorf("expected the stale response, got %q", rec.Body.String())
+	}
+
+	select {
+	case body := <-bodies:
+		if strings.Contains(body, "stream") {
+			t.Errorf("expected the refresh to ask for an unstreamed response, sent %s", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stale entry was not refreshed upstream")
+	}
+}
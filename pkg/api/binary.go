@@ -0,0 +1,279 @@
+package api
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// binaryVersion is the first byte of an entry encoded by MarshalBinary.
+const binaryVersion = 1
+
+// Flags packed into one byte of the binary encoding.
+const (
+	binaryPinned = 1 << iota
+	binaryNegative
+	binaryHasError
+	binaryHasChecksum
+	binaryHasProjection
+	binaryHasSchemaVersion
+)
+
+// errShortBuffer is returned when binary data ends mid-field.
+var errShortBuffer = errors.New("unexpected end of data")
+
+// MarshalBinary encodes the entry in a compact binary form, much smaller
+// than JSON for snapshots and persistent backends. The embedding is
+// packed as float32, so it round-trips with float32 precision; that is
+// well below the differences similarity thresholds distinguish. The
+// request, response and error are embedded as JSON, since they hold
+// values of arbitrary shape.
+func (e *CacheEntry) MarshalBinary() ([]byte, error) {
+	reqJSON, err := json.Marshal(e.Request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	respJSON, err := json.Marshal(e.Response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	var flags byte
+	if e.Pinned {
+		flags |= binaryPinned
+	}
+	if e.Negative {
+		flags |= binaryNegative
+	}
+	var errJSON []byte
+	if e.Error != nil {
+		flags |= binaryHasError
+		if errJSON, err = json.Marshal(e.Error); err != nil {
+			return nil, fmt.Errorf("failed to marshal error: %w", err)
+		}
+	}
+	if e.Checksum != "" {
+		flags |= binaryHasChecksum
+	}
+	if e.Projection != "" {
+		flags |= binaryHasProjection
+	}
+	if e.SchemaVersion != 0 {
+		flags |= binaryHasSchemaVersion
+	}
+
+	buf := make([]byte, 0, 64+len(reqJSON)+len(respJSON)+4*len(e.Embedding))
+	buf = append(buf, binaryVersion, flags)
+	buf = appendString(buf, e.ID)
+	buf = appendString(buf, e.Namespace)
+	buf = appendString(buf, e.EmbeddingModel)
+	buf = appendString(buf, e.RequestHash)
+	for _, t := range []time.Time{e.CreatedAt, e.ExpiresAt, e.LastHitAt} {
+		if buf, err = appendTime(buf, t); err != nil {
+			return nil, err
+		}
+	}
+	buf = binary.AppendVarint(buf, e.HitCount)
+	buf = binary.AppendVarint(buf, int64(e.TTL))
+	buf = binary.AppendVarint(buf, int64(e.StatusCode))
+
+	buf = binary.AppendUvarint(buf, uint64(len(e.Embedding)))
+	for _, f := range e.Embedding {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(f)))
+	}
+
+	buf = appendBytes(buf, reqJSON)
+	buf = appendBytes(buf, respJSON)
+	if e.Error != nil {
+		buf = appendBytes(buf, errJSON)
+	}
+	if e.Checksum != "" {
+		buf = appendString(buf, e.Checksum)
+	}
+	if e.Projection != "" {
+		buf = appendString(buf, e.Projection)
+	}
+	if e.SchemaVersion != 0 {
+		buf = binary.AppendUvarint(buf, uint64(e.SchemaVersion))
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes an entry encoded by MarshalBinary, replacing
+// the contents of e.
+func (e *CacheEntry) UnmarshalBinary(data []byte) error {
+	d := binaryDecoder{buf: data}
+	if v := d.byte(); d.err == nil && v != binaryVersion {
+		return fmt.Errorf("unsupported entry encoding version %d", v)
+	}
+	flags := d.byte()
+
+	var entry CacheEntry
+	entry.ID = d.string()
+	entry.Namespace = d.string()
+	entry.EmbeddingModel = d.string()
+	entry.RequestHash = d.string()
+	entry.CreatedAt = d.time()
+	entry.ExpiresAt = d.time()
+	entry.LastHitAt = d.time()
+	entry.HitCount = d.varint()
+	entry.TTL = time.Duration(d.varint())
+	entry.StatusCode = int(d.varint())
+	entry.Pinned = flags&binaryPinned != 0
+	entry.Negative = flags&binaryNegative != 0
+
+	if n := d.uvarint(); d.err == nil && n > 0 {
+		if n > uint64(len(d.buf))/4 {
+			return fmt.Errorf("failed to decode embedding: %w", errShortBuffer)
+		}
+		entry.Embedding = make([]float64, n)
+		for i := range entry.Embedding {
+			entry.Embedding[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(d.next(4))))
+		}
+	}
+
+	reqJSON := d.bytes()
+	respJSON := d.bytes()
+	var errJSON []byte
+	if flags&binaryHasError != 0 {
+		errJSON = d.bytes()
+	}
+	if flags&binaryHasChecksum != 0 {
+		entry.Checksum = d.string()
+	}
+	if flags&binaryHasProjection != 0 {
+		entry.Projection = d.string()
+	}
+	if flags&binaryHasSchemaVersion != 0 {
+		entry.SchemaVersion = int(d.uvarint())
+	}
+	if d.err != nil {
+		return fmt.Errorf("failed to decode entry: %w", d.err)
+	}
+	if len(d.buf) > 0 {
+		return fmt.Errorf("failed to decode entry: %d trailing bytes", len(d.buf))
+	}
+
+	if err := json.Unmarshal(reqJSON, &entry.Request); err != nil {
+		return fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	if err := json.Unmarshal(respJSON, &entry.Response); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if errJSON != nil {
+		entry.Error = &APIError{}
+		if err := json.Unmarshal(errJSON, entry.Error); err != nil {
+			return fmt.Errorf("failed to unmarshal error: %w", err)
+		}
+	}
+
+	*e = entry
+	return nil
+}
+
+// appendBytes appends b prefixed with its length.
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// appendString appends s prefixed with its length.
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// appendTime appends t prefixed with the length of its encoding; the
+// zero time is a zero length.
+func appendTime(buf []byte, t time.Time) ([]byte, error) {
+	if t.IsZero() {
+		return append(buf, 0), nil
+	}
+	b, err := t.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal time: %w", err)
+	}
+	return appendBytes(buf, b), nil
+}
+
+// binaryDecoder reads the fields appended by MarshalBinary. After the
+// first error, reads return zero values and err holds the error.
+type binaryDecoder struct {
+	buf []byte
+	err error
+}
+
+// next consumes n bytes.
+func (d *binaryDecoder) next(n int) []byte {
+	if d.err != nil {
+		return make([]byte, n)
+	}
+	if n > len(d.buf) {
+		d.err = errShortBuffer
+		return make([]byte, n)
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *binaryDecoder) byte() byte {
+	return d.next(1)[0]
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errShortBuffer
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binaryDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errShortBuffer
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binaryDecoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.buf)) {
+		d.err = errShortBuffer
+		return nil
+	}
+	return d.next(int(n))
+}
+
+func (d *binaryDecoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *binaryDecoder) time() time.Time {
+	b := d.bytes()
+	if len(b) == 0 {
+		return time.Time{}
+	}
+	var t time.Time
+	if err := t.UnmarshalBinary(b); err != nil && d.err == nil {
+		d.err = err
+	}
+	return t
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newBinaryTestEntry() *CacheEntry {
+	temp := 0.2
+	code := "rate_limited"
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return &CacheEntry{
+		ID: "a",
+		Request: ChatCompletionRequest{
+			Model:       "gpt-4",
+			Temperature: &temp,
+			Messages:    []Message{{Role: "user", Content: "hello"}},
+		},
+		Response: ChatCompletionResponse{
+			ID:      "resp",
+			Choices: []Choice{{Message: Message{Role: "assistant", Content: "hi"}, FinishReason: "stop"}},
+			Usage:   Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4},
+		},
+		Embedding:      []float64{0.5, -0.25, 1, 0},
+		CreatedAt:      created,
+		ExpiresAt:      created.Add(time.Hour),
+		HitCount:       7,
+		Namespace:      "tenant",
+		EmbeddingModel: "nomic-embed-text",
+		RequestHash:    "abc",
+		Checksum:       "def",
+		Projection:     "random:384:42",
+		TTL:            time.Minute,
+		Pinned:         true,
+		Negative:       true,
+		StatusCode:     429,
+		Error:          &APIError{Message: "slow down", Code: &code},
+	}
+}
+
+func TestCacheEntryBinary(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry *CacheEntry
+	}{
+		{name: "full", entry: newBinaryTestEntry()},
+		{name: "empty", entry: &CacheEntry{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.entry.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary failed: %v", err)
+			}
+
+			var got CacheEntry
+			if err := got.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary failed: %v", err)
+			}
+
+			// Compare through JSON, which normalizes times and interface values
+			want, _ := json.Marshal(tt.entry)
+			have, _ := json.Marshal(&got)
+			if !bytes.Equal(want, have) {
+				t.Errorf("round trip differs:\nwant %s\ngot  %s", want, have)
+			}
+		})
+	}
+}
+
+func TestCacheEntryBinaryFloat32(t *testing.T) {
+	entry := &CacheEntry{Embedding: []float64{0.1, 1.0 / 3}}
+	data, err := entry.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	var got CacheEntry
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	want := []float64{float64(float32(0.1)), float64(float32(1.0 / 3))}
+	if !reflect.DeepEqual(got.Embedding, want) {
+		t.Errorf("expected %v, got %v", want, got.Embedding)
+	}
+}
+
+func TestCacheEntryBinarySmallerThanJSON(t *testing.T) {
+	entry := newBinaryTestEntry()
+	entry.Embedding = make([]float64, 768)
+	for i := range entry.Embedding {
+		entry.Embedding[i] = math.Sin(float64(i))
+	}
+
+	data, err := entry.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	jsonData, _ := json.Marshal(entry)
+	if len(data) >= len(jsonData)/2 {
+		t.Errorf("expected binary (%d bytes) to be under half of JSON (%d bytes)", len(data), len(jsonData))
+	}
+}
+
+func TestCacheEntryUnmarshalBinaryInvalid(t *testing.T) {
+	data, err := newBinaryTestEntry().MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "unknown version", data: append([]byte{9}, data[1:]...)},
+		{name: "truncated", data: data[:len(data)-1]},
+		{name: "trailing bytes", data: append(append([]byte{}, data...), 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got CacheEntry
+			if err := got.UnmarshalBinary(tt.data); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func FuzzCacheEntryBinary(f *testing.F) {
+	data, err := newBinaryTestEntry().MarshalBinary()
+	if err != nil {
+		f.Fatalf("MarshalBinary failed: %v", err)
+	}
+	f.Add(data)
+	empty, _ := (&CacheEntry{}).MarshalBinary()
+	f.Add(empty)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var entry CacheEntry
+		if err := entry.UnmarshalBinary(data); err != nil {
+			return
+		}
+
+		// Anything that decodes must round-trip
+		first, err := entry.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+		var again CacheEntry
+		if err := again.UnmarshalBinary(first); err != nil {
+			t.Fatalf("UnmarshalBinary of re-encoded entry failed: %v", err)
+		}
+		second, err := again.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+		if !bytes.Equal(first, second) {
+			t.Errorf("re-encoding differs:\n%x\n%x", first, second)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// CanonicalizeRequest returns a stable string form of a request for exact
+// matching. Requests that differ only in JSON field order, surrounding
+// whitespace in message content, explicit nulls, optional parameters set
+// to their OpenAI defaults, the order of stop sequences, or the stream
+// flag canonicalize identically. Generation parameters that change the
+// completion, such as stop, max_tokens and response_format, are kept.
+func CanonicalizeRequest(req *ChatCompletionRequest) string {
+	c := *req
+	c.Stream = false
+	c.Temperature = omitDefaultFloat(c.Temperature, 1)
+	c.TopP = omitDefaultFloat(c.TopP, 1)
+	c.PresencePenalty = omitDefaultFloat(c.PresencePenalty, 0)
+	c.FrequencyPenalty = omitDefaultFloat(c.FrequencyPenalty, 0)
+	if c.N != nil && *c.N == 1 {
+		c.N = nil
+	}
+	if len(c.Stop) > 0 {
+		c.Stop = append([]string(nil), c.Stop...)
+		sort.Strings(c.Stop)
+	} else {
+		c.Stop = nil
+	}
+	if c.ResponseFormat != nil && c.ResponseFormat.Type == "text" {
+		c.ResponseFormat = nil
+	}
+
+	c.Messages = make([]Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		msg.Content = canonicalContent(msg.Content)
+		c.Messages[i] = msg
+	}
+
+	return canonicalJSON(c)
+}
+
+// canonicalJSON returns v as JSON round-tripped through a generic value,
+// so nulls inside free-form fields (content, parameters, tool_choice) are
+// pruned and map keys sorted.
+func canonicalJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return ""
+	}
+
+	out, err := json.Marshal(pruneNulls(generic))
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+// RequestHash returns the hex SHA-256 of CanonicalizeRequest(req), a
+// compact key for exact-match lookups.
+func RequestHash(req *ChatCompletionRequest) string {
+	sum := sha256.Sum256([]byte(CanonicalizeRequest(req)))
+	return hex.EncodeToString(sum[:])
+}
+
+// ContentChecksum returns the hex SHA-256 of the entry's canonical
+// request and response. Stored as Checksum, it lets a cache detect an
+// entry whose content was corrupted or altered after it was written.
+func (e *CacheEntry) ContentChecksum() string {
+	h := sha256.New()
+	h.Write([]byte(CanonicalizeRequest(&e.Request)))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(canonicalJSON(e.Response)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// omitDefaultFloat returns nil if p points at the default value.
+func omitDefaultFloat(p *float64, def float64) *float64 {
+	if p != nil && *p == def {
+		return nil
+	}
+	return p
+}
+
+// canonicalContent trims whitespace from string content and text parts.
+func canonicalContent(content interface{}) interface{} {
+	switch c := content.(type) {
+	case string:
+		return strings.TrimSpace(c)
+	case []ContentPart:
+		parts := make([]ContentPart, len(c))
+		for i, p := range c {
+			p.Text = strings.TrimSpace(p.Text)
+			parts[i] = p
+		}
+		return parts
+	case []interface{}:
+		parts := make([]interface{}, len(c))
+		for i, p := range c {
+			if m, ok := p.(map[string]interface{}); ok {
+				if text, ok := m["text"].(string); ok {
+					trimmed := make(map[string]interface{}, len(m))
+					for k, v := range m {
+						trimmed[k] = v
+					}
+					trimmed["text"] = strings.TrimSpace(text)
+					p = trimmed
+				}
+			}
+			parts[i] = p
+		}
+		return parts
+	default:
+		return content
+	}
+}
+
+// pruneNulls removes null values from objects, recursively.
+func pruneNulls(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if val == nil {
+				delete(t, k)
+				continue
+			}
+			t[k] = pruneNulls(val)
+		}
+		return t
+	case []interface{}:
+		for i, val := range t {
+			t[i] = pruneNulls(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
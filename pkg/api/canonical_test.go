@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCanonicalizeRequest(t *testing.T) {
+	parse := func(t *testing.T, s string) *ChatCompletionRequest {
+		t.Helper()
+		var req ChatCompletionRequest
+		if err := json.Unmarshal([]byte(s), &req); err != nil {
+			t.Fatalf("invalid request JSON: %v", err)
+		}
+		return &req
+	}
+
+	base := `{"model":"gpt-4","messages":[{"role":"user","content":"What is Go?"}]}`
+
+	tests := []struct {
+		name  string
+		other string
+		same  bool
+	}{
+		{"field order", `{"messages":[{"content":"What is Go?","role":"user"}],"model":"gpt-4"}`, true},
+		{"surrounding whitespace", `{"model":"gpt-4","messages":[{"role":"user","content":"  What is Go?\n"}]}`, true},
+		{"explicit nulls", `{"model":"gpt-4","temperature":null,"tool_choice":null,"messages":[{"role":"user","content":"What is Go?"}]}`, true},
+		{"default parameters", `{"model":"gpt-4","temperature":1,"top_p":1,"n":1,"presence_penalty":0,"messages":[{"role":"user","content":"What is Go?"}]}`, true},
+		{"stream flag", `{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"What is Go?"}]}`, true},
+		{"different content", `{"model":"gpt-4","messages":[{"role":"user","content":"What is Rust?"}]}`, false},
+		{"different model", `{"model":"gpt-4o","messages":[{"role":"user","content":"What is Go?"}]}`, false},
+		{"several choices", `{"model":"gpt-4","n":3,"messages":[{"role":"user","content":"What is Go?"}]}`, false},
+		{"non-default temperature", `{"model":"gpt-4","temperature":0,"messages":[{"role":"user","content":"What is Go?"}]}`, false},
+		{"inner whitespace", `{"model":"gpt-4","messages":[{"role":"user","content":"What  is Go?"}]}`, false},
+		{"text response format", `{"model":"gpt-4","response_format":{"type":"text"},"stop":[],"messages":[{"role":"user","content":"What is Go?"}]}`, true},
+		{"stop sequences", `{"model":"gpt-4","stop":["\n"],"messages":[{"role":"user","content":"What is Go?"}]}`, false},
+		{"max tokens", `{"model":"gpt-4","max_tokens":16,"messages":[{"role":"user","content":"What is Go?"}]}`, false},
+		{"json response format", `{"model":"gpt-4","response_format":{"type":"json_object"},"messages":[{"role":"user","content":"What is Go?"}]}`, false},
+	}
+
+	want := CanonicalizeRequest(parse(t, base))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CanonicalizeRequest(parse(t, tt.other))
+			if (got == want) != tt.same {
+				t.Errorf("expected same=%v\nbase:  %s\nother: %s", tt.same, want, got)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeRequestStopOrder(t *testing.T) {
+	a := &ChatCompletionRequest{Model: "gpt-4", Stop: []string{"END", "\n"}}
+	b := &ChatCompletionRequest{Model: "gpt-4", Stop: []string{"\n", "END"}}
+
+	if CanonicalizeRequest(a) != CanonicalizeRequest(b) {
+		t.Errorf("expected stop order not to matter:\n%s\n%s", CanonicalizeRequest(a), CanonicalizeRequest(b))
+	}
+	if a.Stop[0] != "END" {
+		t.Error("expected the original request to be left unmodified")
+	}
+}
+
+func TestCanonicalizeRequestTrimsTextParts(t *testing.T) {
+	a := &ChatCompletionRequest{Model: "gpt-4", Messages: []Message{{
+		Role:    "user",
+		Content: []ContentPart{{Type: "text", Text: " describe this "}},
+	}}}
+	var b ChatCompletionRequest
+	json.Unmarshal([]byte(`{"model":"gpt-4","messages":[{"role":"user","content":[{"text":"describe this","type":"text"}]}]}`), &b)
+
+	if CanonicalizeRequest(a) != CanonicalizeRequest(&b) {
+		t.Errorf("expected typed and decoded content parts to match:\n%s\n%s", CanonicalizeRequest(a), CanonicalizeRequest(&b))
+	}
+	if a.Messages[0].Content.([]ContentPart)[0].Text != " describe this " {
+		t.Error("expected the original request to be left unmodified")
+	}
+}
+
+func TestContentChecksum(t *testing.T) {
+	entry := &CacheEntry{
+		Request: ChatCompletionRequest{
+			Model:    "gpt-4",
+			Messages: []Message{{Role: "user", Content: "What is the capital of France?"}},
+		},
+		Response: ChatCompletionResponse{
+			ID:      "resp-1",
+			Choices: []Choice{{Message: Message{Role: "assistant", Content: "Paris"}, FinishReason: "stop"}},
+		},
+		HitCount: 3,
+	}
+	sum := entry.ContentChecksum()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded CacheEntry
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	decoded.HitCount = 10
+	if got := decoded.ContentChecksum(); got != sum {
+		t.Errorf("expected checksum to survive a round-trip and ignore statistics, got %s want %s", got, sum)
+	}
+
+	decoded.Response.Choices[0].Message.Content = "Lyon"
+	if decoded.ContentChecksum() == sum {
+		t.Error("expected a changed response to change the checksum")
+	}
+	decoded.Response.Choices[0].Message.Content = "Paris"
+	decoded.Request.Messages[0].Content = "What is the capital of Spain?"
+	if decoded.ContentChecksum() == sum {
+		t.Error("expected a changed request to change the checksum")
+	}
+}
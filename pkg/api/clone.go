@@ -0,0 +1,103 @@
+package api
+
+// Clone returns a deep copy of the entry, so a caller can modify what a
+// cache returns without affecting the cached copy or other readers.
+// Values held as interface{} with no known shape, such as function
+// parameters or tool_choice, are shared.
+func (e *CacheEntry) Clone() *CacheEntry {
+	if e == nil {
+		return nil
+	}
+	c := *e
+	c.Request = e.Request.Clone()
+	c.Response = e.Response.Clone()
+	c.Embedding = cloneSlice(e.Embedding)
+	if e.Error != nil {
+		apiErr := *e.Error
+		apiErr.Param = clonePtr(e.Error.Param)
+		apiErr.Code = clonePtr(e.Error.Code)
+		c.Error = &apiErr
+	}
+	return &c
+}
+
+// Clone returns a deep copy of the request.
+func (r ChatCompletionRequest) Clone() ChatCompletionRequest {
+	c := r
+	c.Messages = cloneMessages(r.Messages)
+	c.Temperature = clonePtr(r.Temperature)
+	c.TopP = clonePtr(r.TopP)
+	c.N = clonePtr(r.N)
+	c.Stop = cloneSlice(r.Stop)
+	c.MaxTokens = clonePtr(r.MaxTokens)
+	c.PresencePenalty = clonePtr(r.PresencePenalty)
+	c.FrequencyPenalty = clonePtr(r.FrequencyPenalty)
+	c.Functions = cloneSlice(r.Functions)
+	c.Tools = cloneSlice(r.Tools)
+	c.ResponseFormat = clonePtr(r.ResponseFormat)
+	c.Seed = clonePtr(r.Seed)
+	return c
+}
+
+// Clone returns a deep copy of the response.
+func (r ChatCompletionResponse) Clone() ChatCompletionResponse {
+	c := r
+	if r.Choices != nil {
+		c.Choices = make([]Choice, len(r.Choices))
+		for i, choice := range r.Choices {
+			choice.Message = choice.Message.Clone()
+			if choice.Logprobs != nil {
+				choice.Logprobs = &Logprob{Content: cloneSlice(choice.Logprobs.Content)}
+			}
+			c.Choices[i] = choice
+		}
+	}
+	return c
+}
+
+// Clone returns a deep copy of the message, including its content parts
+// and tool calls.
+func (m Message) Clone() Message {
+	c := m
+	switch content := m.Content.(type) {
+	case []ContentPart:
+		parts := make([]ContentPart, len(content))
+		for i, part := range content {
+			part.ImageURL = clonePtr(part.ImageURL)
+			parts[i] = part
+		}
+		c.Content = parts
+	case []interface{}:
+		c.Content = cloneSlice(content)
+	}
+	c.FunctionCall = clonePtr(m.FunctionCall)
+	c.ToolCalls = cloneSlice(m.ToolCalls)
+	return c
+}
+
+func cloneMessages(messages []Message) []Message {
+	if messages == nil {
+		return nil
+	}
+	c := make([]Message, len(messages))
+	for i, m := range messages {
+		c[i] = m.Clone()
+	}
+	return c
+}
+
+// cloneSlice copies a slice of values, keeping nil as nil.
+func cloneSlice[T any](s []T) []T {
+	if s == nil {
+		return nil
+	}
+	return append(make([]T, 0, len(s)), s...)
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCacheEntryClone(t *testing.T) {
+	temp := 0.2
+	code := "bad_request"
+	original := &CacheEntry{
+		ID: "a",
+		Request: ChatCompletionRequest{
+			Model:       "gpt-4",
+			Temperature: &temp,
+			Stop:        []string{"\n"},
+			Messages: []Message{{Role: "user", Content: []ContentPart{
+				{Type: "image_url", ImageURL: &ImageURL{URL: "https://example.com/a.png"}},
+			}}},
+		},
+		Response: ChatCompletionResponse{
+			Choices: []Choice{{
+				Message: Message{
+					Role:      "assistant",
+					Content:   "hi",
+					ToolCalls: []ToolCall{{ID: "call_1", Function: FunctionCall{Name: "f"}}},
+				},
+				Logprobs: &Logprob{Content: []TokenLogprob{{Token: "hi", Logprob: -0.1}}},
+			}},
+		},
+		Embedding: []float64{1, 0},
+		Error:     &APIError{Message: "nope", Code: &code},
+	}
+
+	clone := original.Clone()
+	if !reflect.DeepEqual(clone, original) {
+		t.Fatalf("clone differs from original:\n%+v\n%+v", clone, original)
+	}
+
+	// Mutate everything reachable from the clone
+	*clone.Request.Temperature = 1
+	clone.Request.Stop[0] = "x"
+	clone.Request.Messages[0].Content.([]ContentPart)[0].ImageURL.URL = "changed"
+	clone.Response.Choices[0].Message.Content = "changed"
+	clone.Response.Choices[0].Message.ToolCalls[0].ID = "changed"
+	clone.Response.Choices[0].Logprobs.Content[0].Logprob = -9
+	clone.Embedding[0] = 0
+	*clone.Error.Code = "changed"
+
+	if temp != 0.2 || original.Request.Stop[0] != "\n" || code != "bad_request" {
+		t.Error("mutating the clone changed request pointers or slices")
+	}
+	if url := original.Request.Messages[0].Content.([]ContentPart)[0].ImageURL.URL; url != "https://example.com/a.png" {
+		t.Errorf("mutating the clone changed content parts: %s", url)
+	}
+	choice := original.Response.Choices[0]
+	if choice.Message.Content != "hi" || choice.Message.ToolCalls[0].ID != "call_1" || choice.Logprobs.Content[0].Logprob != -0.1 {
+		t.Error("mutating the clone changed the response")
+	}
+	if original.Embedding[0] != 1 {
+		t.Error("mutating the clone changed the embedding")
+	}
+
+	if (*CacheEntry)(nil).Clone() != nil {
+		t.Error("expected nil clone of nil entry")
+	}
+}
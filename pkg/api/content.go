@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// messageJSON has Message's fields without its JSON methods.
+type messageJSON Message
+
+// UnmarshalJSON decodes a message, typing Content as a string, a
+// []ContentPart, or nil when it is null or absent, so multimodal content
+// survives a round trip instead of becoming []interface{}.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		messageJSON
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = Message(raw.messageJSON)
+
+	content := bytes.TrimSpace(raw.Content)
+	switch {
+	case len(content) == 0 || bytes.Equal(content, []byte("null")):
+		m.Content = nil
+	case content[0] == '"':
+		var s string
+		if err := json.Unmarshal(content, &s); err != nil {
+			return err
+		}
+		m.Content = s
+	case content[0] == '[':
+		var parts []ContentPart
+		if err := json.Unmarshal(content, &parts); err != nil {
+			return fmt.Errorf("invalid message content: %w", err)
+		}
+		m.Content = parts
+	default:
+		return fmt.Errorf("message content must be a string or array of parts, got %s", content)
+	}
+	return nil
+}
+
+// MarshalJSON encodes a message, rejecting Content of any type other than
+// a string, content parts or nil.
+func (m Message) MarshalJSON() ([]byte, error) {
+	switch m.Content.(type) {
+	case nil, string, []ContentPart, []interface{}:
+	default:
+		return nil, fmt.Errorf("message content must be a string or []ContentPart, got %T", m.Content)
+	}
+	return json.Marshal(messageJSON(m))
+}
+
+// UnmarshalJSON accepts an image URL given either as an object or, as some
+// clients send it, a bare string.
+func (u *ImageURL) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		u.Detail = ""
+		return json.Unmarshal(data, &u.URL)
+	}
+	type imageURLJSON ImageURL
+	return json.Unmarshal(data, (*imageURLJSON)(u))
+}
+
+// MessageText flattens a message's content into plain text. String content
+// is returned as is; multimodal content has its text parts joined by
+// spaces and each image replaced by an "[image <ref>]" placeholder, where
+// ref is the image URL (or a hash of inline data URLs) so requests about
+// different images don't collide. Unknown content yields "".
+func MessageText(m Message) string {
+	switch content := m.Content.(type) {
+	case string:
+		return content
+	case []ContentPart:
+		parts := make([]string, 0, len(content))
+		for _, p := range content {
+			var url string
+			if p.ImageURL != nil {
+				url = p.ImageURL.URL
+			}
+			parts = appendPart(parts, p.Type, p.Text, url)
+		}
+		return strings.Join(parts, " ")
+	case []interface{}:
+		// Content decoded from JSON into an untyped field
+		parts := make([]string, 0, len(content))
+		for _, raw := range content {
+			p, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			typ, _ := p["type"].(string)
+			text, _ := p["text"].(string)
+			var url string
+			switch img := p["image_url"].(type) {
+			case string:
+				url = img
+			case map[string]interface{}:
+				url, _ = img["url"].(string)
+			}
+			parts = appendPart(parts, typ, text, url)
+		}
+		return strings.Join(parts, " ")
+	default:
+		return ""
+	}
+}
+
+// appendPart appends the text form of a content part, skipping empty ones.
+func appendPart(parts []string, typ, text, url string) []string {
+	if typ == "image_url" || url != "" {
+		return append(parts, "[image "+imageRef(url)+"]")
+	}
+	if text != "" {
+		return append(parts, text)
+	}
+	return parts
+}
+
+// imageRef identifies an image by URL, hashing inline data URLs.
+func imageRef(url string) string {
+	if strings.HasPrefix(url, "data:") {
+		sum := sha256.Sum256([]byte(url))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	}
+	return url
+}
+
+// RequestEmbeddingInput builds the text embedded for a cache lookup:
+// one "role: text" line per message.
+func RequestEmbeddingInput(req *ChatCompletionRequest) string {
+	var sb strings.Builder
+	for _, msg := range req.Messages {
+		sb.WriteString(msg.Role)
+		sb.WriteString(": ")
+		sb.WriteString(MessageText(msg))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
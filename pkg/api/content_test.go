@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMessageText(t *testing.T) {
+	decode := func(s string) interface{} {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name     string
+		content  interface{}
+		expected string
+	}{
+		{"string", "hello", "hello"},
+		{"nil", nil, ""},
+		{"unknown type", 42, ""},
+		{"typed parts", []ContentPart{
+			{Type: "text", Text: "what is"},
+			{Type: "image_url", ImageURL: &ImageURL{URL: "https://example.com/cat.png"}},
+		}, "what is [image https://example.com/cat.png]"},
+		{"decoded parts", decode(`[{"type":"text","text":"describe"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]`),
+			"describe [image https://example.com/a.png]"},
+		{"empty parts", decode(`[{"type":"text","text":""},{},"junk"]`), ""},
+		{"image only", decode(`[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]`),
+			"[image https://example.com/a.png]"},
+		{"image without url", []ContentPart{{Type: "image_url"}}, "[image ]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MessageText(Message{Role: "user", Content: tt.content}); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMessageTextDataURL(t *testing.T) {
+	text := func(url string) string {
+		return MessageText(Message{Content: []ContentPart{{Type: "image_url", ImageURL: &ImageURL{URL: url}}}})
+	}
+
+	a := text("data:image/png;base64,AAAA")
+	if !strings.HasPrefix(a, "[image sha256:") {
+		t.Errorf("expected data URL to be hashed, got %q", a)
+	}
+	if a == text("data:image/png;base64,BBBB") {
+		t.Error("expected different images to produce different text")
+	}
+	if a != text("data:image/png;base64,AAAA") {
+		t.Error("expected the same image to produce stable text")
+	}
+}
+
+func TestRequestEmbeddingInput(t *testing.T) {
+	req := &ChatCompletionRequest{Messages: []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: []ContentPart{{Type: "text", Text: "hi"}}},
+	}}
+
+	expected := "system: be brief\nuser: hi\n"
+	if got := RequestEmbeddingInput(req); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestMessageJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Message
+	}{
+		{"string", `{"role":"user","content":"hello"}`, Message{Role: "user", Content: "hello"}},
+		{"null", `{"role":"assistant","content":null,"tool_call_id":"call_1"}`, Message{Role: "assistant", ToolCallID: "call_1"}},
+		{"absent", `{"role":"assistant"}`, Message{Role: "assistant"}},
+		{"parts", `{"role":"user","content":[{"type":"text","text":"describe"},{"type":"image_url","image_url":{"url":"https://example.com/a.png","detail":"low"}}]}`,
+			Message{Role: "user", Content: []ContentPart{
+				{Type: "text", Text: "describe"},
+				{Type: "image_url", ImageURL: &ImageURL{URL: "https://example.com/a.png", Detail: "low"}},
+			}}},
+		{"string image url", `{"role":"user","content":[{"type":"image_url","image_url":"https://example.com/a.png"}]}`,
+			Message{Role: "user", Content: []ContentPart{
+				{Type: "image_url", ImageURL: &ImageURL{URL: "https://example.com/a.png"}},
+			}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg Message
+			if err := json.Unmarshal([]byte(tt.input), &msg); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if !reflect.DeepEqual(msg, tt.expected) {
+				t.Errorf("expected %#v, got %#v", tt.expected, msg)
+			}
+
+			// Round trip
+			data, err := json.Marshal(msg)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			var again Message
+			if err := json.Unmarshal(data, &again); err != nil {
+				t.Fatalf("Unmarshal of %s failed: %v", data, err)
+			}
+			if !reflect.DeepEqual(again, tt.expected) {
+				t.Errorf("round trip: expected %#v, got %#v", tt.expected, again)
+			}
+		})
+	}
+
+	t.Run("invalid content", func(t *testing.T) {
+		var msg Message
+		if err := json.Unmarshal([]byte(`{"role":"user","content":42}`), &msg); err == nil {
+			t.Error("expected error for numeric content")
+		}
+		if _, err := json.Marshal(Message{Role: "user", Content: 42}); err == nil {
+			t.Error("expected error marshaling numeric content")
+		}
+	})
+}
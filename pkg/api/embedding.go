@@ -0,0 +1,46 @@
+package api
+
+import "fmt"
+
+// NormalizeEmbeddingInput returns the texts of an embedding request as a
+// slice, accepting a single string, a []string, or a JSON-decoded array of
+// strings. Token-array inputs are not supported.
+func NormalizeEmbeddingInput(req *EmbeddingRequest) ([]string, error) {
+	switch input := req.Input.(type) {
+	case string:
+		return []string{input}, nil
+	case []string:
+		return input, nil
+	case []interface{}:
+		texts := make([]string, len(input))
+		for i, v := range input {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("input[%d]: expected string, got %T", i, v)
+			}
+			texts[i] = s
+		}
+		return texts, nil
+	default:
+		return nil, fmt.Errorf("input must be a string or array of strings, got %T", req.Input)
+	}
+}
+
+// NewEmbeddingResponse builds an embeddings API response with one data item
+// per embedding, indexed in input order.
+func NewEmbeddingResponse(model string, embeddings [][]float64, usage EmbeddingUsage) *EmbeddingResponse {
+	data := make([]EmbeddingData, len(embeddings))
+	for i, emb := range embeddings {
+		data[i] = EmbeddingData{
+			Object:    "embedding",
+			Embedding: emb,
+			Index:     i,
+		}
+	}
+	return &EmbeddingResponse{
+		Object: "list",
+		Data:   data,
+		Model:  model,
+		Usage:  usage,
+	}
+}
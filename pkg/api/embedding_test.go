@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeEmbeddingInput(t *testing.T) {
+	decode := func(s string) interface{} {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected []string
+		wantErr  bool
+	}{
+		{"string", "hello", []string{"hello"}, false},
+		{"string slice", []string{"a", "b"}, []string{"a", "b"}, false},
+		{"decoded array", decode(`["a","b","c"]`), []string{"a", "b", "c"}, false},
+		{"empty array", decode(`[]`), []string{}, false},
+		{"token array", decode(`[1,2,3]`), nil, true},
+		{"nil", nil, nil, true},
+		{"number", 42, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeEmbeddingInput(&EmbeddingRequest{Input: tt.input})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewEmbeddingResponse(t *testing.T) {
+	resp := NewEmbeddingResponse("test-model", [][]float64{{0.1}, {0.2}, {0.3}}, EmbeddingUsage{PromptTokens: 3, TotalTokens: 3})
+
+	if resp.Object != "list" || resp.Model != "test-model" || resp.Usage.TotalTokens != 3 {
+		t.Errorf("unexpected response metadata: %+v", resp)
+	}
+	if len(resp.Data) != 3 {
+		t.Fatalf("expected 3 data items, got %d", len(resp.Data))
+	}
+	for i, d := range resp.Data {
+		if d.Index != i || d.Object != "embedding" || d.Embedding[0] != float64(i+1)/10 {
+			t.Errorf("data[%d]: unexpected item %+v", i, d)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// DefaultStreamChunkSize is the approximate number of characters per
+// reconstructed content delta.
+const DefaultStreamChunkSize = 16
+
+// MaxStreamChoices is the most choices StreamAssembler accepts, as many
+// as the n parameter allows.
+const MaxStreamChoices = 128
+
+// ErrChoiceIndex is returned by StreamAssembler.Add for a chunk whose
+// choice index is negative or not below MaxStreamChoices.
+var ErrChoiceIndex = errors.New("choice index out of range")
+
+// ChatCompletionChunk represents a streamed chat completion chunk.
+type ChatCompletionChunk struct {
+	ID                string        `json:"id"`
+	Object            string        `json:"object"`
+	Created           int64         `json:"created"`
+	Model             string        `json:"model"`
+	Choices           []ChunkChoice `json:"choices"`
+	SystemFingerprint string        `json:"system_fingerprint,omitempty"`
+	// Usage is sent in a final chunk without choices when the request
+	// asks for it through stream_options.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// ChunkChoice represents a choice within a streamed chunk.
+type ChunkChoice struct {
+	Index        int     `json:"index"`
+	Delta        Delta   `json:"delta"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+// Delta represents the incremental message content of a chunk.
+type Delta struct {
+	Role      string     `json:"role,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// StreamChunks reconstructs a completed response as the sequence of chunks
+// an OpenAI streaming endpoint would have emitted: a role delta, content
+// deltas of roughly chunkSize characters split on word boundaries, and a
+// final empty delta carrying the finish reason.
+func StreamChunks(resp *ChatCompletionResponse, chunkSize int) []ChatCompletionChunk {
+	if chunkSize <= 0 {
+		chunkSize = DefaultStreamChunkSize
+	}
+
+	newChunk := func(choice ChunkChoice) ChatCompletionChunk {
+		return ChatCompletionChunk{
+			ID:                resp.ID,
+			Object:            "chat.completion.chunk",
+			Created:           resp.Created,
+			Model:             resp.Model,
+			Choices:           []ChunkChoice{choice},
+			SystemFingerprint: resp.SystemFingerprint,
+		}
+	}
+
+	var chunks []ChatCompletionChunk
+	for _, choice := range resp.Choices {
+		role := choice.Message.Role
+		if role == "" {
+			role = "assistant"
+		}
+		chunks = append(chunks, newChunk(ChunkChoice{
+			Index: choice.Index,
+			Delta: Delta{Role: role},
+		}))
+
+		content, _ := choice.Message.Content.(string)
+		for _, part := range splitContent(content, chunkSize) {
+			chunks = append(chunks, newChunk(ChunkChoice{
+				Index: choice.Index,
+				Delta: Delta{Content: part},
+			}))
+		}
+
+		if len(choice.Message.ToolCalls) > 0 {
+			chunks = append(chunks, newChunk(ChunkChoice{
+				Index: choice.Index,
+				Delta: Delta{ToolCalls: choice.Message.ToolCalls},
+			}))
+		}
+
+		finishReason := choice.FinishReason
+		chunks = append(chunks, newChunk(ChunkChoice{
+			Index:        choice.Index,
+			FinishReason: &finishReason,
+		}))
+	}
+
+	return chunks
+}
+
+// splitContent splits s into pieces of at least size characters, breaking
+// only after whitespace so words are never split across deltas.
+func splitContent(s string, size int) []string {
+	var parts []string
+	start, n := 0, 0
+	runes := []rune(s)
+	for i, r := range runes {
+		n++
+		if n >= size && unicode.IsSpace(r) {
+			parts = append(parts, string(runes[start:i+1]))
+			start, n = i+1, 0
+		}
+	}
+	if start < len(runes) {
+		parts = append(parts, string(runes[start:]))
+	}
+	return parts
+}
+
+// WriteStream writes a cached response to w as Server-Sent Events,
+// terminated by "data: [DONE]". If w implements Flush (e.g. an
+// http.ResponseWriter), each event is flushed as it is written.
+func WriteStream(w io.Writer, resp *ChatCompletionResponse, chunkSize int) error {
+	flusher, _ := w.(interface{ Flush() })
+
+	for _, chunk := range StreamChunks(resp, chunkSize) {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return fmt.Errorf("failed to marshal chunk: %w", err)
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if _, err := io.WriteString(w, "data: [DONE]\n\n"); err != nil {
+		return err
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// StreamAssembler rebuilds a completed response from the chunks of a
+// stream, the inverse of StreamChunks. Content deltas are concatenated
+// per choice. A tool call delta with an ID starts a new call and one
+// without continues the last call's arguments, since a stream sends each
+// call's fragments contiguously.
+type StreamAssembler struct {
+	resp    ChatCompletionResponse
+	content []*strings.Builder // by choice index
+}
+
+// Add merges a chunk into the response. A chunk with a choice index out
+// of range is rejected with ErrChoiceIndex and leaves the response as it
+// was.
+func (a *StreamAssembler) Add(chunk *ChatCompletionChunk) error {
+	for _, cc := range chunk.Choices {
+		if cc.Index < 0 || cc.Index >= MaxStreamChoices {
+			return fmt.Errorf("%w: %d", ErrChoiceIndex, cc.Index)
+		}
+	}
+
+	if a.resp.ID == "" {
+		a.resp.ID = chunk.ID
+		a.resp.Created = chunk.Created
+		a.resp.Model = chunk.Model
+	}
+	if chunk.SystemFingerprint != "" {
+		a.resp.SystemFingerprint = chunk.SystemFingerprint
+	}
+	if chunk.Usage != nil {
+		a.resp.Usage = *chunk.Usage
+	}
+
+	for _, cc := range chunk.Choices {
+		for len(a.resp.Choices) <= cc.Index {
+			a.resp.Choices = append(a.resp.Choices, Choice{Index: len(a.resp.Choices)})
+			a.content = append(a.content, &strings.Builder{})
+		}
+		choice := &a.resp.Choices[cc.Index]
+		if cc.Delta.Role != "" {
+			choice.Message.Role = cc.Delta.Role
+		}
+		a.content[cc.Index].WriteString(cc.Delta.Content)
+		for _, tc := range cc.Delta.ToolCalls {
+			calls := choice.Message.ToolCalls
+			if tc.ID != "" || len(calls) == 0 {
+				choice.Message.ToolCalls = append(calls, tc)
+				continue
+			}
+			last := &calls[len(calls)-1]
+			last.Function.Name += tc.Function.Name
+			last.Function.Arguments += tc.Function.Arguments
+		}
+		if cc.FinishReason != nil {
+			choice.FinishReason = *cc.FinishReason
+		}
+	}
+	return nil
+}
+
+// Response returns the response assembled so far. Choices that streamed
+// only tool calls have null content, as in a response that wasn't
+// streamed.
+func (a *StreamAssembler) Response() *ChatCompletionResponse {
+	resp := a.resp
+	resp.Object = "chat.completion"
+	resp.Choices = make([]Choice, len(a.resp.Choices))
+	for i, choice := range a.resp.Choices {
+		if choice.Message.Role == "" {
+			choice.Message.Role = "assistant"
+		}
+		if content := a.content[i].String(); content != "" || len(choice.Message.ToolCalls) == 0 {
+			choice.Message.Content = content
+		}
+		resp.Choices[i] = choice
+	}
+	return &resp
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newStreamTestResponse(content string) *ChatCompletionResponse {
+	return &ChatCompletionResponse{
+		ID:      "chatcmpl-123",
+		Object:  "chat.completion",
+		Created: 1700000000,
+		Model:   "gpt-4",
+		Choices: []Choice{{
+			Index:        0,
+			Message:      Message{Role: "assistant", Content: content},
+			FinishReason: "stop",
+		}},
+	}
+}
+
+func TestStreamChunks(t *testing.T) {
+	content := "The capital of France is Paris, a city known for the Eiffel Tower."
+	chunks := StreamChunks(newStreamTestResponse(content), 10)
+
+	if len(chunks) < 4 {
+		t.Fatalf("expected role, content and finish chunks, got %d", len(chunks))
+	}
+
+	first := chunks[0]
+	if first.Object != "chat.completion.chunk" {
+		t.Errorf("expected object chat.completion.chunk, got %s", first.Object)
+	}
+	if first.ID != "chatcmpl-123" || first.Model != "gpt-4" {
+		t.Errorf("expected ID and model to be preserved, got %s %s", first.ID, first.Model)
+	}
+	if first.Choices[0].Delta.Role != "assistant" {
+		t.Errorf("expected first delta to carry role, got %q", first.Choices[0].Delta.Role)
+	}
+
+	var rebuilt strings.Builder
+	for _, c := range chunks[1 : len(chunks)-1] {
+		if c.Choices[0].FinishReason != nil {
+			t.Error("expected finish_reason only on the last chunk")
+		}
+		rebuilt.WriteString(c.Choices[0].Delta.Content)
+	}
+	if rebuilt.String() != content {
+		t.Errorf("expected deltas to rebuild content, got %q", rebuilt.String())
+	}
+
+	last := chunks[len(chunks)-1]
+	if last.Choices[0].FinishReason == nil || *last.Choices[0].FinishReason != "stop" {
+		t.Error("expected last chunk to carry finish_reason=stop")
+	}
+}
+
+func TestSplitContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		size     int
+		expected []string
+	}{
+		{"empty", "", 5, nil},
+		{"shorter than size", "hi", 5, []string{"hi"}},
+		{"breaks after whitespace", "one two three four", 5, []string{"one two ", "three ", "four"}},
+		{"long word is not split", "supercalifragilistic end", 4, []string{"supercalifragilistic ", "end"}},
+		{"multibyte runes", "héllo wörld", 3, []string{"héllo ", "wörld"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := splitContent(tt.input, tt.size)
+			if len(result) != len(tt.expected) {
+				t.Fatalf("expected %q, got %q", tt.expected, result)
+			}
+			for i := range result {
+				if result[i] != tt.expected[i] {
+					t.Errorf("part %d: expected %q, got %q", i, tt.expected[i], result[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteStream(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteStream(&buf, newStreamTestResponse("Hello there"), 0); err != nil {
+		t.Fatalf("WriteStream failed: %v", err)
+	}
+
+	events := strings.Split(strings.TrimSpace(buf.String()), "\n\n")
+	if events[len(events)-1] != "data: [DONE]" {
+		t.Errorf("expected stream to end with [DONE], got %q", events[len(events)-1])
+	}
+
+	for _, event := range events[:len(events)-1] {
+		if !strings.HasPrefix(event, "data: ") {
+			t.Fatalf("expected data: prefix, got %q", event)
+		}
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk); err != nil {
+			t.Errorf("invalid chunk JSON: %v", err)
+		}
+	}
+}
+
+func TestStreamAssembler(t *testing.T) {
+	t.Run("rebuilds streamed chunks", func(t *testing.T) {
+		want := newStreamTestResponse("The capital of France is Paris, a city known for the Eiffel Tower.")
+		want.SystemFingerprint = "fp_1"
+
+		var a StreamAssembler
+		for _, chunk := range StreamChunks(want, 10) {
+			if err := a.Add(&chunk); err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+		}
+		if got := a.Response(); !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("joins tool call fragments and takes usage", func(t *testing.T) {
+		stop := "tool_calls"
+		chunks := []ChatCompletionChunk{
+			{ID: "chatcmpl-1", Model: "gpt-4", Choices: []ChunkChoice{{Delta: Delta{Role: "assistant"}}}},
+			{Choices: []ChunkChoice{{Delta: Delta{ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather"}}}}}}},
+			{Choices: []ChunkChoice{{Delta: Delta{ToolCalls: []ToolCall{{Function: FunctionCall{Arguments: `{"city":`}}}}}}},
+			{Choices: []ChunkChoice{{Delta: Delta{ToolCalls: []ToolCall{{Function: FunctionCall{Arguments: `"Paris"}`}}}}}}},
+			{Choices: []ChunkChoice{{Delta: Delta{ToolCalls: []ToolCall{{ID: "call_2", Type: "function", Function: FunctionCall{Name: "get_time", Arguments: "{}"}}}}}}},
+			{Choices: []ChunkChoice{{FinishReason: &stop}}},
+			{Usage: &Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}},
+		}
+
+		var a StreamAssembler
+		for i := range chunks {
+			if err := a.Add(&chunks[i]); err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+		}
+		got := a.Response()
+
+		if len(got.Choices) != 1 {
+			t.Fatalf("expected 1 choice, got %d", len(got.Choices))
+		}
+		msg := got.Choices[0].Message
+		if msg.Content != nil {
+			t.Errorf("expected null content for a tool call response, got %v", msg.Content)
+		}
+		wantCalls := []ToolCall{
+			{ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+			{ID: "call_2", Type: "function", Function: FunctionCall{Name: "get_time", Arguments: "{}"}},
+		}
+		if !reflect.DeepEqual(msg.ToolCalls, wantCalls) {
+			t.Errorf("expected %+v, got %+v", wantCalls, msg.ToolCalls)
+		}
+		if got.Choices[0].FinishReason != "tool_calls" {
+			t.Errorf("expected finish reason tool_calls, got %q", got.Choices[0].FinishReason)
+		}
+		if got.Usage.TotalTokens != 15 {
+			t.Errorf("expected usage from the final chunk, got %+v", got.Usage)
+		}
+	})
+
+	t.Run("interleaves choices", func(t *testing.T) {
+		stop := "stop"
+		var chunks []ChatCompletionChunk
+		for _, part := range []string{"one ", "two ", "three"} {
+			chunk := ChatCompletionChunk{ID: "chatcmpl-1"}
+			for _, i := range []int{2, 0, 1} {
+				chunk.Choices = append(chunk.Choices, ChunkChoice{Index: i, Delta: Delta{Content: fmt.Sprintf("%d:%s", i, part)}})
+			}
+			chunks = append(chunks, chunk)
+		}
+		chunks = append(chunks, ChatCompletionChunk{Choices: []ChunkChoice{
+			{Index: 1, FinishReason: &stop}, {Index: 0, FinishReason: &stop}, {Index: 2, FinishReason: &stop},
+		}})
+
+		var a StreamAssembler
+		for i := range chunks {
+			if err := a.Add(&chunks[i]); err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+		}
+		got := a.Response()
+
+		if len(got.Choices) != 3 {
+			t.Fatalf("expected 3 choices, got %d", len(got.Choices))
+		}
+		for i, choice := range got.Choices {
+			want := fmt.Sprintf("%d:one %d:two %d:three", i, i, i)
+			if choice.Index != i || choice.Message.Content != want || choice.FinishReason != "stop" {
+				t.Errorf("choice %d: expected %q, got %+v", i, want, choice)
+			}
+		}
+	})
+
+	t.Run("rejects choice index out of range", func(t *testing.T) {
+		var a StreamAssembler
+		for _, index := range []int{-1, MaxStreamChoices} {
+			chunk := ChatCompletionChunk{Choices: []ChunkChoice{{Index: index, Delta: Delta{Content: "x"}}}}
+			if err := a.Add(&chunk); !errors.Is(err, ErrChoiceIndex) {
+				t.Errorf("index %d: expected ErrChoiceIndex, got %v", index, err)
+			}
+		}
+		if got := a.Response(); len(got.Choices) != 0 {
+			t.Errorf("expected no choices, got %d", len(got.Choices))
+		}
+	})
+}
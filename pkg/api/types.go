@@ -158,23 +158,82 @@ type APIError struct {
 	Code    *string `json:"code,omitempty"`
 }
 
+// CacheEntrySchemaVersion is the version of the CacheEntry layout stored
+// by this code. Version 1, the original layout, predates entry IDs,
+// request hashes and negative entries; version 2 is the current one.
+const CacheEntrySchemaVersion = 2
+
 // CacheEntry represents a cached response with metadata.
 type CacheEntry struct {
-	Request    ChatCompletionRequest  `json:"request"`
-	Response   ChatCompletionResponse `json:"response"`
-	Embedding  []float64              `json:"embedding"`
-	CreatedAt  time.Time              `json:"created_at"`
-	ExpiresAt  time.Time              `json:"expires_at"`
-	HitCount   int64                  `json:"hit_count"`
-	LastHitAt  time.Time              `json:"last_hit_at"`
+	ID        string                 `json:"id"`
+	Request   ChatCompletionRequest  `json:"request"`
+	Response  ChatCompletionResponse `json:"response"`
+	Embedding []float64              `json:"embedding"`
+	CreatedAt time.Time              `json:"created_at"`
+	ExpiresAt time.Time              `json:"expires_at"`
+	HitCount  int64                  `json:"hit_count"`
+	LastHitAt time.Time              `json:"last_hit_at"`
+
+	// Namespace partitions the cache, e.g. per tenant; entries only match
+	// lookups in the same namespace.
+	Namespace string `json:"namespace,omitempty"`
+
+	// EmbeddingModel is the model that produced Embedding. Embeddings
+	// from different models are not comparable.
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+
+	// Projection describes the projection Embedding was mapped through
+	// to the cache's dimension, as method:dims:seed; empty if none was.
+	Projection string `json:"projection,omitempty"`
+
+	// RequestHash is the RequestHash of Request as given to Set, before
+	// any sanitization; GetExact matches on it.
+	RequestHash string `json:"request_hash,omitempty"`
+
+	// Checksum is the ContentChecksum of the entry as stored, recorded by
+	// caches verifying integrity; empty otherwise.
+	Checksum string `json:"checksum,omitempty"`
+
+	// TTL overrides the cache's TTL for this entry when ExpiresAt is unset.
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// Pinned exempts the entry from eviction; it still expires.
+	Pinned bool `json:"pinned,omitempty"`
+
+	// Negative marks a remembered upstream failure instead of a
+	// completion; StatusCode and Error describe the failure to replay.
+	Negative   bool      `json:"negative,omitempty"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      *APIError `json:"error,omitempty"`
+
+	// SchemaVersion is the CacheEntrySchemaVersion the entry was stored
+	// with; 0 for entries stored before versioning, which are version 1.
+	// Persistent caches upgrade older entries as they load them.
+	SchemaVersion int `json:"schema_version,omitempty"`
+
+	// Stale marks an entry returned by a lookup after it expired, within
+	// the cache's stale-while-revalidate window. It is not stored.
+	Stale bool `json:"-"`
 }
 
 // CacheStats represents cache statistics.
 type CacheStats struct {
 	TotalEntries   int64   `json:"total_entries"`
 	TotalHits      int64   `json:"total_hits"`
+	ExactHits      int64   `json:"exact_hits"`    // hits served by GetExact
+	SemanticHits   int64   `json:"semantic_hits"` // hits served by Get
 	TotalMisses    int64   `json:"total_misses"`
 	HitRate        float64 `json:"hit_rate"`
 	AvgSimilarity  float64 `json:"avg_similarity"`
 	EstimatedSaved float64 `json:"estimated_saved_usd"`
+	Evictions      int64   `json:"evictions"`
+	// TotalBytes approximates the memory taken by cached entries, where
+	// the cache tracks it.
+	TotalBytes int64 `json:"total_bytes,omitempty"`
+	// Merged counts entries removed by compaction as near-duplicates of
+	// another, where the cache compacts.
+	Merged int64 `json:"merged,omitempty"`
+	// DimensionMismatches counts lookups whose embedding length differed
+	// from the stored entries'.
+	DimensionMismatches int64 `json:"dimension_mismatches,omitempty"`
 }